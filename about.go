@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// aboutMaxAge is how long clients and proxies may cache /api/about
+const aboutMaxAge = 5 * time.Minute
+
+// parseContactURL validates the contact link shown in the site footer
+// (ATHOME_CONTACT): an absolute http(s) URL or a mailto: address.
+//
+// Returns:
+//   - The trimmed link, or "" when unset
+//   - error if the link is not an accepted URL
+func parseContactURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid contact link %q: %w", raw, err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		if u.Host == "" {
+			return "", fmt.Errorf("invalid contact link %q: missing host", raw)
+		}
+	case "mailto":
+		if u.Opaque == "" {
+			return "", fmt.Errorf("invalid contact link %q: missing address", raw)
+		}
+	default:
+		return "", fmt.Errorf("invalid contact link %q: expected an http(s) or mailto URL", raw)
+	}
+	return raw, nil
+}
+
+// handleGetAbout returns the deployment metadata a site header or footer
+// shows, so the SPA does not hardcode it. The response is the same for
+// every visitor, so it may be cached; private instances behind basic
+// auth keep it out of shared caches.
+//
+// Returns:
+//   - 200 OK with About
+func (srv *Server) handleGetAbout(c echo.Context) error {
+	visibility := "public"
+	if srv.basicAuthUser != "" {
+		visibility = "private"
+	}
+	c.Response().Header().Set(echo.HeaderCacheControl, fmt.Sprintf("%s, max-age=%d", visibility, int64(aboutMaxAge.Seconds())))
+
+	return c.JSON(http.StatusOK, About{
+		Handle:  srv.primaryHandle(),
+		Tagline: srv.tagline,
+		Contact: srv.contact,
+		Features: RuntimeFeatures{
+			Portfolio: srv.enablePortfolio,
+			Live:      srv.enableLive,
+		},
+	})
+}
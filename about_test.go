@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleGetAbout(t *testing.T) {
+	serve := func(srv *Server) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		c := srv.e.NewContext(httptest.NewRequest(http.MethodGet, "/api/about", nil), rec)
+		require.NoError(t, srv.handleGetAbout(c))
+		require.Equal(t, http.StatusOK, rec.Code)
+		return rec
+	}
+
+	// Unset values are left out
+	rec := serve(&Server{e: echo.New()})
+	assert.JSONEq(t, `{"features": {"portfolio": false, "live": false}}`, rec.Body.String())
+	assert.Equal(t, "public, max-age=300", rec.Header().Get(echo.HeaderCacheControl))
+
+	srv := &Server{
+		e:               echo.New(),
+		validHandles:    []string{"alice.test", "bob.test"},
+		tagline:         "Photos and notes",
+		contact:         "mailto:alice@example.com",
+		enablePortfolio: true,
+	}
+	rec = serve(srv)
+	assert.JSONEq(t, `{
+		"handle": "alice.test",
+		"tagline": "Photos and notes",
+		"contact": "mailto:alice@example.com",
+		"features": {"portfolio": true, "live": false}
+	}`, rec.Body.String())
+
+	// Falls back to the PDS handle, and stays out of shared caches on private instances
+	srv = &Server{
+		e:                 echo.New(),
+		auth:              &AuthConfig{Handle: "owner.test", Password: "app-password"},
+		basicAuthUser:     "owner",
+		basicAuthPassword: "pw",
+	}
+	rec = serve(srv)
+	assert.Contains(t, rec.Body.String(), `"handle":"owner.test"`)
+	assert.NotContains(t, rec.Body.String(), "app-password")
+	assert.Equal(t, "private, max-age=300", rec.Header().Get(echo.HeaderCacheControl))
+}
+
+func TestParseContactURL(t *testing.T) {
+	for _, raw := range []string{"", "https://example.com/contact", " http://example.com ", "mailto:alice@example.com"} {
+		_, err := parseContactURL(raw)
+		assert.NoError(t, err, raw)
+	}
+	for _, raw := range []string{"example.com", "https://", "mailto:", "javascript:alert(1)", "/contact"} {
+		_, err := parseContactURL(raw)
+		assert.Error(t, err, raw)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// adminTokenHeader carries the shared secret for /admin routes
+const adminTokenHeader = "X-Admin-Token"
+
+// requireAdmin is middleware guarding the /admin routes with the shared
+// secret from ATHOME_ADMIN_TOKEN. The routes are hidden entirely when no
+// token is configured.
+func (srv *Server) requireAdmin(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if srv.adminToken == "" {
+			return echo.ErrNotFound
+		}
+		given := c.Request().Header.Get(adminTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(given), []byte(srv.adminToken)) != 1 {
+			return echo.NewHTTPError(http.StatusUnauthorized, "invalid admin token")
+		}
+		return next(c)
+	}
+}
+
+// handleAdminStatus reports the non-secret authentication state for
+// operators debugging token refresh. Tokens and passwords are never included.
+//
+// Returns:
+//   - 200 OK with AdminStatus
+//   - 401 Unauthorized if the admin token is wrong
+//   - 404 Not Found if no admin token is configured
+func (srv *Server) handleAdminStatus(c echo.Context) error {
+	succeeded, failed := srv.RefreshCounts()
+	status := AdminStatus{
+		Mode:             modeAppView,
+		Degraded:         srv.degraded.Load(),
+		RefreshSucceeded: succeeded,
+		RefreshFailed:    failed,
+		LastRefresh:      srv.lastRefresh.Load(),
+	}
+
+	if srv.auth != nil {
+		srv.authMutex.RLock()
+		status.Mode = modePDS
+		status.Handle = srv.auth.Handle
+		status.PDS = srv.auth.PDS
+		status.Credential = srv.auth.CredentialFingerprint
+		status.CredentialKind = tokenCredentialKind(srv.auth.Token)
+		status.HasToken = srv.auth.Token != ""
+		status.HasRefreshToken = srv.auth.RefreshToken != ""
+		if !srv.auth.RefreshAt.IsZero() {
+			refreshAt := srv.auth.RefreshAt
+			status.RefreshAt = &refreshAt
+			status.RefreshIn = time.Until(refreshAt).Round(time.Second).String()
+		}
+		srv.authMutex.RUnlock()
+	}
+
+	return c.JSON(http.StatusOK, status)
+}
+
+// handleAdminRefresh forces a new PDS session immediately, e.g. after
+// the account password was rotated.
+//
+// Returns:
+//   - 200 OK with the new refresh time
+//   - 401 Unauthorized if the admin token is wrong
+//   - 404 Not Found if no admin token or PDS auth is configured
+//   - 502 Bad Gateway if the PDS rejects the credentials
+func (srv *Server) handleAdminRefresh(c echo.Context) error {
+	if srv.auth == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "no PDS authentication configured")
+	}
+
+	refreshAt, err := srv.forceRefresh(c.Request().Context())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadGateway, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"refreshAt": refreshAt,
+		"refreshIn": time.Until(refreshAt).Round(time.Second).String(),
+	})
+}
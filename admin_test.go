@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveAdmin invokes an admin handler through the requireAdmin guard
+func serveAdmin(srv *Server, method string, h echo.HandlerFunc, token string) (*httptest.ResponseRecorder, error) {
+	req := httptest.NewRequest(method, "/admin", nil)
+	if token != "" {
+		req.Header.Set(adminTokenHeader, token)
+	}
+	rec := httptest.NewRecorder()
+	return rec, srv.requireAdmin(h)(srv.e.NewContext(req, rec))
+}
+
+func TestAdminStatus_Authorization(t *testing.T) {
+	srv := newStubServer(newStubTransport())
+
+	// Hidden when no admin token is configured
+	_, err := serveAdmin(srv, http.MethodGet, srv.handleAdminStatus, "anything")
+	assert.Equal(t, http.StatusNotFound, httpStatus(t, err))
+
+	srv.adminToken = "s3cret"
+
+	_, err = serveAdmin(srv, http.MethodGet, srv.handleAdminStatus, "")
+	assert.Equal(t, http.StatusUnauthorized, httpStatus(t, err))
+
+	_, err = serveAdmin(srv, http.MethodGet, srv.handleAdminStatus, "wrong")
+	assert.Equal(t, http.StatusUnauthorized, httpStatus(t, err))
+
+	rec, err := serveAdmin(srv, http.MethodGet, srv.handleAdminStatus, "s3cret")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var status AdminStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	assert.Equal(t, modeAppView, status.Mode)
+	assert.False(t, status.HasToken)
+}
+
+func TestAdminStatus_NeverExposesSecrets(t *testing.T) {
+	srv := newStubServer(newStubTransport())
+	srv.adminToken = "s3cret"
+	srv.auth = &AuthConfig{
+		PDS:          "https://pds.test",
+		Handle:       "alice.test",
+		Password:     "hunter2-password",
+		Token:        "access-token-value",
+		RefreshToken: "refresh-token-value",
+		RefreshAt:    time.Now().Add(time.Hour),
+	}
+	srv.recordRefreshSuccess()
+
+	rec, err := serveAdmin(srv, http.MethodGet, srv.handleAdminStatus, "s3cret")
+	require.NoError(t, err)
+
+	body := rec.Body.String()
+	assert.NotContains(t, body, "access-token-value")
+	assert.NotContains(t, body, "refresh-token-value")
+	assert.NotContains(t, body, "hunter2-password")
+	assert.NotContains(t, body, "s3cret")
+
+	var status AdminStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	assert.Equal(t, modePDS, status.Mode)
+	assert.Equal(t, "alice.test", status.Handle)
+	assert.True(t, status.HasToken)
+	assert.True(t, status.HasRefreshToken)
+	require.NotNil(t, status.RefreshAt)
+	assert.NotEmpty(t, status.RefreshIn)
+	require.NotNil(t, status.LastRefresh)
+	assert.True(t, status.LastRefresh.Success)
+	assert.Equal(t, int64(1), status.RefreshSucceeded)
+}
+
+func TestAdminRefresh(t *testing.T) {
+	mock := &mockXRPCClient{}
+	srv := &Server{
+		e: echo.New(),
+		xrpcc: &xrpc.Client{
+			Host:   "https://mock.bsky.test",
+			Auth:   &xrpc.AuthInfo{},
+			Client: &http.Client{Transport: mock},
+		},
+		adminToken: "s3cret",
+	}
+
+	// Nothing to refresh in AppView mode
+	_, err := serveAdmin(srv, http.MethodPost, srv.handleAdminRefresh, "s3cret")
+	assert.Equal(t, http.StatusNotFound, httpStatus(t, err))
+
+	// A still-valid token is replaced anyway
+	before := time.Now().Add(time.Hour)
+	srv.auth = &AuthConfig{
+		Handle:    "test.handle",
+		Password:  "rotated-pass",
+		Token:     "old-token",
+		RefreshAt: before,
+	}
+
+	_, err = serveAdmin(srv, http.MethodPost, srv.handleAdminRefresh, "wrong")
+	assert.Equal(t, http.StatusUnauthorized, httpStatus(t, err))
+	assert.Zero(t, mock.getCreateSessionCalls())
+
+	rec, err := serveAdmin(srv, http.MethodPost, srv.handleAdminRefresh, "s3cret")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 1, mock.getCreateSessionCalls())
+	assert.True(t, srv.auth.RefreshAt.After(before), "RefreshAt should advance")
+	assert.Equal(t, "mock-token-1", srv.auth.Token)
+	assert.Equal(t, "mock-token-1", srv.xrpcc.Auth.AccessJwt)
+
+	var body struct {
+		RefreshAt time.Time `json:"refreshAt"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.True(t, body.RefreshAt.Equal(srv.auth.RefreshAt))
+
+	// Failures surface as 502 and are recorded
+	mock.setShouldFail(true)
+	mock.setFailureCount(1)
+	_, err = serveAdmin(srv, http.MethodPost, srv.handleAdminRefresh, "s3cret")
+	assert.Equal(t, http.StatusBadGateway, httpStatus(t, err))
+	require.NotNil(t, srv.lastRefresh.Load())
+	assert.False(t, srv.lastRefresh.Load().Success)
+}
+
+func TestAdminRefresh_ConcurrentWithRefreshAuth(t *testing.T) {
+	mock := &mockXRPCClient{}
+	mock.setSimulatedDelay(10 * time.Millisecond)
+	srv := &Server{
+		e: echo.New(),
+		xrpcc: &xrpc.Client{
+			Host:   "https://mock.bsky.test",
+			Auth:   &xrpc.AuthInfo{},
+			Client: &http.Client{Transport: mock},
+		},
+		auth: &AuthConfig{Handle: "test.handle", Password: "test-pass"},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := srv.forceRefresh(context.Background())
+			assert.NoError(t, err)
+		}()
+		go func() {
+			defer wg.Done()
+			c := srv.e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+			assert.NoError(t, srv.refreshAuth(c))
+		}()
+	}
+	wg.Wait()
+
+	// Every forced refresh mints a session; regular refreshes reuse a valid one
+	assert.GreaterOrEqual(t, mock.getCreateSessionCalls(), 5)
+	assert.LessOrEqual(t, mock.getCreateSessionCalls(), 6)
+}
+
+func TestCredentialFingerprint(t *testing.T) {
+	const key = "deployment-secret"
+	fp := credentialFingerprint(key, "alice.test", "abcd-efgh-ijkl-mnop")
+	assert.Regexp(t, `^[0-9a-f]{12}$`, fp)
+	assert.Equal(t, fp, credentialFingerprint(key, "alice.test", "abcd-efgh-ijkl-mnop"), "stable for the same credentials")
+	assert.NotEqual(t, fp, credentialFingerprint(key, "alice.test", "abcd-efgh-ijkl-mnoq"))
+	assert.NotEqual(t, fp, credentialFingerprint(key, "bob.test", "abcd-efgh-ijkl-mnop"))
+
+	// Keyed: another deployment, or no key at all, gives another fingerprint
+	assert.NotEqual(t, fp, credentialFingerprint("other-secret", "alice.test", "abcd-efgh-ijkl-mnop"))
+	unkeyed := credentialFingerprint("", "alice.test", "abcd-efgh-ijkl-mnop")
+	assert.NotEqual(t, fp, unkeyed)
+	assert.Equal(t, unkeyed, credentialFingerprint("", "alice.test", "abcd-efgh-ijkl-mnop"), "stable within a run")
+}
+
+func TestAdminStatus_Credential(t *testing.T) {
+	const password = "abcd-efgh-ijkl-mnop"
+	token := testJWT(`{"alg": "ES256K"}`, fmt.Sprintf(`{"scope": "com.atproto.appPass", "exp": %d}`, time.Now().Add(2*time.Hour).Unix()))
+	stub := newStubTransport().on("com.atproto.server.createSession", http.StatusOK,
+		`{"accessJwt": "`+token+`", "refreshJwt": "refresh", "handle": "alice.test", "did": "did:plc:abc123"}`)
+	srv := newStubServer(stub)
+	srv.adminToken = "s3cret"
+	srv.auth = &AuthConfig{
+		PDS:                   "https://pds.test",
+		Handle:                "alice.test",
+		Password:              password,
+		CredentialFingerprint: credentialFingerprint("", "alice.test", password),
+	}
+
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer slog.SetDefault(prev)
+
+	_, err := srv.forceRefresh(context.Background())
+	require.NoError(t, err)
+	rec, err := serveAdmin(srv, http.MethodGet, srv.handleAdminStatus, "s3cret")
+	require.NoError(t, err)
+
+	var status AdminStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	assert.Equal(t, srv.auth.CredentialFingerprint, status.Credential)
+	assert.Equal(t, credentialAppPassword, status.CredentialKind)
+
+	// The fingerprint identifies the credential in the logs; the password never appears
+	assert.Contains(t, logs.String(), "credential="+srv.auth.CredentialFingerprint)
+	assert.NotContains(t, logs.String(), password)
+	assert.NotContains(t, rec.Body.String(), password)
+}
+
+func TestTokenCredentialKind(t *testing.T) {
+	for scope, want := range map[string]string{
+		"com.atproto.appPass":           credentialAppPassword,
+		"com.atproto.appPassPrivileged": credentialPrivilegedAppPassword,
+		"com.atproto.access":            credentialAccountPassword,
+		"com.example.other":             "",
+	} {
+		assert.Equal(t, want, tokenCredentialKind(testJWT(`{"alg": "HS256"}`, `{"scope": "`+scope+`"}`)), scope)
+	}
+	assert.Empty(t, tokenCredentialKind("mock-token-1"))
+	assert.Empty(t, tokenCredentialKind(""))
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// allowedHandles returns the current handle allowlist. The returned slice
+// is replaced, never modified, on reload so callers may keep using it.
+func (srv *Server) allowedHandles() []string {
+	srv.handlesMu.RLock()
+	defer srv.handlesMu.RUnlock()
+	return srv.validHandles
+}
+
+// setAllowedHandles replaces the handle allowlist
+func (srv *Server) setAllowedHandles(handles []string) {
+	srv.handlesMu.Lock()
+	defer srv.handlesMu.Unlock()
+	srv.validHandles = handles
+}
+
+// normalizeHandles normalizes a configured handle list (see
+// normalizeHandle), dropping the empty entries left by stray commas
+func normalizeHandles(handles []string) []string {
+	var normalized []string
+	for _, h := range handles {
+		if h = normalizeHandle(h); h != "" {
+			normalized = append(normalized, h)
+		}
+	}
+	return normalized
+}
+
+// loadHandlesFile reads a handle allowlist file. Handles are separated by
+// newlines or commas; blank lines and lines starting with # are ignored.
+// A file listing no handles is an error rather than an empty list, which
+// would allow everyone.
+func loadHandlesFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var handles []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, h := range strings.Split(line, ",") {
+			if h = normalizeHandle(h); h != "" {
+				handles = append(handles, h)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(handles) == 0 {
+		return nil, fmt.Errorf("%s lists no handles", path)
+	}
+	return handles, nil
+}
+
+// reloadHandlesFile replaces the allowlist with the contents of path.
+// On error the current allowlist is kept.
+func (srv *Server) reloadHandlesFile(path string) error {
+	handles, err := loadHandlesFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read handles file: %w", err)
+	}
+	srv.setAllowedHandles(handles)
+	slog.Info("reloaded handle allowlist", "path", path, "count", len(handles))
+	return nil
+}
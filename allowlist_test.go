@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadHandlesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "handles.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# vanity domains\nalice.test\n\n Bob.Test , carol.test.\n"), 0o644))
+
+	handles, err := loadHandlesFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice.test", "bob.test", "carol.test"}, handles)
+
+	_, err = loadHandlesFile(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+
+	// An empty list would allow everyone
+	for _, content := range []string{"", "\n\n", "# nobody yet\n", " , ,\n"} {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		_, err = loadHandlesFile(path)
+		assert.Error(t, err, "%q", content)
+	}
+}
+
+func TestNormalizeHandles(t *testing.T) {
+	// As split from ATHOME_VALID_HANDLES=" Alice.bsky.social , bob.test.,"
+	handles := normalizeHandles([]string{" Alice.bsky.social ", " bob.test.", ""})
+	assert.Equal(t, []string{"alice.bsky.social", "bob.test"}, handles)
+	assert.Nil(t, normalizeHandles([]string{" ", ""}))
+
+	srv := newStubServer(newStubTransport())
+	srv.setAllowedHandles(handles)
+	assert.NoError(t, srv.validateHandle("alice.bsky.social"))
+	assert.NoError(t, srv.validateHandle("ALICE.bsky.social"))
+	assert.Error(t, srv.validateHandle("carol.test"))
+
+	assert.True(t, isValidHandle("Alice.bsky.social", []string{" alice.bsky.social "}))
+	assert.False(t, isValidHandle("carol.test", []string{" alice.bsky.social "}))
+}
+
+func TestWatchHandlesFile_ReloadOnSignal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "handles.txt")
+	require.NoError(t, os.WriteFile(path, []byte("alice.test\n"), 0o644))
+
+	handles, err := loadHandlesFile(path)
+	require.NoError(t, err)
+	srv := newStubServer(newStubTransport())
+	srv.setAllowedHandles(handles)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal)
+	srv.handlesFile = path
+	go srv.watchReload(ctx, signals)
+
+	assert.NoError(t, srv.validateHandle("alice.test"))
+	assert.Error(t, srv.validateHandle("bob.test"))
+
+	// Edit the file; nothing changes until the reload signal
+	require.NoError(t, os.WriteFile(path, []byte("bob.test\n"), 0o644))
+	assert.NoError(t, srv.validateHandle("alice.test"))
+
+	signals <- syscall.SIGHUP
+	assert.Eventually(t, func() bool {
+		return srv.validateHandle("bob.test") == nil
+	}, time.Second, 5*time.Millisecond)
+	assert.Error(t, srv.validateHandle("alice.test"))
+
+	// An emptied file keeps the previous list
+	require.NoError(t, os.WriteFile(path, []byte("# all gone\n"), 0o644))
+	signals <- syscall.SIGHUP
+	signals <- syscall.SIGHUP
+	assert.NoError(t, srv.validateHandle("bob.test"))
+	assert.Error(t, srv.validateHandle("carol.test"))
+
+	// So does a missing one
+	require.NoError(t, os.Remove(path))
+	signals <- syscall.SIGHUP
+	signals <- syscall.SIGHUP // Unbuffered: returns once the first reload finished
+	assert.NoError(t, srv.validateHandle("bob.test"))
+}
+
+func TestValidateHandle_AuthHandleBypass(t *testing.T) {
+	srv := newStubServer(newStubTransport())
+	srv.setAllowedHandles([]string{"alice.test"})
+
+	// AppView mode: only the allowlist counts
+	assert.Error(t, srv.validateHandle("owner.test"))
+
+	srv.auth = &AuthConfig{Handle: "owner.test", Password: "test-pass"}
+	assert.NoError(t, srv.validateHandle("owner.test"))
+	assert.NoError(t, srv.validateHandle("alice.test"))
+	assert.Error(t, srv.validateHandle("bob.test"))
+}
@@ -1,12 +1,20 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"math"
+	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bluesky-social/indigo/api/atproto"
@@ -14,36 +22,47 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
+// Sanity bounds on a token's exp claim. A token expired longer ago than
+// maxTokenExpiredFor, or expiring further ahead than maxTokenLifetime, is
+// not a fresh session token and its exp is not trusted.
+const (
+	maxTokenExpiredFor = 5 * time.Minute
+	maxTokenLifetime   = 90 * 24 * time.Hour
+)
+
+// tokenAlgorithms are the JWT signing algorithms PDSes use for session
+// tokens. Unsigned ("none") and unknown algorithms are rejected.
+var tokenAlgorithms = []string{"HS256", "ES256K", "ES256"}
+
 // extractTokenExpiry extracts the expiry time from a JWT token.
 // JWT tokens are structured as three base64-encoded segments separated by dots.
 // The middle segment contains the claims, including the "exp" claim which is the expiry time.
-// Returns a zero time if the expiry time cannot be extracted.
+// The signature cannot be checked without the PDS signing key, so the token
+// is at least checked for structural integrity: a signed header with a
+// known alg, well-formed claims and an exp within sane bounds of now.
+// Returns a zero time if the expiry time cannot be extracted or trusted.
 func extractTokenExpiry(token string) time.Time {
 	// Split the token into its three parts
 	parts := strings.Split(token, ".")
-	if len(parts) != 3 {
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
 		slog.Warn("invalid JWT token format")
 		return time.Time{}
 	}
 
-	// Decode the claims part (the middle part)
-	claimsPart := parts[1]
-
-	// Add padding if needed
-	if len(claimsPart)%4 != 0 {
-		claimsPart += strings.Repeat("=", 4-len(claimsPart)%4)
+	var header struct {
+		Alg string `json:"alg"`
 	}
-
-	// Decode the base64 string
-	claimsBytes, err := base64.URLEncoding.DecodeString(claimsPart)
-	if err != nil {
-		slog.Warn("failed to decode JWT claims", "error", err)
+	if err := decodeTokenSegment(parts[0], &header); err != nil {
+		slog.Warn("failed to parse JWT header", "error", err)
+		return time.Time{}
+	}
+	if !containsString(tokenAlgorithms, header.Alg) {
+		slog.Warn("JWT token has unexpected alg", "alg", header.Alg)
 		return time.Time{}
 	}
 
-	// Parse the JSON
 	var claims map[string]interface{}
-	if err := json.Unmarshal(claimsBytes, &claims); err != nil {
+	if err := decodeTokenSegment(parts[1], &claims); err != nil {
 		slog.Warn("failed to parse JWT claims", "error", err)
 		return time.Time{}
 	}
@@ -54,37 +73,236 @@ func extractTokenExpiry(token string) time.Time {
 		slog.Warn("JWT token does not contain exp claim")
 		return time.Time{}
 	}
-
-	// Convert the exp claim to a time.Time
-	var expTime time.Time
-	switch exp := expClaim.(type) {
-	case float64:
-		// exp is in seconds since epoch
-		expTime = time.Unix(int64(exp), 0)
-	case int64:
-		expTime = time.Unix(exp, 0)
-	case json.Number:
-		expInt, err := exp.Int64()
-		if err != nil {
-			slog.Warn("failed to convert exp claim to int64", "error", err)
-			return time.Time{}
-		}
-		expTime = time.Unix(expInt, 0)
-	default:
+	exp, ok := expClaim.(json.Number)
+	if !ok {
 		slog.Warn("exp claim has unexpected type", "type", fmt.Sprintf("%T", expClaim))
 		return time.Time{}
 	}
+	expTime, err := parseNumericDate(exp)
+	if err != nil {
+		slog.Warn("failed to convert exp claim to a time", "error", err)
+		return time.Time{}
+	}
 
+	now := time.Now()
+	if expTime.Before(now.Add(-maxTokenExpiredFor)) || expTime.After(now.Add(maxTokenLifetime)) {
+		slog.Warn("JWT exp claim is out of bounds", "exp", expTime)
+		return time.Time{}
+	}
 	return expTime
 }
 
-// ensureValidToken ensures that the token is valid before making API requests.
+// decodeTokenSegment decodes a base64url JWT segment holding a JSON
+// object into v. Numbers are kept as json.Number, since decoding them as
+// float64 would round large values.
+func decodeTokenSegment(segment string, v interface{}) error {
+	// Padding is optional in JWTs
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return fmt.Errorf("trailing data after JSON object")
+	}
+	return nil
+}
+
+// parseNumericDate converts a JWT NumericDate, seconds since the epoch
+// that may be fractional, into a time without rounding integral values.
+func parseNumericDate(n json.Number) (time.Time, error) {
+	if seconds, err := n.Int64(); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	seconds, err := n.Float64()
+	if err != nil || seconds < math.MinInt64 || seconds >= math.MaxInt64 {
+		return time.Time{}, fmt.Errorf("invalid NumericDate %s", n)
+	}
+	whole, frac := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(frac*float64(time.Second))), nil
+}
+
+// credentialFingerprint returns a short fingerprint of the PDS
+// credentials, so operators can tell which password is in use from the
+// admin status and logs without the password ever being shown. It is an
+// HMAC keyed with ATHOME_CREDENTIAL_FINGERPRINT_KEY, so a leaked
+// fingerprint cannot be used to test password guesses offline. Without a
+// key a random one is used, and fingerprints only compare within a run.
+func credentialFingerprint(key, handle, password string) string {
+	k := []byte(key)
+	if key == "" {
+		k = processFingerprintKey()
+	}
+	mac := hmac.New(sha256.New, k)
+	mac.Write([]byte(handle + ":" + password))
+	return hex.EncodeToString(mac.Sum(nil)[:6])
+}
+
+// processFingerprintKey is the random credential fingerprint key used
+// when none is configured
+var processFingerprintKey = sync.OnceValue(func() []byte {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+})
+
+// Kinds of credential a session was created with, from the access
+// token's scope claim
+const (
+	credentialAppPassword           = "app-password"
+	credentialPrivilegedAppPassword = "privileged-app-password"
+	credentialAccountPassword       = "account-password"
+)
+
+// tokenCredentialKind reports which kind of credential created the
+// session an access token belongs to, or "" if the scope is unknown. App
+// password labels are not available to app-password sessions, so this is
+// as close to the label as the server can get.
+func tokenCredentialKind(token string) string {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+	var claims struct {
+		Scope string `json:"scope"`
+	}
+	if err := decodeTokenSegment(parts[1], &claims); err != nil {
+		return ""
+	}
+	switch claims.Scope {
+	case "com.atproto.appPass":
+		return credentialAppPassword
+	case "com.atproto.appPassPrivileged":
+		return credentialPrivilegedAppPassword
+	case "com.atproto.access":
+		return credentialAccountPassword
+	}
+	return ""
+}
+
+// Refresh timing relative to the access token's expiry
+const (
+	refreshBeforeExpiry = 30 * time.Minute // Margin before exp at which the token is refreshed
+	defaultRefreshAfter = 23 * time.Hour   // Used when exp is unknown: 1 hour before an assumed 24-hour expiry
+)
+
+// scheduleRefresh sets when the session is next refreshed from the
+// access token's expiry, falling back to a conservative default when the
+// expiry cannot be trusted. The caller must hold authMutex.
+//
+// Returns:
+//   - The token's expiry, or a zero time if unknown
+func (srv *Server) scheduleRefresh(accessToken string) time.Time {
+	expiry := extractTokenExpiry(accessToken)
+	srv.auth.TokenExpiry = expiry
+	if expiry.IsZero() {
+		srv.auth.RefreshAt = time.Now().Add(defaultRefreshAfter)
+		slog.Warn("could not extract token expiry time, using default refresh time")
+	} else {
+		srv.auth.RefreshAt = expiry.Add(-refreshBeforeExpiry)
+		slog.Info("extracted token expiry time", "expiry", expiry)
+	}
+	return expiry
+}
+
+// defaultFallbackAfter is how many consecutive refresh failures switch
+// reads to the fallback AppView (ATHOME_FALLBACK_AFTER)
+const defaultFallbackAfter = 3
+
+// readClient returns the XRPC client used for hydrated read-only queries
+// (profiles, feeds, threads). When a separate AppView client is configured
+// reads go there; otherwise they share the primary client. While PDS
+// authentication is failing, reads are served by the fallback AppView.
+func (srv *Server) readClient() *xrpc.Client {
+	if srv.degraded.Load() && srv.fallbackc != nil {
+		return srv.fallbackc
+	}
+	if srv.readc != nil {
+		return srv.readc
+	}
+	return srv.xrpcc
+}
+
+// ensureValidToken ensures that the token is valid before making read API requests.
 // It forces a token refresh if the token is expired or about to expire.
+// In AppView mode there is no auth configuration and nothing to refresh.
+// In degraded mode reads go to the fallback AppView, so refresh failures
+// are not reported; the background refresh keeps trying to recover.
 func (srv *Server) ensureValidToken(c echo.Context) error {
+	if srv.auth == nil {
+		return nil
+	}
+	if srv.degraded.Load() {
+		slog.Debug("PDS authentication degraded, skipping token refresh")
+		return nil
+	}
+
 	// Always force a token refresh before making API requests
 	// This is a more aggressive approach to ensure we always have a valid token
-	slog.Info("forcing token refresh before API request")
-	return srv.refreshAuth(c)
+	slog.Debug("forcing token refresh before API request")
+	if err := srv.refreshAuth(c); err != nil && !srv.degraded.Load() {
+		return err
+	}
+	return nil
+}
+
+// ensureAuthToken ensures that a valid token is available for calls that
+// must be made as the authenticated account. Unlike ensureValidToken there
+// is no fallback for these, so degraded mode yields 503 Service Unavailable.
+func (srv *Server) ensureAuthToken(c echo.Context) error {
+	if !srv.degraded.Load() {
+		err := srv.refreshAuth(c)
+		if err == nil {
+			return nil
+		}
+		if !srv.degraded.Load() {
+			return err
+		}
+	}
+	return echo.NewHTTPError(http.StatusServiceUnavailable, "PDS authentication is unavailable")
+}
+
+// recordRefreshSuccess counts a successful token refresh and leaves
+// degraded mode if the server was in it.
+func (srv *Server) recordRefreshSuccess() {
+	srv.refreshSuccesses.Add(1)
+	if srv.metrics != nil {
+		srv.metrics.observeRefresh(time.Now())
+	}
+	srv.consecutiveFailures.Store(0)
+	srv.lastRefresh.Store(&RefreshOutcome{At: time.Now(), Success: true})
+	if srv.degraded.CompareAndSwap(true, false) {
+		slog.Info("PDS authentication recovered, serving reads from the primary client again")
+	}
+}
+
+// recordRefreshFailure counts a failed token refresh. After fallbackAfter
+// consecutive failures the server enters degraded mode, serving reads
+// from the fallback AppView so a bad password doesn't take the site down.
+func (srv *Server) recordRefreshFailure(err error) {
+	srv.refreshFailures.Add(1)
+	failures := srv.consecutiveFailures.Add(1)
+	srv.lastRefresh.Store(&RefreshOutcome{At: time.Now(), Error: err.Error()})
+	if srv.fallbackc == nil || srv.fallbackAfter <= 0 || failures < int64(srv.fallbackAfter) {
+		return
+	}
+	if srv.degraded.CompareAndSwap(false, true) {
+		slog.Error("!!! PDS AUTHENTICATION IS FAILING: serving reads from the fallback AppView until credentials work again !!!",
+			"consecutive_failures", failures,
+			"fallback", srv.fallbackc.Host,
+			"error", err)
+	}
+}
+
+// RefreshCounts reports how many token refreshes have succeeded and failed
+// since the server started, covering both request-driven and background refreshes.
+// Checks that find the token still valid are not counted.
+func (srv *Server) RefreshCounts() (succeeded, failed int64) {
+	return srv.refreshSuccesses.Load(), srv.refreshFailures.Load()
 }
 
 // refreshAuth handles PDS authentication token refresh.
@@ -105,19 +323,19 @@ func (srv *Server) refreshAuth(c echo.Context) error {
 	}
 
 	// Log that we're checking token expiry
-	slog.Info("checking if token needs refresh")
+	slog.Debug("checking if token needs refresh")
 
 	// First acquire a read lock to check if refresh is needed
 	srv.authMutex.RLock()
 	tokenExpired := srv.auth.RefreshAt.IsZero() || time.Now().After(srv.auth.RefreshAt.Add(-30*time.Minute))
-	slog.Info("token expiry check result",
+	slog.Debug("token expiry check result",
 		"token_expired", tokenExpired,
 		"refresh_at", srv.auth.RefreshAt,
 		"now", time.Now(),
 		"time_until_refresh", srv.auth.RefreshAt.Sub(time.Now()))
 
 	if !tokenExpired {
-		slog.Info("token is still valid, no refresh needed")
+		slog.Debug("token is still valid, no refresh needed")
 		srv.authMutex.RUnlock()
 		return nil
 	}
@@ -147,25 +365,19 @@ func (srv *Server) refreshAuth(c echo.Context) error {
 			Password:   srv.auth.Password,
 		})
 		if err != nil {
+			srv.recordRefreshFailure(err)
 			return fmt.Errorf("failed to create session: %w", err)
 		}
 		srv.auth.Token = session.AccessJwt
 		srv.auth.RefreshToken = session.RefreshJwt
 
-		// Extract expiry time from the token if possible
-		expiry := extractTokenExpiry(session.AccessJwt)
-		if expiry.IsZero() {
-			// If we can't extract the expiry time, use a conservative default
-			srv.auth.RefreshAt = time.Now().Add(time.Hour * 23) // Refresh 1 hour before assumed 24-hour expiry
-			slog.Warn("could not extract token expiry time, using default refresh time")
-		} else {
-			// Set refresh time to 30 minutes before expiry
-			srv.auth.RefreshAt = expiry.Add(-30 * time.Minute)
-			slog.Info("extracted token expiry time", "expiry", expiry)
-		}
+		// Schedule the next refresh from the token's expiry
+		expiry := srv.scheduleRefresh(session.AccessJwt)
 
 		srv.xrpcc.Auth = &xrpc.AuthInfo{AccessJwt: session.AccessJwt}
+		srv.recordRefreshSuccess()
 		slog.Info("initial session created successfully",
+			"credential", srv.auth.CredentialFingerprint,
 			"refresh_at", srv.auth.RefreshAt,
 			"refresh_in", srv.auth.RefreshAt.Sub(time.Now()),
 			"token_expiry", expiry)
@@ -192,21 +404,11 @@ func (srv *Server) refreshAuth(c echo.Context) error {
 			srv.auth.Token = refreshedSession.AccessJwt
 			srv.auth.RefreshToken = refreshedSession.RefreshJwt
 
-			// Extract expiry time from the token if possible
-			// The token is a JWT which contains an "exp" claim
-			// We'll set the refresh time to 30 minutes before the token expires
-			expiry := extractTokenExpiry(refreshedSession.AccessJwt)
-			if expiry.IsZero() {
-				// If we can't extract the expiry time, use a conservative default
-				srv.auth.RefreshAt = time.Now().Add(time.Hour * 23) // Refresh 1 hour before assumed 24-hour expiry
-				slog.Warn("could not extract token expiry time, using default refresh time")
-			} else {
-				// Set refresh time to 30 minutes before expiry
-				srv.auth.RefreshAt = expiry.Add(-30 * time.Minute)
-				slog.Info("extracted token expiry time", "expiry", expiry)
-			}
+			// Schedule the next refresh from the token's expiry
+			expiry := srv.scheduleRefresh(refreshedSession.AccessJwt)
 
 			srv.xrpcc.Auth = &xrpc.AuthInfo{AccessJwt: refreshedSession.AccessJwt}
+			srv.recordRefreshSuccess()
 			slog.Info("session refreshed successfully using refresh token",
 				"refresh_at", srv.auth.RefreshAt,
 				"refresh_in", srv.auth.RefreshAt.Sub(time.Now()),
@@ -219,31 +421,24 @@ func (srv *Server) refreshAuth(c echo.Context) error {
 	}
 
 	// Fall back to creating a new session if refresh token is missing or invalid
-	slog.Info("creating new session")
+	slog.Info("creating new session", "credential", srv.auth.CredentialFingerprint)
 	session, err := atproto.ServerCreateSession(c.Request().Context(), srv.xrpcc, &atproto.ServerCreateSession_Input{
 		Identifier: srv.auth.Handle,
 		Password:   srv.auth.Password,
 	})
 	if err != nil {
+		srv.recordRefreshFailure(err)
 		return fmt.Errorf("failed to create new session: %w", err)
 	}
 
 	srv.auth.Token = session.AccessJwt
 	srv.auth.RefreshToken = session.RefreshJwt
 
-	// Extract expiry time from the token if possible
-	expiry := extractTokenExpiry(session.AccessJwt)
-	if expiry.IsZero() {
-		// If we can't extract the expiry time, use a conservative default
-		srv.auth.RefreshAt = time.Now().Add(time.Hour * 23) // Refresh 1 hour before assumed 24-hour expiry
-		slog.Warn("could not extract token expiry time, using default refresh time")
-	} else {
-		// Set refresh time to 30 minutes before expiry
-		srv.auth.RefreshAt = expiry.Add(-30 * time.Minute)
-		slog.Info("extracted token expiry time", "expiry", expiry)
-	}
+	// Schedule the next refresh from the token's expiry
+	expiry := srv.scheduleRefresh(session.AccessJwt)
 
 	srv.xrpcc.Auth = &xrpc.AuthInfo{AccessJwt: session.AccessJwt}
+	srv.recordRefreshSuccess()
 	slog.Info("new session created successfully",
 		"refresh_at", srv.auth.RefreshAt,
 		"refresh_in", srv.auth.RefreshAt.Sub(time.Now()),
@@ -251,6 +446,47 @@ func (srv *Server) refreshAuth(c echo.Context) error {
 	return nil
 }
 
+// forceRefresh creates a brand new session with the configured credentials,
+// regardless of whether the current token is still valid. Operators use it
+// after rotating the PDS password. It holds authMutex for the whole exchange
+// so it cannot interleave with a regular refresh.
+//
+// Returns:
+//   - The new refresh time
+//   - error if no auth config is present or session creation fails
+func (srv *Server) forceRefresh(ctx context.Context) (time.Time, error) {
+	if srv.auth == nil {
+		return time.Time{}, fmt.Errorf("no auth configuration")
+	}
+
+	srv.authMutex.Lock()
+	defer srv.authMutex.Unlock()
+
+	slog.Info("forcing new session", "handle", srv.auth.Handle, "credential", srv.auth.CredentialFingerprint)
+	session, err := atproto.ServerCreateSession(ctx, srv.xrpcc, &atproto.ServerCreateSession_Input{
+		Identifier: srv.auth.Handle,
+		Password:   srv.auth.Password,
+	})
+	if err != nil {
+		srv.recordRefreshFailure(err)
+		return time.Time{}, fmt.Errorf("failed to create new session: %w", err)
+	}
+
+	srv.auth.Token = session.AccessJwt
+	srv.auth.RefreshToken = session.RefreshJwt
+
+	// Schedule the next refresh from the token's expiry
+	expiry := srv.scheduleRefresh(session.AccessJwt)
+
+	srv.xrpcc.Auth = &xrpc.AuthInfo{AccessJwt: session.AccessJwt}
+	srv.recordRefreshSuccess()
+	slog.Info("forced session created successfully",
+		"refresh_at", srv.auth.RefreshAt,
+		"refresh_in", srv.auth.RefreshAt.Sub(time.Now()),
+		"token_expiry", expiry)
+	return srv.auth.RefreshAt, nil
+}
+
 // startBackgroundTokenRefresh starts a background goroutine that periodically checks
 // if the token needs to be refreshed and refreshes it if necessary.
 // This ensures that the token is always valid, even if there are no API requests.
@@ -266,12 +502,12 @@ func (srv *Server) startBackgroundTokenRefresh(ctx context.Context) {
 			return
 		case <-ticker.C:
 			// Log that we're checking token expiry
-			slog.Info("background refresh: checking if token needs refresh")
+			slog.Debug("background refresh: checking if token needs refresh")
 
 			// Check if we need to refresh
 			srv.authMutex.RLock()
 			tokenExpired := srv.auth.RefreshAt.IsZero() || time.Now().After(srv.auth.RefreshAt.Add(-30*time.Minute))
-			slog.Info("background refresh: token expiry check result",
+			slog.Debug("background refresh: token expiry check result",
 				"token_expired", tokenExpired,
 				"refresh_at", srv.auth.RefreshAt,
 				"now", time.Now(),
@@ -279,7 +515,7 @@ func (srv *Server) startBackgroundTokenRefresh(ctx context.Context) {
 			srv.authMutex.RUnlock()
 
 			if !tokenExpired {
-				slog.Info("background refresh: token is still valid, no refresh needed")
+				slog.Debug("background refresh: token is still valid, no refresh needed")
 			} else {
 				// Try to refresh using the refresh token first
 				srv.authMutex.RLock()
@@ -317,13 +553,14 @@ func (srv *Server) startBackgroundTokenRefresh(ctx context.Context) {
 
 				// If refresh token didn't work or isn't available, create a new session
 				if !refreshSuccess {
-					slog.Info("background refresh: creating new session")
+					slog.Info("background refresh: creating new session", "credential", srv.auth.CredentialFingerprint)
 					session, err := atproto.ServerCreateSession(ctx, srv.xrpcc, &atproto.ServerCreateSession_Input{
 						Identifier: srv.auth.Handle,
 						Password:   srv.auth.Password,
 					})
 					if err != nil {
 						slog.Error("background refresh: failed to create new session", "error", err)
+						srv.recordRefreshFailure(err)
 						continue
 					}
 
@@ -337,20 +574,12 @@ func (srv *Server) startBackgroundTokenRefresh(ctx context.Context) {
 				srv.auth.Token = newAccessToken
 				srv.auth.RefreshToken = newRefreshToken
 
-				// Extract expiry time from the token if possible
-				expiry := extractTokenExpiry(newAccessToken)
-				if expiry.IsZero() {
-					// If we can't extract the expiry time, use a conservative default
-					srv.auth.RefreshAt = time.Now().Add(time.Hour * 23) // Refresh 1 hour before assumed 24-hour expiry
-					slog.Warn("background refresh: could not extract token expiry time, using default refresh time")
-				} else {
-					// Set refresh time to 30 minutes before expiry
-					srv.auth.RefreshAt = expiry.Add(-30 * time.Minute)
-					slog.Info("background refresh: extracted token expiry time", "expiry", expiry)
-				}
+				// Schedule the next refresh from the token's expiry
+				expiry := srv.scheduleRefresh(newAccessToken)
 
 				srv.xrpcc.Auth = &xrpc.AuthInfo{AccessJwt: newAccessToken}
 				srv.authMutex.Unlock()
+				srv.recordRefreshSuccess()
 
 				slog.Info("background token refresh completed successfully",
 					"refresh_at", srv.auth.RefreshAt,
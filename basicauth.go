@@ -0,0 +1,28 @@
+package main
+
+import (
+	"crypto/subtle"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// basicAuthRealm is announced to browsers when asking for credentials
+const basicAuthRealm = "AtHome"
+
+// basicAuth protects the whole site with HTTP Basic Auth for private
+// instances, when ATHOME_BASIC_AUTH_USER is set. /healthz stays open so
+// monitoring keeps working. Credentials are compared in constant time.
+func (srv *Server) basicAuth() echo.MiddlewareFunc {
+	return middleware.BasicAuthWithConfig(middleware.BasicAuthConfig{
+		Skipper: func(c echo.Context) bool {
+			return srv.basicAuthUser == "" || c.Request().URL.Path == "/healthz"
+		},
+		Validator: func(user, password string, c echo.Context) (bool, error) {
+			userOK := subtle.ConstantTimeCompare([]byte(user), []byte(srv.basicAuthUser)) == 1
+			passwordOK := subtle.ConstantTimeCompare([]byte(password), []byte(srv.basicAuthPassword)) == 1
+			return userOK && passwordOK, nil
+		},
+		Realm: basicAuthRealm,
+	})
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBasicAuth(t *testing.T) {
+	srv, err := setupServer(":0", nil, nil, nil, nil, t.TempDir(), nil)
+	require.NoError(t, err)
+
+	get := func(path, user, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Host = "alice.test"
+		if user != "" {
+			req.SetBasicAuth(user, password)
+		}
+		rec := httptest.NewRecorder()
+		srv.e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Disabled by default
+	assert.Equal(t, http.StatusOK, get("/", "", "").Code)
+
+	srv.basicAuthUser = "owner"
+	srv.basicAuthPassword = "s3cret"
+
+	rec := get("/", "", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Header().Get("WWW-Authenticate"), `realm="AtHome"`)
+	assert.Equal(t, http.StatusUnauthorized, get("/", "owner", "wrong").Code)
+	assert.Equal(t, http.StatusUnauthorized, get("/", "intruder", "s3cret").Code)
+	assert.Equal(t, http.StatusUnauthorized, get("/api/version", "", "").Code)
+
+	assert.Equal(t, http.StatusOK, get("/", "owner", "s3cret").Code)
+	assert.Equal(t, http.StatusOK, get("/api/version", "owner", "s3cret").Code)
+
+	// Monitoring keeps working without credentials
+	assert.Equal(t, http.StatusOK, get("/healthz", "", "").Code)
+}
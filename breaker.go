@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Circuit breaker defaults (ATHOME_BREAKER_THRESHOLD, ATHOME_BREAKER_COOLDOWN)
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// Circuit breaker states
+const (
+	breakerClosed   = "closed"    // Requests flow; failures are counted
+	breakerOpen     = "open"      // Requests are refused until the cooldown ends
+	breakerHalfOpen = "half-open" // One probe request decides whether to close again
+)
+
+// circuitOpenError is returned instead of calling an upstream whose
+// circuit is open
+type circuitOpenError struct {
+	host       string
+	retryAfter time.Duration // Until the next probe may be attempted
+}
+
+func (e *circuitOpenError) Error() string {
+	return fmt.Sprintf("upstream %s is unavailable (circuit open)", e.host)
+}
+
+// breakerHost is the breaker state of one upstream host
+type breakerHost struct {
+	state    string
+	failures int       // Consecutive failures while closed
+	openedAt time.Time // When the circuit last opened
+	probing  bool      // Whether the half-open probe is in flight
+}
+
+// circuitBreaker stops calling an upstream host after threshold
+// consecutive failures, refusing requests for cooldown instead of
+// hammering a flapping upstream and tying up goroutines. Once the
+// cooldown ends a single probe is let through: success closes the
+// circuit, failure opens it for another cooldown. It is safe for
+// concurrent use.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time // Overridable clock for tests
+
+	mu    sync.Mutex
+	hosts map[string]*breakerHost
+}
+
+// newCircuitBreaker creates a breaker tripping after threshold
+// consecutive failures, or nil when threshold is 0 to disable it
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		hosts:     make(map[string]*breakerHost),
+	}
+}
+
+// host returns the state of a host, creating it closed. The caller must hold mu.
+func (b *circuitBreaker) host(name string) *breakerHost {
+	h, ok := b.hosts[name]
+	if !ok {
+		h = &breakerHost{state: breakerClosed}
+		b.hosts[name] = h
+	}
+	return h
+}
+
+// allow reports whether a request to host may proceed. When it may not,
+// the returned duration is how long until the next probe.
+func (b *circuitBreaker) allow(host string) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	h := b.host(host)
+	switch h.state {
+	case breakerOpen:
+		if wait := h.openedAt.Add(b.cooldown).Sub(b.now()); wait > 0 {
+			return false, wait
+		}
+		h.state = breakerHalfOpen
+		slog.Info("upstream circuit half-open, probing", "host", host)
+		fallthrough
+	case breakerHalfOpen:
+		if h.probing {
+			return false, b.cooldown
+		}
+		h.probing = true
+	}
+	return true, 0
+}
+
+// record reports the outcome of a request allowed by allow
+func (b *circuitBreaker) record(host string, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	h := b.host(host)
+	h.probing = false
+	switch {
+	case !failed:
+		if h.state != breakerClosed {
+			slog.Info("upstream circuit closed", "host", host)
+		}
+		h.state, h.failures = breakerClosed, 0
+	case h.state == breakerHalfOpen:
+		h.state, h.openedAt = breakerOpen, b.now()
+		slog.Warn("upstream probe failed, circuit open again", "host", host, "cooldown", b.cooldown)
+	default:
+		h.failures++
+		if h.failures >= b.threshold {
+			h.state, h.openedAt, h.failures = breakerOpen, b.now(), 0
+			slog.Warn("upstream circuit open", "host", host, "failures", b.threshold, "cooldown", b.cooldown)
+		}
+	}
+}
+
+// release gives up a request's slot without an outcome, e.g. when the
+// client went away, so a cancelled probe doesn't block the next one
+func (b *circuitBreaker) release(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.host(host).probing = false
+}
+
+// state returns the current state of a host
+func (b *circuitBreaker) state(host string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.host(host).state
+}
+
+// breakerTransport guards outbound requests with a circuit breaker keyed
+// by host. Transport errors and 5xx responses count as failures; other
+// statuses are the upstream answering, so they count as successes.
+type breakerTransport struct {
+	next    http.RoundTripper
+	breaker *circuitBreaker
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	if ok, wait := t.breaker.allow(host); !ok {
+		return nil, &circuitOpenError{host: host, retryAfter: wait}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if errors.Is(err, context.Canceled) {
+		t.breaker.release(host)
+		return resp, err
+	}
+	t.breaker.record(host, err != nil || resp.StatusCode >= http.StatusInternalServerError)
+	return resp, err
+}
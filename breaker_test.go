@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyTransport answers with the given status and counts calls
+type flakyTransport struct {
+	status atomic.Int64
+	calls  atomic.Int64
+}
+
+func (f *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.calls.Add(1)
+	return &http.Response{
+		StatusCode: int(f.status.Load()),
+		Body:       io.NopCloser(strings.NewReader(`{}`)),
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Request:    req,
+	}, nil
+}
+
+func TestCircuitBreaker_TripsAndHalfOpens(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	breaker := newCircuitBreaker(3, 30*time.Second)
+	breaker.now = func() time.Time { return now }
+
+	upstream := &flakyTransport{}
+	upstream.status.Store(http.StatusBadGateway)
+	client := &http.Client{Transport: &breakerTransport{next: upstream, breaker: breaker}}
+	get := func(host string) error {
+		resp, err := client.Get("https://" + host + "/xrpc/app.bsky.actor.getProfile")
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	// Failures below the threshold still reach the upstream
+	for i := 0; i < 3; i++ {
+		require.NoError(t, get("appview.test"))
+	}
+	assert.Equal(t, int64(3), upstream.calls.Load())
+	assert.Equal(t, breakerOpen, breaker.state("appview.test"))
+
+	// Open: refused without calling the upstream
+	err := get("appview.test")
+	var openErr *circuitOpenError
+	require.ErrorAs(t, err, &openErr)
+	assert.Equal(t, 30*time.Second, openErr.retryAfter)
+	assert.Equal(t, int64(3), upstream.calls.Load())
+
+	// Other hosts are unaffected
+	assert.Equal(t, breakerClosed, breaker.state("pds.test"))
+
+	// After the cooldown a failing probe opens the circuit again
+	now = now.Add(30 * time.Second)
+	require.NoError(t, get("appview.test"))
+	assert.Equal(t, int64(4), upstream.calls.Load())
+	assert.Equal(t, breakerOpen, breaker.state("appview.test"))
+	assert.Error(t, get("appview.test"))
+
+	// A successful probe closes it
+	now = now.Add(30 * time.Second)
+	upstream.status.Store(http.StatusOK)
+	require.NoError(t, get("appview.test"))
+	assert.Equal(t, breakerClosed, breaker.state("appview.test"))
+	require.NoError(t, get("appview.test"))
+	assert.Equal(t, int64(6), upstream.calls.Load())
+}
+
+func TestCircuitBreaker_SingleProbe(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	breaker := newCircuitBreaker(1, time.Second)
+	breaker.now = func() time.Time { return now }
+
+	breaker.record("appview.test", true)
+	now = now.Add(time.Second)
+
+	ok, _ := breaker.allow("appview.test")
+	assert.True(t, ok, "first request after the cooldown probes")
+	ok, _ = breaker.allow("appview.test")
+	assert.False(t, ok, "only one probe at a time")
+
+	// A cancelled probe frees the slot without deciding anything
+	breaker.release("appview.test")
+	assert.Equal(t, breakerHalfOpen, breaker.state("appview.test"))
+	ok, _ = breaker.allow("appview.test")
+	assert.True(t, ok)
+}
+
+func TestCircuitBreaker_ClientErrorsAreSuccesses(t *testing.T) {
+	breaker := newCircuitBreaker(1, time.Minute)
+	upstream := &flakyTransport{}
+	upstream.status.Store(http.StatusBadRequest)
+	transport := &breakerTransport{next: upstream, breaker: breaker}
+
+	req := httptest.NewRequest(http.MethodGet, "https://appview.test/xrpc/app.bsky.actor.getProfile", nil)
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, breakerClosed, breaker.state("appview.test"))
+
+	// Cancellation by the client is not the upstream's fault
+	failing := &breakerTransport{breaker: breaker, next: roundTripFunc(func(*http.Request) (*http.Response, error) {
+		return nil, context.Canceled
+	})}
+	_, err = failing.RoundTrip(req)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, breakerClosed, breaker.state("appview.test"))
+}
+
+func TestNewCircuitBreaker_Disabled(t *testing.T) {
+	assert.Nil(t, newCircuitBreaker(0, time.Minute))
+}
+
+func TestUpstreamError_CircuitOpen(t *testing.T) {
+	breaker := newCircuitBreaker(1, 10*time.Second)
+	breaker.record("mock.bsky.test", true)
+
+	client := &xrpc.Client{
+		Host:   "https://mock.bsky.test",
+		Client: &http.Client{Transport: &breakerTransport{next: newStubTransport(), breaker: breaker}},
+	}
+	_, err := bsky.ActorGetProfile(context.Background(), client, "did:plc:abc123")
+	require.Error(t, err)
+
+	srv := newStubServer(newStubTransport())
+	rec := httptest.NewRecorder()
+	c := srv.e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+	he := upstreamError(c, err)
+	assert.Equal(t, http.StatusServiceUnavailable, he.Code)
+	assert.Equal(t, "10", rec.Header().Get("Retry-After"))
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Profile cache defaults
+const (
+	defaultProfileCacheTTL        = time.Minute // How long fetched profiles are reused
+	defaultProfileCacheMaxEntries = 1000        // Profiles kept; DIDs come from client input
+)
+
+// warmCacheTimeout bounds the startup prefetch of the primary profile
+const warmCacheTimeout = 30 * time.Second
+
+// ttlEntry is a cached value with its expiry time
+type ttlEntry[V any] struct {
+	key     string
+	value   V
+	expires time.Time
+	elem    *list.Element // Position in ttlCache.order
+}
+
+// ttlCache is a small in-memory cache whose entries expire after a fixed TTL.
+// Expired entries are dropped as new ones are stored, and at most
+// maxEntries are kept, evicting those closest to expiry first. It is safe
+// for concurrent use.
+type ttlCache[V any] struct {
+	mu         sync.RWMutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*ttlEntry[V]
+	order      *list.List       // Entries, most recently stored first, so oldest expire first
+	now        func() time.Time // Overridable clock for tests
+}
+
+// newTTLCache creates a cache whose entries live for ttl, holding at most
+// maxEntries
+func newTTLCache[V any](ttl time.Duration, maxEntries int) *ttlCache[V] {
+	return &ttlCache[V]{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*ttlEntry[V]),
+		order:      list.New(),
+		now:        time.Now,
+	}
+}
+
+// get returns the cached value for key if present and not expired
+func (tc *ttlCache[V]) get(key string) (V, bool) {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+	entry, ok := tc.entries[key]
+	if !ok || tc.now().After(entry.expires) {
+		var zero V
+		return zero, false
+	}
+	return entry.value, true
+}
+
+// set stores value under key, replacing any previous entry. Expired
+// entries are dropped, then the oldest beyond maxEntries.
+func (tc *ttlCache[V]) set(key string, value V) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if entry, ok := tc.entries[key]; ok {
+		tc.remove(entry)
+	}
+	now := tc.now()
+	entry := &ttlEntry[V]{key: key, value: value, expires: now.Add(tc.ttl)}
+	entry.elem = tc.order.PushFront(entry)
+	tc.entries[key] = entry
+
+	for back := tc.order.Back(); back != nil; back = tc.order.Back() {
+		oldest := back.Value.(*ttlEntry[V])
+		if !now.After(oldest.expires) && tc.order.Len() <= tc.maxEntries {
+			break
+		}
+		tc.remove(oldest)
+	}
+}
+
+// delete removes key from the cache
+func (tc *ttlCache[V]) delete(key string) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if entry, ok := tc.entries[key]; ok {
+		tc.remove(entry)
+	}
+}
+
+// remove drops entry from the cache; tc.mu must be held
+func (tc *ttlCache[V]) remove(entry *ttlEntry[V]) {
+	tc.order.Remove(entry.elem)
+	delete(tc.entries, entry.key)
+}
+
+// getProfile returns the profile for a DID, served from the profile cache
+// when a fresh entry exists and fetched from upstream otherwise.
+//
+// Parameters:
+//   - ctx: Context for the upstream request
+//   - did: The DID of the profile to fetch
+//
+// Returns:
+//   - The hydrated profile
+//   - error if the upstream fetch fails
+func (srv *Server) getProfile(ctx context.Context, did string) (*ProfileView, error) {
+	if srv.profiles != nil {
+		if profile, ok := srv.profiles.get(did); ok {
+			return profile, nil
+		}
+	}
+
+	profile, err := srv.profileFetcher().GetProfile(ctx, did)
+	if err != nil {
+		return nil, err
+	}
+
+	if srv.profiles != nil {
+		srv.profiles.set(did, profile)
+	}
+	return profile, nil
+}
+
+// warmCache resolves the deployment's primary handle, remembering its DID
+// for /.well-known/atproto-did, and prefetches its profile. The first
+// visitor then gets a warm cache, and a misconfigured handle shows up in
+// the log at startup rather than on the first request. Failures are only
+// logged; the server runs either way.
+func (srv *Server) warmCache(ctx context.Context) {
+	primary := srv.primaryHandle()
+	if primary == "" || srv.dir == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, warmCacheTimeout)
+	defer cancel()
+
+	did, err := srv.resolvePrimaryDID(ctx, primary)
+	if err != nil {
+		slog.Warn("failed to resolve primary handle at startup", "handle", primary, "error", err)
+		return
+	}
+
+	if _, err := srv.getProfile(ctx, did.String()); err != nil {
+		slog.Warn("failed to prefetch primary profile at startup", "handle", primary, "did", did, "error", err)
+		return
+	}
+	slog.Info("warmed cache for primary handle", "handle", primary, "did", did)
+}
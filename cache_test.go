@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarmCache(t *testing.T) {
+	dir := identity.NewMockDirectory()
+	dir.Insert(identity.Identity{DID: syntax.DID("did:plc:alice"), Handle: syntax.Handle("alice.test")})
+	dir.Insert(identity.Identity{DID: syntax.DID("did:plc:owner"), Handle: syntax.Handle("owner.test")})
+
+	newServer := func(stub *stubTransport) *Server {
+		srv := newStubServer(stub)
+		srv.dir = &dir
+		srv.profiles = newTTLCache[*ProfileView](defaultProfileCacheTTL, defaultProfileCacheMaxEntries)
+		return srv
+	}
+
+	// The first allowed handle is prefetched
+	stub := newStubTransport().on("app.bsky.actor.getProfile", http.StatusOK, `{"did": "did:plc:alice", "handle": "alice.test"}`)
+	srv := newServer(stub)
+	srv.validHandles = []string{"alice.test", "bob.test"}
+	srv.warmCache(context.Background())
+
+	profile, ok := srv.profiles.get("did:plc:alice")
+	require.True(t, ok)
+	assert.Equal(t, "alice.test", profile.Handle)
+	assert.Len(t, stub.requests, 1)
+
+	// Without an allowlist the authenticated handle is used
+	stub = newStubTransport().on("app.bsky.actor.getProfile", http.StatusOK, `{"did": "did:plc:owner", "handle": "owner.test"}`)
+	srv = newServer(stub)
+	srv.auth = &AuthConfig{Handle: "owner.test", Token: "access", RefreshAt: time.Now().Add(time.Hour)}
+	srv.warmCache(context.Background())
+	_, ok = srv.profiles.get("did:plc:owner")
+	assert.True(t, ok)
+}
+
+func TestWarmCache_FailuresAreLogged(t *testing.T) {
+	dir := identity.NewMockDirectory()
+	dir.Insert(identity.Identity{DID: syntax.DID("did:plc:alice"), Handle: syntax.Handle("alice.test")})
+
+	// A handle that does not resolve never reaches the upstream
+	stub := newStubTransport()
+	srv := newStubServer(stub)
+	srv.dir = &dir
+	srv.profiles = newTTLCache[*ProfileView](defaultProfileCacheTTL, defaultProfileCacheMaxEntries)
+	srv.validHandles = []string{"typo.test"}
+	srv.warmCache(context.Background())
+	assert.Empty(t, stub.requests)
+
+	// A failing profile fetch leaves the cache empty
+	stub.on("app.bsky.actor.getProfile", http.StatusInternalServerError, `{"error": "InternalServerError"}`)
+	srv.validHandles = []string{"alice.test"}
+	srv.warmCache(context.Background())
+	_, ok := srv.profiles.get("did:plc:alice")
+	assert.False(t, ok)
+
+	// Nothing to warm without a primary handle
+	srv.validHandles = nil
+	srv.warmCache(context.Background())
+}
+
+func TestTTLCache_DropsExpiredAndCaps(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tc := newTTLCache[string](time.Minute, 3)
+	tc.now = func() time.Time { return now }
+
+	tc.set("did:plc:a", "a")
+	tc.set("did:plc:b", "b")
+
+	// Expired entries are deleted, not just hidden, once a new one is stored
+	now = now.Add(2 * time.Minute)
+	_, ok := tc.get("did:plc:a")
+	assert.False(t, ok)
+	tc.set("did:plc:c", "c")
+	assert.Len(t, tc.entries, 1)
+	assert.NotContains(t, tc.entries, "did:plc:a")
+	assert.NotContains(t, tc.entries, "did:plc:b")
+	assert.Equal(t, 1, tc.order.Len())
+
+	// Beyond the cap the oldest entries go first
+	for _, key := range []string{"did:plc:d", "did:plc:e", "did:plc:f"} {
+		now = now.Add(time.Second)
+		tc.set(key, key)
+	}
+	assert.Len(t, tc.entries, 3)
+	assert.NotContains(t, tc.entries, "did:plc:c")
+
+	// Replacing an entry does not grow the cache
+	tc.set("did:plc:d", "d2")
+	assert.Len(t, tc.entries, 3)
+	assert.Equal(t, 3, tc.order.Len())
+	v, ok := tc.get("did:plc:d")
+	require.True(t, ok)
+	assert.Equal(t, "d2", v)
+
+	tc.delete("did:plc:d")
+	assert.Len(t, tc.entries, 2)
+	assert.Equal(t, 2, tc.order.Len())
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// defaultRouteMaxAges are how long clients may cache API responses, by
+// route prefix (ATHOME_CACHE_MAX_AGES). Feeds change with every post, so
+// they are kept short; profiles rarely change.
+var defaultRouteMaxAges = map[string]time.Duration{
+	"/api/feed":    30 * time.Second,
+	"/api/post":    time.Minute,
+	"/api/profile": 5 * time.Minute,
+}
+
+// parseRouteMaxAges validates the configured route=max-age entries, e.g.
+// "/api/feed=1m". Entries override the defaults for their route; a max-age
+// of 0 leaves that route without a Cache-Control header.
+//
+// Returns:
+//   - The defaults merged with the configured entries
+//   - error naming the first malformed entry
+func parseRouteMaxAges(entries []string) (map[string]time.Duration, error) {
+	maxAges := make(map[string]time.Duration, len(defaultRouteMaxAges)+len(entries))
+	for route, age := range defaultRouteMaxAges {
+		maxAges[route] = age
+	}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		route, value, ok := strings.Cut(entry, "=")
+		route = strings.TrimSuffix(strings.TrimSpace(route), "/")
+		if !ok || !strings.HasPrefix(route, "/api/") {
+			return nil, fmt.Errorf("invalid cache max-age %q: expected /api/<route>=<duration>", entry)
+		}
+		age, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || age < 0 {
+			return nil, fmt.Errorf("invalid cache max-age %q: expected a non-negative duration", entry)
+		}
+		maxAges[route] = age
+	}
+	return maxAges, nil
+}
+
+// routeMaxAge is the max-age configured for one route prefix
+type routeMaxAge struct {
+	route string
+	age   time.Duration
+}
+
+// sortRouteMaxAges lists the configured max-ages longest prefix first, so
+// the first match is the most specific. It runs once when the
+// configuration is loaded rather than on every request.
+func sortRouteMaxAges(maxAges map[string]time.Duration) []routeMaxAge {
+	sorted := make([]routeMaxAge, 0, len(maxAges))
+	for route, age := range maxAges {
+		sorted = append(sorted, routeMaxAge{route: route, age: age})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if len(sorted[i].route) != len(sorted[j].route) {
+			return len(sorted[i].route) > len(sorted[j].route)
+		}
+		return sorted[i].route < sorted[j].route
+	})
+	return sorted
+}
+
+// routeMaxAge returns the max-age configured for a route pattern such as
+// "/api/profile/:handle". The longest configured prefix ending at a path
+// segment wins, so "/api/feed" covers "/api/feed/did/:did" but not
+// "/api/feed-generator/*".
+func (srv *Server) routeMaxAge(path string) (time.Duration, bool) {
+	for _, r := range srv.routeMaxAges {
+		if path == r.route || strings.HasPrefix(path, r.route+"/") {
+			return r.age, true
+		}
+	}
+	return 0, false
+}
+
+// routeCacheControl is middleware setting Cache-Control on successful API
+// responses from the per-route max-ages. Handlers that set their own
+// header win, and errors are left uncached. Private instances behind
+// basic auth keep responses out of shared caches.
+func (srv *Server) routeCacheControl(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		age, ok := srv.routeMaxAge(c.Path())
+		if !ok || age <= 0 {
+			return next(c)
+		}
+
+		visibility := "public"
+		if srv.basicAuthUser != "" {
+			visibility = "private"
+		}
+		header := c.Response().Header()
+		header.Set(echo.HeaderCacheControl, fmt.Sprintf("%s, max-age=%d", visibility, int64(age.Seconds())))
+		err := next(c)
+		if err != nil && !c.Response().Committed {
+			header.Del(echo.HeaderCacheControl)
+		}
+		return err
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRouteMaxAges(t *testing.T) {
+	// Without entries the defaults apply
+	maxAges, err := parseRouteMaxAges(nil)
+	require.NoError(t, err)
+	assert.Equal(t, defaultRouteMaxAges, maxAges)
+
+	// Entries override the defaults and add routes
+	maxAges, err = parseRouteMaxAges([]string{" /api/feed = 1m", "/api/media/=10m", "/api/post=0", ""})
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, maxAges["/api/feed"])
+	assert.Equal(t, 10*time.Minute, maxAges["/api/media"])
+	assert.Equal(t, time.Duration(0), maxAges["/api/post"])
+	assert.Equal(t, defaultRouteMaxAges["/api/profile"], maxAges["/api/profile"])
+	assert.Equal(t, 30*time.Second, defaultRouteMaxAges["/api/feed"], "the defaults must not be modified")
+
+	for _, entry := range []string{"/api/feed", "/healthz=1m", "/api/feed=soon", "/api/feed=-1s"} {
+		_, err := parseRouteMaxAges([]string{entry})
+		assert.Error(t, err, entry)
+	}
+}
+
+func TestRouteCacheControl(t *testing.T) {
+	srv := &Server{routeMaxAges: sortRouteMaxAges(map[string]time.Duration{
+		"/api/feed":     30 * time.Second,
+		"/api/profile":  5 * time.Minute,
+		"/api/post":     time.Minute,
+		"/api/post/raw": 0,
+	})}
+	ok := func(c echo.Context) error { return c.String(http.StatusOK, "ok") }
+
+	e := echo.New()
+	api := e.Group("/api", srv.routeCacheControl)
+	api.GET("/profile/:handle", ok)
+	api.GET("/profile", ok)
+	api.GET("/feed/did/:did", ok)
+	api.GET("/feed-generator/*", ok)
+	api.GET("/post/*", ok)
+	api.GET("/post/raw/*", ok)
+	api.GET("/version", ok)
+	api.GET("/feed/:handle", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusNotFound, "no such feed")
+	})
+	api.GET("/about", func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderCacheControl, "public, max-age=300")
+		return c.String(http.StatusOK, "ok")
+	})
+
+	cacheControl := func(path string) string {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Header().Get(echo.HeaderCacheControl)
+	}
+
+	assert.Equal(t, "public, max-age=300", cacheControl("/api/profile/alice.test"))
+	assert.Equal(t, "public, max-age=300", cacheControl("/api/profile"))
+	assert.Equal(t, "public, max-age=30", cacheControl("/api/feed/did/did:plc:abc123"))
+	assert.Equal(t, "public, max-age=60", cacheControl("/api/post/at://did:plc:abc123/app.bsky.feed.post/1"))
+
+	// The longest prefix wins, and prefixes end at a path segment
+	assert.Empty(t, cacheControl("/api/post/raw/at://did:plc:abc123/app.bsky.feed.post/1"))
+	assert.Empty(t, cacheControl("/api/feed-generator/at://did:plc:abc123/app.bsky.feed.generator/x"))
+	assert.Empty(t, cacheControl("/api/version"))
+
+	// Errors are not cached, and a handler's own header wins
+	assert.Empty(t, cacheControl("/api/feed/alice.test"))
+	assert.Equal(t, "public, max-age=300", cacheControl("/api/about"))
+
+	// Private instances keep responses out of shared caches
+	srv.basicAuthUser = "owner"
+	assert.Equal(t, "private, max-age=300", cacheControl("/api/profile/alice.test"))
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/labstack/gommon/bytes"
+	"gopkg.in/yaml.v3"
+)
+
+// loadConfigFile reads a YAML or JSON config file (ATHOME_CONFIG / --config).
+// Keys are flag names; lists are joined with commas, as the list flags expect.
+//
+// Returns:
+//   - The settings as flag values keyed by flag name
+//   - error if the file cannot be read or parsed
+func loadConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	// JSON is a subset of YAML, so one parser handles both
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	settings := make(map[string]string, len(doc))
+	for key, value := range doc {
+		switch v := value.(type) {
+		case nil:
+			settings[key] = ""
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			settings[key] = strings.Join(items, ",")
+		case map[string]interface{}:
+			return nil, fmt.Errorf("config setting %s must not be a mapping", key)
+		default:
+			settings[key] = fmt.Sprint(v)
+		}
+	}
+	return settings, nil
+}
+
+// applyConfigFile applies config file settings to the flags that were not
+// given on the command line. The flags are updated without being marked as
+// set, so environment variables still override file values.
+//
+// Returns:
+//   - The names of the flags taken from the file, sorted
+//   - error naming the first unknown or invalid setting; values are left
+//     out of the message since they may be secrets
+func applyConfigFile(fs *flag.FlagSet, settings map[string]string) ([]string, error) {
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var applied []string
+	for _, name := range names {
+		f := fs.Lookup(name)
+		if f == nil || name == "config" {
+			return nil, fmt.Errorf("unknown config setting %s", name)
+		}
+		if explicit[name] {
+			continue
+		}
+		if err := f.Value.Set(settings[name]); err != nil {
+			return nil, fmt.Errorf("invalid value for config setting %s", name)
+		}
+		applied = append(applied, name)
+	}
+	return applied, nil
+}
+
+// rawConfig holds the settings that need validation as they were given,
+// after environment variables have been applied over the flags.
+type rawConfig struct {
+	Mode                string
+	PublicOnly          bool
+	AppViewHost         string
+	AppViewConfigured   bool // Whether the AppView was set explicitly rather than defaulted
+	HydrationAppView    string
+	FeedProxy           string
+	PDSHost             string
+	PDSHandle           string
+	PDSPassword         string
+	FingerprintKey      string
+	ValidHandles        []string
+	ValidDIDs           []string
+	TrustedProxies      []string
+	RecordCollections   []string
+	CacheMaxAges        []string
+	CSPConnectExtra     []string
+	Contact             string
+	BodyLimit           string
+	APIBodyLimit        string
+	UpstreamMaxResponse string
+	FeedDefaultLimit    int
+	FeedMaxLimit        int
+	FeedMaxFetches      int
+	EnablePortfolio     bool
+	EnableLive          bool
+	StrictFields        bool
+	DisableHostFallback bool
+	DefaultHandle       string
+	AdminToken          string
+	BasicAuthUser       string
+	BasicAuthPassword   string
+	HealthDetail        string
+	HealthSecret        string
+}
+
+// Config is the validated, effective configuration the server runs with.
+type Config struct {
+	Mode                string // modeAppView or modePDS
+	PublicOnly          bool   // No credentials, admin or owner routes at all
+	AppViewHost         string
+	AppViewConfigured   bool
+	HydrationAppView    string // AppView for hydrated reads in PDS mode; empty when unset
+	FeedProxy           string // atproto-proxy service reference for feed generator fetches
+	PDSHost             string
+	PDSHandle           string
+	PDSPassword         string
+	FingerprintKey      string // Keys the credential fingerprint; empty for a random key
+	ValidHandles        []string
+	ValidDIDs           []string
+	TrustedProxies      []netip.Prefix
+	RecordCollections   []string
+	RouteMaxAges        []routeMaxAge // Defaults merged with the configured entries, longest prefix first
+	CSPConnectExtra     []string      // Normalized origins or hosts
+	Contact             string
+	BodyLimit           int64
+	APIBodyLimit        int64
+	UpstreamMaxResponse int64 // 0 disables the cap
+	FeedDefaultLimit    int
+	FeedMaxLimit        int
+	FeedMaxFetches      int
+	EnablePortfolio     bool
+	EnableLive          bool
+	StrictFields        bool
+	DisableHostFallback bool
+	DefaultHandle       string // Normalized; empty when unset
+	AdminToken          string
+	BasicAuthUser       string
+	BasicAuthPassword   string
+	HealthDetail        string // healthDetailPublic, healthDetailMinimal or healthDetailSecret
+	HealthSecret        string
+}
+
+// validateConfig checks the raw settings and converts them into a Config.
+// Every problem is reported rather than only the first, so an operator can
+// fix a misconfiguration in one go.
+//
+// Returns:
+//   - The effective configuration, only meaningful when errs is empty
+//   - One error per invalid setting
+func validateConfig(raw rawConfig) (Config, []error) {
+	var errs []error
+	cfg := Config{
+		PublicOnly:          raw.PublicOnly,
+		AppViewHost:         raw.AppViewHost,
+		AppViewConfigured:   raw.AppViewConfigured,
+		PDSHost:             raw.PDSHost,
+		PDSHandle:           raw.PDSHandle,
+		PDSPassword:         raw.PDSPassword,
+		FingerprintKey:      raw.FingerprintKey,
+		ValidHandles:        normalizeHandles(raw.ValidHandles),
+		ValidDIDs:           raw.ValidDIDs,
+		FeedDefaultLimit:    raw.FeedDefaultLimit,
+		FeedMaxLimit:        raw.FeedMaxLimit,
+		FeedMaxFetches:      raw.FeedMaxFetches,
+		EnablePortfolio:     raw.EnablePortfolio,
+		EnableLive:          raw.EnableLive,
+		StrictFields:        raw.StrictFields,
+		DisableHostFallback: raw.DisableHostFallback,
+		AdminToken:          raw.AdminToken,
+		BasicAuthUser:       raw.BasicAuthUser,
+		BasicAuthPassword:   raw.BasicAuthPassword,
+		HealthDetail:        strings.ToLower(strings.TrimSpace(raw.HealthDetail)),
+		HealthSecret:        raw.HealthSecret,
+	}
+
+	// PDS and AppView settings are mutually exclusive unless reads are split
+	mode, err := selectMode(raw.Mode, raw.PDSHost, raw.PDSHandle, raw.PDSPassword)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.Mode = mode
+
+	// Hydrated reads can only be split off from an authenticated PDS
+	if raw.HydrationAppView != "" {
+		cfg.HydrationAppView = strings.TrimSuffix(strings.TrimSpace(raw.HydrationAppView), "/")
+		if u, err := url.Parse(cfg.HydrationAppView); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid hydration AppView %q: expected an http(s) URL", raw.HydrationAppView))
+		}
+		if mode != modePDS {
+			errs = append(errs, fmt.Errorf("a hydration AppView only applies in PDS mode"))
+		}
+	}
+
+	// A public-only mirror asserts that no credentials are configured at all
+	if raw.PublicOnly {
+		var set []string
+		for _, s := range []struct{ name, value string }{
+			{"PDS host", raw.PDSHost},
+			{"PDS handle", raw.PDSHandle},
+			{"PDS password", raw.PDSPassword},
+			{"admin token", raw.AdminToken},
+			{"basic auth", raw.BasicAuthUser + raw.BasicAuthPassword},
+		} {
+			if s.value != "" {
+				set = append(set, s.name)
+			}
+		}
+		if len(set) > 0 {
+			errs = append(errs, fmt.Errorf("public-only mode forbids credentials, but these are set: %s", strings.Join(set, ", ")))
+		}
+	}
+
+	if cfg.BodyLimit, err = bytes.Parse(raw.BodyLimit); err != nil {
+		errs = append(errs, fmt.Errorf("invalid body limit %q: %w", raw.BodyLimit, err))
+	}
+	if cfg.APIBodyLimit, err = bytes.Parse(raw.APIBodyLimit); err != nil {
+		errs = append(errs, fmt.Errorf("invalid API body limit %q: %w", raw.APIBodyLimit, err))
+	}
+	if cfg.UpstreamMaxResponse, err = bytes.Parse(raw.UpstreamMaxResponse); err != nil {
+		errs = append(errs, fmt.Errorf("invalid upstream max response %q: %w", raw.UpstreamMaxResponse, err))
+	}
+
+	if raw.FeedDefaultLimit < 1 || raw.FeedMaxLimit < raw.FeedDefaultLimit {
+		errs = append(errs, fmt.Errorf("invalid feed limits: default %d, max %d", raw.FeedDefaultLimit, raw.FeedMaxLimit))
+	}
+	if raw.FeedMaxFetches < 1 {
+		errs = append(errs, fmt.Errorf("invalid feed max fetches %d: must be at least 1", raw.FeedMaxFetches))
+	}
+
+	// A list of only blanks must not silently turn into "allow everyone"
+	if len(raw.ValidHandles) > 0 && len(cfg.ValidHandles) == 0 {
+		errs = append(errs, fmt.Errorf("handle allowlist is set but has no handles"))
+	}
+
+	if raw.DefaultHandle != "" {
+		cfg.DefaultHandle = normalizeHandle(raw.DefaultHandle)
+		if _, err := syntax.ParseHandle(cfg.DefaultHandle); err != nil {
+			errs = append(errs, fmt.Errorf("invalid default handle %q: %w", raw.DefaultHandle, err))
+		}
+	}
+
+	if cfg.TrustedProxies, err = parseTrustedProxies(raw.TrustedProxies); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.RecordCollections, err = parseRecordCollections(raw.RecordCollections); err != nil {
+		errs = append(errs, err)
+	}
+	if maxAges, err := parseRouteMaxAges(raw.CacheMaxAges); err != nil {
+		errs = append(errs, err)
+	} else {
+		cfg.RouteMaxAges = sortRouteMaxAges(maxAges)
+	}
+	if cfg.CSPConnectExtra, err = parseCSPSources(raw.CSPConnectExtra); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.FeedProxy, err = parseServiceRef(raw.FeedProxy); err != nil {
+		errs = append(errs, fmt.Errorf("invalid feed proxy: %w", err))
+	}
+	if cfg.Contact, err = parseContactURL(raw.Contact); err != nil {
+		errs = append(errs, err)
+	}
+
+	if (raw.BasicAuthUser == "") != (raw.BasicAuthPassword == "") {
+		errs = append(errs, fmt.Errorf("basic auth requires both a user and a password"))
+	}
+
+	switch cfg.HealthDetail {
+	case "":
+		cfg.HealthDetail = healthDetailPublic
+	case healthDetailPublic, healthDetailMinimal:
+	case healthDetailSecret:
+		if raw.HealthSecret == "" {
+			errs = append(errs, fmt.Errorf("health detail mode %s requires a health secret", healthDetailSecret))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown health detail mode %q (expected %s, %s or %s)", raw.HealthDetail, healthDetailPublic, healthDetailMinimal, healthDetailSecret))
+	}
+
+	return cfg, errs
+}
+
+// host returns the upstream the server primarily talks to in its mode.
+func (cfg Config) host() string {
+	if cfg.Mode == modePDS {
+		return cfg.PDSHost
+	}
+	return cfg.AppViewHost
+}
+
+// readHost returns the AppView hydrated reads are sent to unauthenticated
+// in PDS mode: the hydration AppView if set, else an explicitly configured
+// AppView. Empty means reads share the PDS client.
+func (cfg Config) readHost() string {
+	switch {
+	case cfg.Mode != modePDS:
+		return ""
+	case cfg.HydrationAppView != "":
+		return cfg.HydrationAppView
+	case cfg.AppViewConfigured:
+		return cfg.AppViewHost
+	}
+	return ""
+}
+
+// logSummary logs the effective configuration as a single line.
+// Secrets are reported only as being set or not.
+func (cfg Config) logSummary() {
+	slog.Info("effective configuration",
+		"mode", cfg.Mode,
+		"public_only", cfg.PublicOnly,
+		"host", cfg.host(),
+		"read_host", cfg.readHost(),
+		"handle", cfg.PDSHandle,
+		"allowed_handles", len(cfg.ValidHandles),
+		"allowed_dids", len(cfg.ValidDIDs),
+		"trusted_proxies", len(cfg.TrustedProxies),
+		"portfolio", cfg.EnablePortfolio,
+		"live", cfg.EnableLive,
+		"strict_fields", cfg.StrictFields,
+		"host_fallback", !cfg.DisableHostFallback,
+		"default_handle", cfg.DefaultHandle,
+		"admin", cfg.AdminToken != "",
+		"basic_auth", cfg.BasicAuthUser != "",
+		"health_detail", cfg.HealthDetail)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"flag"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// validRawConfig returns a minimal AppView configuration that passes validation
+func validRawConfig() rawConfig {
+	return rawConfig{
+		AppViewHost:         "https://api.bsky.app",
+		BodyLimit:           "64M",
+		APIBodyLimit:        "64K",
+		UpstreamMaxResponse: "16M",
+		FeedDefaultLimit:    defaultFeedLimit,
+		FeedMaxLimit:        defaultFeedMaxLimit,
+		FeedMaxFetches:      defaultFeedMaxFetches,
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	cfg, errs := validateConfig(validRawConfig())
+	require.Empty(t, errs)
+	assert.Equal(t, modeAppView, cfg.Mode)
+	assert.Equal(t, int64(64_000_000), cfg.BodyLimit)
+	assert.Equal(t, int64(64_000), cfg.APIBodyLimit)
+	assert.Equal(t, "https://api.bsky.app", cfg.host())
+
+	raw := validRawConfig()
+	raw.PDSHost, raw.PDSHandle, raw.PDSPassword = "https://pds.test", "me.test", "pw"
+	raw.TrustedProxies = []string{"10.0.0.0/8"}
+	cfg, errs = validateConfig(raw)
+	require.Empty(t, errs)
+	assert.Equal(t, modePDS, cfg.Mode)
+	assert.Equal(t, "https://pds.test", cfg.host())
+	assert.Equal(t, []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}, cfg.TrustedProxies)
+
+	// Configured handles are trimmed and lowercased, as from "a, B ,"
+	raw = validRawConfig()
+	raw.ValidHandles = []string{" Alice.bsky.social ", " bob.test", ""}
+	cfg, errs = validateConfig(raw)
+	require.Empty(t, errs)
+	assert.Equal(t, []string{"alice.bsky.social", "bob.test"}, cfg.ValidHandles)
+
+	// So is the default handle
+	raw = validRawConfig()
+	raw.DefaultHandle = " Alice.bsky.social. "
+	cfg, errs = validateConfig(raw)
+	require.Empty(t, errs)
+	assert.Equal(t, "alice.bsky.social", cfg.DefaultHandle)
+}
+
+func TestValidateConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*rawConfig)
+		wantErr string
+	}{
+		{name: "pds host with appview mode", modify: func(r *rawConfig) {
+			r.Mode, r.PDSHost, r.PDSHandle, r.PDSPassword = modeAppView, "https://pds.test", "me.test", "pw"
+		}, wantErr: "mode is appview"},
+		{name: "pds mode without host", modify: func(r *rawConfig) { r.Mode = modePDS }, wantErr: "requires a PDS host"},
+		{name: "pds host without handle", modify: func(r *rawConfig) {
+			r.PDSHost, r.PDSPassword = "https://pds.test", "pw"
+		}, wantErr: "missing handle or password"},
+		{name: "pds host without password", modify: func(r *rawConfig) {
+			r.PDSHost, r.PDSHandle = "https://pds.test", "me.test"
+		}, wantErr: "missing handle or password"},
+		{name: "unknown mode", modify: func(r *rawConfig) { r.Mode = "relay" }, wantErr: "unknown mode"},
+		{name: "invalid body limit", modify: func(r *rawConfig) { r.BodyLimit = "lots" }, wantErr: "invalid body limit"},
+		{name: "invalid upstream max response", modify: func(r *rawConfig) { r.UpstreamMaxResponse = "lots" }, wantErr: "invalid upstream max response"},
+		{name: "invalid api body limit", modify: func(r *rawConfig) { r.APIBodyLimit = "lots" }, wantErr: "invalid API body limit"},
+		{name: "zero default feed limit", modify: func(r *rawConfig) { r.FeedDefaultLimit = 0 }, wantErr: "invalid feed limits"},
+		{name: "max feed limit below default", modify: func(r *rawConfig) { r.FeedMaxLimit = r.FeedDefaultLimit - 1 }, wantErr: "invalid feed limits"},
+		{name: "zero feed fetches", modify: func(r *rawConfig) { r.FeedMaxFetches = 0 }, wantErr: "invalid feed max fetches"},
+		{name: "basic auth user without password", modify: func(r *rawConfig) { r.BasicAuthUser = "owner" }, wantErr: "basic auth"},
+		{name: "basic auth password without user", modify: func(r *rawConfig) { r.BasicAuthPassword = "pw" }, wantErr: "basic auth"},
+		{name: "unknown health detail", modify: func(r *rawConfig) { r.HealthDetail = "verbose" }, wantErr: "unknown health detail mode"},
+		{name: "health secret mode without secret", modify: func(r *rawConfig) { r.HealthDetail = healthDetailSecret }, wantErr: "requires a health secret"},
+		{name: "invalid trusted proxy", modify: func(r *rawConfig) { r.TrustedProxies = []string{"not-an-ip"} }, wantErr: "invalid trusted proxy"},
+		{name: "invalid record collection", modify: func(r *rawConfig) { r.RecordCollections = []string{"not a nsid"} }, wantErr: "invalid record collection"},
+		{name: "blank handle allowlist", modify: func(r *rawConfig) { r.ValidHandles = []string{" ", ""} }, wantErr: "has no handles"},
+		{name: "invalid cache max-age", modify: func(r *rawConfig) { r.CacheMaxAges = []string{"/api/feed=soon"} }, wantErr: "invalid cache max-age"},
+		{name: "invalid csp connect-src entry", modify: func(r *rawConfig) { r.CSPConnectExtra = []string{"https:"} }, wantErr: "invalid CSP connect-src entry"},
+		{name: "invalid hydration appview", modify: func(r *rawConfig) {
+			r.PDSHost, r.PDSHandle, r.PDSPassword = "https://pds.test", "me.test", "pw"
+			r.HydrationAppView = "api.bsky.app"
+		}, wantErr: "invalid hydration AppView"},
+		{name: "hydration appview without pds", modify: func(r *rawConfig) { r.HydrationAppView = "https://api.bsky.app" }, wantErr: "only applies in PDS mode"},
+		{name: "invalid feed proxy", modify: func(r *rawConfig) { r.FeedProxy = "did:web:api.bsky.app" }, wantErr: "invalid feed proxy"},
+		{name: "invalid default handle", modify: func(r *rawConfig) { r.DefaultHandle = "localhost" }, wantErr: "invalid default handle"},
+		{name: "invalid contact link", modify: func(r *rawConfig) { r.Contact = "javascript:alert(1)" }, wantErr: "invalid contact link"},
+		{name: "public only with pds credentials", modify: func(r *rawConfig) {
+			r.PublicOnly, r.PDSHost, r.PDSHandle, r.PDSPassword = true, "https://pds.test", "me.test", "pw"
+		}, wantErr: "PDS host, PDS handle, PDS password"},
+		{name: "public only with admin token", modify: func(r *rawConfig) {
+			r.PublicOnly, r.AdminToken = true, "s3cret"
+		}, wantErr: "public-only mode forbids credentials, but these are set: admin token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := validRawConfig()
+			tt.modify(&raw)
+			_, errs := validateConfig(raw)
+			require.Len(t, errs, 1)
+			assert.ErrorContains(t, errs[0], tt.wantErr)
+		})
+	}
+}
+
+func TestConfigReadHost(t *testing.T) {
+	pds := func(modify func(r *rawConfig)) Config {
+		raw := validRawConfig()
+		raw.PDSHost, raw.PDSHandle, raw.PDSPassword = "https://pds.test", "me.test", "pw"
+		modify(&raw)
+		cfg, errs := validateConfig(raw)
+		require.Empty(t, errs)
+		return cfg
+	}
+
+	// Reads share the PDS client unless an AppView is named
+	assert.Empty(t, pds(func(r *rawConfig) {}).readHost())
+	assert.Equal(t, "https://appview.test", pds(func(r *rawConfig) {
+		r.AppViewHost, r.AppViewConfigured = "https://appview.test", true
+	}).readHost())
+
+	// The hydration AppView wins over the general one
+	assert.Equal(t, "https://hydration.test", pds(func(r *rawConfig) {
+		r.AppViewHost, r.AppViewConfigured = "https://appview.test", true
+		r.HydrationAppView = " https://hydration.test/ "
+	}).readHost())
+
+	// In AppView mode every call goes to the AppView anyway
+	cfg, errs := validateConfig(validRawConfig())
+	require.Empty(t, errs)
+	assert.Empty(t, cfg.readHost())
+}
+
+func TestValidateConfig_ReportsEveryError(t *testing.T) {
+	raw := validRawConfig()
+	raw.Mode = "relay"
+	raw.BodyLimit = "lots"
+	raw.FeedMaxFetches = 0
+
+	_, errs := validateConfig(raw)
+	assert.Len(t, errs, 3)
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(yamlPath, []byte(`
+bind: ":9000"
+pds: https://pds.test
+pds-handle: me.test
+valid-handles:
+  - me.test
+  - alt.test
+portfolio: true
+feed-max-limit: 50
+`), 0o600))
+
+	settings, err := loadConfigFile(yamlPath)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"bind":           ":9000",
+		"pds":            "https://pds.test",
+		"pds-handle":     "me.test",
+		"valid-handles":  "me.test,alt.test",
+		"portfolio":      "true",
+		"feed-max-limit": "50",
+	}, settings)
+
+	jsonPath := filepath.Join(dir, "config.json")
+	require.NoError(t, os.WriteFile(jsonPath, []byte(`{"bind": ":9000", "valid-dids": ["did:plc:me"]}`), 0o600))
+	settings, err = loadConfigFile(jsonPath)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"bind": ":9000", "valid-dids": "did:plc:me"}, settings)
+
+	nestedPath := filepath.Join(dir, "nested.yaml")
+	require.NoError(t, os.WriteFile(nestedPath, []byte("pds:\n  host: https://pds.test\n"), 0o600))
+	_, err = loadConfigFile(nestedPath)
+	assert.Error(t, err)
+
+	_, err = loadConfigFile(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestApplyConfigFile_Errors(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("pds-password", "", "")
+	fs.Int("feed-max-limit", 0, "")
+	fs.String("config", "", "")
+
+	_, err := applyConfigFile(fs, map[string]string{"pds-pasword": "secret"})
+	assert.ErrorContains(t, err, "unknown config setting pds-pasword")
+
+	_, err = applyConfigFile(fs, map[string]string{"config": "other.yaml"})
+	assert.Error(t, err)
+
+	_, err = applyConfigFile(fs, map[string]string{"feed-max-limit": "lots"})
+	assert.ErrorContains(t, err, "feed-max-limit")
+	assert.NotContains(t, err.Error(), "lots")
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	// isFlagSet consults the global flag set
+	saved := flag.CommandLine
+	t.Cleanup(func() { flag.CommandLine = saved })
+	flag.CommandLine = flag.NewFlagSet("athome", flag.ContinueOnError)
+
+	var fromFlag, fromEnv, fromFile, fromDefault string
+	flag.StringVar(&fromFlag, "from-flag", "default", "")
+	flag.StringVar(&fromEnv, "from-env", "default", "")
+	flag.StringVar(&fromFile, "from-file", "default", "")
+	flag.StringVar(&fromDefault, "from-default", "default", "")
+	require.NoError(t, flag.CommandLine.Parse([]string{"--from-flag", "flag"}))
+
+	applied, err := applyConfigFile(flag.CommandLine, map[string]string{
+		"from-flag": "file",
+		"from-env":  "file",
+		"from-file": "file",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"from-env", "from-file"}, applied)
+
+	t.Setenv("ATHOME_FROM_FLAG", "env")
+	t.Setenv("ATHOME_FROM_ENV", "env")
+
+	assert.Equal(t, "flag", getEnvOrFlag("ATHOME_FROM_FLAG", "from-flag", fromFlag))
+	assert.Equal(t, "env", getEnvOrFlag("ATHOME_FROM_ENV", "from-env", fromEnv))
+	assert.Equal(t, "file", getEnvOrFlag("ATHOME_FROM_FILE", "from-file", fromFile))
+	assert.Equal(t, "default", getEnvOrFlag("ATHOME_FROM_DEFAULT", "from-default", fromDefault))
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// bskyImageHosts serve the avatars, banners, embed images and video
+// thumbnails in AppView responses. There is no blob proxy, so the default
+// img-src must still allow them.
+var bskyImageHosts = []string{"https://cdn.bsky.app", "https://video.bsky.app"}
+
+// parseCSPSources validates extra connect-src hosts
+// (ATHOME_CSP_CONNECT_EXTRA). An entry is an origin such as
+// "https://media.example.com" or "wss://stream.example.com:8443", or a bare
+// host such as "media.example.com" or "*.example.com". Keywords and
+// scheme-only sources like "https:", which would open the policy to every
+// host, are rejected.
+//
+// Returns:
+//   - The sources as origins or hosts
+//   - error naming the first invalid entry
+func parseCSPSources(entries []string) ([]string, error) {
+	var sources []string
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		source, ok := cspSource(entry)
+		if !ok {
+			return nil, fmt.Errorf("invalid CSP connect-src entry %q", entry)
+		}
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+// cspSource normalizes one origin or host entry to a CSP source
+func cspSource(entry string) (string, bool) {
+	if strings.ContainsAny(entry, " ;,'\"") {
+		return "", false
+	}
+
+	if strings.Contains(entry, "://") {
+		u, err := url.Parse(entry)
+		if err != nil || u.Hostname() == "" || u.User != nil || u.RawQuery != "" || u.Fragment != "" || (u.Path != "" && u.Path != "/") {
+			return "", false
+		}
+		switch u.Scheme {
+		case "https", "http", "wss", "ws":
+			return u.Scheme + "://" + strings.ToLower(u.Host), true
+		}
+		return "", false
+	}
+
+	// A bare host, optionally with a wildcard for its subdomains
+	host := strings.TrimPrefix(entry, "*.")
+	u, err := url.Parse("https://" + host)
+	if err != nil || u.Host != host || !strings.Contains(u.Hostname(), ".") {
+		return "", false
+	}
+	return strings.ToLower(entry), true
+}
+
+// buildCSP returns the Content-Security-Policy for a response whose
+// scripts carry nonce. Images are limited to this server, data: URLs and
+// the Bluesky CDN unless ATHOME_CSP_ALLOW_EXTERNAL_IMG opens img-src to
+// any HTTPS host. In PDS mode the PDS may be contacted directly, as may
+// the hosts an operator lists in ATHOME_CSP_CONNECT_EXTRA.
+func (srv *Server) buildCSP(nonce string) string {
+	img := append([]string{"'self'", "data:"}, bskyImageHosts...)
+	if srv.cspAllowExternalImg {
+		img = []string{"'self'", "data:", "https:"}
+	}
+
+	connect := []string{"'self'", "https://api.bsky.app"}
+	if srv.auth != nil && srv.auth.PDS != "" {
+		connect = append(connect, srv.auth.PDS)
+	}
+	connect = append(connect, srv.cspConnectExtra...)
+
+	return strings.Join([]string{
+		"default-src 'self'",
+		"script-src 'self' 'nonce-" + nonce + "'",
+		"style-src 'self' 'unsafe-inline' https://fonts.googleapis.com",
+		"font-src 'self' https://fonts.gstatic.com",
+		"img-src " + strings.Join(img, " "),
+		"connect-src " + strings.Join(connect, " "),
+		"manifest-src 'self'",
+		"worker-src 'self'",
+	}, "; ")
+}
+
+// contentSecurityPolicy is middleware generating a script nonce for each
+// request and sending the matching Content-Security-Policy
+func (srv *Server) contentSecurityPolicy(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		nonce := generateNonce()
+		c.Set("nonce", nonce)
+		c.Response().Header().Set(echo.HeaderContentSecurityPolicy, srv.buildCSP(nonce))
+		return next(c)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cspDirective returns the sources of one directive in a policy
+func cspDirective(policy, name string) string {
+	for _, directive := range strings.Split(policy, ";") {
+		directive = strings.TrimSpace(directive)
+		if sources, ok := strings.CutPrefix(directive, name+" "); ok {
+			return sources
+		}
+	}
+	return ""
+}
+
+func TestBuildCSP(t *testing.T) {
+	srv := &Server{}
+	policy := srv.buildCSP("abc123")
+
+	// Images are limited to this server and the Bluesky CDN by default
+	assert.Equal(t, "'self' data: https://cdn.bsky.app https://video.bsky.app", cspDirective(policy, "img-src"))
+	assert.Equal(t, "'self' 'nonce-abc123'", cspDirective(policy, "script-src"))
+	assert.Equal(t, "'self' https://api.bsky.app", cspDirective(policy, "connect-src"))
+	assert.NotContains(t, policy, "\n")
+
+	// Opting in allows any HTTPS image host
+	srv.cspAllowExternalImg = true
+	assert.Equal(t, "'self' data: https:", cspDirective(srv.buildCSP("abc123"), "img-src"))
+
+	// The PDS may be contacted directly in PDS mode
+	srv.auth = &AuthConfig{PDS: "https://pds.example.com"}
+	assert.Equal(t, "'self' https://api.bsky.app https://pds.example.com", cspDirective(srv.buildCSP("abc123"), "connect-src"))
+
+	// Extra hosts follow the built-in ones
+	srv.cspConnectExtra = []string{"https://media.example.com", "*.cdn.example.com"}
+	assert.Equal(t, "'self' https://api.bsky.app https://pds.example.com https://media.example.com *.cdn.example.com", cspDirective(srv.buildCSP("abc123"), "connect-src"))
+}
+
+func TestParseCSPSources(t *testing.T) {
+	sources, err := parseCSPSources([]string{
+		" https://Media.Example.com ",
+		"wss://stream.example.com:8443/",
+		"embed.example.com",
+		"*.cdn.example.com",
+		"",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"https://media.example.com",
+		"wss://stream.example.com:8443",
+		"embed.example.com",
+		"*.cdn.example.com",
+	}, sources)
+
+	sources, err = parseCSPSources(nil)
+	require.NoError(t, err)
+	assert.Empty(t, sources)
+
+	for _, entry := range []string{
+		"https:",
+		"*",
+		"'unsafe-eval'",
+		"https://example.com/path",
+		"ftp://files.example.com",
+		"example.com; script-src *",
+		"localhost",
+		"https://user@example.com",
+	} {
+		_, err := parseCSPSources([]string{"embed.example.com", entry})
+		assert.ErrorContains(t, err, "invalid CSP connect-src entry", entry)
+	}
+}
+
+func TestContentSecurityPolicy_Header(t *testing.T) {
+	srv, err := setupServer(":0", nil, nil, nil, nil, t.TempDir(), nil)
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	srv.e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/robots.txt", nil))
+	policy := rec.Header().Get(echo.HeaderContentSecurityPolicy)
+	assert.Equal(t, "'self' data: https://cdn.bsky.app https://video.bsky.app", cspDirective(policy, "img-src"))
+	assert.NotContains(t, policy, "{nonce}")
+	assert.Regexp(t, `script-src 'self' 'nonce-[^']+'`, policy)
+
+	// Each request gets a fresh nonce
+	rec2 := httptest.NewRecorder()
+	srv.e.ServeHTTP(rec2, httptest.NewRequest(http.MethodGet, "/robots.txt", nil))
+	assert.NotEqual(t, policy, rec2.Header().Get(echo.HeaderContentSecurityPolicy))
+
+	// The setting applies without rebuilding the server
+	srv.cspAllowExternalImg = true
+	rec = httptest.NewRecorder()
+	srv.e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/robots.txt", nil))
+	assert.Equal(t, "'self' data: https:", cspDirective(rec.Header().Get(echo.HeaderContentSecurityPolicy), "img-src"))
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// handleDescribe lists the API routes registered on the server and the
+// optional features enabled, so clients can detect what is available
+// rather than probe for it. Routes come from the router itself, so the
+// list cannot drift from what is actually served.
+//
+// Returns:
+//   - 200 OK with Description
+func (srv *Server) handleDescribe(c echo.Context) error {
+	return c.JSON(http.StatusOK, Description{
+		Routes: apiRoutes(srv.e.Routes()),
+		Features: RuntimeFeatures{
+			Portfolio: srv.enablePortfolio,
+			Live:      srv.enableLive,
+		},
+	})
+}
+
+// apiRoutes filters routes down to the /api group, sorted by path and
+// method. The catch-all not-found routes echo adds for group middleware
+// are not real endpoints and are left out.
+func apiRoutes(routes []*echo.Route) []RouteDescription {
+	described := []RouteDescription{}
+	seen := make(map[RouteDescription]bool)
+	for _, r := range routes {
+		if r.Method == echo.RouteNotFound || (r.Path != "/api" && !strings.HasPrefix(r.Path, "/api/")) {
+			continue
+		}
+		route := RouteDescription{Method: r.Method, Path: r.Path}
+		if !seen[route] {
+			seen[route] = true
+			described = append(described, route)
+		}
+	}
+	sort.Slice(described, func(i, j int) bool {
+		if described[i].Path != described[j].Path {
+			return described[i].Path < described[j].Path
+		}
+		return described[i].Method < described[j].Method
+	})
+	return described
+}
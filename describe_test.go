@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleDescribe(t *testing.T) {
+	srv, err := setupServer(":0", nil, nil, nil, nil, t.TempDir(), nil)
+	require.NoError(t, err)
+	srv.enableLive = true
+
+	rec := httptest.NewRecorder()
+	srv.e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/describe", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var desc Description
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &desc))
+	assert.Equal(t, RuntimeFeatures{Live: true}, desc.Features)
+
+	for _, route := range []RouteDescription{
+		{http.MethodGet, "/api/describe"},
+		{http.MethodGet, "/api/version"},
+		{http.MethodGet, "/api/profile/:handle"},
+		{http.MethodGet, "/api/feed/did/:did"},
+		{http.MethodGet, "/api/post/*"},
+		{http.MethodGet, "/api/portfolio"},
+	} {
+		assert.Contains(t, desc.Routes, route)
+	}
+
+	// Only real /api endpoints are listed
+	for _, route := range desc.Routes {
+		assert.Regexp(t, `^/api/`, route.Path)
+		assert.NotEqual(t, "/api/*", route.Path)
+		assert.NotEqual(t, "/healthz", route.Path)
+	}
+}
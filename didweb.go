@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// didDocumentTimeout bounds fetching a DID document from a URL
+const didDocumentTimeout = 10 * time.Second
+
+// didDocumentResolver resolves a fixed set of did:web identities from
+// operator-supplied DID documents (local files or URLs), for self-hosted
+// setups whose did:web documents aren't reachable the usual way.
+// Documents are loaded on first use and reloaded after a Purge of one of
+// their identities.
+type didDocumentResolver struct {
+	sources []string     // File paths or http(s) URLs of DID documents
+	client  *http.Client // Used for URL sources
+
+	loadMu sync.Mutex // Serializes loads, which are done without holding mu
+
+	mu       sync.Mutex
+	loaded   bool // Whether byDID and byHandle hold a successful load
+	stale    bool // Whether a purge asked for a reload
+	byDID    map[syntax.DID]*identity.Identity
+	byHandle map[syntax.Handle]*identity.Identity
+}
+
+// newDIDDocumentResolver creates a resolver for the given document sources
+func newDIDDocumentResolver(sources []string) *didDocumentResolver {
+	return &didDocumentResolver{
+		sources: sources,
+		client:  &http.Client{Timeout: didDocumentTimeout},
+	}
+}
+
+// readSource returns the raw DID document from a file path or URL
+func (r *didDocumentResolver) readSource(ctx context.Context, source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.ReadFile(source)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// load reads every configured document. Any failure fails the whole
+// load, leaving the caller to keep what it had.
+func (r *didDocumentResolver) load(ctx context.Context) (map[syntax.DID]*identity.Identity, map[syntax.Handle]*identity.Identity, error) {
+	byDID := make(map[syntax.DID]*identity.Identity, len(r.sources))
+	byHandle := make(map[syntax.Handle]*identity.Identity, len(r.sources))
+
+	for _, source := range r.sources {
+		raw, err := r.readSource(ctx, source)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read DID document %s: %w", source, err)
+		}
+
+		var doc identity.DIDDocument
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse DID document %s: %w", source, err)
+		}
+		if doc.DID.Method() != "web" {
+			return nil, nil, fmt.Errorf("DID document %s is for %s, only did:web is supported", source, doc.DID)
+		}
+
+		ident := identity.ParseIdentity(&doc)
+		// The operator vouches for these documents, so the declared handle is trusted
+		if handle, err := ident.DeclaredHandle(); err == nil {
+			ident.Handle = handle
+			byHandle[handle] = &ident
+		} else {
+			ident.Handle = syntax.HandleInvalid
+		}
+		byDID[ident.DID] = &ident
+	}
+
+	return byDID, byHandle, nil
+}
+
+// preload reads the documents now so misconfiguration is caught at startup
+func (r *didDocumentResolver) preload(ctx context.Context) error {
+	r.loadMu.Lock()
+	defer r.loadMu.Unlock()
+	byDID, byHandle, err := r.load(ctx)
+	if err != nil {
+		return err
+	}
+	r.store(byDID, byHandle)
+	return nil
+}
+
+// store makes a successful load current
+func (r *didDocumentResolver) store(byDID map[syntax.DID]*identity.Identity, byHandle map[syntax.Handle]*identity.Identity) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.byDID, r.byHandle = byDID, byHandle
+	r.loaded, r.stale = true, false
+}
+
+// current returns the loaded documents, or whether they must be (re)loaded
+func (r *didDocumentResolver) current() (map[syntax.DID]*identity.Identity, map[syntax.Handle]*identity.Identity, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.byDID, r.byHandle, r.loaded && !r.stale
+}
+
+// documents returns the loaded documents, loading them first if needed.
+// When a reload fails the last good documents are kept until the next
+// purge; only a failed first load is an error.
+func (r *didDocumentResolver) documents(ctx context.Context) (map[syntax.DID]*identity.Identity, map[syntax.Handle]*identity.Identity, error) {
+	if byDID, byHandle, ok := r.current(); ok {
+		return byDID, byHandle, nil
+	}
+
+	r.loadMu.Lock()
+	defer r.loadMu.Unlock()
+	// Another caller may have loaded them while we waited
+	if byDID, byHandle, ok := r.current(); ok {
+		return byDID, byHandle, nil
+	}
+
+	byDID, byHandle, err := r.load(ctx)
+	if err == nil {
+		r.store(byDID, byHandle)
+		return byDID, byHandle, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.loaded {
+		return nil, nil, err
+	}
+	slog.Warn("failed to reload DID documents, keeping the previous ones", "error", err)
+	r.stale = false
+	return r.byDID, r.byHandle, nil
+}
+
+// lookupDID returns the configured identity for did, or nil if the DID
+// is not one of the configured documents.
+func (r *didDocumentResolver) lookupDID(ctx context.Context, did syntax.DID) (*identity.Identity, error) {
+	byDID, _, err := r.documents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return byDID[did], nil
+}
+
+// lookupHandle returns the configured identity declaring handle, or nil
+// if no configured document declares it.
+func (r *didDocumentResolver) lookupHandle(ctx context.Context, handle syntax.Handle) (*identity.Identity, error) {
+	_, byHandle, err := r.documents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return byHandle[handle.Normalize()], nil
+}
+
+// purge marks the documents for re-reading on next use if id is one of
+// the configured identities; purges of any other identity leave them be.
+func (r *didDocumentResolver) purge(id syntax.AtIdentifier) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.loaded {
+		return // Read on next use anyway
+	}
+	if did, err := id.AsDID(); err == nil {
+		r.stale = r.stale || r.byDID[did] != nil
+	} else if handle, err := id.AsHandle(); err == nil {
+		r.stale = r.stale || r.byHandle[handle.Normalize()] != nil
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const aliceDIDDocument = `{
+	"@context": ["https://www.w3.org/ns/did/v1"],
+	"id": "did:web:alice.example",
+	"alsoKnownAs": ["at://alice.example"],
+	"service": [{"id": "#atproto_pds", "type": "AtprotoPersonalDataServer", "serviceEndpoint": "https://pds.alice.example"}]
+}`
+
+func TestDefaultDirectory_DIDDocuments(t *testing.T) {
+	docPath := filepath.Join(t.TempDir(), "did.json")
+	require.NoError(t, os.WriteFile(docPath, []byte(aliceDIDDocument), 0o644))
+
+	var fetches atomic.Int32
+	var failing atomic.Bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"id": "did:web:bob.example", "alsoKnownAs": ["at://bob.example"]}`))
+	}))
+	defer ts.Close()
+
+	fallback := identity.NewMockDirectory()
+	fallback.Insert(identity.Identity{DID: syntax.DID("did:plc:carol"), Handle: syntax.Handle("carol.test")})
+
+	dir := &defaultDirectory{
+		dir:    &fallback,
+		static: newDIDDocumentResolver([]string{docPath, ts.URL + "/.well-known/did.json"}),
+	}
+	ctx := context.Background()
+
+	// Configured documents resolve by DID and by declared handle
+	ident, err := dir.LookupDID(ctx, syntax.DID("did:web:alice.example"))
+	require.NoError(t, err)
+	assert.Equal(t, "alice.example", ident.Handle.String())
+	assert.Equal(t, "https://pds.alice.example", ident.PDSEndpoint())
+
+	ident, err = dir.LookupHandle(ctx, syntax.Handle("bob.example"))
+	require.NoError(t, err)
+	assert.Equal(t, "did:web:bob.example", ident.DID.String())
+
+	ident, err = dir.Lookup(ctx, syntax.Handle("alice.example").AtIdentifier())
+	require.NoError(t, err)
+	assert.Equal(t, "did:web:alice.example", ident.DID.String())
+
+	// Everything else falls through to the wrapped directory
+	ident, err = dir.LookupHandle(ctx, syntax.Handle("carol.test"))
+	require.NoError(t, err)
+	assert.Equal(t, "did:plc:carol", ident.DID.String())
+
+	_, err = dir.LookupDID(ctx, syntax.DID("did:web:unknown.example"))
+	assert.ErrorIs(t, err, identity.ErrDIDNotFound)
+
+	// Documents are cached until one of them is purged
+	assert.Equal(t, int32(1), fetches.Load())
+	require.NoError(t, dir.Purge(ctx, syntax.DID("did:plc:carol").AtIdentifier()))
+	require.NoError(t, dir.Purge(ctx, syntax.Handle("carol.test").AtIdentifier()))
+	_, err = dir.LookupDID(ctx, syntax.DID("did:web:bob.example"))
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), fetches.Load())
+
+	require.NoError(t, dir.Purge(ctx, syntax.DID("did:web:bob.example").AtIdentifier()))
+	_, err = dir.LookupDID(ctx, syntax.DID("did:web:bob.example"))
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), fetches.Load())
+
+	// A failed reload keeps serving the last good documents
+	failing.Store(true)
+	require.NoError(t, dir.Purge(ctx, syntax.Handle("Bob.Example").AtIdentifier()))
+	ident, err = dir.LookupHandle(ctx, syntax.Handle("bob.example"))
+	require.NoError(t, err)
+	assert.Equal(t, "did:web:bob.example", ident.DID.String())
+	ident, err = dir.LookupDID(ctx, syntax.DID("did:web:alice.example"))
+	require.NoError(t, err)
+	assert.Equal(t, "alice.example", ident.Handle.String())
+	assert.Equal(t, int32(3), fetches.Load())
+}
+
+func TestDIDDocumentResolver_RejectsNonWeb(t *testing.T) {
+	docPath := filepath.Join(t.TempDir(), "did.json")
+	require.NoError(t, os.WriteFile(docPath, []byte(`{"id": "did:plc:abc123"}`), 0o644))
+
+	err := newDIDDocumentResolver([]string{docPath}).preload(context.Background())
+	assert.ErrorContains(t, err, "only did:web")
+
+	err = newDIDDocumentResolver([]string{filepath.Join(t.TempDir(), "missing.json")}).preload(context.Background())
+	assert.Error(t, err)
+}
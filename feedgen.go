@@ -0,0 +1,144 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/labstack/echo/v4"
+)
+
+// feedGeneratorCollection is the NSID of feed generator records
+const feedGeneratorCollection = "app.bsky.feed.generator"
+
+// handleGetActorFeeds handles requests for the custom feed generators
+// a user has published. The handle is checked against the allowed list.
+//
+// URL Parameters:
+//   - handle: Optional handle parameter (falls back to hostname)
+//
+// Query Parameters:
+//   - cursor: Pagination cursor for fetching more feeds
+//   - limit: Page size (default 50, max 100)
+//
+// Returns:
+//   - 200 OK with the feed generators
+//   - 400 Bad Request if handle, cursor or limit is invalid
+//   - 403 Forbidden if handle is not allowed
+//   - 500 Internal Server Error if the fetch fails
+func (srv *Server) handleGetActorFeeds(c echo.Context) error {
+	did, err := srv.validateAndGetDID(c, getActorFromRequest(c))
+	if err != nil {
+		return err
+	}
+
+	limit, err := getLimitFromRequest(c, defaultListLimit, maxListLimit)
+	if err != nil {
+		return err
+	}
+	cursor, err := getCursorFromRequest(c)
+	if err != nil {
+		return err
+	}
+
+	// Ensure we have a valid token before making the API request
+	if err := srv.ensureValidToken(c); err != nil {
+		slog.Error("failed to ensure valid token", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Authentication error: "+err.Error())
+	}
+
+	out, err := bsky.FeedGetActorFeeds(c.Request().Context(), srv.readClient(), did, cursor, limit)
+	if err != nil {
+		slog.Error("failed to fetch actor feeds", "error", err)
+		return upstreamError(c, err)
+	}
+
+	feeds := []FeedGenerator{}
+	for _, gen := range out.Feeds {
+		if gen == nil {
+			continue
+		}
+		feeds = append(feeds, FeedGenerator{
+			URI:         gen.Uri,
+			DisplayName: gen.DisplayName,
+			Description: gen.Description,
+			Avatar:      gen.Avatar,
+			LikeCount:   gen.LikeCount,
+		})
+	}
+
+	response := map[string]interface{}{
+		"cursor": out.Cursor,
+		"feeds":  feeds,
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// handleGetFeedGenerator handles requests for the posts served by a
+// custom feed generator, hydrated by the AppView.
+//
+// URL Parameters:
+//   - *: The AT-URI of the feed generator record (with or without at:// prefix)
+//
+// Query Parameters:
+//   - cursor: Pagination cursor for fetching more posts
+//   - limit: Page size (defaults to FeedDefaultLimit, clamped to FeedMaxLimit)
+//
+// Returns:
+//   - 200 OK with the feed posts
+//   - 400 Bad Request if URI or cursor is invalid, or not a feed generator
+//   - 404 Not Found if the feed generator does not exist
+//   - 500 Internal Server Error if the fetch fails
+func (srv *Server) handleGetFeedGenerator(c echo.Context) error {
+	atUri, err := getATURIFromRequest(c)
+	if err != nil {
+		return err
+	}
+	if atUri.Collection().String() != feedGeneratorCollection {
+		return echo.NewHTTPError(http.StatusBadRequest, "uri is not a feed generator")
+	}
+
+	limit, err := srv.getFeedLimitFromRequest(c)
+	if err != nil {
+		return err
+	}
+	cursor, err := getCursorFromRequest(c)
+	if err != nil {
+		return err
+	}
+
+	// Ensure we have a valid token before making the API request
+	if err := srv.ensureValidToken(c); err != nil {
+		slog.Error("failed to ensure valid token", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Authentication error: "+err.Error())
+	}
+
+	// Optionally have the upstream route the call to a specific service
+	ctx := c.Request().Context()
+	if srv.feedProxy != "" {
+		ctx = withAtprotoProxy(ctx, srv.feedProxy)
+	}
+
+	out, err := bsky.FeedGetFeed(ctx, srv.readClient(), cursor, atUri.String(), limit)
+	if err != nil {
+		if isNotFoundError(err) {
+			return echo.NewHTTPError(http.StatusNotFound, "feed generator not found")
+		}
+		slog.Error("failed to fetch feed generator", "error", err)
+		return upstreamError(c, err)
+	}
+
+	feed := out.Feed
+	if feed == nil {
+		feed = []*bsky.FeedDefs_FeedViewPost{}
+	}
+
+	response := map[string]interface{}{
+		"cursor":  out.Cursor,
+		"hasMore": hasMore(out.Cursor),
+		"feed":    feed,
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
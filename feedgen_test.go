@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleGetActorFeeds(t *testing.T) {
+	dir := identity.NewMockDirectory()
+	dir.Insert(identity.Identity{DID: syntax.DID("did:plc:alice"), Handle: syntax.Handle("alice.test")})
+
+	stub := newStubTransport().on("app.bsky.feed.getActorFeeds", http.StatusOK, `{
+		"cursor": "feeds-next",
+		"feeds": [{
+			"uri": "at://did:plc:alice/app.bsky.feed.generator/cats",
+			"cid": "bafycats",
+			"did": "did:web:feeds.alice.test",
+			"creator": {"did": "did:plc:alice", "handle": "alice.test"},
+			"displayName": "Cats",
+			"description": "Only cats",
+			"avatar": "https://cdn.test/cats.jpg",
+			"likeCount": 42,
+			"indexedAt": "2024-01-01T00:00:00Z"
+		}]
+	}`)
+	srv := newStubServer(stub)
+	srv.dir = &dir
+
+	rec, err := serveParam(srv, srv.handleGetActorFeeds, "handle", "alice.test", "cursor=feeds-1&limit=10")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req := stub.lastRequest("app.bsky.feed.getActorFeeds")
+	require.NotNil(t, req)
+	assert.Equal(t, "did:plc:alice", req.URL.Query().Get("actor"))
+	assert.Equal(t, "feeds-1", req.URL.Query().Get("cursor"))
+	assert.Equal(t, "10", req.URL.Query().Get("limit"))
+
+	assert.JSONEq(t, `{
+		"cursor": "feeds-next",
+		"feeds": [{
+			"uri": "at://did:plc:alice/app.bsky.feed.generator/cats",
+			"displayName": "Cats",
+			"description": "Only cats",
+			"avatar": "https://cdn.test/cats.jpg",
+			"likeCount": 42
+		}]
+	}`, rec.Body.String())
+
+	// The allowed-handle list applies to the listing
+	srv.validHandles = []string{"bob.test"}
+	_, err = serveParam(srv, srv.handleGetActorFeeds, "handle", "alice.test", "")
+	assert.Equal(t, http.StatusForbidden, httpStatus(t, err))
+}
+
+func TestHandleGetFeedGenerator(t *testing.T) {
+	const feedURI = "at://did:plc:alice/app.bsky.feed.generator/cats"
+
+	stub := newStubTransport().on("app.bsky.feed.getFeed", http.StatusOK, `{
+		"cursor": "posts-next",
+		"feed": [{"post": {
+			"uri": "at://did:plc:bob/app.bsky.feed.post/1",
+			"cid": "bafy1",
+			"author": {"did": "did:plc:bob", "handle": "bob.test"},
+			"record": {"$type": "app.bsky.feed.post", "text": "meow", "createdAt": "2024-01-01T00:00:00Z"},
+			"indexedAt": "2024-01-01T00:00:00Z"
+		}}]
+	}`)
+	srv := newStubServer(stub)
+
+	rec, err := serveWildcard(srv, srv.handleGetFeedGenerator, "did:plc:alice/app.bsky.feed.generator/cats", "cursor=posts-1")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req := stub.lastRequest("app.bsky.feed.getFeed")
+	require.NotNil(t, req)
+	assert.Equal(t, feedURI, req.URL.Query().Get("feed"))
+	assert.Equal(t, "posts-1", req.URL.Query().Get("cursor"))
+	assert.Contains(t, rec.Body.String(), `"cursor":"posts-next"`)
+	assert.Contains(t, rec.Body.String(), `"text":"meow"`)
+
+	// Only feed generator records are accepted
+	_, err = serveWildcard(srv, srv.handleGetFeedGenerator, "did:plc:alice/app.bsky.feed.post/1", "")
+	assert.Equal(t, http.StatusBadRequest, httpStatus(t, err))
+
+	stub.on("app.bsky.feed.getFeed", http.StatusNotFound, `{"error": "NotFound", "message": "unknown feed"}`)
+	_, err = serveWildcard(srv, srv.handleGetFeedGenerator, feedURI, "")
+	assert.Equal(t, http.StatusNotFound, httpStatus(t, err))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/labstack/echo/v4"
+)
+
+// Feed response formats (?format=)
+const (
+	feedFormatJSON = "json"
+	feedFormatHTML = "html"
+)
+
+// feedHTMLTemplate renders a feed as a minimal HTML fragment for embedding
+// where JavaScript is not available, e.g. email previews. html/template
+// escapes every value for the context it appears in.
+var feedHTMLTemplate = template.Must(template.New("feed").Parse(`<div class="athome-feed">
+{{- range .}}
+<article class="athome-post" data-post="{{.URI}}">
+<header><span class="athome-author">{{.DisplayName}}</span> <span class="athome-handle">@{{.Handle}}</span></header>
+<p>{{.Text}}</p>
+<footer><time datetime="{{.CreatedAt}}">{{.CreatedAt}}</time></footer>
+</article>
+{{- end}}
+</div>
+`))
+
+// feedHTMLPost is the view of one post rendered by feedHTMLTemplate
+type feedHTMLPost struct {
+	URI         string
+	DisplayName string
+	Handle      string
+	Text        string
+	CreatedAt   string
+}
+
+// getFeedFormatFromRequest picks the feed response format from the
+// "format" query parameter, falling back to the Accept header. HTML is
+// only chosen from the header when the client prefers it over JSON, so
+// clients sending "*/*" keep getting JSON.
+//
+// Returns:
+//   - feedFormatJSON or feedFormatHTML
+//   - error (400) if the format parameter is unknown
+func getFeedFormatFromRequest(c echo.Context) (string, error) {
+	switch format := c.QueryParam("format"); format {
+	case feedFormatJSON, feedFormatHTML:
+		return format, nil
+	case "":
+	default:
+		return "", echo.NewHTTPError(http.StatusBadRequest, "invalid format: expected json or html")
+	}
+
+	// The first recognised media type wins; q-values are not weighed
+	for _, part := range strings.Split(c.Request().Header.Get(echo.HeaderAccept), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case echo.MIMETextHTML:
+			return feedFormatHTML, nil
+		case echo.MIMEApplicationJSON:
+			return feedFormatJSON, nil
+		}
+	}
+	return feedFormatJSON, nil
+}
+
+// writeFeedHTML renders the feed as an HTML fragment. The cursor is passed
+// in the X-Cursor header since the fragment has nowhere to carry it.
+func writeFeedHTML(c echo.Context, cursor *string, feed []*bsky.FeedDefs_FeedViewPost) error {
+	posts := make([]feedHTMLPost, 0, len(feed))
+	for _, item := range feed {
+		post := item.Post
+		view := feedHTMLPost{
+			URI:       post.Uri,
+			Handle:    post.Author.Handle,
+			CreatedAt: post.IndexedAt,
+		}
+		if post.Author.DisplayName != nil && *post.Author.DisplayName != "" {
+			view.DisplayName = *post.Author.DisplayName
+		} else {
+			view.DisplayName = post.Author.Handle
+		}
+		if post.Record != nil {
+			if record, ok := post.Record.Val.(*bsky.FeedPost); ok {
+				view.Text = record.Text
+				view.CreatedAt = record.CreatedAt
+			}
+		}
+		posts = append(posts, view)
+	}
+
+	var buf bytes.Buffer
+	if err := feedHTMLTemplate.Execute(&buf, posts); err != nil {
+		slog.Error("failed to render feed HTML", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to render feed")
+	}
+
+	if cursor != nil && *cursor != "" {
+		c.Response().Header().Set("X-Cursor", *cursor)
+	}
+	return c.HTMLBlob(http.StatusOK, buf.Bytes())
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const feedHTMLStubResponse = `{"cursor": "next-page", "feed": [{"post": {
+	"uri": "at://did:plc:abc123/app.bsky.feed.post/1",
+	"cid": "bafy1",
+	"author": {"did": "did:plc:abc123", "handle": "alice.test", "displayName": "Alice <3"},
+	"record": {"$type": "app.bsky.feed.post", "text": "<script>alert(1)</script> & \"friends\"", "createdAt": "2024-01-02T03:04:05Z"},
+	"indexedAt": "2024-01-02T03:04:06Z"
+}}]}`
+
+func TestHandleGetFeed_HTMLFormat(t *testing.T) {
+	srv := newStubServer(newStubTransport().on("app.bsky.feed.getAuthorFeed", http.StatusOK, feedHTMLStubResponse))
+
+	serve := func(query, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+		c := srv.e.NewContext(req, rec)
+		c.SetParamNames("did")
+		c.SetParamValues("did:plc:abc123")
+		require.NoError(t, srv.handleGetFeed(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Header().Values("Vary"), "Accept")
+		return rec
+	}
+
+	// JSON stays the default, also for clients accepting anything
+	for _, accept := range []string{"", "*/*", "application/json, text/html"} {
+		rec := serve("", accept)
+		assert.Contains(t, rec.Header().Get("Content-Type"), "application/json", accept)
+		assert.Contains(t, rec.Body.String(), `"cursor":"next-page"`, accept)
+	}
+	rec := serve("format=json", "text/html")
+	assert.Contains(t, rec.Header().Get("Content-Type"), "application/json")
+
+	// HTML by parameter or by Accept header
+	for _, tc := range []struct{ query, accept string }{
+		{"format=html", ""},
+		{"", "text/html,application/xhtml+xml,*/*;q=0.8"},
+	} {
+		rec := serve(tc.query, tc.accept)
+		assert.Contains(t, rec.Header().Get("Content-Type"), "text/html")
+		assert.Equal(t, "next-page", rec.Header().Get("X-Cursor"))
+
+		body := rec.Body.String()
+		assert.Contains(t, body, `<article class="athome-post" data-post="at://did:plc:abc123/app.bsky.feed.post/1">`)
+		assert.Contains(t, body, "Alice &lt;3")
+		assert.Contains(t, body, "@alice.test")
+		assert.Contains(t, body, `<time datetime="2024-01-02T03:04:05Z">2024-01-02T03:04:05Z</time>`)
+	}
+}
+
+func TestHandleGetFeed_HTMLEscapesPostText(t *testing.T) {
+	srv := newStubServer(newStubTransport().on("app.bsky.feed.getAuthorFeed", http.StatusOK, feedHTMLStubResponse))
+
+	rec, err := serveParam(srv, srv.handleGetFeed, "did", "did:plc:abc123", "format=html")
+	require.NoError(t, err)
+
+	body := rec.Body.String()
+	assert.NotContains(t, body, "<script>")
+	assert.Contains(t, body, "&lt;script&gt;alert(1)&lt;/script&gt; &amp; &#34;friends&#34;")
+}
+
+func TestHandleGetFeed_InvalidFormat(t *testing.T) {
+	srv := newStubServer(newStubTransport().on("app.bsky.feed.getAuthorFeed", http.StatusOK, feedHTMLStubResponse))
+
+	_, err := serveParam(srv, srv.handleGetFeed, "did", "did:plc:abc123", "format=xml")
+	assert.Equal(t, http.StatusBadRequest, httpStatus(t, err))
+}
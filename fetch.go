@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/xrpc"
+)
+
+// ProfileFetcher fetches hydrated profiles from upstream. Handlers go
+// through it, and through FeedFetcher, rather than the bsky package so
+// tests can inject fakes and exercise the transform and filter logic
+// without an HTTP mock.
+type ProfileFetcher interface {
+	GetProfile(ctx context.Context, did string) (*ProfileView, error)
+}
+
+// FeedFetcher fetches pages of an actor's feed from upstream. filter is
+// an app.bsky.feed.getAuthorFeed filter such as "posts_no_replies".
+type FeedFetcher interface {
+	GetAuthorFeed(ctx context.Context, did, cursor, filter string, limit int64) (*bsky.FeedGetAuthorFeed_Output, error)
+}
+
+// xrpcFetcher implements ProfileFetcher and FeedFetcher over XRPC. The
+// client is looked up per call, so reads follow readClient into degraded
+// mode and back.
+type xrpcFetcher struct {
+	client func() *xrpc.Client
+}
+
+// GetProfile implements ProfileFetcher. It is called directly rather than
+// through bsky.ActorGetProfile, whose output type would drop the
+// verification state.
+func (f xrpcFetcher) GetProfile(ctx context.Context, did string) (*ProfileView, error) {
+	profile := &ProfileView{}
+	params := map[string]interface{}{"actor": did}
+	if err := f.client().Do(ctx, xrpc.Query, "", "app.bsky.actor.getProfile", params, nil, profile); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// GetAuthorFeed implements FeedFetcher
+func (f xrpcFetcher) GetAuthorFeed(ctx context.Context, did, cursor, filter string, limit int64) (*bsky.FeedGetAuthorFeed_Output, error) {
+	return bsky.FeedGetAuthorFeed(ctx, f.client(), did, cursor, filter, false, limit)
+}
+
+// profileFetcher returns the injected ProfileFetcher, or the XRPC one
+func (srv *Server) profileFetcher() ProfileFetcher {
+	if srv.profileSource != nil {
+		return srv.profileSource
+	}
+	return xrpcFetcher{client: srv.readClient}
+}
+
+// feedFetcher returns the injected FeedFetcher, or the XRPC one
+func (srv *Server) feedFetcher() FeedFetcher {
+	if srv.feedSource != nil {
+		return srv.feedSource
+	}
+	return xrpcFetcher{client: srv.readClient}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeFeedFetcher serves canned author feed pages keyed by cursor and
+// records the calls made to it
+type fakeFeedFetcher struct {
+	mu    sync.Mutex
+	pages map[string]*bsky.FeedGetAuthorFeed_Output
+	calls []string // "cursor|filter|limit" of each call
+}
+
+func (f *fakeFeedFetcher) GetAuthorFeed(ctx context.Context, did, cursor, filter string, limit int64) (*bsky.FeedGetAuthorFeed_Output, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, fmt.Sprintf("%s|%s|%d", cursor, filter, limit))
+	page, ok := f.pages[cursor]
+	if !ok {
+		return nil, fmt.Errorf("unexpected cursor %q", cursor)
+	}
+	return page, nil
+}
+
+// fakeProfileFetcher serves a canned profile and counts the calls made to it
+type fakeProfileFetcher struct {
+	profile *ProfileView
+	calls   int
+}
+
+func (f *fakeProfileFetcher) GetProfile(ctx context.Context, did string) (*ProfileView, error) {
+	f.calls++
+	return f.profile, nil
+}
+
+// feedPost builds a feed entry for a post by author written in langs
+func feedPost(author, text string, langs ...string) *bsky.FeedDefs_FeedViewPost {
+	return &bsky.FeedDefs_FeedViewPost{Post: &bsky.FeedDefs_PostView{
+		Uri:    "at://" + author + "/app.bsky.feed.post/" + text,
+		Author: &bsky.ActorDefs_ProfileViewBasic{Did: author},
+		Record: &lexutil.LexiconTypeDecoder{Val: &bsky.FeedPost{Text: text, Langs: langs}},
+	}}
+}
+
+// postTexts returns the texts of the posts in a feed page
+func postTexts(feed []*bsky.FeedDefs_FeedViewPost) []string {
+	texts := []string{}
+	for _, item := range feed {
+		texts = append(texts, item.Post.Record.Val.(*bsky.FeedPost).Text)
+	}
+	return texts
+}
+
+func TestFetchAuthorFeed_FakeFetcher(t *testing.T) {
+	p2, end := "p2", ""
+	fetcher := &fakeFeedFetcher{pages: map[string]*bsky.FeedGetAuthorFeed_Output{
+		"": {Cursor: &p2, Feed: []*bsky.FeedDefs_FeedViewPost{
+			feedPost("did:plc:alice", "first", "en"),
+			feedPost("did:plc:bob", "reposted", "en"),
+			nil,
+			{Post: &bsky.FeedDefs_PostView{}},
+		}},
+		"p2": {Cursor: &end, Feed: []*bsky.FeedDefs_FeedViewPost{
+			feedPost("did:plc:alice", "segundo", "es"),
+			feedPost("did:plc:alice", "third", "en-US"),
+		}},
+	}}
+	srv := &Server{feedSource: fetcher, FeedMaxFetches: defaultFeedMaxFetches}
+
+	// Other authors and malformed entries are dropped, and the short first
+	// page is topped up from the next one
+	page, err := srv.fetchAuthorFeed(context.Background(), "did:plc:alice", "", 2, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first", "segundo", "third"}, postTexts(page.Feed))
+	assert.Equal(t, &end, page.Cursor)
+	assert.Equal(t, []string{"|posts_no_replies|2", "p2|posts_no_replies|2"}, fetcher.calls)
+
+	// The language filter applies after the author filter
+	page, err = srv.fetchAuthorFeed(context.Background(), "did:plc:alice", "", 5, []string{"en"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first", "third"}, postTexts(page.Feed))
+
+	// A filled first page needs no second fetch
+	fetcher.calls = nil
+	page, err = srv.fetchAuthorFeed(context.Background(), "did:plc:alice", "", 1, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first"}, postTexts(page.Feed))
+	assert.Equal(t, &p2, page.Cursor)
+	assert.Len(t, fetcher.calls, 1)
+
+	// The fetch cap stops paging early
+	fetcher.calls = nil
+	srv.FeedMaxFetches = 1
+	page, err = srv.fetchAuthorFeed(context.Background(), "did:plc:alice", "", 5, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first"}, postTexts(page.Feed))
+	assert.Len(t, fetcher.calls, 1)
+}
+
+func TestGetProfile_FakeFetcher(t *testing.T) {
+	fetcher := &fakeProfileFetcher{profile: &ProfileView{ActorDefs_ProfileViewDetailed: bsky.ActorDefs_ProfileViewDetailed{Did: "did:plc:alice", Handle: "alice.test"}}}
+	srv := &Server{profileSource: fetcher, profiles: newTTLCache[*ProfileView](defaultProfileCacheTTL, defaultProfileCacheMaxEntries)}
+
+	for i := 0; i < 2; i++ {
+		profile, err := srv.getProfile(context.Background(), "did:plc:alice")
+		require.NoError(t, err)
+		assert.Equal(t, "alice.test", profile.Handle)
+	}
+	assert.Equal(t, 1, fetcher.calls, "the second read must come from the cache")
+}
+
+func TestFeedFetcher_DefaultsToXRPC(t *testing.T) {
+	stub := newStubTransport().on("app.bsky.feed.getAuthorFeed", http.StatusOK, `{"feed": []}`)
+	srv := newStubServer(stub)
+
+	_, err := srv.feedFetcher().GetAuthorFeed(context.Background(), "did:plc:alice", "c1", "posts_with_media", 7)
+	require.NoError(t, err)
+	query := stub.lastRequest("app.bsky.feed.getAuthorFeed").URL.Query()
+	assert.Equal(t, "did:plc:alice", query.Get("actor"))
+	assert.Equal(t, "c1", query.Get("cursor"))
+	assert.Equal(t, "posts_with_media", query.Get("filter"))
+	assert.Equal(t, "7", query.Get("limit"))
+}
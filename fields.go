@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// profileFields are the keys of a profile response selectable via ?fields=
+var profileFields = []string{
+	"did", "handle", "displayName", "description", "avatar", "banner",
+	"followsCount", "followersCount", "postsCount", "indexedAt", "viewer",
+	"verification",
+}
+
+// postFields are the keys of each feed post selectable via ?fields=
+var postFields = []string{
+	"uri", "cid", "author", "record", "embed", "labels", "threadgate", "viewer",
+	"replyCount", "repostCount", "likeCount", "quoteCount", "indexedAt",
+	"relativeTime", "localTime",
+}
+
+// getFieldsFromRequest parses the optional comma-separated "fields" query
+// parameter against the known keys. Unknown names are ignored unless the
+// server is configured for strict projection.
+//
+// Returns:
+//   - The selected keys, or nil when every field should be returned
+//   - error (400) for unknown fields in strict mode
+func (srv *Server) getFieldsFromRequest(c echo.Context, known []string) (map[string]bool, error) {
+	raw := c.QueryParam("fields")
+	if raw == "" {
+		return nil, nil
+	}
+
+	selected := make(map[string]bool)
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !containsString(known, name) {
+			if srv.strictFields {
+				return nil, echo.NewHTTPError(http.StatusBadRequest, "unknown field: "+name)
+			}
+			continue
+		}
+		selected[name] = true
+	}
+
+	// Nothing usable requested means the full response
+	if len(selected) == 0 {
+		return nil, nil
+	}
+	return selected, nil
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// projectFields keeps only the selected keys of m. A nil selection
+// returns m unchanged.
+func projectFields(m map[string]interface{}, fields map[string]bool) map[string]interface{} {
+	if fields == nil {
+		return m
+	}
+	projected := make(map[string]interface{}, len(fields))
+	for k, v := range m {
+		if fields[k] {
+			projected[k] = v
+		}
+	}
+	return projected
+}
+
+// projectFeedPosts applies a post field selection to every feed item,
+// leaving the reply and reason context intact.
+func projectFeedPosts(feed []*timedFeedViewPost, fields map[string]bool) ([]interface{}, error) {
+	items := make([]interface{}, 0, len(feed))
+	for _, item := range feed {
+		if item == nil {
+			continue
+		}
+		raw, err := json.Marshal(item.Post)
+		if err != nil {
+			return nil, err
+		}
+		var post map[string]interface{}
+		if err := json.Unmarshal(raw, &post); err != nil {
+			return nil, err
+		}
+
+		projected := map[string]interface{}{"post": projectFields(post, fields)}
+		if item.Reply != nil {
+			projected["reply"] = item.Reply
+		}
+		if item.Reason != nil {
+			projected["reason"] = item.Reason
+		}
+		items = append(items, projected)
+	}
+	return items, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleGetProfile_Fields(t *testing.T) {
+	stub := newStubTransport().on("app.bsky.actor.getProfile", http.StatusOK, `{
+		"did": "did:plc:abc123",
+		"handle": "alice.test",
+		"displayName": "Alice",
+		"avatar": "https://cdn.test/alice.jpg",
+		"followersCount": 10
+	}`)
+	srv := newStubServer(stub)
+
+	keys := func(query string) []string {
+		t.Helper()
+		rec, err := serveParam(srv, srv.handleGetProfile, "did", "did:plc:abc123", query)
+		require.NoError(t, err)
+		var body map[string]json.RawMessage
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		var names []string
+		for k := range body {
+			names = append(names, k)
+		}
+		return names
+	}
+
+	all := keys("")
+	assert.Contains(t, all, "displayName")
+	assert.Contains(t, all, "followersCount")
+
+	// Empty projections return everything
+	assert.ElementsMatch(t, all, keys("fields="))
+	assert.ElementsMatch(t, all, keys("fields=bogus"))
+
+	assert.ElementsMatch(t, []string{"did", "handle", "avatar"}, keys("fields=did,handle,avatar"))
+	assert.ElementsMatch(t, []string{"did", "handle"}, keys("fields=did,%20handle,bogus"))
+
+	// Strict mode rejects unknown names
+	srv.strictFields = true
+	_, err := serveParam(srv, srv.handleGetProfile, "did", "did:plc:abc123", "fields=did,bogus")
+	assert.Equal(t, http.StatusBadRequest, httpStatus(t, err))
+	assert.ElementsMatch(t, []string{"did"}, keys("fields=did"))
+}
+
+func TestHandleGetFeed_Fields(t *testing.T) {
+	stub := newStubTransport().on("app.bsky.feed.getAuthorFeed", http.StatusOK, `{
+		"cursor": "next",
+		"feed": [{
+			"post": {
+				"uri": "at://did:plc:abc123/app.bsky.feed.post/1",
+				"cid": "bafy1",
+				"author": {"did": "did:plc:abc123", "handle": "alice.test"},
+				"record": {"$type": "app.bsky.feed.post", "text": "hi", "createdAt": "2024-01-01T00:00:00Z"},
+				"likeCount": 3,
+				"indexedAt": "2024-01-01T00:00:00Z"
+			}
+		}]
+	}`)
+	srv := newStubServer(stub)
+
+	rec, err := serveParam(srv, srv.handleGetFeed, "did", "did:plc:abc123", "fields=uri,likeCount")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"cursor": "next",
+		"feed": [{"post": {"uri": "at://did:plc:abc123/app.bsky.feed.post/1", "likeCount": 3}}],
+		"hasMore": true
+	}`, rec.Body.String())
+
+	// Without a projection the full post is returned
+	rec, err = serveParam(srv, srv.handleGetFeed, "did", "did:plc:abc123", "")
+	require.NoError(t, err)
+	assert.Contains(t, rec.Body.String(), `"text":"hi"`)
+}
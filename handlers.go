@@ -1,28 +1,96 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math"
+	"net"
 	"net/http"
-	"os"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/identity"
 	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/xrpc"
 	"github.com/labstack/echo/v4"
 )
 
+const (
+	// defaultListLimit is the page size used by list endpoints when no limit is given
+	defaultListLimit = 50
+	// maxListLimit is the largest page size accepted by the upstream list lexicons
+	maxListLimit = 100
+
+	// defaultFeedLimit is the default page size for feed endpoints (ATHOME_FEED_DEFAULT_LIMIT)
+	defaultFeedLimit = 20
+	// defaultFeedMaxLimit is the default cap on feed page sizes (ATHOME_FEED_MAX_LIMIT)
+	defaultFeedMaxLimit = 100
+	// defaultFeedMaxFetches is the default cap on upstream pages read to fill one feed page (ATHOME_FEED_MAX_FETCHES)
+	defaultFeedMaxFetches = 5
+)
+
+// errExplicitHandle is returned when a request names no handle and the
+// hostname cannot stand in for one
+var errExplicitHandle = echo.NewHTTPError(http.StatusBadRequest, "this deployment requires an explicit handle")
+
+// Health check detail levels (ATHOME_HEALTH_DETAIL), deciding who sees
+// the daemon name and build information.
+const (
+	healthDetailPublic  = "public"  // Everyone
+	healthDetailMinimal = "minimal" // Nobody; only the status is returned
+	healthDetailSecret  = "secret"  // Callers sending ATHOME_HEALTH_SECRET in healthSecretHeader
+)
+
+// healthSecretHeader carries the secret unlocking the detailed health status
+const healthSecretHeader = "X-Health-Secret"
+
 // HandleHealthCheck responds to health check requests with a simple status message.
 // This endpoint is used by monitoring systems to verify the service is running.
+// Depending on healthDetail, the daemon name and build are left out so
+// unauthenticated callers can't fingerprint the deployment.
 //
 // Returns:
 //   - 200 OK with GenericStatus if the service is healthy
 func (srv *Server) HandleHealthCheck(c echo.Context) error {
-	return c.JSON(200, GenericStatus{Status: "ok", Daemon: "athome"})
+	if !srv.healthDetailAllowed(c) {
+		return c.JSON(200, GenericStatus{Status: "ok"})
+	}
+	return c.JSON(200, GenericStatus{Status: "ok", Daemon: "athome", Build: srv.buildInfo()})
+}
+
+// healthDetailAllowed reports whether the caller may see the detailed
+// health status.
+func (srv *Server) healthDetailAllowed(c echo.Context) bool {
+	switch srv.healthDetail {
+	case healthDetailMinimal:
+		return false
+	case healthDetailSecret:
+		given := c.Request().Header.Get(healthSecretHeader)
+		return srv.healthSecret != "" && subtle.ConstantTimeCompare([]byte(given), []byte(srv.healthSecret)) == 1
+	default:
+		return true
+	}
+}
+
+// normalizeHandle puts a handle in canonical form: lowercase, without the
+// trailing dot of a fully qualified domain name. Handles are domain names,
+// so "Alice.bsky.social." and "alice.bsky.social" are the same handle.
+func normalizeHandle(handle string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(handle)), ".")
 }
 
 // validateHandle checks if the handle is in the allowed list of handles.
 // If no handles are configured (empty list), all handles are allowed.
+// Handles are compared in normalized form (see normalizeHandle).
+// In PDS mode the authenticated account's own handle is always allowed,
+// since the deployment clearly serves that account.
 //
 // Parameters:
 //   - handle: The handle to validate
@@ -31,20 +99,51 @@ func (srv *Server) HandleHealthCheck(c echo.Context) error {
 //   - nil if the handle is valid
 //   - error if the handle is not in the allowed list
 func (srv *Server) validateHandle(handle string) error {
-	if len(srv.validHandles) == 0 {
+	validHandles := srv.allowedHandles()
+	if len(validHandles) == 0 {
 		return nil
 	}
-	for _, h := range srv.validHandles {
-		if h == handle {
+	handle = normalizeHandle(handle)
+	for _, h := range validHandles {
+		if normalizeHandle(h) == handle {
 			return nil
 		}
 	}
+	if handle != "" && handle == normalizeHandle(srv.authHandle()) {
+		return nil
+	}
 	return fmt.Errorf("handle %s is not in the allowed list", handle)
 }
 
-// getHandleFromRequest extracts the handle from either the URL parameter
-// or the request hostname. This allows for both explicit handle parameters
-// and hostname-based handle resolution.
+// authHandle returns the handle of the account the server authenticates
+// as, or "" in AppView mode.
+func (srv *Server) authHandle() string {
+	if srv.auth == nil {
+		return ""
+	}
+	srv.authMutex.RLock()
+	defer srv.authMutex.RUnlock()
+	return srv.auth.Handle
+}
+
+// primaryHandle returns the deployment's primary handle: the first
+// allowed handle, or else the authenticated one. It is "" when neither
+// is configured.
+func (srv *Server) primaryHandle() string {
+	if handles := srv.allowedHandles(); len(handles) > 0 {
+		return handles[0]
+	}
+	return srv.authHandle()
+}
+
+// getHandleFromRequest extracts the handle from the handle header set by a
+// trusted proxy, the URL parameter or the request hostname, in that order.
+// This allows for both explicit handle parameters and hostname-based
+// handle resolution. The hostname is skipped when the server disables the
+// host fallback or when it is not a valid handle (e.g. "localhost" or an
+// IP address); the configured default handle (ATHOME_DEFAULT_HANDLE), if
+// any, is used instead, and otherwise the handle is left empty. Handles
+// are returned normalized (see normalizeHandle).
 //
 // Parameters:
 //   - c: The Echo context containing the request
@@ -52,46 +151,126 @@ func (srv *Server) validateHandle(handle string) error {
 // Returns:
 //   - The extracted handle string
 func getHandleFromRequest(c echo.Context) string {
-	// First try to get handle from URL parameter
+	// A trusted proxy may name the handle explicitly
+	if handle, ok := c.Get(headerHandleKey).(string); ok && handle != "" {
+		return normalizeHandle(handle)
+	}
+
+	// Then try to get handle from URL parameter
 	handle := c.Param("handle")
 	if handle != "" {
-		return handle
+		return normalizeHandle(handle)
+	}
+
+	// If no handle provided, use hostname unless the fallback is disabled
+	srv, _ := c.Get("server").(*Server)
+	if srv == nil || !srv.disableHostFallback {
+		if host := hostHandle(c.Request().Host); host != "" {
+			return host
+		}
+	}
+
+	// Finally fall back to the configured default handle
+	if srv != nil {
+		return srv.defaultHandle
 	}
+	return ""
+}
 
-	// If no handle provided, use hostname
-	host := c.Request().Host
+// hostHandle returns the hostname of a Host header as a normalized
+// handle, or "" if it is not a valid handle
+func hostHandle(host string) string {
 	// Remove port if present
-	if idx := strings.Index(host, ":"); idx != -1 {
-		host = host[:idx]
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = normalizeHandle(host)
+	if _, err := syntax.ParseHandle(host); err != nil {
+		return ""
 	}
 	return host
 }
 
-// validateAndGetDID validates a handle and resolves it to a DID.
+// missingHandleError explains why a request resolved to no handle
+func missingHandleError(c echo.Context) *echo.HTTPError {
+	srv, ok := c.Get("server").(*Server)
+	if c.Request().Host == "" && !(ok && srv.disableHostFallback) {
+		return echo.NewHTTPError(http.StatusBadRequest, "no handle given and the request has no Host header to take it from; name a handle in the URL")
+	}
+	return errExplicitHandle
+}
+
+// validateDID checks if the DID is in the allowed list of DIDs.
+// If no DIDs are configured (empty list), all DIDs are allowed.
+//
+// Parameters:
+//   - did: The DID to validate
+//
+// Returns:
+//   - nil if the DID is valid
+//   - error if the DID is not in the allowed list
+func (srv *Server) validateDID(did string) error {
+	if len(srv.validDIDs) == 0 {
+		return nil
+	}
+	for _, d := range srv.validDIDs {
+		if d == did {
+			return nil
+		}
+	}
+	return fmt.Errorf("did %s is not in the allowed list", did)
+}
+
+// getActorFromRequest extracts the actor identifier for the request.
+// A DID given through the "did" URL parameter takes precedence; otherwise
+// the handle is taken from the URL parameter or the request hostname.
+//
+// Parameters:
+//   - c: The Echo context containing the request
+//
+// Returns:
+//   - The extracted DID or handle string
+func getActorFromRequest(c echo.Context) string {
+	if did := c.Param("did"); did != "" {
+		return did
+	}
+	return getHandleFromRequest(c)
+}
+
+// validateAndGetDID validates an actor identifier and resolves it to a DID.
 // This is a common operation used by multiple handlers to ensure
-// the handle is valid and get its corresponding DID for API operations.
+// the actor is valid and get its corresponding DID for API operations.
+// The actor may be either a handle, which is checked against the allowed
+// handles, resolved through the directory and then checked against the
+// allowed DIDs, or a DID, which is checked as described by
+// validateAndParseDID.
 //
 // Parameters:
 //   - c: The Echo context
-//   - handle: The handle to validate and resolve
+//   - actor: The handle or DID to validate and resolve
 //
 // Returns:
 //   - The resolved DID string
 //   - error if validation fails or DID resolution fails
-func (srv *Server) validateAndGetDID(c echo.Context, handle string) (string, error) {
-	if handle == "" {
-		return "", echo.NewHTTPError(http.StatusBadRequest, "handle is required")
+func (srv *Server) validateAndGetDID(c echo.Context, actor string) (string, error) {
+	if actor == "" {
+		return "", missingHandleError(c)
+	}
+
+	if strings.HasPrefix(actor, "did:") {
+		return srv.validateAndParseDID(c.Request().Context(), actor)
 	}
 
 	// Parse handle to ensure it's valid
-	h, err := syntax.ParseHandle(handle)
+	actor = normalizeHandle(actor)
+	h, err := syntax.ParseHandle(actor)
 	if err != nil {
 		slog.Error("invalid handle format", "error", err)
 		return "", echo.NewHTTPError(http.StatusBadRequest, "invalid handle format")
 	}
 
 	// Validate handle against allowed list
-	if err := srv.validateHandle(handle); err != nil {
+	if err := srv.validateHandle(actor); err != nil {
 		slog.Error("handle not allowed", "error", err)
 		return "", echo.NewHTTPError(http.StatusForbidden, err.Error())
 	}
@@ -103,24 +282,114 @@ func (srv *Server) validateAndGetDID(c echo.Context, handle string) (string, err
 		return "", echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 
+	// Validate the resolved DID against allowed list, which stays stable across handle changes
+	if err := srv.validateDID(ident.DID.String()); err != nil {
+		slog.Error("resolved did not allowed", "handle", actor, "error", err)
+		return "", echo.NewHTTPError(http.StatusForbidden, err.Error())
+	}
+
 	return ident.DID.String(), nil
 }
 
+// revalidateStaleDID is the retry path for validateAndGetDID. When an
+// upstream call for a DID resolved from a handle reports the account as
+// not found, the directory may have served a stale resolution; the handle
+// is purged and resolved once more, going through the same checks.
+//
+// Returns:
+//   - The fresh DID and true when it differs from did and may be retried
+//   - "" and false when actor is a DID, the error is not a not-found error,
+//     or the handle still resolves to the same DID
+func (srv *Server) revalidateStaleDID(c echo.Context, actor, did string, err error) (string, bool) {
+	if actor == "" || strings.HasPrefix(actor, "did:") || !isAccountNotFound(err) {
+		return "", false
+	}
+	h, perr := syntax.ParseHandle(actor)
+	if perr != nil {
+		return "", false
+	}
+
+	if err := srv.purgeIdentity(c.Request().Context(), h.AtIdentifier()); err != nil {
+		slog.Warn("failed to purge stale handle", "handle", actor, "error", err)
+		return "", false
+	}
+	fresh, err := srv.validateAndGetDID(c, actor)
+	if err != nil || fresh == did {
+		return "", false
+	}
+
+	slog.Info("handle resolution was stale", "handle", actor, "stale", did, "did", fresh)
+	return fresh, true
+}
+
+// validateAndParseDID parses a DID and checks it against the allowed DIDs.
+// When only handles are allowlisted, the DID is resolved through the
+// directory and its verified handle must be allowed, so DID routes cannot
+// bypass the handle allowlist.
+//
+// Returns:
+//   - The normalized DID string
+//   - error (400) if the DID is malformed, (403) if it is not allowed,
+//     (404) if it must be resolved and does not exist, (500) if that
+//     resolution fails
+func (srv *Server) validateAndParseDID(ctx context.Context, raw string) (string, error) {
+	did, err := syntax.ParseDID(raw)
+	if err != nil {
+		slog.Error("invalid did format", "error", err)
+		return "", echo.NewHTTPError(http.StatusBadRequest, "invalid did format")
+	}
+
+	if err := srv.validateDID(did.String()); err != nil {
+		slog.Error("did not allowed", "error", err)
+		return "", echo.NewHTTPError(http.StatusForbidden, err.Error())
+	}
+
+	// A DID allowlist is authoritative; otherwise the handle allowlist gates
+	if len(srv.validDIDs) == 0 && len(srv.allowedHandles()) > 0 {
+		if srv.dir == nil {
+			return "", echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("did %s is not in the allowed list", did))
+		}
+		ident, err := srv.dir.LookupDID(ctx, did)
+		if err != nil {
+			if errors.Is(err, identity.ErrDIDNotFound) {
+				return "", echo.NewHTTPError(http.StatusNotFound, "did not found")
+			}
+			slog.Error("failed to resolve did for the handle allowlist", "did", did, "error", err)
+			return "", echo.NewHTTPError(http.StatusInternalServerError, "failed to resolve did")
+		}
+		if err := srv.validateHandle(ident.Handle.String()); err != nil {
+			slog.Error("did resolves to a handle that is not allowed", "did", did, "error", err)
+			return "", echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("did %s is not in the allowed list", did))
+		}
+	}
+
+	return did.String(), nil
+}
+
 // handleGetProfile handles requests for user profile information.
 // It validates the handle, resolves it to a DID, and fetches the
 // profile data from the Bluesky API.
 //
 // URL Parameters:
 //   - handle: Optional handle parameter (falls back to hostname)
+//   - did: Optional DID parameter, used instead of the handle when present
+//
+// Query Parameters:
+//   - fields: Optional comma-separated list of keys to return (see profileFields)
 //
 // Returns:
 //   - 200 OK with profile data
-//   - 400 Bad Request if handle is invalid
+//   - 400 Bad Request if handle is invalid, or fields has unknown keys in strict mode
 //   - 403 Forbidden if handle is not allowed
 //   - 500 Internal Server Error if profile fetch fails
 func (srv *Server) handleGetProfile(c echo.Context) error {
-	handle := getHandleFromRequest(c)
-	did, err := srv.validateAndGetDID(c, handle)
+	actor := getActorFromRequest(c)
+	did, err := srv.validateAndGetDID(c, actor)
+	if err != nil {
+		return err
+	}
+
+	fields, err := srv.getFieldsFromRequest(c, profileFields)
 	if err != nil {
 		return err
 	}
@@ -131,11 +400,27 @@ func (srv *Server) handleGetProfile(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Authentication error: "+err.Error())
 	}
 
-	// Get profile using DID
-	profile, err := bsky.ActorGetProfile(c.Request().Context(), srv.xrpcc, did)
+	// Get profile using DID (served from the profile cache when fresh),
+	// re-resolving the handle once if the DID turns out to be stale
+	profile, err := srv.getProfile(c.Request().Context(), did)
+	if fresh, ok := srv.revalidateStaleDID(c, actor, did, err); ok {
+		did = fresh
+		profile, err = srv.getProfile(c.Request().Context(), did)
+	}
 	if err != nil {
 		slog.Error("failed to fetch profile", "error", err)
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return upstreamError(c, err)
+	}
+	if profile == nil {
+		slog.Error("profile data is nil")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch profile data")
+	}
+
+	// A handle lookup that lands on a profile with another handle means the
+	// cached resolution is stale; drop it so the next request re-resolves
+	if !strings.HasPrefix(actor, "did:") && handleMismatch(actor, profile) {
+		slog.Info("requested handle no longer matches profile", "requested", actor, "current", profile.Handle, "did", did)
+		srv.invalidateIdentity(c.Request().Context(), did, actor)
 	}
 
 	// Transform profile data using ActorDefs_ProfileViewDetailed
@@ -152,28 +437,61 @@ func (srv *Server) handleGetProfile(c echo.Context) error {
 		"indexedAt":      profile.IndexedAt,
 	}
 
-	return c.JSON(http.StatusOK, response)
+	// Relationship state is only populated when authenticated as a real account
+	if profile.Viewer != nil {
+		response["viewer"] = profile.Viewer
+	}
+
+	// Verification is only present once the AppView has assessed the profile
+	if profile.Verification != nil {
+		response["verification"] = profileVerification(profile.Verification)
+	}
+
+	return c.JSON(http.StatusOK, projectFields(response, fields))
+}
+
+// profileVerification summarises a verification state for clients: whether
+// the profile is verified, whether it may itself verify others, and which
+// verifiers currently vouch for it.
+func profileVerification(state *VerificationState) ProfileVerification {
+	v := ProfileVerification{
+		Verified:        state.VerifiedStatus == "valid",
+		TrustedVerifier: state.TrustedVerifierStatus == "valid",
+	}
+	for _, view := range state.Verifications {
+		if view.IsValid {
+			v.Verifiers = append(v.Verifiers, view.Issuer)
+		}
+	}
+	return v
 }
 
 // handleGetFeed handles requests for a user's feed.
 // It validates the handle, resolves it to a DID, and fetches
 // the feed data from the Bluesky API. The feed is filtered to
-// only include posts by the specified handle.
+// only include posts by the specified actor, reading further upstream
+// pages (up to FeedMaxFetches) until limit posts are collected.
 //
 // URL Parameters:
 //   - handle: Optional handle parameter (falls back to hostname)
+//   - did: Optional DID parameter, used instead of the handle when present
 //
 // Query Parameters:
 //   - cursor: Pagination cursor for fetching more posts
+//   - limit: Page size (defaults to FeedDefaultLimit, clamped to FeedMaxLimit)
+//   - fields: Optional comma-separated list of per-post keys to return (see postFields)
+//   - lang: Optional comma-separated list of languages to keep (see getLangsFromRequest)
+//   - format: Optional json (default) or html; Accept: text/html also selects HTML
+//   - tz: Optional IANA time zone for each post's localTime (see postTimes)
 //
 // Returns:
-//   - 200 OK with feed data
-//   - 400 Bad Request if handle is invalid
+//   - 200 OK with feed data, or an HTML fragment (see writeFeedHTML); an
+//     account without posts gets an empty feed
+//   - 400 Bad Request if handle, cursor, limit, fields, lang, format or tz is invalid
 //   - 403 Forbidden if handle is not allowed
 //   - 500 Internal Server Error if feed fetch fails
 func (srv *Server) handleGetFeed(c echo.Context) error {
-	handle := getHandleFromRequest(c)
-	did, err := srv.validateAndGetDID(c, handle)
+	did, err := srv.validateAndGetDID(c, getActorFromRequest(c))
 	if err != nil {
 		return err
 	}
@@ -184,55 +502,217 @@ func (srv *Server) handleGetFeed(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Authentication error: "+err.Error())
 	}
 
-	cursor := c.QueryParam("cursor")
-	slog.Info("fetching feed", "did", did, "cursor", cursor)
-
-	// Get feed using DID
-	feed, err := bsky.FeedGetAuthorFeed(c.Request().Context(), srv.xrpcc, did, cursor, "posts_no_replies", false, 20)
+	cursor, err := getCursorFromRequest(c)
 	if err != nil {
-		slog.Error("failed to fetch feed", "error", err)
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
+	}
+	limit, err := srv.getFeedLimitFromRequest(c)
+	if err != nil {
+		return err
 	}
+	fields, err := srv.getFieldsFromRequest(c, postFields)
+	if err != nil {
+		return err
+	}
+	langs, err := getLangsFromRequest(c)
+	if err != nil {
+		return err
+	}
+	format, err := getFeedFormatFromRequest(c)
+	if err != nil {
+		return err
+	}
+	times, err := getPostTimesFromRequest(c)
+	if err != nil {
+		return err
+	}
+	c.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+	slog.Info("fetching feed", "did", did, "cursor", cursor, "limit", limit, "langs", langs)
 
-	// Ensure feed is not nil before returning
-	if feed == nil || feed.Feed == nil {
+	// Served from the feed cache when enabled, refreshed in the background once stale
+	fetch := func(ctx context.Context) (*authorFeedPage, error) {
+		return srv.fetchAuthorFeed(ctx, did, cursor, limit, langs)
+	}
+	var page *authorFeedPage
+	if srv.feeds != nil {
+		page, err = srv.feeds.get(c.Request().Context(), feedCacheKey(did, cursor, limit, langs), fetch)
+	} else {
+		page, err = fetch(c.Request().Context())
+	}
+	if errors.Is(err, errNilFeed) {
 		slog.Error("feed data is nil")
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch feed data")
 	}
+	if err != nil {
+		slog.Error("failed to fetch feed", "error", err)
+		return upstreamError(c, err)
+	}
+	filteredFeed, nextCursor := page.Feed, page.Cursor
+
+	// Server-rendered fragment for embedding without JavaScript
+	if format == feedFormatHTML {
+		return writeFeedHTML(c, nextCursor, filteredFeed)
+	}
+
+	// Add relative and localized timestamps next to each post's indexedAt
+	timedFeed := times.annotateFeed(filteredFeed)
 
-	// Filter feed whose author is the handle
-	filteredFeed := []*bsky.FeedDefs_FeedViewPost{}
-	for _, post := range feed.Feed {
-		if post.Post.Author.Handle == handle {
-			filteredFeed = append(filteredFeed, post)
+	// Trim each post down to the requested fields
+	if fields != nil {
+		projected, err := projectFeedPosts(timedFeed, fields)
+		if err != nil {
+			slog.Error("failed to project feed fields", "error", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 		}
+		return writeFeedJSON(c, nextCursor, projected)
 	}
 
-	// Transform feed data using FeedDefs_FeedViewPost
-	response := map[string]interface{}{
-		"cursor": feed.Cursor,
-		"feed":   filteredFeed,
+	// Stream the feed post by post rather than buffering the whole response
+	return writeFeedJSON(c, nextCursor, timedFeed)
+}
+
+// authorFeedPage is one page of an actor's own posts
+type authorFeedPage struct {
+	Feed   []*bsky.FeedDefs_FeedViewPost
+	Cursor *string // Upstream cursor for the next page
+}
+
+// errNilFeed is returned when the upstream answers without a response
+var errNilFeed = errors.New("feed data is nil")
+
+// fetchAuthorFeed reads a page of did's own posts. Reposts and other
+// authors' posts are filtered out, so a single upstream page can come back
+// nearly empty. Pages are read until the limit is reached, the feed ends
+// or the fetch cap (FeedMaxFetches) is hit. Whole pages are kept so the
+// returned cursor never skips posts, which means the result can run over
+// the limit.
+func (srv *Server) fetchAuthorFeed(ctx context.Context, did, cursor string, limit int64, langs []string) (*authorFeedPage, error) {
+	page := &authorFeedPage{Feed: []*bsky.FeedDefs_FeedViewPost{}}
+	maxFetches := max(srv.FeedMaxFetches, 1)
+	for fetches := 0; fetches < maxFetches; fetches++ {
+		feed, err := srv.feedFetcher().GetAuthorFeed(ctx, did, cursor, "posts_no_replies", limit)
+		if err != nil {
+			return nil, err
+		}
+		if feed == nil {
+			return nil, errNilFeed
+		}
+		// A missing or null feed is an empty page, e.g. for a new account
+		// without posts, not a failure
+
+		page.Feed = append(page.Feed, filterAuthorFeed(feed.Feed, did, langs)...)
+		page.Cursor = feed.Cursor
+
+		// Stop once filled, at the end of the feed, or if upstream stops advancing
+		if int64(len(page.Feed)) >= limit || page.Cursor == nil || *page.Cursor == "" || *page.Cursor == cursor {
+			break
+		}
+		cursor = *page.Cursor
 	}
+	return page, nil
+}
 
-	return c.JSON(http.StatusOK, response)
+// feedCacheKey identifies a feed page in the feed cache. It starts with
+// the DID so purging the identity drops its pages.
+func feedCacheKey(did, cursor string, limit int64, langs []string) string {
+	return fmt.Sprintf("%s|%s|%d|%s", did, cursor, limit, strings.Join(langs, ","))
 }
 
-// handleGetPost handles requests for a specific post and its thread.
-// It accepts an AT-URI and fetches the post and surrounding thread
-// context from the Bluesky API.
+// filterAuthorFeed keeps the posts authored by did (see isOwnFeedPost)
+// and, when requested, written in one of langs. The author feed is not
+// filtered upstream, so this happens after hydration. Malformed entries
+// without a post or author are skipped.
+func filterAuthorFeed(feed []*bsky.FeedDefs_FeedViewPost, did string, langs []string) []*bsky.FeedDefs_FeedViewPost {
+	var filtered []*bsky.FeedDefs_FeedViewPost
+	for _, post := range feed {
+		if post == nil || post.Post == nil || post.Post.Author == nil {
+			slog.Warn("skipping malformed feed entry", "did", did)
+			continue
+		}
+		if isOwnFeedPost(post, did) && postMatchesLangs(post.Post, langs) {
+			filtered = append(filtered, post)
+		}
+	}
+	return filtered
+}
+
+// isOwnFeedPost reports whether an author feed entry is a post by did, by
+// the rules every owner-only listing (feed, media, sitemap) shares:
+//   - Posts written by did are kept, including replies to did's own posts,
+//     so self-threads stay whole.
+//   - A quote post belongs to whoever wrote it: did's quotes of others are
+//     kept, and the quoted post is only an embed.
+//   - Reposts are dropped, even of did's own posts, which would otherwise
+//     be listed twice.
+//   - Pinned posts are kept; the pin does not change the author.
+func isOwnFeedPost(item *bsky.FeedDefs_FeedViewPost, did string) bool {
+	if item == nil || item.Post == nil || item.Post.Author == nil || item.Post.Author.Did != did {
+		return false
+	}
+	return item.Reason == nil || item.Reason.FeedDefs_ReasonRepost == nil
+}
+
+// getLangsFromRequest parses the optional "lang" query parameter, a
+// comma-separated list of BCP-47 language tags.
 //
-// URL Parameters:
-//   - *: The AT-URI of the post (with or without at:// prefix)
+// Returns:
+//   - The lowercased language tags, or nil when no filter is set
+//   - error (400) if any tag is malformed
+func getLangsFromRequest(c echo.Context) ([]string, error) {
+	raw := c.QueryParam("lang")
+	if raw == "" {
+		return nil, nil
+	}
+	var langs []string
+	for _, tag := range strings.Split(raw, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if _, err := syntax.ParseLanguage(tag); err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid lang: "+tag)
+		}
+		langs = append(langs, tag)
+	}
+	return langs, nil
+}
+
+// postMatchesLangs reports whether a post's record declares one of the
+// requested languages. Matching is by BCP-47 prefix, so "en" matches
+// "en-US". Posts without a langs field only match when no filter is set.
+func postMatchesLangs(post *bsky.FeedDefs_PostView, langs []string) bool {
+	if len(langs) == 0 {
+		return true
+	}
+	if post == nil || post.Record == nil {
+		return false
+	}
+	record, ok := post.Record.Val.(*bsky.FeedPost)
+	if !ok {
+		return false
+	}
+	for _, have := range record.Langs {
+		have = strings.ToLower(have)
+		for _, want := range langs {
+			if have == want || strings.HasPrefix(have, want+"-") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getATURIFromRequest extracts and parses the AT-URI carried in the wildcard
+// URL parameter. The at:// prefix is optional in the URL.
+//
+// Parameters:
+//   - c: The Echo context containing the request
 //
 // Returns:
-//   - 200 OK with post and thread data
-//   - 400 Bad Request if URI is invalid
-//   - 500 Internal Server Error if post fetch fails
-func (srv *Server) handleGetPost(c echo.Context) error {
+//   - The parsed AT-URI
+//   - error (400) if the URI is missing or malformed
+func getATURIFromRequest(c echo.Context) (syntax.ATURI, error) {
 	// Get full URI path from wildcard parameter
 	uri := c.Param("*")
 	if uri == "" {
-		return echo.NewHTTPError(http.StatusBadRequest, "uri is required")
+		return "", echo.NewHTTPError(http.StatusBadRequest, "uri is required")
 	}
 
 	// Add at:// prefix if not present
@@ -240,14 +720,210 @@ func (srv *Server) handleGetPost(c echo.Context) error {
 		uri = "at://" + uri
 	}
 
-	slog.Info("fetching post", "uri", uri)
-
 	// Parse AT-URI
 	atUri, err := syntax.ParseATURI(uri)
 	if err != nil {
 		slog.Error("invalid uri format", "error", err)
-		return echo.NewHTTPError(http.StatusBadRequest, "invalid uri format")
+		return "", echo.NewHTTPError(http.StatusBadRequest, "invalid uri format")
+	}
+	return atUri, nil
+}
+
+// getLimitFromRequest parses the optional "limit" query parameter.
+// Missing values fall back to def and values above max are clamped.
+//
+// Returns:
+//   - The page size to request upstream
+//   - error (400) if the limit is not a positive integer
+func getLimitFromRequest(c echo.Context, def, max int64) (int64, error) {
+	raw := c.QueryParam("limit")
+	if raw == "" {
+		return def, nil
+	}
+	limit, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || limit < 1 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "limit must be a positive integer")
 	}
+	if limit > max {
+		limit = max
+	}
+	return limit, nil
+}
+
+// getFeedLimitFromRequest parses the "limit" query parameter of feed
+// endpoints using the server's configured default and maximum.
+func (srv *Server) getFeedLimitFromRequest(c echo.Context) (int64, error) {
+	return getLimitFromRequest(c, srv.FeedDefaultLimit, srv.FeedMaxLimit)
+}
+
+// maxCursorLength bounds the pagination cursors accepted from clients.
+// Upstream cursors are short opaque strings, so anything longer is bogus.
+const maxCursorLength = 512
+
+// getCursorFromRequest returns the optional "cursor" query parameter.
+// Valid cursors are passed through unchanged; obviously malformed ones
+// are rejected here rather than producing an opaque upstream error.
+//
+// Returns:
+//   - The cursor, or "" when none was given
+//   - error (400) if the cursor is empty, too long or not printable
+func getCursorFromRequest(c echo.Context) (string, error) {
+	if !c.QueryParams().Has("cursor") {
+		return "", nil
+	}
+	cursor := c.QueryParam("cursor")
+	if cursor == "" {
+		return "", echo.NewHTTPError(http.StatusBadRequest, "cursor must not be empty")
+	}
+	if len(cursor) > maxCursorLength {
+		return "", echo.NewHTTPError(http.StatusBadRequest, "cursor is too long")
+	}
+	if !utf8.ValidString(cursor) {
+		return "", echo.NewHTTPError(http.StatusBadRequest, "cursor contains invalid characters")
+	}
+	for _, r := range cursor {
+		if !unicode.IsPrint(r) {
+			return "", echo.NewHTTPError(http.StatusBadRequest, "cursor contains invalid characters")
+		}
+	}
+	return cursor, nil
+}
+
+// isNotFoundError reports whether an upstream XRPC error means the
+// requested record or actor does not exist.
+func isNotFoundError(err error) bool {
+	var xrpcErr *xrpc.Error
+	if errors.As(err, &xrpcErr) && xrpcErr.StatusCode == http.StatusNotFound {
+		return true
+	}
+	var xe *xrpc.XRPCError
+	if errors.As(err, &xe) && (xe.ErrStr == "NotFound" || xe.ErrStr == "RecordNotFound") {
+		return true
+	}
+	return false
+}
+
+// isAccountNotFound reports whether an upstream error means the account
+// is missing, either as a plain not-found error or as an account error
+// that maps to 404.
+func isAccountNotFound(err error) bool {
+	if isNotFoundError(err) {
+		return true
+	}
+	he := accountError(err)
+	return he != nil && he.Code == http.StatusNotFound
+}
+
+// upstreamError converts a failed upstream call into the response error,
+// mapping the upstream status to one that is meaningful to the client:
+//   - not found (404, or an XRPC NotFound error) becomes 404
+//   - 400 stays 400, with the upstream message
+//   - 401 and 403 become 502, since they concern our credentials rather
+//     than the client's request
+//   - 429 stays 429, with Retry-After set from the upstream reset time
+//     when known, so clients can back off
+//   - a refused call to an upstream whose circuit is open becomes 503,
+//     with Retry-After set to the end of the cooldown
+//   - a response body past ATHOME_UPSTREAM_MAX_RESPONSE becomes 502
+//
+// Unavailable accounts are reported as described by accountError.
+// Anything else, including transport failures, is a 500 with a generic
+// message; the error itself is only logged, since it can name internal
+// hosts and addresses.
+func upstreamError(c echo.Context, err error) *echo.HTTPError {
+	var openErr *circuitOpenError
+	if errors.As(err, &openErr) {
+		wait := int64(math.Ceil(openErr.retryAfter.Seconds()))
+		c.Response().Header().Set("Retry-After", strconv.FormatInt(max(wait, 1), 10))
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "upstream temporarily unavailable")
+	}
+
+	var tooLarge *responseTooLargeError
+	if errors.As(err, &tooLarge) {
+		return echo.NewHTTPError(http.StatusBadGateway, "upstream response too large")
+	}
+
+	var xrpcErr *xrpc.Error
+	if !errors.As(err, &xrpcErr) {
+		return upstreamFailure(c, err)
+	}
+	if he := accountError(err); he != nil {
+		return he
+	}
+
+	// Only the upstream message is passed on, never the raw error text
+	message := http.StatusText(xrpcErr.StatusCode)
+	var xe *xrpc.XRPCError
+	if errors.As(err, &xe) && xe.Message != "" {
+		message = xe.Message
+	}
+
+	switch {
+	case isNotFoundError(err):
+		return echo.NewHTTPError(http.StatusNotFound, message)
+	case xrpcErr.StatusCode == http.StatusBadRequest:
+		return echo.NewHTTPError(http.StatusBadRequest, message)
+	case xrpcErr.StatusCode == http.StatusUnauthorized || xrpcErr.StatusCode == http.StatusForbidden:
+		return echo.NewHTTPError(http.StatusBadGateway, "upstream rejected our credentials")
+	case xrpcErr.StatusCode == http.StatusTooManyRequests:
+		if xrpcErr.Ratelimit != nil && !xrpcErr.Ratelimit.Reset.IsZero() {
+			wait := int64(math.Ceil(time.Until(xrpcErr.Ratelimit.Reset).Seconds()))
+			c.Response().Header().Set("Retry-After", strconv.FormatInt(max(wait, 1), 10))
+		}
+		return echo.NewHTTPError(http.StatusTooManyRequests, "upstream rate limit exceeded")
+	}
+	return upstreamFailure(c, err)
+}
+
+// upstreamFailure logs an unexpected upstream error and returns a 500
+// that does not reveal it
+func upstreamFailure(c echo.Context, err error) *echo.HTTPError {
+	slog.Error("upstream request failed", "path", c.Path(), "error", err)
+	return echo.NewHTTPError(http.StatusInternalServerError, "upstream request failed")
+}
+
+// accountError recognises upstream errors for accounts that cannot be
+// shown although their handle or DID resolved. Missing profiles and
+// deactivated accounts are 404s; accounts taken down by moderation are
+// 451 Unavailable For Legal Reasons. It returns nil for any other error.
+func accountError(err error) *echo.HTTPError {
+	var xe *xrpc.XRPCError
+	if !errors.As(err, &xe) {
+		return nil
+	}
+	switch {
+	case xe.ErrStr == "AccountDeactivated":
+		return echo.NewHTTPError(http.StatusNotFound, "account is deactivated")
+	case xe.ErrStr == "AccountTakedown":
+		return echo.NewHTTPError(http.StatusUnavailableForLegalReasons, "account has been taken down")
+	case xe.ErrStr == "ProfileNotFound" || strings.EqualFold(xe.Message, "profile not found"):
+		return echo.NewHTTPError(http.StatusNotFound, "profile not found")
+	}
+	return nil
+}
+
+// handleGetPost handles requests for a specific post and its thread.
+// It accepts an AT-URI and fetches the post and surrounding thread
+// context from the Bluesky API.
+//
+// URL Parameters:
+//   - *: The AT-URI of the post (with or without at:// prefix)
+//
+// Large threads are pruned to threadMaxNodes posts (see pruneThread), in
+// which case "truncated" is true. Every node carries a "type" of "post",
+// "notFound" or "blocked" (see normalizeThread).
+//
+// Returns:
+//   - 200 OK with post and thread data
+//   - 400 Bad Request if URI is invalid
+//   - 500 Internal Server Error if post fetch fails or returns no thread
+func (srv *Server) handleGetPost(c echo.Context) error {
+	atUri, err := getATURIFromRequest(c)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("fetching post", "uri", atUri)
 
 	// Ensure we have a valid token before making the API request
 	if err := srv.ensureValidToken(c); err != nil {
@@ -256,55 +932,314 @@ func (srv *Server) handleGetPost(c echo.Context) error {
 	}
 
 	// Get thread with depth 8 for context
-	thread, err := bsky.FeedGetPostThread(c.Request().Context(), srv.xrpcc, 8, 0, atUri.String())
+	thread, err := bsky.FeedGetPostThread(c.Request().Context(), srv.readClient(), 8, 0, atUri.String())
 	if err != nil {
 		slog.Error("failed to fetch post", "error", err)
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return upstreamError(c, err)
+	}
+
+	// A deleted or blocked post still comes back as a thread root; no root
+	// at all means the upstream answer is broken
+	if thread.Thread == nil {
+		slog.Error("thread data is nil", "uri", atUri)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch post data")
 	}
+	truncated := pruneThread(thread.Thread.FeedDefs_ThreadViewPost, srv.threadMaxNodes)
 
-	return c.JSON(http.StatusOK, thread)
+	response := map[string]interface{}{
+		"thread":    normalizeThread(thread.Thread),
+		"truncated": truncated,
+	}
+	if thread.Threadgate != nil {
+		response["threadgate"] = thread.Threadgate
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// handleGetPostRecord handles requests for the raw record of a post,
+// without thread hydration, for clients that need facets or langs. It is
+// handleGetRecord limited to posts, whatever collections are allowed.
+//
+// URL Parameters:
+//   - *: The AT-URI of the post (with or without at:// prefix)
+//
+// Returns:
+//   - 200 OK with the record URI, CID and value
+//   - 400 Bad Request if URI is invalid or not a post
+//   - 404 Not Found if the record does not exist
+//   - 500 Internal Server Error if the fetch fails
+func (srv *Server) handleGetPostRecord(c echo.Context) error {
+	atUri, err := getATURIFromRequest(c)
+	if err != nil {
+		return err
+	}
+	if atUri.Collection().String() != postCollection || atUri.RecordKey() == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "uri is not a post")
+	}
+	return srv.writeRecord(c, atUri, "post")
+}
+
+// handleGetRepostedBy handles requests for the list of actors who reposted a post.
+//
+// URL Parameters:
+//   - *: The AT-URI of the post (with or without at:// prefix)
+//
+// Query Parameters:
+//   - cursor: Pagination cursor for fetching more actors
+//   - limit: Page size (default 50, max 100)
+//
+// Returns:
+//   - 200 OK with the reposting actors
+//   - 400 Bad Request if URI, cursor or limit is invalid
+//   - 404 Not Found if the post does not exist
+//   - 500 Internal Server Error if the fetch fails
+func (srv *Server) handleGetRepostedBy(c echo.Context) error {
+	atUri, err := getATURIFromRequest(c)
+	if err != nil {
+		return err
+	}
+
+	limit, err := getLimitFromRequest(c, defaultListLimit, maxListLimit)
+	if err != nil {
+		return err
+	}
+	cursor, err := getCursorFromRequest(c)
+	if err != nil {
+		return err
+	}
+
+	// Ensure we have a valid token before making the API request
+	if err := srv.ensureValidToken(c); err != nil {
+		slog.Error("failed to ensure valid token", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Authentication error: "+err.Error())
+	}
+
+	out, err := bsky.FeedGetRepostedBy(c.Request().Context(), srv.readClient(), "", cursor, limit, atUri.String())
+	if err != nil {
+		if isNotFoundError(err) {
+			return echo.NewHTTPError(http.StatusNotFound, "post not found")
+		}
+		slog.Error("failed to fetch reposted-by", "error", err)
+		return upstreamError(c, err)
+	}
+
+	repostedBy := out.RepostedBy
+	if repostedBy == nil {
+		repostedBy = []*bsky.ActorDefs_ProfileView{}
+	}
+
+	response := map[string]interface{}{
+		"uri":        out.Uri,
+		"cursor":     out.Cursor,
+		"repostedBy": repostedBy,
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// handleGetLikes handles requests for the list of actors who liked a post.
+//
+// URL Parameters:
+//   - *: The AT-URI of the post (with or without at:// prefix)
+//
+// Query Parameters:
+//   - cursor: Pagination cursor for fetching more likes
+//   - limit: Page size (default 50, max 100)
+//
+// Returns:
+//   - 200 OK with the likes (an empty array when nobody liked the post)
+//   - 400 Bad Request if URI, cursor or limit is invalid
+//   - 404 Not Found if the post does not exist
+//   - 500 Internal Server Error if the fetch fails
+func (srv *Server) handleGetLikes(c echo.Context) error {
+	atUri, err := getATURIFromRequest(c)
+	if err != nil {
+		return err
+	}
+
+	limit, err := getLimitFromRequest(c, defaultListLimit, maxListLimit)
+	if err != nil {
+		return err
+	}
+	cursor, err := getCursorFromRequest(c)
+	if err != nil {
+		return err
+	}
+
+	// Ensure we have a valid token before making the API request
+	if err := srv.ensureValidToken(c); err != nil {
+		slog.Error("failed to ensure valid token", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Authentication error: "+err.Error())
+	}
+
+	out, err := bsky.FeedGetLikes(c.Request().Context(), srv.readClient(), "", cursor, limit, atUri.String())
+	if err != nil {
+		if isNotFoundError(err) {
+			return echo.NewHTTPError(http.StatusNotFound, "post not found")
+		}
+		slog.Error("failed to fetch likes", "error", err)
+		return upstreamError(c, err)
+	}
+
+	likes := out.Likes
+	if likes == nil {
+		likes = []*bsky.FeedGetLikes_Like{}
+	}
+
+	response := map[string]interface{}{
+		"uri":    out.Uri,
+		"cursor": out.Cursor,
+		"likes":  likes,
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// handleGetQuotes handles requests for the posts quoting a post.
+//
+// URL Parameters:
+//   - *: The AT-URI of the post (with or without at:// prefix)
+//
+// Query Parameters:
+//   - cursor: Pagination cursor for fetching more quotes
+//   - limit: Page size (default 50, max 100)
+//
+// Returns:
+//   - 200 OK with the quoting posts (an empty array when nobody quoted the post)
+//   - 400 Bad Request if URI, cursor or limit is invalid
+//   - 404 Not Found if the post does not exist
+//   - 500 Internal Server Error if the fetch fails
+func (srv *Server) handleGetQuotes(c echo.Context) error {
+	atUri, err := getATURIFromRequest(c)
+	if err != nil {
+		return err
+	}
+
+	limit, err := getLimitFromRequest(c, defaultListLimit, maxListLimit)
+	if err != nil {
+		return err
+	}
+	cursor, err := getCursorFromRequest(c)
+	if err != nil {
+		return err
+	}
+
+	// Ensure we have a valid token before making the API request
+	if err := srv.ensureValidToken(c); err != nil {
+		slog.Error("failed to ensure valid token", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Authentication error: "+err.Error())
+	}
+
+	out, err := bsky.FeedGetQuotes(c.Request().Context(), srv.readClient(), "", cursor, limit, atUri.String())
+	if err != nil {
+		if isNotFoundError(err) {
+			return echo.NewHTTPError(http.StatusNotFound, "post not found")
+		}
+		slog.Error("failed to fetch quotes", "error", err)
+		return upstreamError(c, err)
+	}
+
+	posts := out.Posts
+	if posts == nil {
+		posts = []*bsky.FeedDefs_PostView{}
+	}
+
+	response := map[string]interface{}{
+		"uri":    out.Uri,
+		"cursor": out.Cursor,
+		"posts":  posts,
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// Defaults for the document title injected into index.html
+const (
+	defaultSiteTitle   = "AtHome"
+	defaultTitleFormat = "@{handle}"
+)
+
+// formatTitle expands a title format. Supported placeholders are {handle},
+// {displayName} and {siteTitle}; {displayName} falls back to the handle when
+// the profile has no display name. Without a handle the site title is used.
+//
+// Parameters:
+//   - format: The title format, e.g. "{displayName} (@{handle})"
+//   - siteTitle: The base site title
+//   - handle: The handle the page is for
+//   - displayName: The profile display name, if known
+//
+// Returns the expanded title.
+func formatTitle(format, siteTitle, handle, displayName string) string {
+	if siteTitle == "" {
+		siteTitle = defaultSiteTitle
+	}
+	if handle == "" {
+		return siteTitle
+	}
+	if format == "" {
+		format = defaultTitleFormat
+	}
+	if displayName == "" {
+		displayName = handle
+	}
+	return strings.NewReplacer(
+		"{handle}", handle,
+		"{displayName}", displayName,
+		"{siteTitle}", siteTitle,
+	).Replace(format)
+}
+
+// pageTitle builds the document title for the handle a page is served for.
+// The display name is only looked up when the configured format uses it,
+// and any failure to resolve the profile falls back to the handle.
+func (srv *Server) pageTitle(c echo.Context, handle string) string {
+	displayName := ""
+	if strings.Contains(srv.titleFormat, "{displayName}") && handle != "" {
+		if did, err := srv.validateAndGetDID(c, handle); err == nil {
+			if profile, err := srv.getProfile(c.Request().Context(), did); err == nil && profile != nil && profile.DisplayName != nil {
+				displayName = *profile.DisplayName
+			} else if err != nil {
+				slog.Warn("failed to fetch profile for page title", "handle", handle, "error", err)
+			}
+		}
+	}
+	return formatTitle(srv.titleFormat, srv.siteTitle, handle, displayName)
 }
 
 // handleIndex serves the main SPA (Single Page Application) HTML.
 // It injects necessary data attributes and security nonces into
-// the HTML before serving it.
+// the cached index.html template before serving it.
 //
 // Returns:
-//   - 200 OK with the modified index.html content
+//   - 200 OK with the rendered index.html content (or the fallback page if it is absent)
 //   - 500 Internal Server Error if index.html cannot be read
 func (srv *Server) handleIndex(c echo.Context) error {
 	nonce := c.Get("nonce").(string)
 
-	// Read the Vite-built index.html
-	content, err := os.ReadFile("public/index.html")
+	tmpl, err := srv.index.get()
 	if err != nil {
 		slog.Error("failed to read index.html", "error", err)
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to read index.html")
 	}
 
 	defaultHandle := getHandleFromRequest(c)
+	content, err := tmpl.render(indexData{
+		Nonce:  nonce,
+		Handle: defaultHandle,
+		Title:  srv.pageTitle(c, defaultHandle),
+	})
+	if err != nil {
+		slog.Error("failed to render index.html", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to render index.html")
+	}
 
-	// Add nonce to all script tags
-	doc := string(content)
-	scriptPattern := `<script`
-	nonceAttr := ` nonce="` + nonce + `"`
-
-	modifiedContent := strings.ReplaceAll(doc, scriptPattern, scriptPattern+nonceAttr)
-
-	// Add the default handle as a data attribute to html tag
-	modifiedContent = strings.Replace(
-		modifiedContent,
-		`<html lang="en"`,
-		`<html lang="en" data-default-handle="`+defaultHandle+`"`,
-		1,
-	)
-
-	// Add the index.html title using the handle
-	modifiedContent = strings.ReplaceAll(modifiedContent, "<title>AtHome</title>", "<title>@"+defaultHandle+"</title>")
-
-	// Set proper content type
+	// Set proper content type; the page names the current asset hashes, so
+	// browsers must revalidate it rather than keep a stale copy
 	c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTMLCharsetUTF8)
-	return c.HTMLBlob(http.StatusOK, []byte(modifiedContent))
+	c.Response().Header().Set("Cache-Control", "no-cache")
+	return c.HTMLBlob(http.StatusOK, content)
 }
 
 // Portfolio represents a user's portfolio data
@@ -349,6 +1284,10 @@ func (srv *Server) handleGetPortfolio(c echo.Context) error {
 		handle = getHandleFromRequest(c)
 	}
 
+	if handle == "" {
+		return missingHandleError(c)
+	}
+
 	// Validate handle
 	if err := srv.validateHandle(handle); err != nil {
 		return echo.NewHTTPError(http.StatusNotFound, "invalid handle")
@@ -1,15 +1,25 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
 	"github.com/bluesky-social/indigo/xrpc"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
@@ -98,6 +108,229 @@ func (m *mockXRPCClient) getCreateSessionCalls() int {
 	return m.createSessionCalls
 }
 
+// stubTransport answers XRPC queries with canned responses keyed by NSID
+// and records every request it receives
+type stubTransport struct {
+	mu        sync.Mutex
+	responses map[string]stubResponse
+	requests  []*http.Request
+}
+
+// stubResponse is a canned HTTP response for a single XRPC method
+type stubResponse struct {
+	status int
+	body   string
+	header http.Header
+	delay  time.Duration // How long the upstream takes to answer
+}
+
+func newStubTransport() *stubTransport {
+	return &stubTransport{responses: map[string]stubResponse{}}
+}
+
+// on registers a canned response for the given XRPC method
+func (s *stubTransport) on(nsid string, status int, body string) *stubTransport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[nsid] = stubResponse{status: status, body: body}
+	return s
+}
+
+// onWithHeader registers a canned response carrying extra headers
+func (s *stubTransport) onWithHeader(nsid string, status int, body string, header http.Header) *stubTransport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[nsid] = stubResponse{status: status, body: body, header: header}
+	return s
+}
+
+// onDelayed registers a canned response sent only after delay, unless the
+// request is cancelled first
+func (s *stubTransport) onDelayed(nsid string, delay time.Duration, status int, body string) *stubTransport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[nsid] = stubResponse{status: status, body: body, delay: delay}
+	return s
+}
+
+// RoundTrip implements http.RoundTripper
+func (s *stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	nsid := strings.TrimPrefix(req.URL.Path, "/xrpc/")
+	r, ok := s.responses[nsid]
+	s.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unexpected XRPC call to %s", nsid)
+	}
+
+	if r.delay > 0 {
+		select {
+		case <-time.After(r.delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+
+	resp := &http.Response{
+		StatusCode: r.status,
+		Body:       io.NopCloser(strings.NewReader(r.body)),
+		Header:     make(http.Header),
+		Request:    req,
+	}
+	for k, v := range r.header {
+		resp.Header[k] = v
+	}
+	resp.Header.Set("Content-Type", "application/json")
+	return resp, nil
+}
+
+// lastRequest returns the most recent request made to the given XRPC method
+func (s *stubTransport) lastRequest(nsid string) *http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.requests) - 1; i >= 0; i-- {
+		if strings.TrimPrefix(s.requests[i].URL.Path, "/xrpc/") == nsid {
+			return s.requests[i]
+		}
+	}
+	return nil
+}
+
+// newStubServer creates an AppView-mode server whose XRPC client is backed by the stub
+func newStubServer(stub *stubTransport) *Server {
+	return &Server{
+		e: echo.New(),
+		xrpcc: &xrpc.Client{
+			Host:   "https://mock.bsky.test",
+			Client: &http.Client{Transport: stub},
+		},
+		FeedDefaultLimit: defaultFeedLimit,
+		FeedMaxLimit:     defaultFeedMaxLimit,
+	}
+}
+
+// fakeDirectory is an identity.Directory returning canned identities. It
+// can fail every lookup and records purges, which the mock directory in
+// indigo cannot, so handler tests can cover resolution errors and cache
+// invalidation end to end.
+type fakeDirectory struct {
+	mu      sync.Mutex
+	byDID   map[syntax.DID]*identity.Identity
+	err     error                 // Returned by every lookup when set
+	lookups int                   // Number of lookups made
+	purged  []syntax.AtIdentifier // Identifiers purged, in order
+}
+
+func newFakeDirectory() *fakeDirectory {
+	return &fakeDirectory{byDID: map[syntax.DID]*identity.Identity{}}
+}
+
+// add registers an identity for handle and did
+func (d *fakeDirectory) add(handle, did string) *fakeDirectory {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.byDID[syntax.DID(did)] = &identity.Identity{DID: syntax.DID(did), Handle: syntax.Handle(handle)}
+	return d
+}
+
+func (d *fakeDirectory) LookupHandle(ctx context.Context, handle syntax.Handle) (*identity.Identity, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lookups++
+	if d.err != nil {
+		return nil, d.err
+	}
+	for _, ident := range d.byDID {
+		if ident.Handle == handle.Normalize() {
+			return ident, nil
+		}
+	}
+	return nil, identity.ErrHandleNotFound
+}
+
+func (d *fakeDirectory) LookupDID(ctx context.Context, did syntax.DID) (*identity.Identity, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lookups++
+	if d.err != nil {
+		return nil, d.err
+	}
+	if ident, ok := d.byDID[did]; ok {
+		return ident, nil
+	}
+	return nil, identity.ErrDIDNotFound
+}
+
+func (d *fakeDirectory) Lookup(ctx context.Context, atid syntax.AtIdentifier) (*identity.Identity, error) {
+	if did, err := atid.AsDID(); err == nil {
+		return d.LookupDID(ctx, did)
+	}
+	handle, err := atid.AsHandle()
+	if err != nil {
+		return nil, err
+	}
+	return d.LookupHandle(ctx, handle)
+}
+
+func (d *fakeDirectory) Purge(ctx context.Context, atid syntax.AtIdentifier) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.purged = append(d.purged, atid)
+	return nil
+}
+
+// serveParam invokes a handler with a single URL parameter and query string
+func serveParam(srv *Server, h echo.HandlerFunc, name, value, query string) (*httptest.ResponseRecorder, error) {
+	req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+	rec := httptest.NewRecorder()
+	c := srv.e.NewContext(req, rec)
+	c.SetParamNames(name)
+	c.SetParamValues(value)
+	return rec, h(c)
+}
+
+// serveWildcard invokes a wildcard-routed handler for the given path and query
+func serveWildcard(srv *Server, h echo.HandlerFunc, wildcard, query string) (*httptest.ResponseRecorder, error) {
+	return serveParam(srv, h, "*", wildcard, query)
+}
+
+// httpStatus extracts the status code from a handler error
+func httpStatus(t *testing.T, err error) int {
+	t.Helper()
+	he, ok := err.(*echo.HTTPError)
+	require.True(t, ok, "expected *echo.HTTPError, got %T (%v)", err, err)
+	return he.Code
+}
+
+func TestHandleHealthCheck_Detail(t *testing.T) {
+	srv := newStubServer(newStubTransport())
+	check := func(secret string) string {
+		req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+		if secret != "" {
+			req.Header.Set(healthSecretHeader, secret)
+		}
+		rec := httptest.NewRecorder()
+		require.NoError(t, srv.HandleHealthCheck(srv.e.NewContext(req, rec)))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		return rec.Body.String()
+	}
+
+	// Public by default
+	assert.Contains(t, check(""), `"daemon":"athome"`)
+
+	srv.healthDetail = healthDetailMinimal
+	assert.JSONEq(t, `{"status": "ok"}`, check(""))
+
+	srv.healthDetail = healthDetailSecret
+	srv.healthSecret = "s3cret"
+	assert.JSONEq(t, `{"status": "ok"}`, check(""))
+	assert.JSONEq(t, `{"status": "ok"}`, check("wrong"))
+	detailed := check("s3cret")
+	assert.Contains(t, detailed, `"daemon":"athome"`)
+	assert.Contains(t, detailed, `"build"`)
+}
+
 func TestRefreshAuth_Concurrency(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -202,6 +435,77 @@ func TestRefreshAuth_Concurrency(t *testing.T) {
 	}
 }
 
+// testJWT builds a token from raw header and claims JSON with a dummy signature
+func testJWT(header, claims string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(header)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".c2lnbmF0dXJl"
+}
+
+func TestExtractTokenExpiry(t *testing.T) {
+	const header = `{"typ": "at+jwt", "alg": "HS256"}`
+	exp := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+	claims := fmt.Sprintf(`{"scope": "com.atproto.access", "sub": "did:plc:abc123", "exp": %d}`, exp.Unix())
+
+	assert.Equal(t, exp, extractTokenExpiry(testJWT(header, claims)))
+	assert.Equal(t, exp, extractTokenExpiry(testJWT(`{"alg": "ES256K"}`, claims)))
+
+	// Padded segments are accepted too
+	padded := base64.URLEncoding.EncodeToString([]byte(header)) + "." + base64.URLEncoding.EncodeToString([]byte(claims)) + ".c2ln"
+	assert.Equal(t, exp, extractTokenExpiry(padded))
+
+	// A token that just expired is trusted, so it gets refreshed at once
+	recent := time.Now().Add(-time.Minute).Truncate(time.Second)
+	assert.Equal(t, recent, extractTokenExpiry(testJWT(header, fmt.Sprintf(`{"exp": %d}`, recent.Unix()))))
+}
+
+func TestExtractTokenExpiry_Untrusted(t *testing.T) {
+	const header = `{"alg": "HS256"}`
+	valid := testJWT(header, fmt.Sprintf(`{"exp": %d}`, time.Now().Add(time.Hour).Unix()))
+	parts := strings.Split(valid, ".")
+
+	tests := map[string]string{
+		"not a jwt":             "not-a-jwt",
+		"too many segments":     valid + ".extra",
+		"missing signature":     parts[0] + "." + parts[1] + ".",
+		"empty claims":          parts[0] + ".." + parts[2],
+		"garbage claims":        parts[0] + ".!!!not-base64!!!." + parts[2],
+		"tampered claims":       parts[0] + "." + parts[1][:len(parts[1])-3] + "xyz." + parts[2],
+		"claims not json":       testJWT(header, `exp=1`),
+		"trailing claims data":  testJWT(header, fmt.Sprintf(`{"exp": %d} {}`, time.Now().Add(time.Hour).Unix())),
+		"unsigned alg":          testJWT(`{"alg": "none"}`, `{"exp": 1}`),
+		"missing alg":           testJWT(`{"typ": "JWT"}`, fmt.Sprintf(`{"exp": %d}`, time.Now().Add(time.Hour).Unix())),
+		"garbage header":        "!!!." + parts[1] + "." + parts[2],
+		"missing exp":           testJWT(header, `{"sub": "did:plc:abc123"}`),
+		"string exp":            testJWT(header, `{"exp": "1700000000"}`),
+		"long expired":          testJWT(header, fmt.Sprintf(`{"exp": %d}`, time.Now().Add(-24*time.Hour).Unix())),
+		"implausibly far ahead": testJWT(header, fmt.Sprintf(`{"exp": %d}`, time.Now().Add(365*24*time.Hour).Unix())),
+		"out of range exp":      testJWT(header, `{"exp": 1e30}`),
+	}
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.True(t, extractTokenExpiry(token).IsZero())
+		})
+	}
+}
+
+func TestParseNumericDate(t *testing.T) {
+	// 2^53+1 is not representable as a float64 and must not be rounded
+	exp, err := parseNumericDate("9007199254740993")
+	require.NoError(t, err)
+	assert.Equal(t, int64(9007199254740993), exp.Unix())
+
+	// Fractional and exponent forms are valid NumericDates
+	exp, err = parseNumericDate("1700000000.5")
+	require.NoError(t, err)
+	assert.Equal(t, time.Unix(1700000000, 500_000_000), exp)
+	exp, err = parseNumericDate("1.7e9")
+	require.NoError(t, err)
+	assert.Equal(t, time.Unix(1700000000, 0), exp)
+
+	_, err = parseNumericDate("1e30")
+	assert.Error(t, err)
+}
+
 func TestRefreshAuth_TokenExpiry(t *testing.T) {
 	mock := &mockXRPCClient{}
 	client := &xrpc.Client{
@@ -260,3 +564,1272 @@ func TestRefreshAuth_NoConfig(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "no auth configuration")
 }
+
+func TestRefreshAuth_Counts(t *testing.T) {
+	mock := &mockXRPCClient{}
+	mock.setShouldFail(true)
+	mock.setFailureCount(1)
+
+	srv := &Server{
+		e: echo.New(),
+		xrpcc: &xrpc.Client{
+			Host:   "https://mock.bsky.test",
+			Auth:   &xrpc.AuthInfo{},
+			Client: &http.Client{Transport: mock},
+		},
+		auth: &AuthConfig{Handle: "test.handle", Password: "test-pass"},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	c := srv.e.NewContext(req, httptest.NewRecorder())
+
+	// First attempt fails, second succeeds, third is a no-op
+	assert.Error(t, srv.refreshAuth(c))
+	require.NoError(t, srv.refreshAuth(c))
+	require.NoError(t, srv.refreshAuth(c))
+
+	succeeded, failed := srv.RefreshCounts()
+	assert.Equal(t, int64(1), succeeded)
+	assert.Equal(t, int64(1), failed)
+}
+
+func TestRefreshAuth_NoOpLogsNothingAtInfo(t *testing.T) {
+	srv := &Server{
+		e:     echo.New(),
+		xrpcc: newMockXRPCClient(),
+		auth: &AuthConfig{
+			Handle:    "test.handle",
+			Password:  "test-pass",
+			Token:     "existing-token",
+			RefreshAt: time.Now().Add(2 * time.Hour),
+		},
+	}
+
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})))
+	defer slog.SetDefault(prev)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	c := srv.e.NewContext(req, httptest.NewRecorder())
+
+	require.NoError(t, srv.ensureValidToken(c))
+	assert.Empty(t, buf.String(), "no-op refresh should not log at info level")
+
+	succeeded, failed := srv.RefreshCounts()
+	assert.Zero(t, succeeded)
+	assert.Zero(t, failed)
+}
+
+func TestHandleGetRepostedBy(t *testing.T) {
+	const postURI = "at://did:plc:abc123/app.bsky.feed.post/3kxyz"
+
+	stub := newStubTransport().on("app.bsky.feed.getRepostedBy", http.StatusOK, `{
+		"uri": "`+postURI+`",
+		"cursor": "next-page",
+		"repostedBy": [{"did": "did:plc:r1", "handle": "r1.test"}]
+	}`)
+	srv := newStubServer(stub)
+
+	rec, err := serveWildcard(srv, srv.handleGetRepostedBy, "did:plc:abc123/app.bsky.feed.post/3kxyz", "cursor=page-1&limit=25")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req := stub.lastRequest("app.bsky.feed.getRepostedBy")
+	require.NotNil(t, req)
+	assert.Equal(t, postURI, req.URL.Query().Get("uri"))
+	assert.Equal(t, "page-1", req.URL.Query().Get("cursor"))
+	assert.Equal(t, "25", req.URL.Query().Get("limit"))
+
+	assert.Contains(t, rec.Body.String(), `"cursor":"next-page"`)
+	assert.Contains(t, rec.Body.String(), `"handle":"r1.test"`)
+
+	// Over-max limits are clamped
+	_, err = serveWildcard(srv, srv.handleGetRepostedBy, postURI, "limit=1000")
+	require.NoError(t, err)
+	assert.Equal(t, "100", stub.lastRequest("app.bsky.feed.getRepostedBy").URL.Query().Get("limit"))
+}
+
+func TestHandleGetQuotes(t *testing.T) {
+	const postURI = "at://did:plc:abc123/app.bsky.feed.post/3kxyz"
+
+	stub := newStubTransport().on("app.bsky.feed.getQuotes", http.StatusOK, `{
+		"uri": "`+postURI+`",
+		"cursor": "next-page",
+		"posts": [{
+			"uri": "at://did:plc:q1/app.bsky.feed.post/1",
+			"cid": "bafyreib2rxk3rh6kzwq",
+			"author": {"did": "did:plc:q1", "handle": "q1.test"},
+			"record": {"$type": "app.bsky.feed.post", "text": "look at this", "createdAt": "2024-01-01T00:00:00Z"},
+			"indexedAt": "2024-01-01T00:00:00Z"
+		}]
+	}`)
+	srv := newStubServer(stub)
+
+	rec, err := serveWildcard(srv, srv.handleGetQuotes, "did:plc:abc123/app.bsky.feed.post/3kxyz", "cursor=page-1&limit=25")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req := stub.lastRequest("app.bsky.feed.getQuotes")
+	require.NotNil(t, req)
+	assert.Equal(t, postURI, req.URL.Query().Get("uri"))
+	assert.Equal(t, "page-1", req.URL.Query().Get("cursor"))
+	assert.Equal(t, "25", req.URL.Query().Get("limit"))
+
+	assert.Contains(t, rec.Body.String(), `"cursor":"next-page"`)
+	assert.Contains(t, rec.Body.String(), `"text":"look at this"`)
+
+	// A post nobody quoted has an empty list, not null
+	stub.on("app.bsky.feed.getQuotes", http.StatusOK, `{"uri": "`+postURI+`", "posts": null}`)
+	rec, err = serveWildcard(srv, srv.handleGetQuotes, postURI, "")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"uri": "`+postURI+`", "cursor": null, "posts": []}`, rec.Body.String())
+}
+
+func TestHandleGetQuotes_Errors(t *testing.T) {
+	stub := newStubTransport().on("app.bsky.feed.getQuotes", http.StatusNotFound,
+		`{"error": "NotFound", "message": "post not found"}`)
+	srv := newStubServer(stub)
+
+	_, err := serveWildcard(srv, srv.handleGetQuotes, "did:plc:abc123/app.bsky.feed.post/missing", "")
+	assert.Equal(t, http.StatusNotFound, httpStatus(t, err))
+
+	_, err = serveWildcard(srv, srv.handleGetQuotes, "not a uri", "")
+	assert.Equal(t, http.StatusBadRequest, httpStatus(t, err))
+
+	_, err = serveWildcard(srv, srv.handleGetQuotes, "did:plc:abc123/app.bsky.feed.post/3kxyz", "cursor=%00")
+	assert.Equal(t, http.StatusBadRequest, httpStatus(t, err))
+}
+
+func TestHandleGetRepostedBy_Errors(t *testing.T) {
+	stub := newStubTransport().on("app.bsky.feed.getRepostedBy", http.StatusNotFound,
+		`{"error": "NotFound", "message": "post not found"}`)
+	srv := newStubServer(stub)
+
+	_, err := serveWildcard(srv, srv.handleGetRepostedBy, "did:plc:abc123/app.bsky.feed.post/missing", "")
+	assert.Equal(t, http.StatusNotFound, httpStatus(t, err))
+
+	_, err = serveWildcard(srv, srv.handleGetRepostedBy, "not a uri", "")
+	assert.Equal(t, http.StatusBadRequest, httpStatus(t, err))
+
+	_, err = serveWildcard(srv, srv.handleGetRepostedBy, "did:plc:abc123/app.bsky.feed.post/3kxyz", "limit=abc")
+	assert.Equal(t, http.StatusBadRequest, httpStatus(t, err))
+}
+
+func TestHandleGetLikes(t *testing.T) {
+	const postURI = "at://did:plc:abc123/app.bsky.feed.post/3kxyz"
+
+	stub := newStubTransport().on("app.bsky.feed.getLikes", http.StatusOK, `{
+		"uri": "`+postURI+`",
+		"cursor": "likes-next",
+		"likes": [{"createdAt": "2024-01-01T00:00:00Z", "indexedAt": "2024-01-01T00:00:00Z", "actor": {"did": "did:plc:l1", "handle": "l1.test"}}]
+	}`)
+	srv := newStubServer(stub)
+
+	rec, err := serveWildcard(srv, srv.handleGetLikes, postURI, "cursor=likes-1")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req := stub.lastRequest("app.bsky.feed.getLikes")
+	require.NotNil(t, req)
+	assert.Equal(t, postURI, req.URL.Query().Get("uri"))
+	assert.Equal(t, "likes-1", req.URL.Query().Get("cursor"))
+	assert.Contains(t, rec.Body.String(), `"cursor":"likes-next"`)
+	assert.Contains(t, rec.Body.String(), `"handle":"l1.test"`)
+}
+
+func TestHandleGetLikes_Empty(t *testing.T) {
+	stub := newStubTransport().on("app.bsky.feed.getLikes", http.StatusOK,
+		`{"uri": "at://did:plc:abc123/app.bsky.feed.post/3kxyz"}`)
+	srv := newStubServer(stub)
+
+	rec, err := serveWildcard(srv, srv.handleGetLikes, "did:plc:abc123/app.bsky.feed.post/3kxyz", "")
+	require.NoError(t, err)
+	assert.Contains(t, rec.Body.String(), `"likes":[]`)
+
+	stub.on("app.bsky.feed.getLikes", http.StatusNotFound, `{"error": "NotFound", "message": "post not found"}`)
+	_, err = serveWildcard(srv, srv.handleGetLikes, "did:plc:abc123/app.bsky.feed.post/gone", "")
+	assert.Equal(t, http.StatusNotFound, httpStatus(t, err))
+}
+
+func TestValidateAndGetDID_HandleAllowlistGatesDIDs(t *testing.T) {
+	dir := newFakeDirectory().add("alice.test", "did:plc:alice").add("mallory.test", "did:plc:mallory")
+	stub := newStubTransport().
+		on("app.bsky.actor.getProfile", http.StatusOK, `{"did": "did:plc:alice", "handle": "alice.test"}`).
+		on("app.bsky.feed.getAuthorFeed", http.StatusOK, `{"feed": []}`)
+
+	// Only the handle allowlist is set
+	srv, err := setupServer(":0", &xrpc.Client{Host: "https://mock.bsky.test", Client: &http.Client{Transport: stub}}, dir, []string{"alice.test"}, nil, "", nil)
+	require.NoError(t, err)
+
+	// A DID is served only when its verified handle is allowed
+	assert.Equal(t, http.StatusOK, serveRoute(srv, "/api/profile/did/did:plc:alice").Code)
+	assert.Equal(t, http.StatusOK, serveRoute(srv, "/api/feed/did/did:plc:alice").Code)
+	assert.Equal(t, http.StatusForbidden, serveRoute(srv, "/api/profile/did/did:plc:mallory").Code)
+	assert.Equal(t, http.StatusForbidden, serveRoute(srv, "/api/feed/did/did:plc:mallory").Code)
+	assert.Equal(t, http.StatusForbidden, serveRoute(srv, "/api/did-doc/did/did:plc:mallory").Code)
+	assert.Equal(t, http.StatusNotFound, serveRoute(srv, "/api/profile/did/did:plc:nobody").Code)
+	assert.Equal(t, "did:plc:alice", stub.lastRequest("app.bsky.feed.getAuthorFeed").URL.Query().Get("actor"))
+
+	// A failing directory fails closed
+	dir.err = fmt.Errorf("plc directory unavailable")
+	rec := serveRoute(srv, "/api/profile/did/did:plc:mallory")
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "plc directory unavailable")
+}
+
+func TestHandleGetProfile_ByDID(t *testing.T) {
+	stub := newStubTransport().on("app.bsky.actor.getProfile", http.StatusOK,
+		`{"did": "did:plc:abc123", "handle": "alice.test", "displayName": "Alice"}`)
+
+	tests := []struct {
+		name       string
+		did        string
+		validDIDs  []string
+		wantStatus int
+	}{
+		{name: "valid plc DID", did: "did:plc:abc123", wantStatus: http.StatusOK},
+		{name: "valid web DID", did: "did:web:alice.test", wantStatus: http.StatusOK},
+		{name: "allowed DID", did: "did:plc:abc123", validDIDs: []string{"did:plc:abc123"}, wantStatus: http.StatusOK},
+		{name: "invalid DID", did: "did:nope", wantStatus: http.StatusBadRequest},
+		{name: "disallowed DID", did: "did:plc:other", validDIDs: []string{"did:plc:abc123"}, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newStubServer(stub)
+			srv.validDIDs = tt.validDIDs
+
+			rec, err := serveParam(srv, srv.handleGetProfile, "did", tt.did, "")
+			if tt.wantStatus == http.StatusOK {
+				require.NoError(t, err)
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, tt.did, stub.lastRequest("app.bsky.actor.getProfile").URL.Query().Get("actor"))
+				return
+			}
+			assert.Equal(t, tt.wantStatus, httpStatus(t, err))
+		})
+	}
+}
+
+func TestHandleGetProfile_Viewer(t *testing.T) {
+	// AppView mode: no viewer block upstream, none in the response
+	stub := newStubTransport().on("app.bsky.actor.getProfile", http.StatusOK,
+		`{"did": "did:plc:abc123", "handle": "alice.test"}`)
+	srv := newStubServer(stub)
+
+	rec, err := serveParam(srv, srv.handleGetProfile, "did", "did:plc:abc123", "")
+	require.NoError(t, err)
+	assert.NotContains(t, rec.Body.String(), `"viewer"`)
+
+	// Authenticated mode: relationship state is passed through
+	stub.on("app.bsky.actor.getProfile", http.StatusOK, `{
+		"did": "did:plc:abc123",
+		"handle": "alice.test",
+		"viewer": {"following": "at://did:plc:me/app.bsky.graph.follow/1", "muted": false}
+	}`)
+	rec, err = serveParam(srv, srv.handleGetProfile, "did", "did:plc:abc123", "")
+	require.NoError(t, err)
+
+	var body map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Contains(t, body, "viewer")
+	assert.JSONEq(t, `{"following": "at://did:plc:me/app.bsky.graph.follow/1", "muted": false}`, string(body["viewer"]))
+}
+
+func TestHandleGetProfile_Verification(t *testing.T) {
+	stub := newStubTransport().on("app.bsky.actor.getProfile", http.StatusOK,
+		`{"did": "did:plc:abc123", "handle": "alice.test"}`)
+	srv := newStubServer(stub)
+
+	rec, err := serveParam(srv, srv.handleGetProfile, "did", "did:plc:abc123", "")
+	require.NoError(t, err)
+	assert.NotContains(t, rec.Body.String(), `"verification"`)
+
+	stub.on("app.bsky.actor.getProfile", http.StatusOK, `{
+		"did": "did:plc:abc123",
+		"handle": "alice.test",
+		"verification": {
+			"verifiedStatus": "valid",
+			"trustedVerifierStatus": "none",
+			"verifications": [
+				{"issuer": "did:plc:verifier", "uri": "at://did:plc:verifier/app.bsky.graph.verification/1", "isValid": true, "createdAt": "2025-04-21T10:00:00Z"},
+				{"issuer": "did:plc:stale", "uri": "at://did:plc:stale/app.bsky.graph.verification/1", "isValid": false, "createdAt": "2025-04-01T10:00:00Z"}
+			]
+		}
+	}`)
+	rec, err = serveParam(srv, srv.handleGetProfile, "did", "did:plc:abc123", "")
+	require.NoError(t, err)
+
+	var body map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Contains(t, body, "verification")
+	assert.JSONEq(t, `{"verified": true, "trustedVerifier": false, "verifiers": ["did:plc:verifier"]}`, string(body["verification"]))
+}
+
+func TestValidateAndGetDID_AllowedDIDs(t *testing.T) {
+	dir := identity.NewMockDirectory()
+	dir.Insert(identity.Identity{
+		DID:    syntax.DID("did:plc:alice"),
+		Handle: syntax.Handle("alice.test"),
+	})
+
+	tests := []struct {
+		name         string
+		validHandles []string
+		validDIDs    []string
+		wantStatus   int
+	}{
+		{name: "no lists allows all", wantStatus: http.StatusOK},
+		{name: "resolved DID allowed", validDIDs: []string{"did:plc:alice"}, wantStatus: http.StatusOK},
+		{name: "resolved DID not allowed", validDIDs: []string{"did:plc:bob"}, wantStatus: http.StatusForbidden},
+		{name: "handle allowed but DID not", validHandles: []string{"alice.test"}, validDIDs: []string{"did:plc:bob"}, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &Server{
+				e:            echo.New(),
+				dir:          &dir,
+				validHandles: tt.validHandles,
+				validDIDs:    tt.validDIDs,
+			}
+			c := srv.e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+
+			did, err := srv.validateAndGetDID(c, "alice.test")
+			if tt.wantStatus == http.StatusOK {
+				require.NoError(t, err)
+				assert.Equal(t, "did:plc:alice", did)
+				return
+			}
+			assert.Equal(t, tt.wantStatus, httpStatus(t, err))
+		})
+	}
+}
+
+func TestValidateAndGetDID_NormalizesHandle(t *testing.T) {
+	dir := identity.NewMockDirectory()
+	dir.Insert(identity.Identity{
+		DID:    syntax.DID("did:plc:alice"),
+		Handle: syntax.Handle("alice.test"),
+	})
+
+	tests := []struct {
+		actor        string
+		validHandles []string
+	}{
+		{actor: "Alice.Test", validHandles: []string{"alice.test"}},
+		{actor: "alice.test.", validHandles: []string{"alice.test"}},
+		{actor: "ALICE.TEST.", validHandles: []string{"bob.test", "alice.test"}},
+		{actor: "alice.test", validHandles: []string{"Alice.Test."}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.actor, func(t *testing.T) {
+			srv := &Server{e: echo.New(), dir: &dir, validHandles: tt.validHandles}
+			c := srv.e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+
+			did, err := srv.validateAndGetDID(c, tt.actor)
+			require.NoError(t, err)
+			assert.Equal(t, "did:plc:alice", did)
+		})
+	}
+
+	// Normalizing does not loosen the allowlist
+	srv := &Server{e: echo.New(), dir: &dir, validHandles: []string{"bob.test"}}
+	c := srv.e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	_, err := srv.validateAndGetDID(c, "Alice.Test.")
+	assert.Equal(t, http.StatusForbidden, httpStatus(t, err))
+}
+
+func TestGetHandleFromRequest_NormalizesParam(t *testing.T) {
+	e := echo.New()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	c.SetParamNames("handle")
+	c.SetParamValues("Alice.bsky.social.")
+	assert.Equal(t, "alice.bsky.social", getHandleFromRequest(c))
+}
+
+func TestReadClientSelection(t *testing.T) {
+	pds := newStubTransport().on("com.atproto.server.createSession", http.StatusOK,
+		`{"accessJwt": "pds-token", "refreshJwt": "pds-refresh", "handle": "owner.test", "did": "did:plc:owner"}`)
+	pds.on("app.bsky.actor.getSuggestions", http.StatusOK, `{"actors": []}`).
+		on("app.bsky.notification.getUnreadCount", http.StatusOK, `{"count": 2}`)
+	appview := newStubTransport().
+		on("app.bsky.actor.getProfile", http.StatusOK, `{"did": "did:plc:abc123", "handle": "alice.test"}`).
+		on("app.bsky.feed.getAuthorFeed", http.StatusOK, `{"feed": []}`).
+		on("app.bsky.feed.getPostThread", http.StatusOK, `{"thread": {"$type": "app.bsky.feed.defs#notFoundPost", "uri": "at://did:plc:abc123/app.bsky.feed.post/3kxyz", "notFound": true}}`)
+
+	srv := &Server{
+		e: echo.New(),
+		xrpcc: &xrpc.Client{
+			Host:   "https://pds.test",
+			Client: &http.Client{Transport: pds},
+		},
+		readc: &xrpc.Client{
+			Host:   "https://appview.test",
+			Client: &http.Client{Transport: appview},
+		},
+		auth: &AuthConfig{Handle: "owner.test", Password: "test-pass"},
+	}
+
+	_, err := serveParam(srv, srv.handleGetProfile, "did", "did:plc:abc123", "")
+	require.NoError(t, err)
+	_, err = serveWildcard(srv, srv.handleGetPost, "did:plc:abc123/app.bsky.feed.post/3kxyz", "")
+	require.NoError(t, err)
+	_, err = serveParam(srv, srv.handleGetFeed, "did", "did:plc:abc123", "")
+	require.NoError(t, err)
+	_, err = serveParam(srv, srv.handleGetSuggestions, "", "", "")
+	require.NoError(t, err)
+	_, err = serveParam(srv, srv.handleGetUnreadCount, "", "", "")
+	require.NoError(t, err)
+
+	// Authentication goes to the PDS, hydrated reads go to the AppView
+	assert.NotNil(t, pds.lastRequest("com.atproto.server.createSession"))
+	for _, nsid := range []string{"app.bsky.actor.getProfile", "app.bsky.feed.getPostThread", "app.bsky.feed.getAuthorFeed"} {
+		assert.Nil(t, pds.lastRequest(nsid), nsid)
+		require.NotNil(t, appview.lastRequest(nsid), nsid)
+		assert.Empty(t, appview.lastRequest(nsid).Header.Get("Authorization"), nsid)
+	}
+
+	// Calls made as the account stay on the PDS
+	for _, nsid := range []string{"app.bsky.actor.getSuggestions", "app.bsky.notification.getUnreadCount"} {
+		assert.Nil(t, appview.lastRequest(nsid), nsid)
+		require.NotNil(t, pds.lastRequest(nsid), nsid)
+		assert.Equal(t, "Bearer pds-token", pds.lastRequest(nsid).Header.Get("Authorization"), nsid)
+	}
+
+	// Without a separate read client everything shares the primary client
+	srv.readc = nil
+	assert.Same(t, srv.xrpcc, srv.readClient())
+}
+
+func TestFormatTitle(t *testing.T) {
+	tests := []struct {
+		name        string
+		format      string
+		siteTitle   string
+		handle      string
+		displayName string
+		want        string
+	}{
+		{name: "defaults", handle: "alice.test", want: "@alice.test"},
+		{name: "display name", format: "{displayName} (@{handle})", handle: "alice.test", displayName: "Alice", want: "Alice (@alice.test)"},
+		{name: "display name fallback", format: "{displayName} (@{handle})", handle: "alice.test", want: "alice.test (@alice.test)"},
+		{name: "site title placeholder", format: "@{handle} | {siteTitle}", siteTitle: "My Site", handle: "alice.test", want: "@alice.test | My Site"},
+		{name: "no handle uses site title", format: "{displayName}", siteTitle: "My Site", want: "My Site"},
+		{name: "no handle default site title", want: "AtHome"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, formatTitle(tt.format, tt.siteTitle, tt.handle, tt.displayName))
+		})
+	}
+}
+
+func TestPageTitle(t *testing.T) {
+	dir := identity.NewMockDirectory()
+	dir.Insert(identity.Identity{DID: syntax.DID("did:plc:alice"), Handle: syntax.Handle("alice.test")})
+
+	newTitleServer := func(stub *stubTransport) *Server {
+		srv := newStubServer(stub)
+		srv.dir = &dir
+		srv.titleFormat = "{displayName} (@{handle})"
+		srv.profiles = newTTLCache[*ProfileView](time.Minute, defaultProfileCacheMaxEntries)
+		return srv
+	}
+	newContext := func(srv *Server) echo.Context {
+		return srv.e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	}
+
+	t.Run("uses cached display name", func(t *testing.T) {
+		stub := newStubTransport().on("app.bsky.actor.getProfile", http.StatusOK,
+			`{"did": "did:plc:alice", "handle": "alice.test", "displayName": "Alice"}`)
+		srv := newTitleServer(stub)
+
+		assert.Equal(t, "Alice (@alice.test)", srv.pageTitle(newContext(srv), "alice.test"))
+		assert.Equal(t, "Alice (@alice.test)", srv.pageTitle(newContext(srv), "alice.test"))
+
+		// Second render is served from the profile cache
+		stub.mu.Lock()
+		assert.Len(t, stub.requests, 1)
+		stub.mu.Unlock()
+	})
+
+	t.Run("falls back to handle when profile fetch fails", func(t *testing.T) {
+		stub := newStubTransport().on("app.bsky.actor.getProfile", http.StatusInternalServerError,
+			`{"error": "InternalServerError", "message": "boom"}`)
+		srv := newTitleServer(stub)
+
+		assert.Equal(t, "alice.test (@alice.test)", srv.pageTitle(newContext(srv), "alice.test"))
+	})
+
+	t.Run("skips the fetch when the format has no display name", func(t *testing.T) {
+		stub := newStubTransport()
+		srv := newTitleServer(stub)
+		srv.titleFormat = ""
+
+		assert.Equal(t, "@alice.test", srv.pageTitle(newContext(srv), "alice.test"))
+		assert.Empty(t, stub.requests)
+	})
+}
+
+func TestGetCursorFromRequest(t *testing.T) {
+	srv := newStubServer(newStubTransport())
+
+	cursorFor := func(query string) (string, error) {
+		req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		return getCursorFromRequest(srv.e.NewContext(req, httptest.NewRecorder()))
+	}
+
+	cursor, err := cursorFor("")
+	require.NoError(t, err)
+	assert.Equal(t, "", cursor)
+
+	// Valid cursors are echoed unchanged
+	cursor, err = cursorFor("cursor=" + url.QueryEscape("1704067200000::bafy/abc+="))
+	require.NoError(t, err)
+	assert.Equal(t, "1704067200000::bafy/abc+=", cursor)
+
+	for name, query := range map[string]string{
+		"empty":     "cursor=",
+		"oversized": "cursor=" + strings.Repeat("a", maxCursorLength+1),
+		"control":   "cursor=abc%00def",
+		"newline":   "cursor=abc%0Adef",
+		"bad utf-8": "cursor=%FF%FE",
+	} {
+		_, err := cursorFor(query)
+		assert.Equal(t, http.StatusBadRequest, httpStatus(t, err), name)
+	}
+
+	// Handlers reject bad cursors before calling upstream
+	stub := newStubTransport()
+	srv = newStubServer(stub)
+	_, err = serveWildcard(srv, srv.handleGetLikes, "did:plc:abc123/app.bsky.feed.post/3kxyz", "cursor=%07")
+	assert.Equal(t, http.StatusBadRequest, httpStatus(t, err))
+	assert.Nil(t, stub.lastRequest("app.bsky.feed.getLikes"))
+}
+
+func TestHandleGetFeed_Limit(t *testing.T) {
+	stub := newStubTransport().on("app.bsky.feed.getAuthorFeed", http.StatusOK, `{"feed": []}`)
+	srv := newStubServer(stub)
+	srv.FeedDefaultLimit = 10
+	srv.FeedMaxLimit = 30
+
+	_, err := serveParam(srv, srv.handleGetFeed, "did", "did:plc:abc123", "")
+	require.NoError(t, err)
+	assert.Equal(t, "10", stub.lastRequest("app.bsky.feed.getAuthorFeed").URL.Query().Get("limit"))
+
+	// Over-max limits are clamped to FeedMaxLimit
+	_, err = serveParam(srv, srv.handleGetFeed, "did", "did:plc:abc123", "limit=500")
+	require.NoError(t, err)
+	assert.Equal(t, "30", stub.lastRequest("app.bsky.feed.getAuthorFeed").URL.Query().Get("limit"))
+
+	_, err = serveParam(srv, srv.handleGetFeed, "did", "did:plc:abc123", "limit=abc")
+	assert.Equal(t, http.StatusBadRequest, httpStatus(t, err))
+}
+
+func TestDegradedMode_FallsBackToAppView(t *testing.T) {
+	pds := newStubTransport().on("com.atproto.server.createSession", http.StatusUnauthorized,
+		`{"error": "AuthenticationRequired", "message": "Invalid identifier or password"}`)
+	appview := newStubTransport().on("app.bsky.actor.getProfile", http.StatusOK,
+		`{"did": "did:plc:abc123", "handle": "alice.test"}`)
+
+	srv := newStubServer(pds)
+	srv.auth = &AuthConfig{Handle: "alice.test", Password: "rotated"}
+	srv.fallbackc = &xrpc.Client{Host: "https://appview.test", Client: &http.Client{Transport: appview}}
+	srv.fallbackAfter = 3
+
+	// Reads fail until the failure threshold is reached
+	for i := 0; i < 2; i++ {
+		_, err := serveParam(srv, srv.handleGetProfile, "did", "did:plc:abc123", "")
+		assert.Equal(t, http.StatusInternalServerError, httpStatus(t, err))
+	}
+	assert.False(t, srv.degraded.Load())
+
+	// The third failure switches reads to the fallback AppView
+	for i := 0; i < 3; i++ {
+		rec, err := serveParam(srv, srv.handleGetProfile, "did", "did:plc:abc123", "")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"handle":"alice.test"`)
+	}
+	assert.True(t, srv.degraded.Load())
+	assert.NotNil(t, appview.lastRequest("app.bsky.actor.getProfile"))
+	assert.Nil(t, pds.lastRequest("app.bsky.actor.getProfile"))
+
+	// Degraded reads don't keep hammering the PDS with bad credentials
+	_, failed := srv.RefreshCounts()
+	assert.Equal(t, int64(3), failed)
+
+	// Auth-only calls have no fallback
+	c := srv.e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	assert.Equal(t, http.StatusServiceUnavailable, httpStatus(t, srv.ensureAuthToken(c)))
+
+	// A successful refresh leaves degraded mode
+	pds.on("com.atproto.server.createSession", http.StatusOK,
+		`{"accessJwt": "access", "refreshJwt": "refresh", "did": "did:plc:abc123", "handle": "alice.test"}`)
+	require.NoError(t, srv.refreshAuth(c))
+	assert.False(t, srv.degraded.Load())
+	assert.Same(t, srv.xrpcc, srv.readClient())
+}
+
+func TestDegradedMode_DisabledWithoutFallback(t *testing.T) {
+	pds := newStubTransport().on("com.atproto.server.createSession", http.StatusUnauthorized,
+		`{"error": "AuthenticationRequired"}`)
+	srv := newStubServer(pds)
+	srv.auth = &AuthConfig{Handle: "alice.test", Password: "rotated"}
+	srv.fallbackAfter = 3
+
+	for i := 0; i < 5; i++ {
+		_, err := serveParam(srv, srv.handleGetProfile, "did", "did:plc:abc123", "")
+		assert.Equal(t, http.StatusInternalServerError, httpStatus(t, err))
+	}
+	assert.False(t, srv.degraded.Load())
+}
+
+func TestHandleGetPostRecord(t *testing.T) {
+	const postURI = "at://did:plc:abc123/app.bsky.feed.post/3kxyz"
+
+	stub := newStubTransport().on("com.atproto.repo.getRecord", http.StatusOK, `{
+		"uri": "`+postURI+`",
+		"cid": "bafyrecord",
+		"value": {
+			"$type": "app.bsky.feed.post",
+			"text": "hola",
+			"langs": ["es"],
+			"createdAt": "2024-01-01T00:00:00Z"
+		}
+	}`)
+	srv := newStubServer(stub)
+
+	rec, err := serveWildcard(srv, srv.handleGetPostRecord, "did:plc:abc123/app.bsky.feed.post/3kxyz", "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req := stub.lastRequest("com.atproto.repo.getRecord")
+	require.NotNil(t, req)
+	assert.Equal(t, "did:plc:abc123", req.URL.Query().Get("repo"))
+	assert.Equal(t, "app.bsky.feed.post", req.URL.Query().Get("collection"))
+	assert.Equal(t, "3kxyz", req.URL.Query().Get("rkey"))
+
+	var body struct {
+		URI   string          `json:"uri"`
+		CID   string          `json:"cid"`
+		Value json.RawMessage `json:"value"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, postURI, body.URI)
+	assert.Equal(t, "bafyrecord", body.CID)
+	assert.JSONEq(t, `{"$type": "app.bsky.feed.post", "text": "hola", "langs": ["es"], "createdAt": "2024-01-01T00:00:00Z"}`, string(body.Value))
+
+	// Only post records are accepted
+	_, err = serveWildcard(srv, srv.handleGetPostRecord, "did:plc:abc123/app.bsky.feed.like/3kxyz", "")
+	assert.Equal(t, http.StatusBadRequest, httpStatus(t, err))
+
+	stub.on("com.atproto.repo.getRecord", http.StatusBadRequest, `{"error": "RecordNotFound", "message": "Could not locate record"}`)
+	_, err = serveWildcard(srv, srv.handleGetPostRecord, postURI, "")
+	assert.Equal(t, http.StatusNotFound, httpStatus(t, err))
+}
+
+func TestHandleGetFeed_LangFilter(t *testing.T) {
+	post := func(rkey, langs string) string {
+		record := `{"$type": "app.bsky.feed.post", "text": "` + rkey + `", "createdAt": "2024-01-01T00:00:00Z"`
+		if langs != "" {
+			record += `, "langs": ` + langs
+		}
+		record += `}`
+		return `{"post": {
+			"uri": "at://did:plc:abc123/app.bsky.feed.post/` + rkey + `",
+			"cid": "bafy` + rkey + `",
+			"author": {"did": "did:plc:abc123", "handle": "alice.test"},
+			"record": ` + record + `,
+			"indexedAt": "2024-01-01T00:00:00Z"
+		}}`
+	}
+	stub := newStubTransport().on("app.bsky.feed.getAuthorFeed", http.StatusOK, `{"feed": [`+
+		post("english", `["en"]`)+`,`+
+		post("american", `["en-US"]`)+`,`+
+		post("spanish", `["es"]`)+`,`+
+		post("bilingual", `["es", "en"]`)+`,`+
+		post("untagged", "")+`]}`)
+	srv := newStubServer(stub)
+
+	texts := func(query string) []string {
+		rec, err := serveParam(srv, srv.handleGetFeed, "did", "did:plc:abc123", query)
+		require.NoError(t, err)
+		var body struct {
+			Feed []struct {
+				Post struct {
+					Record struct {
+						Text string `json:"text"`
+					} `json:"record"`
+				} `json:"post"`
+			} `json:"feed"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		var out []string
+		for _, item := range body.Feed {
+			out = append(out, item.Post.Record.Text)
+		}
+		return out
+	}
+
+	assert.Equal(t, []string{"english", "american", "spanish", "bilingual", "untagged"}, texts(""))
+	assert.Equal(t, []string{"english", "american", "bilingual"}, texts("lang=en"))
+	assert.Equal(t, []string{"american"}, texts("lang=EN-us"))
+	assert.Equal(t, []string{"spanish", "bilingual"}, texts("lang=es"))
+	assert.Equal(t, []string{"english", "american", "spanish", "bilingual"}, texts("lang=es,en"))
+	assert.Empty(t, texts("lang=fr"))
+
+	_, err := serveParam(srv, srv.handleGetFeed, "did", "did:plc:abc123", "lang=not%20a%20tag")
+	assert.Equal(t, http.StatusBadRequest, httpStatus(t, err))
+}
+
+func TestHandleGetFeed_SkipsMalformedEntries(t *testing.T) {
+	stub := newStubTransport().on("app.bsky.feed.getAuthorFeed", http.StatusOK, `{"feed": [
+		null,
+		{"post": null},
+		{"post": {
+			"uri": "at://did:plc:abc123/app.bsky.feed.post/orphan",
+			"cid": "bafyorphan",
+			"record": {"$type": "app.bsky.feed.post", "text": "no author", "createdAt": "2024-01-01T00:00:00Z"},
+			"indexedAt": "2024-01-01T00:00:00Z"
+		}},
+		{"post": {
+			"uri": "at://did:plc:abc123/app.bsky.feed.post/ok",
+			"cid": "bafyok",
+			"author": {"did": "did:plc:abc123", "handle": "alice.test"},
+			"record": {"$type": "app.bsky.feed.post", "text": "fine", "createdAt": "2024-01-01T00:00:00Z"},
+			"indexedAt": "2024-01-01T00:00:00Z"
+		}}
+	]}`)
+	srv := newStubServer(stub)
+
+	for _, query := range []string{"", "lang=en", "fields=uri"} {
+		rec, err := serveParam(srv, srv.handleGetFeed, "did", "did:plc:abc123", query)
+		require.NoError(t, err, query)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NotContains(t, rec.Body.String(), "orphan", query)
+	}
+
+	rec, err := serveParam(srv, srv.handleGetFeed, "did", "did:plc:abc123", "")
+	require.NoError(t, err)
+	var body struct {
+		Feed []json.RawMessage `json:"feed"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Len(t, body.Feed, 1)
+	assert.Contains(t, string(body.Feed[0]), `"uri":"at://did:plc:abc123/app.bsky.feed.post/ok"`)
+}
+
+// roundTripFunc adapts a function to http.RoundTripper
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip implements http.RoundTripper
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestHandleGetFeed_FillsFromMultiplePages(t *testing.T) {
+	// Each upstream page holds one post by the owner and three reposts
+	var cursors []string
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		cursor := req.URL.Query().Get("cursor")
+		cursors = append(cursors, cursor)
+		page := 0
+		if cursor != "" {
+			page, _ = strconv.Atoi(strings.TrimPrefix(cursor, "page-"))
+		}
+
+		var items []string
+		for i := 0; i < 4; i++ {
+			author := "did:plc:other"
+			if i == 0 {
+				author = "did:plc:abc123"
+			}
+			items = append(items, fmt.Sprintf(`{"post": {
+				"uri": "at://%s/app.bsky.feed.post/%d-%d",
+				"cid": "bafy%d%d",
+				"author": {"did": %q, "handle": "someone.test"},
+				"record": {"$type": "app.bsky.feed.post", "text": "post", "createdAt": "2024-01-01T00:00:00Z"},
+				"indexedAt": "2024-01-01T00:00:00Z"
+			}}`, author, page, i, page, i, author))
+		}
+		body := fmt.Sprintf(`{"cursor": "page-%d", "feed": [%s]}`, page+1, strings.Join(items, ","))
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Request:    req,
+		}, nil
+	})
+
+	srv := newStubServer(newStubTransport())
+	srv.xrpcc.Client = &http.Client{Transport: transport}
+	srv.FeedMaxFetches = 5
+
+	feedOf := func(query string) (int, string) {
+		rec, err := serveParam(srv, srv.handleGetFeed, "did", "did:plc:abc123", query)
+		require.NoError(t, err)
+		var body struct {
+			Cursor string            `json:"cursor"`
+			Feed   []json.RawMessage `json:"feed"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		for _, item := range body.Feed {
+			assert.Contains(t, string(item), `"did":"did:plc:abc123"`)
+		}
+		return len(body.Feed), body.Cursor
+	}
+
+	// Three upstream pages fill a limit of three, resuming from the last cursor
+	count, cursor := feedOf("limit=3")
+	assert.Equal(t, 3, count)
+	assert.Equal(t, "page-3", cursor)
+	assert.Equal(t, []string{"", "page-1", "page-2"}, cursors)
+
+	// The fetch cap stops paging before the limit is reached
+	cursors = nil
+	count, cursor = feedOf("limit=10&cursor=page-3")
+	assert.Equal(t, 5, count)
+	assert.Equal(t, "page-8", cursor)
+	assert.Len(t, cursors, 5)
+}
+
+func TestHandleGetFeed_StopsAtEndOfFeed(t *testing.T) {
+	stub := newStubTransport().on("app.bsky.feed.getAuthorFeed", http.StatusOK, `{"feed": [{"post": {
+		"uri": "at://did:plc:other/app.bsky.feed.post/1",
+		"cid": "bafyother",
+		"author": {"did": "did:plc:other", "handle": "other.test"},
+		"record": {"$type": "app.bsky.feed.post", "text": "repost", "createdAt": "2024-01-01T00:00:00Z"},
+		"indexedAt": "2024-01-01T00:00:00Z"
+	}}]}`)
+	srv := newStubServer(stub)
+	srv.FeedMaxFetches = 5
+
+	rec, err := serveParam(srv, srv.handleGetFeed, "did", "did:plc:abc123", "")
+	require.NoError(t, err)
+	assert.Contains(t, rec.Body.String(), `"feed":[]`)
+	assert.Len(t, stub.requests, 1)
+}
+
+func TestHandleGetFeed_EmptyFeed(t *testing.T) {
+	// A new account without posts is an empty page, however upstream spells it
+	for _, body := range []string{`{"feed": []}`, `{"feed": null}`, `{}`} {
+		t.Run(body, func(t *testing.T) {
+			stub := newStubTransport().on("app.bsky.feed.getAuthorFeed", http.StatusOK, body)
+			srv := newStubServer(stub)
+
+			rec, err := serveParam(srv, srv.handleGetFeed, "did", "did:plc:abc123", "")
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.JSONEq(t, `{"cursor": null, "feed": [], "hasMore": false}`, rec.Body.String())
+		})
+	}
+}
+
+func TestHandleGetFeed_UpstreamErrorIsNotEmpty(t *testing.T) {
+	stub := newStubTransport().on("app.bsky.feed.getAuthorFeed", http.StatusInternalServerError, `{"error": "InternalServerError"}`)
+	srv := newStubServer(stub)
+
+	rec, err := serveParam(srv, srv.handleGetFeed, "did", "did:plc:abc123", "")
+	require.Error(t, err)
+	assert.GreaterOrEqual(t, httpStatus(t, err), http.StatusInternalServerError)
+	assert.Empty(t, rec.Body.String())
+}
+
+func TestUpstreamRateLimit(t *testing.T) {
+	reset := time.Now().Add(30 * time.Second).Unix()
+	stub := newStubTransport().onWithHeader("app.bsky.feed.getAuthorFeed", http.StatusTooManyRequests,
+		`{"error": "RateLimitExceeded", "message": "Rate Limit Exceeded"}`,
+		http.Header{
+			"Ratelimit-Limit":     []string{"3000"},
+			"Ratelimit-Remaining": []string{"0"},
+			"Ratelimit-Reset":     []string{strconv.FormatInt(reset, 10)},
+			"Ratelimit-Policy":    []string{"3000;w=300"},
+		})
+	srv := newStubServer(stub)
+
+	rec, err := serveParam(srv, srv.handleGetFeed, "did", "did:plc:abc123", "")
+	assert.Equal(t, http.StatusTooManyRequests, httpStatus(t, err))
+	retryAfter, convErr := strconv.Atoi(rec.Header().Get("Retry-After"))
+	require.NoError(t, convErr)
+	assert.InDelta(t, 30, retryAfter, 2)
+
+	// Without rate limit headers the status is still passed on
+	stub.on("app.bsky.feed.getAuthorFeed", http.StatusTooManyRequests, `{"error": "RateLimitExceeded"}`)
+	rec, err = serveParam(srv, srv.handleGetFeed, "did", "did:plc:abc123", "")
+	assert.Equal(t, http.StatusTooManyRequests, httpStatus(t, err))
+	assert.Empty(t, rec.Header().Get("Retry-After"))
+
+	// Other upstream failures remain internal errors
+	stub.on("app.bsky.feed.getAuthorFeed", http.StatusBadGateway, `{"error": "UpstreamFailure"}`)
+	_, err = serveParam(srv, srv.handleGetFeed, "did", "did:plc:abc123", "")
+	assert.Equal(t, http.StatusInternalServerError, httpStatus(t, err))
+}
+
+func TestUpstreamErrorMapping(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		expected int
+		message  string
+	}{
+		{"bad request", http.StatusBadRequest, `{"error": "InvalidRequest", "message": "actor must be a valid did or a handle"}`, http.StatusBadRequest, "actor must be a valid did or a handle"},
+		{"not found error name", http.StatusBadRequest, `{"error": "NotFound", "message": "Post not found"}`, http.StatusNotFound, "Post not found"},
+		{"not found status", http.StatusNotFound, `{"error": "NotFound"}`, http.StatusNotFound, "Not Found"},
+		{"unauthorized", http.StatusUnauthorized, `{"error": "ExpiredToken", "message": "Token has expired"}`, http.StatusBadGateway, "upstream rejected our credentials"},
+		{"forbidden", http.StatusForbidden, `{"error": "Forbidden"}`, http.StatusBadGateway, "upstream rejected our credentials"},
+		{"rate limited", http.StatusTooManyRequests, `{"error": "RateLimitExceeded"}`, http.StatusTooManyRequests, "upstream rate limit exceeded"},
+		{"server error", http.StatusServiceUnavailable, `{"error": "Unavailable", "message": "backend 10.0.0.7 is down"}`, http.StatusInternalServerError, "upstream request failed"},
+	}
+
+	handlers := []struct {
+		name   string
+		nsid   string
+		handle func(srv *Server) (*httptest.ResponseRecorder, error)
+	}{
+		{"profile", "app.bsky.actor.getProfile", func(srv *Server) (*httptest.ResponseRecorder, error) {
+			return serveParam(srv, srv.handleGetProfile, "did", "did:plc:abc123", "")
+		}},
+		{"feed", "app.bsky.feed.getAuthorFeed", func(srv *Server) (*httptest.ResponseRecorder, error) {
+			return serveParam(srv, srv.handleGetFeed, "did", "did:plc:abc123", "")
+		}},
+		{"post", "app.bsky.feed.getPostThread", func(srv *Server) (*httptest.ResponseRecorder, error) {
+			return serveWildcard(srv, srv.handleGetPost, "did:plc:abc123/app.bsky.feed.post/3kxyz", "")
+		}},
+	}
+
+	for _, h := range handlers {
+		for _, tt := range tests {
+			t.Run(h.name+"/"+tt.name, func(t *testing.T) {
+				srv := newStubServer(newStubTransport().on(h.nsid, tt.status, tt.body))
+				_, err := h.handle(srv)
+
+				var he *echo.HTTPError
+				require.ErrorAs(t, err, &he)
+				assert.Equal(t, tt.expected, he.Code)
+				if tt.message != "" {
+					assert.Equal(t, tt.message, he.Message)
+				}
+			})
+		}
+	}
+
+	// Transport failures don't leak the raw error either
+	srv := newStubServer(newStubTransport())
+	c := srv.e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	he := upstreamError(c, errors.New("dial tcp 10.0.0.7:443: connect: connection refused"))
+	assert.Equal(t, http.StatusInternalServerError, he.Code)
+	assert.Equal(t, "upstream request failed", he.Message)
+}
+
+func TestHandleGetProfile_UnavailableAccounts(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected int
+		message  string
+	}{
+		{"profile not found", `{"error": "InvalidRequest", "message": "Profile not found"}`, http.StatusNotFound, "profile not found"},
+		{"deactivated", `{"error": "AccountDeactivated", "message": "Account is deactivated"}`, http.StatusNotFound, "account is deactivated"},
+		{"taken down", `{"error": "AccountTakedown", "message": "Account has been suspended"}`, http.StatusUnavailableForLegalReasons, "account has been taken down"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newStubServer(newStubTransport().
+				on("app.bsky.actor.getProfile", http.StatusBadRequest, tt.body).
+				on("app.bsky.feed.getAuthorFeed", http.StatusBadRequest, tt.body))
+
+			_, err := serveParam(srv, srv.handleGetProfile, "did", "did:plc:abc123", "")
+			var he *echo.HTTPError
+			require.ErrorAs(t, err, &he)
+			assert.Equal(t, tt.expected, he.Code)
+			assert.Equal(t, tt.message, he.Message)
+
+			// The author feed reports the same account states
+			_, err = serveParam(srv, srv.handleGetFeed, "did", "did:plc:abc123", "")
+			assert.Equal(t, tt.expected, httpStatus(t, err))
+		})
+	}
+}
+
+func TestHostFallback(t *testing.T) {
+	dir := identity.NewMockDirectory()
+	dir.Insert(identity.Identity{DID: syntax.DID("did:plc:alice"), Handle: syntax.Handle("alice.test")})
+	stub := newStubTransport().on("app.bsky.actor.getProfile", http.StatusOK, `{"did": "did:plc:alice", "handle": "alice.test"}`)
+
+	srv, err := setupServer(":0", &xrpc.Client{Host: "https://mock.bsky.test", Client: &http.Client{Transport: stub}}, &dir, nil, nil, "", nil)
+	require.NoError(t, err)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Host = "alice.test:8080"
+		rec := httptest.NewRecorder()
+		srv.e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// By default the hostname names the handle
+	rec := get("/api/profile")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"handle":"alice.test"`)
+
+	// With the fallback disabled an explicit handle is required
+	srv.disableHostFallback = true
+	rec = get("/api/profile")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "this deployment requires an explicit handle")
+	assert.Equal(t, http.StatusBadRequest, get("/api/feed").Code)
+
+	rec = get("/api/profile/alice.test")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"handle":"alice.test"`)
+}
+
+func TestGetHandleFromRequest_Host(t *testing.T) {
+	tests := []struct {
+		host     string
+		expected string
+	}{
+		{"alice.example.com", "alice.example.com"},
+		{"alice.example.com:8080", "alice.example.com"},
+		{"Alice.Example.COM", "alice.example.com"},
+		{"alice.example.com.:8080", "alice.example.com"},
+		{"localhost", ""},
+		{"localhost:8080", ""},
+		{"127.0.0.1:8080", ""},
+		{"[::1]:8080", ""},
+		{"192.0.2.10", ""},
+	}
+
+	e := echo.New()
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Host = tt.host
+			assert.Equal(t, tt.expected, getHandleFromRequest(e.NewContext(req, httptest.NewRecorder())))
+		})
+	}
+}
+
+func TestHandleGetProfile_InvalidHostHandle(t *testing.T) {
+	srv := newStubServer(newStubTransport())
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Host = "localhost:8080"
+	err := srv.handleGetProfile(srv.e.NewContext(req, httptest.NewRecorder()))
+
+	var he *echo.HTTPError
+	require.ErrorAs(t, err, &he)
+	assert.Equal(t, http.StatusBadRequest, he.Code)
+	assert.Equal(t, "this deployment requires an explicit handle", he.Message)
+}
+
+func TestHostFallback_EmptyHost(t *testing.T) {
+	dir := identity.NewMockDirectory()
+	dir.Insert(identity.Identity{DID: syntax.DID("did:plc:alice"), Handle: syntax.Handle("alice.test")})
+	stub := newStubTransport().on("app.bsky.actor.getProfile", http.StatusOK, `{"did": "did:plc:alice", "handle": "alice.test"}`)
+
+	srv, err := setupServer(":0", &xrpc.Client{Host: "https://mock.bsky.test", Client: &http.Client{Transport: stub}}, &dir, nil, nil, "", nil)
+	require.NoError(t, err)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Host = ""
+		rec := httptest.NewRecorder()
+		srv.e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Without a default the error says why no handle could be found
+	rec := get("/api/profile")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "no Host header")
+
+	// With one the request is served for the default handle
+	srv.defaultHandle = "alice.test"
+	rec = get("/api/profile")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"handle":"alice.test"`)
+
+	// An explicit handle still wins
+	rec = get("/api/profile/bob.test")
+	assert.NotContains(t, rec.Body.String(), `"handle":"alice.test"`)
+}
+
+// newFakeDirectoryServer creates a fully routed server resolving handles
+// with dir and reading from the stub
+func newFakeDirectoryServer(t *testing.T, dir *fakeDirectory, stub *stubTransport, validDIDs []string) *Server {
+	t.Helper()
+	srv, err := setupServer(":0", &xrpc.Client{Host: "https://mock.bsky.test", Client: &http.Client{Transport: stub}}, dir, nil, validDIDs, "", nil)
+	require.NoError(t, err)
+	return srv
+}
+
+// serveRoute sends a GET request through the server's router
+func serveRoute(srv *Server, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	srv.e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestHandleGetProfile_FakeDirectory(t *testing.T) {
+	t.Run("resolves the handle to its DID", func(t *testing.T) {
+		dir := newFakeDirectory().add("alice.test", "did:plc:alice")
+		stub := newStubTransport().on("app.bsky.actor.getProfile", http.StatusOK, `{"did": "did:plc:alice", "handle": "alice.test", "displayName": "Alice"}`)
+		srv := newFakeDirectoryServer(t, dir, stub, nil)
+
+		rec := serveRoute(srv, "/api/profile/Alice.Test.")
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Contains(t, rec.Body.String(), `"displayName":"Alice"`)
+		assert.Equal(t, "did:plc:alice", stub.lastRequest("app.bsky.actor.getProfile").URL.Query().Get("actor"))
+		assert.Empty(t, dir.purged)
+	})
+
+	t.Run("directory failure", func(t *testing.T) {
+		dir := newFakeDirectory().add("alice.test", "did:plc:alice")
+		dir.err = fmt.Errorf("plc directory unavailable")
+		stub := newStubTransport()
+		srv := newFakeDirectoryServer(t, dir, stub, nil)
+
+		rec := serveRoute(srv, "/api/profile/alice.test")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Nil(t, stub.lastRequest("app.bsky.actor.getProfile"), "the upstream must not be called")
+	})
+
+	t.Run("resolved DID outside the allowlist", func(t *testing.T) {
+		dir := newFakeDirectory().add("mallory.test", "did:plc:mallory")
+		srv := newFakeDirectoryServer(t, dir, newStubTransport(), []string{"did:plc:alice"})
+
+		assert.Equal(t, http.StatusForbidden, serveRoute(srv, "/api/profile/mallory.test").Code)
+	})
+
+	t.Run("handle changed upstream", func(t *testing.T) {
+		dir := newFakeDirectory().add("alice.test", "did:plc:alice")
+		stub := newStubTransport().on("app.bsky.actor.getProfile", http.StatusOK, `{"did": "did:plc:alice", "handle": "alice.example.com"}`)
+		srv := newFakeDirectoryServer(t, dir, stub, nil)
+
+		rec := serveRoute(srv, "/api/profile/alice.test")
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		// The stale resolution is dropped for both the DID and the old handle
+		assert.Equal(t, []syntax.AtIdentifier{
+			syntax.DID("did:plc:alice").AtIdentifier(),
+			syntax.Handle("alice.test").AtIdentifier(),
+		}, dir.purged)
+	})
+}
+
+func TestHandleGetFeed_FakeDirectory(t *testing.T) {
+	dir := newFakeDirectory().add("alice.test", "did:plc:alice")
+	stub := newStubTransport().on("app.bsky.feed.getAuthorFeed", http.StatusOK, `{"feed": [{"post": {
+		"uri": "at://did:plc:alice/app.bsky.feed.post/1",
+		"cid": "bafyreib2rxk3rh6kzwq",
+		"author": {"did": "did:plc:alice", "handle": "alice.test"},
+		"record": {"$type": "app.bsky.feed.post", "text": "hello", "createdAt": "2024-01-01T00:00:00Z"},
+		"indexedAt": "2024-01-01T00:00:00Z"
+	}}]}`)
+	srv := newFakeDirectoryServer(t, dir, stub, nil)
+
+	rec := serveRoute(srv, "/api/feed/alice.test")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), `"text":"hello"`)
+	assert.Equal(t, "did:plc:alice", stub.lastRequest("app.bsky.feed.getAuthorFeed").URL.Query().Get("actor"))
+	assert.Equal(t, 1, dir.lookups)
+
+	// DID routes skip the directory entirely
+	rec = serveRoute(srv, "/api/feed/did/did:plc:alice")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 1, dir.lookups)
+}
+
+func TestHandleGetFeed_HasMore(t *testing.T) {
+	post := `{"post": {
+		"uri": "at://did:plc:abc123/app.bsky.feed.post/1",
+		"cid": "bafyreib2rxk3rh6kzwq",
+		"author": {"did": "did:plc:abc123", "handle": "alice.test"},
+		"record": {"$type": "app.bsky.feed.post", "text": "hi", "createdAt": "2024-01-01T00:00:00Z"},
+		"indexedAt": "2024-01-01T00:00:00Z"
+	}}`
+
+	for _, tt := range []struct {
+		name     string
+		body     string
+		expected bool
+	}{
+		{"cursor", `{"cursor": "next", "feed": [` + post + `]}`, true},
+		{"no cursor", `{"feed": [` + post + `]}`, false},
+		{"empty cursor", `{"cursor": "", "feed": [` + post + `]}`, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newStubServer(newStubTransport().on("app.bsky.feed.getAuthorFeed", http.StatusOK, tt.body))
+
+			rec, err := serveParam(srv, srv.handleGetFeed, "did", "did:plc:abc123", "")
+			require.NoError(t, err)
+			var body struct {
+				HasMore *bool `json:"hasMore"`
+			}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+			require.NotNil(t, body.HasMore)
+			assert.Equal(t, tt.expected, *body.HasMore)
+		})
+	}
+}
+
+func TestHandleGetFeed_InclusionRules(t *testing.T) {
+	post := func(rkey, author, extra string) string {
+		return `{"$type": "app.bsky.feed.defs#postView",
+			"uri": "at://` + author + `/app.bsky.feed.post/` + rkey + `",
+			"cid": "bafyreib2rxk3rh6kzwq",
+			"author": {"did": "` + author + `", "handle": "someone.test"},
+			"record": {"$type": "app.bsky.feed.post", "text": "` + rkey + `", "createdAt": "2024-01-01T00:00:00Z"},
+			"indexedAt": "2024-01-01T00:00:00Z"` + extra + `}`
+	}
+	quoteEmbed := `, "embed": {"$type": "app.bsky.embed.record#view", "record": {
+		"$type": "app.bsky.embed.record#viewRecord",
+		"uri": "at://did:plc:bob/app.bsky.feed.post/quoted",
+		"cid": "bafyreib2rxk3rh6kzwq",
+		"author": {"did": "did:plc:bob", "handle": "bob.test"},
+		"value": {"$type": "app.bsky.feed.post", "text": "quoted", "createdAt": "2024-01-01T00:00:00Z"},
+		"indexedAt": "2024-01-01T00:00:00Z"}}`
+	repost := `, "reason": {"$type": "app.bsky.feed.defs#reasonRepost", "by": {"did": "did:plc:alice", "handle": "alice.test"}, "indexedAt": "2024-01-02T00:00:00Z"}`
+	pin := `, "reason": {"$type": "app.bsky.feed.defs#reasonPin"}`
+
+	stub := newStubTransport().on("app.bsky.feed.getAuthorFeed", http.StatusOK, `{"feed": [
+		{"post": `+post("pinned", "did:plc:alice", "")+pin+`},
+		{"post": `+post("root", "did:plc:alice", "")+`},
+		{"post": `+post("self-reply", "did:plc:alice", "")+`,
+		 "reply": {"root": `+post("root", "did:plc:alice", "")+`, "parent": `+post("root", "did:plc:alice", "")+`}},
+		{"post": `+post("quote", "did:plc:alice", quoteEmbed)+`},
+		{"post": `+post("quote-of-alice", "did:plc:bob", "")+`},
+		{"post": `+post("reposted-other", "did:plc:bob", "")+repost+`},
+		{"post": `+post("root", "did:plc:alice", "")+repost+`}
+	]}`)
+	srv := newStubServer(stub)
+
+	rec, err := serveParam(srv, srv.handleGetFeed, "did", "did:plc:alice", "")
+	require.NoError(t, err)
+	var body struct {
+		Feed []struct {
+			Post struct {
+				Record struct {
+					Text string `json:"text"`
+				} `json:"record"`
+			} `json:"post"`
+		} `json:"feed"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body), rec.Body.String())
+	var texts []string
+	for _, item := range body.Feed {
+		texts = append(texts, item.Post.Record.Text)
+	}
+
+	// Self-threads and the owner's quote posts are kept; other authors'
+	// posts and every repost, even of the owner's own post, are dropped
+	assert.Equal(t, []string{"pinned", "root", "self-reply", "quote"}, texts)
+}
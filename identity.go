@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/labstack/echo/v4"
+)
+
+// defaultHandleRecheckInterval is how often the configured handles are
+// re-resolved to catch upstream handle changes (ATHOME_HANDLE_RECHECK_INTERVAL)
+const defaultHandleRecheckInterval = time.Hour
+
+// handleMismatch reports whether the profile returned for a requested
+// handle carries a different handle, meaning cached resolution is stale.
+func handleMismatch(requested string, profile *ProfileView) bool {
+	if requested == "" || profile == nil {
+		return false
+	}
+	return !strings.EqualFold(profile.Handle, requested)
+}
+
+// invalidateIdentity drops every cached view of a DID and the handles
+// that pointed at it, so the next request resolves them afresh.
+func (srv *Server) invalidateIdentity(ctx context.Context, did string, handles ...string) {
+	if parsed, err := syntax.ParseDID(did); err == nil {
+		if err := srv.purgeIdentity(ctx, parsed.AtIdentifier()); err != nil {
+			slog.Warn("failed to purge identity", "did", did, "error", err)
+		}
+	}
+	for _, h := range handles {
+		parsed, err := syntax.ParseHandle(h)
+		if err != nil {
+			continue
+		}
+		if err := srv.purgeIdentity(ctx, parsed.AtIdentifier()); err != nil {
+			slog.Warn("failed to purge identity", "handle", h, "error", err)
+		}
+	}
+}
+
+// recheckHandles re-resolves every configured handle bypassing the
+// directory cache and compares it with the handle on the fresh profile.
+// Stale entries are purged so titles and lookups pick up the change.
+func (srv *Server) recheckHandles(ctx context.Context) {
+	for _, h := range srv.allowedHandles() {
+		handle, err := syntax.ParseHandle(h)
+		if err != nil {
+			continue
+		}
+
+		// Force a fresh resolution of the handle
+		if err := srv.purgeIdentity(ctx, handle.AtIdentifier()); err != nil {
+			slog.Warn("failed to purge handle before recheck", "handle", h, "error", err)
+		}
+		ident, err := srv.dir.LookupHandle(ctx, handle)
+		if err != nil {
+			slog.Warn("handle no longer resolves", "handle", h, "error", err)
+			continue
+		}
+		did := ident.DID.String()
+
+		// Fetch the authoritative profile rather than a cached one
+		if srv.profiles != nil {
+			srv.profiles.delete(did)
+		}
+		profile, err := srv.getProfile(ctx, did)
+		if err != nil {
+			slog.Warn("failed to fetch profile during handle recheck", "handle", h, "did", did, "error", err)
+			continue
+		}
+
+		if handleMismatch(h, profile) {
+			slog.Warn("configured handle changed upstream",
+				"configured", h,
+				"current", profile.Handle,
+				"did", did)
+			srv.invalidateIdentity(ctx, did, h, profile.Handle)
+		}
+	}
+}
+
+// startHandleRecheck periodically re-resolves the configured handles
+// until ctx is cancelled.
+func (srv *Server) startHandleRecheck(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			slog.Debug("rechecking configured handles", "count", len(srv.allowedHandles()))
+			srv.recheckHandles(ctx)
+		}
+	}
+}
+
+// handleGetDIDDoc handles requests for an actor's resolved DID document,
+// for debugging identity problems. The handle is checked against the
+// allowed list before anything is returned.
+//
+// URL Parameters:
+//   - handle: Optional handle parameter (falls back to hostname)
+//   - did: Optional DID parameter, used instead of the handle when present
+//
+// Returns:
+//   - 200 OK with the DIDDocument
+//   - 400 Bad Request if handle or DID is invalid
+//   - 403 Forbidden if handle or DID is not allowed
+//   - 500 Internal Server Error if resolution fails
+func (srv *Server) handleGetDIDDoc(c echo.Context) error {
+	did, err := srv.validateAndGetDID(c, getActorFromRequest(c))
+	if err != nil {
+		return err
+	}
+
+	ident, err := srv.dir.LookupDID(c.Request().Context(), syntax.DID(did))
+	if err != nil {
+		if errors.Is(err, identity.ErrDIDNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "did not found")
+		}
+		slog.Error("failed to resolve did document", "did", did, "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to resolve DID document")
+	}
+
+	doc := DIDDocument{
+		DID:         ident.DID.String(),
+		Handle:      ident.Handle.String(),
+		AlsoKnownAs: ident.AlsoKnownAs,
+		PDS:         ident.PDSEndpoint(),
+		Services:    map[string]DIDService{},
+		Keys:        map[string]DIDKey{},
+	}
+	if doc.AlsoKnownAs == nil {
+		doc.AlsoKnownAs = []string{}
+	}
+	for id, svc := range ident.Services {
+		doc.Services[id] = DIDService{Type: svc.Type, URL: svc.URL}
+	}
+	for id, key := range ident.Keys {
+		doc.Keys[id] = DIDKey{Type: key.Type, PublicKeyMultibase: key.PublicKeyMultibase}
+	}
+
+	return c.JSON(http.StatusOK, doc)
+}
+
+// handleResolve resolves a handle to its DID, or a DID to its handle and
+// PDS, through the directory alone, without fetching a profile. It is a
+// developer utility; both directions respect the allowlists.
+//
+// Query Parameters:
+//   - handle: Handle to resolve to a DID
+//   - did: DID to resolve to its handle and PDS; exactly one of the two
+//
+// Returns:
+//   - 200 OK with Resolution
+//   - 400 Bad Request if neither or both are given, or either is invalid
+//   - 403 Forbidden if the handle or DID is not allowed
+//   - 404 Not Found if the handle or DID does not resolve
+//   - 500 Internal Server Error if resolution fails
+func (srv *Server) handleResolve(c echo.Context) error {
+	handle, did := c.QueryParam("handle"), c.QueryParam("did")
+	if (handle == "") == (did == "") {
+		return echo.NewHTTPError(http.StatusBadRequest, "exactly one of handle or did is required")
+	}
+	ctx := c.Request().Context()
+
+	if did != "" {
+		did, err := srv.validateAndParseDID(ctx, did)
+		if err != nil {
+			return err
+		}
+		ident, err := srv.dir.LookupDID(ctx, syntax.DID(did))
+		if err != nil {
+			if errors.Is(err, identity.ErrDIDNotFound) {
+				return echo.NewHTTPError(http.StatusNotFound, "did not found")
+			}
+			slog.Error("failed to resolve did", "did", did, "error", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to resolve did")
+		}
+		// The handle allowlist holds in this direction too
+		if err := srv.validateHandle(ident.Handle.String()); err != nil {
+			return echo.NewHTTPError(http.StatusForbidden, err.Error())
+		}
+		return c.JSON(http.StatusOK, Resolution{
+			DID:    ident.DID.String(),
+			Handle: ident.Handle.String(),
+			PDS:    ident.PDSEndpoint(),
+		})
+	}
+
+	handle = normalizeHandle(handle)
+	h, err := syntax.ParseHandle(handle)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid handle format")
+	}
+	if err := srv.validateHandle(handle); err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	}
+	ident, err := srv.dir.LookupHandle(ctx, h)
+	if err != nil {
+		if errors.Is(err, identity.ErrHandleNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "handle not found")
+		}
+		slog.Error("failed to resolve handle", "handle", handle, "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to resolve handle")
+	}
+	if err := srv.validateDID(ident.DID.String()); err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	}
+	return c.JSON(http.StatusOK, Resolution{DID: ident.DID.String(), Handle: handle})
+}
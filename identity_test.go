@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingDirectory wraps a directory and records every Purge
+type recordingDirectory struct {
+	identity.Directory
+	mu     sync.Mutex
+	purged []string
+}
+
+func (d *recordingDirectory) Purge(ctx context.Context, id syntax.AtIdentifier) error {
+	d.mu.Lock()
+	d.purged = append(d.purged, id.String())
+	d.mu.Unlock()
+	return d.Directory.Purge(ctx, id)
+}
+
+func (d *recordingDirectory) purges() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.purged...)
+}
+
+// staleDirectory serves a stale resolution for every handle until the
+// first Purge, then falls through to the wrapped directory
+type staleDirectory struct {
+	recordingDirectory
+	stale syntax.DID
+}
+
+func (d *staleDirectory) LookupHandle(ctx context.Context, h syntax.Handle) (*identity.Identity, error) {
+	if len(d.purges()) == 0 {
+		return &identity.Identity{DID: d.stale, Handle: h}, nil
+	}
+	return d.Directory.LookupHandle(ctx, h)
+}
+
+func TestHandleMismatch(t *testing.T) {
+	profile := &ProfileView{ActorDefs_ProfileViewDetailed: bsky.ActorDefs_ProfileViewDetailed{Handle: "alice.test"}}
+	assert.False(t, handleMismatch("alice.test", profile))
+	assert.False(t, handleMismatch("Alice.Test", profile))
+	assert.True(t, handleMismatch("old-alice.test", profile))
+	assert.False(t, handleMismatch("", profile))
+	assert.False(t, handleMismatch("alice.test", nil))
+}
+
+func TestRecheckHandles_HandleChanged(t *testing.T) {
+	mock := identity.NewMockDirectory()
+	mock.Insert(identity.Identity{DID: syntax.DID("did:plc:alice"), Handle: syntax.Handle("alice.test")})
+	dir := &recordingDirectory{Directory: &mock}
+
+	// The profile now reports a new handle for the same DID
+	stub := newStubTransport().on("app.bsky.actor.getProfile", http.StatusOK,
+		`{"did": "did:plc:alice", "handle": "alice-new.test"}`)
+	srv := newStubServer(stub)
+	srv.dir = dir
+	srv.validHandles = []string{"alice.test"}
+	srv.profiles = newTTLCache[*ProfileView](defaultProfileCacheTTL, defaultProfileCacheMaxEntries)
+	srv.profiles.set("did:plc:alice", &ProfileView{ActorDefs_ProfileViewDetailed: bsky.ActorDefs_ProfileViewDetailed{Did: "did:plc:alice", Handle: "alice.test"}})
+
+	srv.recheckHandles(context.Background())
+
+	assert.Contains(t, dir.purges(), "did:plc:alice")
+	assert.Contains(t, dir.purges(), "alice-new.test")
+	_, cached := srv.profiles.get("did:plc:alice")
+	assert.False(t, cached, "stale profile should be dropped")
+}
+
+func TestRecheckHandles_Unchanged(t *testing.T) {
+	mock := identity.NewMockDirectory()
+	mock.Insert(identity.Identity{DID: syntax.DID("did:plc:alice"), Handle: syntax.Handle("alice.test")})
+	dir := &recordingDirectory{Directory: &mock}
+
+	stub := newStubTransport().on("app.bsky.actor.getProfile", http.StatusOK,
+		`{"did": "did:plc:alice", "handle": "alice.test"}`)
+	srv := newStubServer(stub)
+	srv.dir = dir
+	srv.validHandles = []string{"alice.test"}
+
+	srv.recheckHandles(context.Background())
+
+	// Only the forced re-resolution of the handle itself
+	assert.Equal(t, []string{"alice.test"}, dir.purges())
+}
+
+func TestHandleGetProfile_PurgesOnHandleMismatch(t *testing.T) {
+	mock := identity.NewMockDirectory()
+	mock.Insert(identity.Identity{DID: syntax.DID("did:plc:alice"), Handle: syntax.Handle("alice.test")})
+	dir := &recordingDirectory{Directory: &mock}
+
+	stub := newStubTransport().on("app.bsky.actor.getProfile", http.StatusOK,
+		`{"did": "did:plc:alice", "handle": "alice-new.test"}`)
+	srv := newStubServer(stub)
+	srv.dir = dir
+
+	rec, err := serveParam(srv, srv.handleGetProfile, "handle", "alice.test", "")
+	require.NoError(t, err)
+	assert.Contains(t, rec.Body.String(), `"handle":"alice-new.test"`)
+	assert.ElementsMatch(t, []string{"did:plc:alice", "alice.test"}, dir.purges())
+}
+
+func TestHandleGetProfile_ReresolvesStaleDID(t *testing.T) {
+	mock := identity.NewMockDirectory()
+	mock.Insert(identity.Identity{DID: syntax.DID("did:plc:alice-new"), Handle: syntax.Handle("alice.test")})
+	dir := &staleDirectory{recordingDirectory: recordingDirectory{Directory: &mock}, stale: "did:plc:alice-old"}
+
+	// The account has moved away from the stale DID
+	var actors []string
+	srv := newStubServer(newStubTransport())
+	srv.dir = dir
+	srv.xrpcc.Client.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		actor := req.URL.Query().Get("actor")
+		actors = append(actors, actor)
+		status, body := http.StatusOK, `{"did": "did:plc:alice-new", "handle": "alice.test"}`
+		if actor == "did:plc:alice-old" {
+			status, body = http.StatusBadRequest, `{"error": "InvalidRequest", "message": "Profile not found"}`
+		}
+		return &http.Response{
+			StatusCode: status,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Request:    req,
+		}, nil
+	})
+
+	rec, err := serveParam(srv, srv.handleGetProfile, "handle", "alice.test", "")
+	require.NoError(t, err)
+	assert.Contains(t, rec.Body.String(), `"did":"did:plc:alice-new"`)
+	assert.Equal(t, []string{"alice.test"}, dir.purges())
+	assert.Equal(t, []string{"did:plc:alice-old", "did:plc:alice-new"}, actors)
+}
+
+func TestHandleGetProfile_NotFoundAfterReresolve(t *testing.T) {
+	mock := identity.NewMockDirectory()
+	mock.Insert(identity.Identity{DID: syntax.DID("did:plc:alice"), Handle: syntax.Handle("alice.test")})
+	dir := &recordingDirectory{Directory: &mock}
+
+	// Re-resolution yields the same DID, so the not-found stands
+	stub := newStubTransport().on("app.bsky.actor.getProfile", http.StatusBadRequest,
+		`{"error": "InvalidRequest", "message": "Profile not found"}`)
+	srv := newStubServer(stub)
+	srv.dir = dir
+
+	_, err := serveParam(srv, srv.handleGetProfile, "handle", "alice.test", "")
+	assert.Equal(t, http.StatusNotFound, httpStatus(t, err))
+	assert.Equal(t, []string{"alice.test"}, dir.purges())
+	assert.Len(t, stub.requests, 1)
+}
+
+func TestHandleGetDIDDoc(t *testing.T) {
+	dir := identity.NewMockDirectory()
+	dir.Insert(identity.Identity{
+		DID:         syntax.DID("did:plc:alice"),
+		Handle:      syntax.Handle("alice.test"),
+		AlsoKnownAs: []string{"at://alice.test"},
+		Services: map[string]identity.Service{
+			"atproto_pds": {Type: "AtprotoPersonalDataServer", URL: "https://pds.alice.test"},
+		},
+		Keys: map[string]identity.Key{
+			"atproto": {Type: "Multikey", PublicKeyMultibase: "zQ3shXjHeiBuRCKmM36cuYnm7YEMzhGnCmCyW92sRJ9pribSF"},
+		},
+	})
+	dir.Insert(identity.Identity{DID: syntax.DID("did:plc:bob"), Handle: syntax.Handle("bob.test")})
+
+	srv := newStubServer(newStubTransport())
+	srv.dir = &dir
+	srv.setAllowedHandles([]string{"alice.test"})
+
+	rec, err := serveParam(srv, srv.handleGetDIDDoc, "handle", "alice.test", "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var doc DIDDocument
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	assert.Equal(t, DIDDocument{
+		DID:         "did:plc:alice",
+		Handle:      "alice.test",
+		AlsoKnownAs: []string{"at://alice.test"},
+		PDS:         "https://pds.alice.test",
+		Services: map[string]DIDService{
+			"atproto_pds": {Type: "AtprotoPersonalDataServer", URL: "https://pds.alice.test"},
+		},
+		Keys: map[string]DIDKey{
+			"atproto": {Type: "Multikey", PublicKeyMultibase: "zQ3shXjHeiBuRCKmM36cuYnm7YEMzhGnCmCyW92sRJ9pribSF"},
+		},
+	}, doc)
+
+	// Handles outside the allowed list are refused
+	_, err = serveParam(srv, srv.handleGetDIDDoc, "handle", "bob.test", "")
+	assert.Equal(t, http.StatusForbidden, httpStatus(t, err))
+}
+
+func TestHandleResolve(t *testing.T) {
+	dir := identity.NewMockDirectory()
+	dir.Insert(identity.Identity{
+		DID:    syntax.DID("did:plc:alice"),
+		Handle: syntax.Handle("alice.test"),
+		Services: map[string]identity.Service{
+			"atproto_pds": {Type: "AtprotoPersonalDataServer", URL: "https://pds.alice.test"},
+		},
+	})
+	dir.Insert(identity.Identity{DID: syntax.DID("did:plc:bob"), Handle: syntax.Handle("bob.test")})
+
+	stub := newStubTransport()
+	srv := newStubServer(stub)
+	srv.dir = &dir
+	srv.setAllowedHandles([]string{"alice.test"})
+	srv.validDIDs = []string{"did:plc:alice"}
+
+	resolve := func(query string) (Resolution, error) {
+		rec := httptest.NewRecorder()
+		err := srv.handleResolve(srv.e.NewContext(httptest.NewRequest(http.MethodGet, "/?"+query, nil), rec))
+		var res Resolution
+		if err == nil {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		}
+		return res, err
+	}
+
+	// Handle to DID, normalizing the input
+	res, err := resolve("handle=Alice.Test")
+	require.NoError(t, err)
+	assert.Equal(t, Resolution{DID: "did:plc:alice", Handle: "alice.test"}, res)
+
+	// DID to handle and PDS
+	res, err = resolve("did=did:plc:alice")
+	require.NoError(t, err)
+	assert.Equal(t, Resolution{DID: "did:plc:alice", Handle: "alice.test", PDS: "https://pds.alice.test"}, res)
+
+	// No profile is fetched either way
+	assert.Empty(t, stub.requests)
+
+	for _, tt := range []struct {
+		query      string
+		wantStatus int
+	}{
+		{"", http.StatusBadRequest},
+		{"handle=alice.test&did=did:plc:alice", http.StatusBadRequest},
+		{"handle=not_a_handle", http.StatusBadRequest},
+		{"did=did:nope", http.StatusBadRequest},
+		{"handle=bob.test", http.StatusForbidden},
+		{"did=did:plc:bob", http.StatusForbidden},
+	} {
+		_, err := resolve(tt.query)
+		assert.Equal(t, tt.wantStatus, httpStatus(t, err), tt.query)
+	}
+
+	// Unknown identities are not found rather than failures
+	srv.setAllowedHandles(nil)
+	srv.validDIDs = nil
+	_, err = resolve("handle=carol.test")
+	assert.Equal(t, http.StatusNotFound, httpStatus(t, err))
+	_, err = resolve("did=did:plc:carol")
+	assert.Equal(t, http.StatusNotFound, httpStatus(t, err))
+
+	// An allowed DID is still refused if its handle is not allowed
+	srv.setAllowedHandles([]string{"alice.test"})
+	srv.validDIDs = []string{"did:plc:alice", "did:plc:bob"}
+	_, err = resolve("did=did:plc:bob")
+	assert.Equal(t, http.StatusForbidden, httpStatus(t, err))
+}
+
+func TestHandleGetDIDDoc_FailureHidesError(t *testing.T) {
+	dir := newFakeDirectory()
+	dir.err = errors.New("lookup plc.directory on 10.0.0.53:53: server misbehaving")
+	srv := newStubServer(newStubTransport())
+	srv.dir = dir
+
+	_, err := serveParam(srv, srv.handleGetDIDDoc, "did", "did:plc:alice", "")
+	assert.Equal(t, http.StatusInternalServerError, httpStatus(t, err))
+	assert.NotContains(t, err.Error(), "10.0.0.53")
+	assert.Contains(t, err.Error(), "failed to resolve DID document")
+}
+
+func TestHandleResolve_FailureHidesError(t *testing.T) {
+	dir := newFakeDirectory()
+	dir.err = errors.New("dial tcp 10.0.0.1:443: connection refused")
+	srv := newStubServer(newStubTransport())
+	srv.dir = dir
+
+	for _, query := range []string{"handle=alice.test", "did=did:plc:alice"} {
+		err := srv.handleResolve(srv.e.NewContext(httptest.NewRequest(http.MethodGet, "/?"+query, nil), httptest.NewRecorder()))
+		assert.Equal(t, http.StatusInternalServerError, httpStatus(t, err), query)
+		assert.NotContains(t, err.Error(), "10.0.0.1", query)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// fallbackIndexHTML is served when the public directory has no index.html,
+// e.g. when running the backend without building the frontend.
+const fallbackIndexHTML = `<!doctype html>
+<html lang="en">
+  <head>
+    <meta charset="UTF-8" />
+    <meta name="viewport" content="width=device-width, initial-scale=1.0" />
+    <title>AtHome</title>
+  </head>
+  <body>
+    <p>The AtHome frontend has not been built. Run <code>make frontend-build</code> to build it.</p>
+  </body>
+</html>
+`
+
+// indexData holds the per-request values injected into index.html
+type indexData struct {
+	Nonce  string // CSP nonce added to every script tag
+	Handle string // Default handle exposed as data-default-handle
+	Title  string // Document title
+}
+
+// Template delimiters used for the injected actions. They contain NUL bytes,
+// which are stripped from the document beforehand, so literal text in
+// index.html (including "{{") can never be mistaken for a template action.
+const (
+	indexLeftDelim  = "\x00{{"
+	indexRightDelim = "}}\x00"
+)
+
+// indexTemplate is index.html compiled into an html/template, so the
+// nonce, handle and title are escaped for the context they appear in.
+type indexTemplate struct {
+	tmpl *template.Template
+}
+
+// parseIndexTemplate compiles index.html into a template. The document is
+// tokenized so that injection points are real markup rather than text
+// matches: a nonce attribute on each script element, the default handle on
+// the html element and the contents of the title element. Text that merely
+// looks like markup, such as "<script" inside a comment, gets no injection.
+// As with any html/template, comments are dropped from the rendered output.
+func parseIndexTemplate(content []byte) (*indexTemplate, error) {
+	doc := bytes.ReplaceAll(content, []byte{0}, nil)
+
+	var src strings.Builder
+	z := html.NewTokenizer(bytes.NewReader(doc))
+	htmlTagSeen := false
+	inTitle := false
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if err := z.Err(); err != io.EOF {
+				return nil, fmt.Errorf("failed to tokenize index.html: %w", err)
+			}
+			break
+		}
+
+		raw := string(z.Raw())
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "script":
+				// Insert the nonce right after the tag name
+				raw = raw[:len("<script")] + ` nonce="` + indexAction("Nonce") + `"` + raw[len("<script"):]
+			case "html":
+				if !htmlTagSeen {
+					htmlTagSeen = true
+					end := strings.LastIndex(raw, ">")
+					raw = raw[:end] + ` data-default-handle="` + indexAction("Handle") + `"` + raw[end:]
+				}
+			case "title":
+				inTitle = true
+				src.WriteString(raw + indexAction("Title"))
+				continue
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "title" {
+				inTitle = false
+			}
+		case html.TextToken:
+			if inTitle {
+				// The title text is replaced by the configured title
+				continue
+			}
+		}
+		src.WriteString(raw)
+	}
+
+	tmpl, err := template.New("index.html").Delims(indexLeftDelim, indexRightDelim).Parse(src.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile index.html template: %w", err)
+	}
+	return &indexTemplate{tmpl: tmpl}, nil
+}
+
+// indexAction returns the template action printing the named indexData field
+func indexAction(field string) string {
+	return indexLeftDelim + "." + field + indexRightDelim
+}
+
+// render produces the document for a single request
+func (t *indexTemplate) render(data indexData) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render index.html: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// indexCache holds the parsed index.html so it is not reread per request.
+// When watch is set (assets served from disk during development), the file's
+// modification time is checked on each access and the template reparsed on change.
+type indexCache struct {
+	fsys  fs.FS
+	watch bool
+
+	mu      sync.RWMutex
+	tmpl    *indexTemplate
+	modTime time.Time
+}
+
+// newIndexCache creates a cache for index.html in the given file system
+func newIndexCache(fsys fs.FS, watch bool) *indexCache {
+	return &indexCache{fsys: fsys, watch: watch}
+}
+
+// get returns the current template, loading or reloading it as needed
+func (ic *indexCache) get() (*indexTemplate, error) {
+	ic.mu.RLock()
+	tmpl, modTime := ic.tmpl, ic.modTime
+	ic.mu.RUnlock()
+
+	if tmpl != nil && !ic.watch {
+		return tmpl, nil
+	}
+
+	var current time.Time
+	if info, err := fs.Stat(ic.fsys, "index.html"); err == nil {
+		current = info.ModTime()
+	}
+	if tmpl != nil && current.Equal(modTime) {
+		return tmpl, nil
+	}
+
+	return ic.load(current)
+}
+
+// load reads and parses index.html, using the fallback page if it is absent
+func (ic *indexCache) load(modTime time.Time) (*indexTemplate, error) {
+	content, err := fs.ReadFile(ic.fsys, "index.html")
+	if errors.Is(err, fs.ErrNotExist) {
+		content = []byte(fallbackIndexHTML)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read index.html: %w", err)
+	}
+
+	tmpl, err := parseIndexTemplate(content)
+	if err != nil {
+		return nil, err
+	}
+
+	ic.mu.Lock()
+	ic.tmpl = tmpl
+	ic.modTime = modTime
+	ic.mu.Unlock()
+
+	slog.Debug("parsed index.html template", "mod_time", modTime)
+	return tmpl, nil
+}
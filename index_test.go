@@ -0,0 +1,155 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sampleIndexHTML resembles the Vite-built index.html
+const sampleIndexHTML = `<!doctype html>
+<html lang="en">
+  <head>
+    <meta charset="UTF-8" />
+    <link rel="icon" type="image/svg+xml" href="/vite.svg" />
+    <meta name="viewport" content="width=device-width, initial-scale=1.0" />
+    <title>AtHome</title>
+    <script type="module" crossorigin src="/assets/index-abc123.js"></script>
+    <link rel="stylesheet" crossorigin href="/assets/index-def456.css">
+  </head>
+  <body>
+    <div id="app"></div>
+    <script>window.athome = true;</script>
+  </body>
+</html>
+`
+
+// renderIndexPerRequest is the previous handleIndex implementation, which
+// rescanned the whole document on every request. Kept as the reference output.
+func renderIndexPerRequest(content []byte, nonce, handle string) []byte {
+	doc := strings.ReplaceAll(string(content), `<script`, `<script nonce="`+nonce+`"`)
+	doc = strings.Replace(doc, `<html lang="en"`, `<html lang="en" data-default-handle="`+handle+`"`, 1)
+	doc = strings.ReplaceAll(doc, "<title>AtHome</title>", "<title>@"+handle+"</title>")
+	return []byte(doc)
+}
+
+// renderIndex parses and renders content, failing the test on error
+func renderIndex(t testing.TB, content string, data indexData) string {
+	t.Helper()
+	tmpl, err := parseIndexTemplate([]byte(content))
+	require.NoError(t, err)
+	out, err := tmpl.render(data)
+	require.NoError(t, err)
+	return string(out)
+}
+
+func TestIndexTemplate_MatchesPerRequestRendering(t *testing.T) {
+	for _, content := range []string{sampleIndexHTML, fallbackIndexHTML, "no injection points"} {
+		got := renderIndex(t, content, indexData{Nonce: "abc", Handle: "alice.test", Title: "@alice.test"})
+		assert.Equal(t, string(renderIndexPerRequest([]byte(content), "abc", "alice.test")), got)
+	}
+}
+
+func TestIndexTemplate_TrickyContent(t *testing.T) {
+	const content = `<!doctype html>
+<html lang="en">
+  <head>
+    <title>AtHome</title>
+    <!-- a literal <script in a comment -->
+    <SCRIPT src="/assets/app.js"></SCRIPT>
+  </head>
+  <body>
+    <p>Write &lt;script&gt; tags {{carefully}}</p>
+    <script>const s = "<script";</script>
+  </body>
+</html>
+`
+	got := renderIndex(t, content, indexData{
+		Nonce:  "n+1/=",
+		Handle: `evil"><script>alert(1)</script>`,
+		Title:  "<b>@alice.test</b>",
+	})
+
+	// Only the two real script elements get a nonce; the comment is dropped by html/template
+	assert.Equal(t, 2, strings.Count(got, `nonce="`))
+	assert.NotContains(t, got, `a literal`)
+	assert.Contains(t, got, `<SCRIPT nonce="n&#43;1/=" src="/assets/app.js">`)
+	assert.Contains(t, got, `<script nonce="n&#43;1/=">const s = "\x3Cscript";</script>`)
+
+	// Literal text, including template-like braces, is preserved
+	assert.Contains(t, got, `<p>Write &lt;script&gt; tags {{carefully}}</p>`)
+
+	// Injected values are escaped for their context
+	assert.Contains(t, got, `data-default-handle="evil&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;"`)
+	assert.Contains(t, got, `<title>&lt;b&gt;@alice.test&lt;/b&gt;</title>`)
+	assert.NotContains(t, got, `<script>alert(1)`)
+}
+
+func TestIndexCache_ReloadsOnChange(t *testing.T) {
+	dir := t.TempDir()
+	index := filepath.Join(dir, "index.html")
+	require.NoError(t, os.WriteFile(index, []byte(`<html lang="en"><title>AtHome</title>v1</html>`), 0o644))
+
+	watched := newIndexCache(os.DirFS(dir), true)
+	static := newIndexCache(os.DirFS(dir), false)
+	for _, ic := range []*indexCache{watched, static} {
+		tmpl, err := ic.get()
+		require.NoError(t, err)
+		out, err := tmpl.render(indexData{})
+		require.NoError(t, err)
+		assert.Contains(t, string(out), "v1")
+	}
+
+	require.NoError(t, os.WriteFile(index, []byte(`<html lang="en"><title>AtHome</title>v2</html>`), 0o644))
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(index, future, future))
+
+	tmpl, err := watched.get()
+	require.NoError(t, err)
+	out, err := tmpl.render(indexData{})
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "v2", "watched cache should reparse on change")
+
+	tmpl, err = static.get()
+	require.NoError(t, err)
+	out, err = tmpl.render(indexData{})
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "v1", "unwatched cache should keep the startup parse")
+}
+
+func BenchmarkIndexPerRequest(b *testing.B) {
+	dir := b.TempDir()
+	require.NoError(b, os.WriteFile(filepath.Join(dir, "index.html"), []byte(sampleIndexHTML), 0o644))
+	path := filepath.Join(dir, "index.html")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		renderIndexPerRequest(content, "abc==", "alice.test")
+	}
+}
+
+func BenchmarkIndexCached(b *testing.B) {
+	dir := b.TempDir()
+	require.NoError(b, os.WriteFile(filepath.Join(dir, "index.html"), []byte(sampleIndexHTML), 0o644))
+	ic := newIndexCache(os.DirFS(dir), false)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		tmpl, err := ic.get()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := tmpl.render(indexData{Nonce: "abc==", Handle: "alice.test", Title: "@alice.test"}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
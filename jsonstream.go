@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// hasMore reports whether a feed page has a next page, i.e. the upstream
+// returned a cursor. The page size is not consulted, since filtered pages
+// and pages cut short by FeedMaxFetches can be short while more posts
+// follow.
+func hasMore(cursor *string) bool {
+	return cursor != nil && *cursor != ""
+}
+
+// writeFeedJSON writes {"cursor": ..., "feed": [...], "hasMore": ...}
+// (see hasMore) with status 200,
+// encoding one post at a time straight to the response. c.JSON would
+// produce the same bytes, but json.Encoder buffers the whole document
+// before writing, so large feeds briefly cost twice their encoded size.
+// Any compression middleware sees the stream as usual.
+//
+// Once the first byte is written the status can no longer change, so a
+// later encoding error is logged and the truncated body is abandoned
+// rather than reported to the error handler, which would write a second
+// response into the first.
+func writeFeedJSON[T any](c echo.Context, cursor *string, feed []T) error {
+	cursorJSON, err := json.Marshal(cursor)
+	if err != nil {
+		return err
+	}
+
+	resp := c.Response()
+	resp.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	resp.WriteHeader(http.StatusOK)
+
+	write := func(b []byte) bool {
+		if _, err := resp.Write(b); err != nil {
+			slog.Warn("failed to write feed response", "error", err)
+			return false
+		}
+		return true
+	}
+
+	if !write([]byte(`{"cursor":`)) || !write(cursorJSON) || !write([]byte(`,"feed":[`)) {
+		return nil
+	}
+	// One buffer is reused for every post; Encode appends a newline that
+	// json.Marshal would not, so it is dropped before writing
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for i, item := range feed {
+		buf.Reset()
+		if err := enc.Encode(item); err != nil {
+			slog.Error("failed to encode feed item after response started", "index", i, "error", err)
+			return nil
+		}
+		if i > 0 && !write([]byte(",")) {
+			return nil
+		}
+		if !write(bytes.TrimSuffix(buf.Bytes(), []byte("\n"))) {
+			return nil
+		}
+	}
+	write([]byte(`],"hasMore":` + strconv.FormatBool(hasMore(cursor)) + "}\n"))
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// benchmarkFeed builds a feed of n posts with some HTML-sensitive text
+func benchmarkFeed(n int) []*bsky.FeedDefs_FeedViewPost {
+	feed := make([]*bsky.FeedDefs_FeedViewPost, 0, n)
+	for i := 0; i < n; i++ {
+		likes := int64(i)
+		feed = append(feed, &bsky.FeedDefs_FeedViewPost{
+			Post: &bsky.FeedDefs_PostView{
+				Uri:       fmt.Sprintf("at://did:plc:abc123/app.bsky.feed.post/%d", i),
+				Cid:       "bafyreib2rxk3rybk3aobmv5cjuql3bm2twh4jo5uxgf5ocaqpr6a3n4bme",
+				Author:    &bsky.ActorDefs_ProfileViewBasic{Did: "did:plc:abc123", Handle: "alice.test"},
+				LikeCount: &likes,
+				IndexedAt: "2024-01-01T00:00:00Z",
+			},
+			Reason: &bsky.FeedDefs_FeedViewPost_Reason{FeedDefs_ReasonPin: &bsky.FeedDefs_ReasonPin{}},
+		})
+	}
+	return feed
+}
+
+// renderFeed returns the body written by render for the given feed
+func renderFeed(t testing.TB, render func(c echo.Context) error) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+	require.NoError(t, render(c))
+	return rec
+}
+
+func TestHasMore(t *testing.T) {
+	next, empty := "next", ""
+	assert.True(t, hasMore(&next))
+	assert.False(t, hasMore(&empty))
+	assert.False(t, hasMore(nil))
+}
+
+func TestWriteFeedJSON_MatchesJSON(t *testing.T) {
+	cursor := "cursor<&>"
+	projected := []interface{}{map[string]interface{}{"post": map[string]interface{}{"uri": "at://x", "text": "<b>"}}}
+
+	cases := map[string]struct {
+		cursor *string
+		feed   any
+	}{
+		"posts":     {&cursor, benchmarkFeed(3)},
+		"projected": {&cursor, projected},
+		"empty":     {nil, []*bsky.FeedDefs_FeedViewPost{}},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			want := renderFeed(t, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, map[string]interface{}{"cursor": tc.cursor, "feed": tc.feed, "hasMore": hasMore(tc.cursor)})
+			})
+			got := renderFeed(t, func(c echo.Context) error {
+				switch feed := tc.feed.(type) {
+				case []*bsky.FeedDefs_FeedViewPost:
+					return writeFeedJSON(c, tc.cursor, feed)
+				case []interface{}:
+					return writeFeedJSON(c, tc.cursor, feed)
+				}
+				return fmt.Errorf("unexpected feed type %T", tc.feed)
+			})
+
+			assert.Equal(t, want.Code, got.Code)
+			assert.Equal(t, want.Header().Get(echo.HeaderContentType), got.Header().Get(echo.HeaderContentType))
+			assert.Equal(t, want.Body.String(), got.Body.String())
+		})
+	}
+}
+
+func BenchmarkFeedJSON(b *testing.B) {
+	feed := benchmarkFeed(500)
+	cursor := "next"
+
+	b.Run("c.JSON", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			renderFeed(b, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, map[string]interface{}{"cursor": &cursor, "feed": feed})
+			})
+		}
+	})
+
+	b.Run("writeFeedJSON", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			renderFeed(b, func(c echo.Context) error {
+				return writeFeedJSON(c, &cursor, feed)
+			})
+		}
+	})
+}
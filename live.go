@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// defaultJetstreamURL is the Jetstream subscription endpoint (ATHOME_JETSTREAM_URL)
+	defaultJetstreamURL = "wss://jetstream2.us-east.bsky.network/subscribe"
+	// defaultLiveMaxConns caps concurrent /ws clients (ATHOME_LIVE_MAX_CONNS)
+	defaultLiveMaxConns = 100
+
+	// postCollection is the NSID of post records
+	postCollection = "app.bsky.feed.post"
+
+	// liveClientBuffer is how many posts are queued per client before
+	// new ones are dropped for that client
+	liveClientBuffer = 16
+
+	// liveKeepAlive is how often idle SSE streams get a comment line so
+	// proxies don't time them out
+	liveKeepAlive = 15 * time.Second
+)
+
+// errLiveFull is returned when the connection cap has been reached
+var errLiveFull = errors.New("too many live connections")
+
+// postSource streams new posts by a DID until the context is done or
+// the upstream connection drops.
+type postSource interface {
+	Subscribe(ctx context.Context, did string, emit func(LivePost)) error
+}
+
+// jetstreamSource is a postSource backed by a Jetstream instance
+type jetstreamSource struct {
+	url string
+}
+
+// jetstreamEvent is the subset of a Jetstream event we care about
+type jetstreamEvent struct {
+	Did    string `json:"did"`
+	TimeUS int64  `json:"time_us"`
+	Kind   string `json:"kind"`
+	Commit *struct {
+		Operation  string          `json:"operation"`
+		Collection string          `json:"collection"`
+		Rkey       string          `json:"rkey"`
+		Cid        string          `json:"cid"`
+		Record     json.RawMessage `json:"record"`
+	} `json:"commit"`
+}
+
+// Subscribe connects to Jetstream filtered to posts by did and emits
+// every created post until the connection fails or ctx is cancelled.
+func (s *jetstreamSource) Subscribe(ctx context.Context, did string, emit func(LivePost)) error {
+	u, err := url.Parse(s.url)
+	if err != nil {
+		return fmt.Errorf("invalid jetstream url: %w", err)
+	}
+	q := u.Query()
+	q.Set("wantedCollections", postCollection)
+	q.Set("wantedDids", did)
+	u.RawQuery = q.Encode()
+
+	config, err := websocket.NewConfig(u.String(), "http://localhost/")
+	if err != nil {
+		return fmt.Errorf("invalid jetstream url: %w", err)
+	}
+	ws, err := config.DialContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to jetstream: %w", err)
+	}
+	defer ws.Close()
+
+	// Unblock the receive loop on shutdown
+	stop := context.AfterFunc(ctx, func() { ws.Close() })
+	defer stop()
+
+	for {
+		var event jetstreamEvent
+		if err := websocket.JSON.Receive(ws, &event); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("jetstream receive failed: %w", err)
+		}
+		if event.Kind != "commit" || event.Commit == nil || event.Did != did {
+			continue
+		}
+		if event.Commit.Operation != "create" || event.Commit.Collection != postCollection {
+			continue
+		}
+		emit(LivePost{
+			URI:       fmt.Sprintf("at://%s/%s/%s", event.Did, event.Commit.Collection, event.Commit.Rkey),
+			CID:       event.Commit.Cid,
+			DID:       event.Did,
+			Record:    event.Commit.Record,
+			IndexedAt: time.UnixMicro(event.TimeUS).UTC(),
+		})
+	}
+}
+
+// liveHub fans out new posts to connected /ws clients. One upstream
+// subscription is kept per DID while at least one client watches it.
+type liveHub struct {
+	src        postSource
+	maxConns   int
+	backoffMin time.Duration // First reconnect delay
+	backoffMax time.Duration // Upper bound for reconnect delays
+	keepAlive  time.Duration // Interval between SSE keep-alive comments
+
+	ctx    context.Context // Cancelled on shutdown
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	conns  int
+	topics map[string]*liveTopic // Keyed by DID
+}
+
+// liveTopic tracks the clients and upstream subscription for one DID
+type liveTopic struct {
+	clients map[chan LivePost]struct{}
+	cancel  context.CancelFunc
+}
+
+// newLiveHub creates a hub reading from src
+func newLiveHub(src postSource, maxConns int) *liveHub {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &liveHub{
+		src:        src,
+		maxConns:   maxConns,
+		backoffMin: time.Second,
+		backoffMax: time.Minute,
+		keepAlive:  liveKeepAlive,
+		ctx:        ctx,
+		cancel:     cancel,
+		topics:     make(map[string]*liveTopic),
+	}
+}
+
+// subscribe registers a client for posts by did, starting the upstream
+// subscription if this is the first client for it.
+func (h *liveHub) subscribe(did string) (chan LivePost, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.ctx.Err() != nil {
+		return nil, h.ctx.Err()
+	}
+	if h.conns >= h.maxConns {
+		return nil, errLiveFull
+	}
+
+	topic, ok := h.topics[did]
+	if !ok {
+		ctx, cancel := context.WithCancel(h.ctx)
+		topic = &liveTopic{clients: make(map[chan LivePost]struct{}), cancel: cancel}
+		h.topics[did] = topic
+		go h.run(ctx, did)
+	}
+
+	ch := make(chan LivePost, liveClientBuffer)
+	topic.clients[ch] = struct{}{}
+	h.conns++
+	return ch, nil
+}
+
+// unsubscribe removes a client, stopping the upstream subscription
+// once nobody is watching the DID.
+func (h *liveHub) unsubscribe(did string, ch chan LivePost) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	topic, ok := h.topics[did]
+	if !ok {
+		return
+	}
+	if _, ok := topic.clients[ch]; !ok {
+		return
+	}
+	delete(topic.clients, ch)
+	h.conns--
+	if len(topic.clients) == 0 {
+		topic.cancel()
+		delete(h.topics, did)
+	}
+}
+
+// broadcast queues a post for every client watching did. Clients that
+// are not keeping up miss the post rather than stalling the others.
+func (h *liveHub) broadcast(did string, post LivePost) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	topic, ok := h.topics[did]
+	if !ok {
+		return
+	}
+	for ch := range topic.clients {
+		select {
+		case ch <- post:
+		default:
+			slog.Debug("dropping live post for slow client", "did", did, "uri", post.URI)
+		}
+	}
+}
+
+// run keeps the upstream subscription for did alive, reconnecting with
+// exponential backoff until ctx is cancelled.
+func (h *liveHub) run(ctx context.Context, did string) {
+	backoff := h.backoffMin
+	for {
+		start := time.Now()
+		err := h.src.Subscribe(ctx, did, func(post LivePost) { h.broadcast(did, post) })
+		if ctx.Err() != nil {
+			return
+		}
+
+		// A connection that stayed up for a while starts over from the minimum delay
+		if time.Since(start) > h.backoffMax {
+			backoff = h.backoffMin
+		}
+		slog.Warn("live upstream disconnected, reconnecting", "did", did, "error", err, "backoff", backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, h.backoffMax)
+	}
+}
+
+// serve pushes posts to a client until it disconnects or the hub shuts down
+func (h *liveHub) serve(ws *websocket.Conn, posts chan LivePost) {
+	// The server's read/write timeouts are meant for requests, not long-lived streams
+	if err := ws.SetDeadline(time.Time{}); err != nil {
+		slog.Debug("failed to clear live connection deadline", "error", err)
+	}
+
+	// Clients don't send anything; reading detects when they go away
+	gone := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, ws)
+		close(gone)
+	}()
+
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-gone:
+			return
+		case post := <-posts:
+			if err := websocket.JSON.Send(ws, post); err != nil {
+				slog.Debug("failed to send live post", "error", err)
+				return
+			}
+		}
+	}
+}
+
+// close stops all upstream subscriptions and disconnects clients
+func (h *liveHub) close() {
+	h.cancel()
+}
+
+// handleLive upgrades the request to a WebSocket that receives new posts
+// by the actor as they are published.
+//
+// URL Parameters:
+//   - handle: Optional handle parameter (falls back to hostname)
+//
+// Returns:
+//   - 101 Switching Protocols, then one JSON message per new post
+//   - 400 Bad Request if handle is invalid
+//   - 403 Forbidden if handle is not allowed
+//   - 404 Not Found if live updates are not enabled
+//   - 503 Service Unavailable if the connection cap has been reached
+func (srv *Server) handleLive(c echo.Context) error {
+	did, posts, err := srv.subscribeLive(c)
+	if err != nil {
+		return err
+	}
+	defer srv.live.unsubscribe(did, posts)
+
+	websocket.Server{Handler: func(ws *websocket.Conn) {
+		srv.live.serve(ws, posts)
+	}}.ServeHTTP(c.Response(), c.Request())
+	return nil
+}
+
+// handleLiveSSE streams new posts by the actor as Server-Sent Events,
+// for deployments whose proxies don't pass WebSockets through.
+//
+// URL Parameters:
+//   - handle: Optional handle parameter (falls back to hostname)
+//
+// Returns:
+//   - 200 OK with a text/event-stream of "post" events
+//   - 400 Bad Request if handle is invalid
+//   - 403 Forbidden if handle is not allowed
+//   - 404 Not Found if live updates are not enabled
+//   - 503 Service Unavailable if the connection cap has been reached
+func (srv *Server) handleLiveSSE(c echo.Context) error {
+	did, posts, err := srv.subscribeLive(c)
+	if err != nil {
+		return err
+	}
+	defer srv.live.unsubscribe(did, posts)
+
+	w := c.Response()
+
+	// The server's write timeout is meant for requests, not long-lived streams
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		slog.Debug("failed to clear SSE write deadline", "error", err)
+	}
+
+	w.Header().Set(echo.HeaderContentType, "text/event-stream")
+	w.Header().Set(echo.HeaderCacheControl, "no-cache")
+	w.Header().Set(echo.HeaderConnection, "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable nginx response buffering
+	w.WriteHeader(http.StatusOK)
+	w.Flush()
+
+	keepAlive := time.NewTicker(srv.live.keepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-srv.live.ctx.Done():
+			return nil
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+		case post := <-posts:
+			data, err := json.Marshal(post)
+			if err != nil {
+				slog.Error("failed to encode live post", "error", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: post\ndata: %s\n\n", data); err != nil {
+				return nil
+			}
+		}
+		w.Flush()
+	}
+}
+
+// subscribeLive validates the requested actor and registers a live client
+// for it. Callers must unsubscribe when done.
+func (srv *Server) subscribeLive(c echo.Context) (string, chan LivePost, error) {
+	if !srv.enableLive || srv.live == nil {
+		return "", nil, echo.NewHTTPError(http.StatusNotFound, "live updates are not enabled")
+	}
+
+	did, err := srv.validateAndGetDID(c, getActorFromRequest(c))
+	if err != nil {
+		return "", nil, err
+	}
+
+	posts, err := srv.live.subscribe(did)
+	if err != nil {
+		if errors.Is(err, errLiveFull) {
+			return "", nil, echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
+		}
+		return "", nil, echo.NewHTTPError(http.StatusServiceUnavailable, "server is shutting down")
+	}
+	return did, posts, nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+// fakePostSource is a postSource fed by the test
+type fakePostSource struct {
+	posts      chan LivePost
+	subscribed chan string
+	failFirst  int32 // Number of subscriptions that fail immediately
+	calls      atomic.Int32
+}
+
+func newFakePostSource() *fakePostSource {
+	return &fakePostSource{
+		posts:      make(chan LivePost),
+		subscribed: make(chan string, 10),
+	}
+}
+
+func (f *fakePostSource) Subscribe(ctx context.Context, did string, emit func(LivePost)) error {
+	if f.calls.Add(1) <= f.failFirst {
+		return errors.New("upstream unavailable")
+	}
+	f.subscribed <- did
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case post := <-f.posts:
+			emit(post)
+		}
+	}
+}
+
+// newLiveTestServer serves /ws/:did backed by the fake source
+func newLiveTestServer(t *testing.T, src postSource, maxConns int) (*Server, *httptest.Server) {
+	t.Helper()
+	srv := newStubServer(newStubTransport())
+	srv.live = newLiveHub(src, maxConns)
+	srv.live.backoffMin = time.Millisecond
+	srv.live.backoffMax = 10 * time.Millisecond
+	srv.enableLive = true
+	srv.e.GET("/ws/:did", srv.handleLive)
+	srv.e.GET("/sse/:did", srv.handleLiveSSE)
+
+	ts := httptest.NewServer(srv.e)
+	t.Cleanup(func() {
+		srv.live.close()
+		ts.Close()
+	})
+	return srv, ts
+}
+
+func dialLive(t *testing.T, ts *httptest.Server, did string) *websocket.Conn {
+	t.Helper()
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws/"+did, "", ts.URL)
+	require.NoError(t, err)
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+func waitSubscribed(t *testing.T, src *fakePostSource) string {
+	t.Helper()
+	select {
+	case did := <-src.subscribed:
+		return did
+	case <-time.After(5 * time.Second):
+		t.Fatal("upstream subscription was not started")
+		return ""
+	}
+}
+
+func TestLive_PostReachesClient(t *testing.T) {
+	src := newFakePostSource()
+	_, ts := newLiveTestServer(t, src, 10)
+
+	ws := dialLive(t, ts, "did:plc:alice")
+	assert.Equal(t, "did:plc:alice", waitSubscribed(t, src))
+
+	src.posts <- LivePost{
+		URI:    "at://did:plc:alice/app.bsky.feed.post/1",
+		CID:    "bafy1",
+		DID:    "did:plc:alice",
+		Record: []byte(`{"text":"hello"}`),
+	}
+
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(5*time.Second)))
+	var got LivePost
+	require.NoError(t, websocket.JSON.Receive(ws, &got))
+	assert.Equal(t, "at://did:plc:alice/app.bsky.feed.post/1", got.URI)
+	assert.JSONEq(t, `{"text":"hello"}`, string(got.Record))
+}
+
+func TestLive_ReconnectsUpstream(t *testing.T) {
+	src := newFakePostSource()
+	src.failFirst = 2
+	_, ts := newLiveTestServer(t, src, 10)
+
+	dialLive(t, ts, "did:plc:alice")
+	waitSubscribed(t, src)
+	assert.Equal(t, int32(3), src.calls.Load())
+}
+
+func TestLive_ConnectionCap(t *testing.T) {
+	src := newFakePostSource()
+	_, ts := newLiveTestServer(t, src, 1)
+
+	dialLive(t, ts, "did:plc:alice")
+	waitSubscribed(t, src)
+
+	_, err := websocket.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws/did:plc:alice", "", ts.URL)
+	var dialErr *websocket.DialError
+	require.ErrorAs(t, err, &dialErr)
+
+	resp, err := http.Get(ts.URL + "/ws/did:plc:alice")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestLive_CloseDisconnectsClients(t *testing.T) {
+	src := newFakePostSource()
+	srv, ts := newLiveTestServer(t, src, 10)
+
+	ws := dialLive(t, ts, "did:plc:alice")
+	waitSubscribed(t, src)
+
+	srv.live.close()
+
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(5*time.Second)))
+	var got LivePost
+	assert.Error(t, websocket.JSON.Receive(ws, &got))
+
+	// The slot is released once the client is gone
+	assert.Eventually(t, func() bool {
+		srv.live.mu.Lock()
+		defer srv.live.mu.Unlock()
+		return srv.live.conns == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestLive_SSE(t *testing.T) {
+	src := newFakePostSource()
+	srv, ts := newLiveTestServer(t, src, 10)
+	srv.live.keepAlive = 10 * time.Millisecond
+
+	resp, err := http.Get(ts.URL + "/sse/did:plc:alice")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	waitSubscribed(t, src)
+	src.posts <- LivePost{URI: "at://did:plc:alice/app.bsky.feed.post/1", DID: "did:plc:alice"}
+
+	// Read frames until the post arrives, skipping keep-alive comments
+	reader := bufio.NewReader(resp.Body)
+	var frame []string
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			if len(frame) > 0 && frame[0] == ": keep-alive" {
+				frame = nil
+				continue
+			}
+			break
+		}
+		frame = append(frame, line)
+	}
+
+	require.Len(t, frame, 2)
+	assert.Equal(t, "event: post", frame[0])
+	require.True(t, strings.HasPrefix(frame[1], "data: "))
+	var got LivePost
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(frame[1], "data: ")), &got))
+	assert.Equal(t, "at://did:plc:alice/app.bsky.feed.post/1", got.URI)
+}
+
+func TestLive_Disabled(t *testing.T) {
+	srv, ts := newLiveTestServer(t, newFakePostSource(), 10)
+	srv.enableLive = false
+
+	for _, path := range []string{"/ws/did:plc:alice", "/sse/did:plc:alice"} {
+		resp, err := http.Get(ts.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, path)
+	}
+}
+
+func TestLive_StreamsOutliveWriteTimeout(t *testing.T) {
+	src := newFakePostSource()
+	srv := newStubServer(newStubTransport())
+	srv.live = newLiveHub(src, 10)
+	srv.enableLive = true
+	srv.e.GET("/ws/:did", srv.handleLive)
+	srv.e.GET("/sse/:did", srv.handleLiveSSE)
+
+	ts := httptest.NewUnstartedServer(srv.e)
+	ts.Config.WriteTimeout = 50 * time.Millisecond
+	ts.Config.ReadTimeout = 50 * time.Millisecond
+	ts.Start()
+	t.Cleanup(func() {
+		srv.live.close()
+		ts.Close()
+	})
+
+	ws := dialLive(t, ts, "did:plc:alice")
+	waitSubscribed(t, src)
+	resp, err := http.Get(ts.URL + "/sse/did:plc:alice")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	// Outlast the server timeouts before anything is sent
+	time.Sleep(150 * time.Millisecond)
+	post := LivePost{URI: "at://did:plc:alice/app.bsky.feed.post/1", DID: "did:plc:alice"}
+	src.posts <- post
+
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(5*time.Second)))
+	var got LivePost
+	require.NoError(t, websocket.JSON.Receive(ws, &got))
+	assert.Equal(t, post.URI, got.URI)
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "event: post\n", line)
+}
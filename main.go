@@ -9,68 +9,172 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/bluesky-social/indigo/atproto/identity"
 	"github.com/bluesky-social/indigo/atproto/syntax"
-	"github.com/bluesky-social/indigo/util"
 	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/labstack/gommon/bytes"
 )
 
 // defaultDirectory implements the identity.Directory interface by wrapping
 // the default Bluesky directory service. It provides handle resolution and
-// DID lookup capabilities.
+// DID lookup capabilities. Configured did:web documents, when present, are
+// consulted before the wrapped directory.
 type defaultDirectory struct {
-	dir identity.Directory
+	dir    identity.Directory
+	static *didDocumentResolver // Optional operator-supplied did:web documents
 }
 
 // LookupHandle resolves a Bluesky handle to its corresponding identity.
 // This is used to convert user handles to DIDs for API operations.
 func (d *defaultDirectory) LookupHandle(ctx context.Context, handle syntax.Handle) (*identity.Identity, error) {
+	if d.static != nil {
+		ident, err := d.static.lookupHandle(ctx, handle)
+		if err != nil {
+			return nil, err
+		}
+		if ident != nil {
+			return ident, nil
+		}
+	}
 	return d.dir.LookupHandle(ctx, handle)
 }
 
 // Lookup resolves an AT identifier (handle or DID) to its corresponding identity.
-func (d *defaultDirectory) Lookup(ctx context.Context, did syntax.AtIdentifier) (*identity.Identity, error) {
-	return d.dir.Lookup(ctx, did)
+func (d *defaultDirectory) Lookup(ctx context.Context, atid syntax.AtIdentifier) (*identity.Identity, error) {
+	if did, err := atid.AsDID(); err == nil {
+		return d.LookupDID(ctx, did)
+	}
+	if handle, err := atid.AsHandle(); err == nil {
+		return d.LookupHandle(ctx, handle)
+	}
+	return d.dir.Lookup(ctx, atid)
 }
 
 // LookupDID resolves a DID to its corresponding identity.
 func (d *defaultDirectory) LookupDID(ctx context.Context, did syntax.DID) (*identity.Identity, error) {
+	if d.static != nil {
+		ident, err := d.static.lookupDID(ctx, did)
+		if err != nil {
+			return nil, err
+		}
+		if ident != nil {
+			return ident, nil
+		}
+	}
 	return d.dir.LookupDID(ctx, did)
 }
 
-// Purge removes an identity from the directory cache.
+// Purge removes an identity from the directory cache. If it is one of the
+// configured did:web documents, they are re-read on next use.
 func (d *defaultDirectory) Purge(ctx context.Context, did syntax.AtIdentifier) error {
+	if d.static != nil {
+		d.static.purge(did)
+	}
 	return d.dir.Purge(ctx, did)
 }
 
 // getEnvOrFlag retrieves a configuration value from either an environment variable
-// or a command-line flag, prioritizing the environment variable if present.
+// or a command-line flag. A flag given explicitly wins, then the environment
+// variable, then the flag value, which holds the config file setting or the default.
 //
 // Parameters:
 //   - envKey: The environment variable name
+//   - flagName: The command-line flag name
 //   - flagValue: The command-line flag value
 //
-// Returns the environment variable value if set, otherwise the flag value.
-func getEnvOrFlag(envKey, flagValue string) string {
-	if env := os.Getenv(envKey); env != "" {
+// Returns the environment variable value if set and the flag was not given,
+// otherwise the flag value.
+func getEnvOrFlag(envKey, flagName, flagValue string) string {
+	if env := os.Getenv(envKey); env != "" && !isFlagSet(flagName) {
 		return env
 	}
 	return flagValue
 }
 
+// getEnvIntOrFlag retrieves an integer configuration value from either an environment
+// variable or a command-line flag, with the same precedence as getEnvOrFlag.
+//
+// Parameters:
+//   - envKey: The environment variable name
+//   - flagName: The command-line flag name
+//   - flagValue: The command-line flag value
+//
+// Returns the environment variable value if set, valid and the flag was not
+// given, otherwise the flag value.
+func getEnvIntOrFlag(envKey, flagName string, flagValue int) int {
+	env := os.Getenv(envKey)
+	if env == "" || isFlagSet(flagName) {
+		return flagValue
+	}
+	n, err := strconv.Atoi(env)
+	if err != nil {
+		slog.Warn("ignoring invalid integer in environment", "key", envKey, "value", env)
+		return flagValue
+	}
+	return n
+}
+
+// getEnvDurationOrFlag retrieves a duration configuration value (e.g. "90s", "5m")
+// from either an environment variable or a command-line flag, with the same
+// precedence as getEnvOrFlag.
+//
+// Parameters:
+//   - envKey: The environment variable name
+//   - flagName: The command-line flag name
+//   - flagValue: The command-line flag value
+//
+// Returns the environment variable value if set, valid and the flag was not
+// given, otherwise the flag value.
+func getEnvDurationOrFlag(envKey, flagName string, flagValue time.Duration) time.Duration {
+	env := os.Getenv(envKey)
+	if env == "" || isFlagSet(flagName) {
+		return flagValue
+	}
+	d, err := time.ParseDuration(env)
+	if err != nil {
+		slog.Warn("ignoring invalid duration in environment", "key", envKey, "value", env)
+		return flagValue
+	}
+	return d
+}
+
+// getEnvBoolOrFlag retrieves a boolean configuration value from either an
+// environment variable ("true" or "1" enable it, anything else disables it)
+// or a command-line flag, with the same precedence as getEnvOrFlag.
+//
+// Parameters:
+//   - envKey: The environment variable name
+//   - flagName: The command-line flag name
+//   - flagValue: The command-line flag value
+//
+// Returns the environment variable value if set and the flag was not given,
+// otherwise the flag value.
+func getEnvBoolOrFlag(envKey, flagName string, flagValue bool) bool {
+	env := os.Getenv(envKey)
+	if env == "" || isFlagSet(flagName) {
+		return flagValue
+	}
+	return strings.ToLower(env) == "true" || env == "1"
+}
+
 // getEnvListOrFlag retrieves a comma-separated list from either an environment variable
-// or a command-line flag, splitting it into a slice of strings.
+// or a command-line flag, splitting it into a slice of strings, with the same
+// precedence as getEnvOrFlag.
 //
 // Parameters:
 //   - envKey: The environment variable name
+//   - flagName: The command-line flag name
 //   - flagValue: The command-line flag value
 //
 // Returns a slice of strings, or nil if both sources are empty.
-func getEnvListOrFlag(envKey string, flagValue string) []string {
-	if env := os.Getenv(envKey); env != "" {
+func getEnvListOrFlag(envKey, flagName, flagValue string) []string {
+	if env := os.Getenv(envKey); env != "" && !isFlagSet(flagName) {
 		return strings.Split(env, ",")
 	}
 	if flagValue == "" {
@@ -79,8 +183,98 @@ func getEnvListOrFlag(envKey string, flagValue string) []string {
 	return strings.Split(flagValue, ",")
 }
 
+// Operating modes selecting the upstream the server talks to.
+const (
+	modeAppView = "appview" // Unauthenticated reads from a public AppView
+	modePDS     = "pds"     // Authenticated access to a PDS
+)
+
+// selectMode determines the operating mode from the configuration.
+// An explicit mode is validated against the PDS settings; when no mode is
+// given, PDS mode is inferred from the presence of a PDS host.
+//
+// Parameters:
+//   - mode: The requested mode ("appview", "pds" or empty to infer)
+//   - pdsHost: The configured PDS host
+//   - pdsHandle: The handle to authenticate with the PDS
+//   - pdsPassword: The password to authenticate with the PDS
+//
+// Returns the selected mode, or an error if the configuration is inconsistent.
+func selectMode(mode, pdsHost, pdsHandle, pdsPassword string) (string, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if mode == "" {
+		mode = modeAppView
+		if pdsHost != "" {
+			mode = modePDS
+		}
+	}
+
+	switch mode {
+	case modePDS:
+		if pdsHost == "" {
+			return "", fmt.Errorf("pds mode requires a PDS host")
+		}
+		if pdsHandle == "" || pdsPassword == "" {
+			return "", fmt.Errorf("PDS host specified but missing handle or password")
+		}
+	case modeAppView:
+		if pdsHost != "" {
+			return "", fmt.Errorf("PDS host specified but mode is %s", modeAppView)
+		}
+	default:
+		return "", fmt.Errorf("unknown mode %q (expected %s or %s)", mode, modeAppView, modePDS)
+	}
+	return mode, nil
+}
+
+// isFlagSet reports whether the named command-line flag was given explicitly.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// parseLogLevel converts a textual log level into its slog.Level equivalent.
+// Matching is case-insensitive and surrounding whitespace is ignored.
+//
+// Parameters:
+//   - level: One of "debug", "info", "warn" (or "warning"), "error"
+//
+// Returns the parsed level and true, or slog.LevelInfo and false if the
+// value is not recognised.
+func parseLogLevel(level string) (slog.Level, bool) {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return slog.LevelDebug, true
+	case "info", "":
+		return slog.LevelInfo, true
+	case "warn", "warning":
+		return slog.LevelWarn, true
+	case "error":
+		return slog.LevelError, true
+	default:
+		return slog.LevelInfo, false
+	}
+}
+
+// newLogHandler builds the slog handler used by the application.
+// The format may be "json" for structured JSON output; anything else
+// falls back to the human-readable text handler.
+func newLogHandler(format string, level slog.Leveler) slog.Handler {
+	opts := &slog.HandlerOptions{Level: level}
+	if strings.ToLower(strings.TrimSpace(format)) == "json" {
+		return slog.NewJSONHandler(os.Stdout, opts)
+	}
+	return slog.NewTextHandler(os.Stdout, opts)
+}
+
 // isValidHandle checks if a given handle is in the list of valid handles.
 // If the validHandles list is empty, all handles are considered valid.
+// Both sides are compared normalized (see normalizeHandle).
 //
 // Parameters:
 //   - handle: The handle to validate
@@ -91,8 +285,9 @@ func isValidHandle(handle string, validHandles []string) bool {
 	if len(validHandles) == 0 {
 		return true
 	}
+	handle = normalizeHandle(handle)
 	for _, h := range validHandles {
-		if h == handle {
+		if normalizeHandle(h) == handle {
 			return true
 		}
 	}
@@ -108,12 +303,14 @@ func isValidHandle(handle string, validHandles []string) bool {
 //   - xrpcc: XRPC client for API communication
 //   - dir: Identity directory service
 //   - validHandles: List of allowed handles
+//   - validDIDs: List of allowed DIDs
+//   - publicDir: Directory holding the built frontend (empty to use embedded assets)
 //   - auth: Optional PDS authentication configuration
 //
 // Returns an error if server setup or operation fails.
-func Run(ctx context.Context, bindAddr string, xrpcc *xrpc.Client, dir identity.Directory, validHandles []string, auth *AuthConfig) error {
+func Run(ctx context.Context, bindAddr string, xrpcc *xrpc.Client, dir identity.Directory, validHandles []string, validDIDs []string, publicDir string, auth *AuthConfig) error {
 	// Create and set up server
-	srv, err := setupServer(bindAddr, xrpcc, dir, validHandles, auth)
+	srv, err := setupServer(bindAddr, xrpcc, dir, validHandles, validDIDs, publicDir, auth)
 	if err != nil {
 		return fmt.Errorf("failed to set up server: %w", err)
 	}
@@ -126,98 +323,490 @@ func Run(ctx context.Context, bindAddr string, xrpcc *xrpc.Client, dir identity.
 // server setup, and graceful shutdown.
 func main() {
 	var bindAddr string
+	var mode string
+	var publicOnly bool
 	var appviewHost string
 	var validHandles string
+	var validDIDs string
 	var pdsHost string
 	var pdsHandle string
 	var pdsPassword string
 	var enablePortfolio bool
+	var enableLive bool
+	var publicDir string
+	var siteTitle string
+	var titleFormat string
+	var tagline string
+	var contact string
+	var robotsTxt string
+	var robotsFile string
+	var sitemapMaxURLs int
+	var sitemapCacheTTL time.Duration
+	var feedDefaultLimit int
+	var feedMaxLimit int
+	var feedMaxFetches int
+	var feedCacheTTL time.Duration
+	var feedCacheMaxAge time.Duration
+	var threadMaxNodes int
+	var jetstreamURL string
+	var fallbackAppView string
+	var hydrationAppView string
+	var feedProxy string
+	var fallbackAfter int
+	var adminToken string
+	var fingerprintKey string
+	var handleHeader string
+	var disableHostFallback bool
+	var defaultHandle string
+	var userAgent string
+	var traceUpstream bool
+	var assetMaxAge time.Duration
+	var canonicalHost string
+	var trustedProxies string
+	var recordCollections string
+	var cacheMaxAges string
+	var bodyLimit string
+	var handleRecheckInterval time.Duration
+	var didDocumentsFlag string
+	var strictFields bool
+	var cspAllowExternalImg bool
+	var cspConnectExtra string
+	var validHandlesFile string
+	tuning := defaultServerTuning
+	upstream := defaultUpstreamTuning
+	var apiBodyLimit string
+	var upstreamMaxResponse string
+	var liveMaxConns int
+	var maxInFlight int
+	var logLevel string
+	var logFormat string
+	var configFile string
+	var basicAuthUser string
+	var basicAuthPassword string
+	var healthDetail string
+	var healthSecret string
+	var breakerThreshold int
+	var breakerCooldown time.Duration
 
 	// Parse command line flags
+	flag.StringVar(&configFile, "config", "", "YAML or JSON file with settings keyed by flag name")
 	flag.StringVar(&bindAddr, "bind", ":8200", "address to bind server to")
+	flag.StringVar(&mode, "mode", "", "operating mode (appview, pds); inferred from PDS settings when empty")
+	flag.BoolVar(&publicOnly, "public-only", false, "run as a public AppView mirror, refusing any credentials and disabling auth and admin endpoints")
 	flag.StringVar(&appviewHost, "appview", "https://api.bsky.app", "appview host to connect to")
 	flag.StringVar(&validHandles, "valid-handles", "", "comma-separated list of valid handles")
+	flag.StringVar(&validHandlesFile, "valid-handles-file", "", "file listing valid handles, reloaded on SIGHUP")
+	flag.StringVar(&validDIDs, "valid-dids", "", "comma-separated list of valid DIDs")
 	flag.StringVar(&pdsHost, "pds", "", "PDS host to connect to")
 	flag.StringVar(&pdsHandle, "pds-handle", "", "handle to authenticate with PDS")
 	flag.StringVar(&pdsPassword, "pds-password", "", "password to authenticate with PDS")
 	flag.BoolVar(&enablePortfolio, "portfolio", false, "enable portfolio feature")
+	flag.StringVar(&siteTitle, "site-title", defaultSiteTitle, "base document title")
+	flag.StringVar(&titleFormat, "title-format", defaultTitleFormat, "per-profile title format ({handle}, {displayName}, {siteTitle})")
+	flag.StringVar(&tagline, "tagline", "", "site tagline returned by /api/about")
+	flag.StringVar(&contact, "contact", "", "contact link returned by /api/about (http(s) or mailto URL)")
+	flag.StringVar(&robotsTxt, "robots", "", "robots.txt content (generated from the known routes when empty)")
+	flag.StringVar(&robotsFile, "robots-file", "", "file to serve as robots.txt")
+	flag.IntVar(&sitemapMaxURLs, "sitemap-max-urls", defaultSitemapMaxURLs, "maximum number of URLs in sitemap.xml")
+	flag.DurationVar(&sitemapCacheTTL, "sitemap-cache-ttl", defaultSitemapCacheTTL, "how long a generated sitemap.xml is cached")
+	flag.IntVar(&feedDefaultLimit, "feed-default-limit", defaultFeedLimit, "default page size for feed endpoints")
+	flag.IntVar(&feedMaxLimit, "feed-max-limit", defaultFeedMaxLimit, "maximum page size for feed endpoints")
+	flag.IntVar(&threadMaxNodes, "thread-max-nodes", defaultThreadMaxNodes, "maximum posts returned for one thread, pruning the deepest and widest replies first (0 disables)")
+	flag.IntVar(&feedMaxFetches, "feed-max-fetches", defaultFeedMaxFetches, "maximum upstream pages read to fill one author feed page")
+	flag.DurationVar(&feedCacheTTL, "feed-cache-ttl", defaultFeedCacheTTL, "how long a cached feed page is served as fresh before a background refresh (0 disables the feed cache)")
+	flag.DurationVar(&feedCacheMaxAge, "feed-cache-max-age", defaultFeedCacheMaxAge, "how long a stale feed page may still be served while it is refreshed")
+	flag.StringVar(&hydrationAppView, "hydration-appview", "", "AppView serving hydrated reads unauthenticated in PDS mode (takes precedence over --appview)")
+	flag.StringVar(&feedProxy, "feed-proxy", "", "atproto-proxy service (did#service_id) the upstream should route feed generator fetches to")
+	flag.StringVar(&fallbackAppView, "fallback-appview", "https://api.bsky.app", "AppView serving reads when PDS authentication keeps failing")
+	flag.IntVar(&fallbackAfter, "fallback-after", defaultFallbackAfter, "consecutive token refresh failures before falling back to the AppView (0 disables)")
+	flag.DurationVar(&tuning.ReadHeaderTimeout, "read-header-timeout", tuning.ReadHeaderTimeout, "maximum duration for reading request headers")
+	flag.DurationVar(&tuning.ReadTimeout, "read-timeout", tuning.ReadTimeout, "maximum duration for reading an entire request")
+	flag.DurationVar(&tuning.WriteTimeout, "write-timeout", tuning.WriteTimeout, "maximum duration for writing a response")
+	flag.DurationVar(&tuning.IdleTimeout, "idle-timeout", tuning.IdleTimeout, "how long keep-alive connections may stay idle")
+	flag.IntVar(&tuning.MaxHeaderBytes, "max-header-bytes", tuning.MaxHeaderBytes, "maximum size of request headers in bytes")
+	flag.BoolVar(&strictFields, "strict-fields", false, "reject unknown ?fields= names with 400 instead of ignoring them")
+	flag.StringVar(&didDocumentsFlag, "did-documents", "", "comma-separated did:web document files or URLs resolved before the network directory")
+	flag.DurationVar(&handleRecheckInterval, "handle-recheck-interval", defaultHandleRecheckInterval, "how often configured handles are re-resolved to detect changes (0 disables)")
+	flag.StringVar(&bodyLimit, "body-limit", "64M", "maximum request body size (e.g. 64M, 512K)")
+	flag.StringVar(&apiBodyLimit, "api-body-limit", "64K", "maximum request body size for /api routes")
+	flag.IntVar(&maxInFlight, "max-in-flight", defaultMaxInFlight, "maximum concurrent /api requests before answering 503 (0 disables)")
+	flag.BoolVar(&cspAllowExternalImg, "csp-allow-external-img", false, "allow images from any HTTPS host in the CSP instead of only the Bluesky CDN")
+	flag.StringVar(&cspConnectExtra, "csp-connect-extra", "", "comma-separated origins or hosts the CSP additionally allows in connect-src")
+	flag.StringVar(&canonicalHost, "canonical-host", "", "redirect pages requested under other hostnames to this host (disabled when empty)")
+	flag.StringVar(&userAgent, "user-agent", "", "User-Agent for outbound XRPC requests (default athome/<version>, plus the canonical host if set)")
+	flag.IntVar(&breakerThreshold, "breaker-threshold", defaultBreakerThreshold, "consecutive failures after which an upstream host is short-circuited (0 disables)")
+	flag.DurationVar(&breakerCooldown, "breaker-cooldown", defaultBreakerCooldown, "how long a tripped upstream host is short-circuited before a probe")
+	flag.IntVar(&upstream.MaxIdleConnsPerHost, "upstream-max-idle-conns-per-host", upstream.MaxIdleConnsPerHost, "idle keep-alive connections kept per upstream host")
+	flag.DurationVar(&upstream.IdleConnTimeout, "upstream-idle-conn-timeout", upstream.IdleConnTimeout, "how long an idle upstream connection is kept")
+	flag.DurationVar(&upstream.DialTimeout, "upstream-dial-timeout", upstream.DialTimeout, "maximum duration for connecting to an upstream host")
+	flag.StringVar(&upstreamMaxResponse, "upstream-max-response", bytes.FormatDecimal(defaultUpstreamMaxResponse), "largest upstream response body read (e.g. 16M; 0 disables)")
+	flag.BoolVar(&traceUpstream, "trace-upstream", false, "log every outbound XRPC request with its status and duration at debug level")
+	flag.BoolVar(&disableHostFallback, "disable-host-fallback", false, "require an explicit handle instead of using the request hostname")
+	flag.StringVar(&defaultHandle, "default-handle", "", "handle used when a request names none and its hostname is not a handle")
+	flag.StringVar(&handleHeader, "handle-header", defaultHandleHeader, "header a trusted proxy uses to name the target handle (empty disables)")
+	flag.StringVar(&recordCollections, "record-collections", strings.Join(defaultRecordCollections, ","), "comma-separated collections whose records /api/record/* may return (empty disables)")
+	flag.StringVar(&cacheMaxAges, "cache-max-ages", "", "comma-separated route=duration entries overriding how long clients may cache API responses, e.g. /api/feed=1m")
+	flag.StringVar(&trustedProxies, "trusted-proxies", "", "comma-separated IPs or CIDR ranges of proxies allowed to set the handle header")
+	flag.StringVar(&adminToken, "admin-token", "", "shared secret for the /admin endpoints (disabled when empty)")
+	flag.StringVar(&fingerprintKey, "credential-fingerprint-key", "", "secret keying the PDS credential fingerprint (random per run when empty)")
+	flag.StringVar(&basicAuthUser, "basic-auth-user", "", "require HTTP Basic Auth with this user for every route but /healthz (disabled when empty)")
+	flag.StringVar(&basicAuthPassword, "basic-auth-password", "", "password for --basic-auth-user")
+	flag.StringVar(&healthDetail, "health-detail", healthDetailPublic, "who sees the daemon name and build in /healthz (public, minimal, secret)")
+	flag.StringVar(&healthSecret, "health-secret", "", "secret sent in the X-Health-Secret header to see /healthz details in secret mode")
+	flag.BoolVar(&enableLive, "live", false, "enable live post updates over /ws and /sse")
+	flag.StringVar(&jetstreamURL, "jetstream-url", defaultJetstreamURL, "Jetstream endpoint used for live post updates")
+	flag.IntVar(&liveMaxConns, "live-max-conns", defaultLiveMaxConns, "maximum concurrent /ws connections")
+	flag.DurationVar(&assetMaxAge, "asset-max-age", defaultAssetMaxAge, "how long browsers may cache the content-hashed /assets files (0 disables)")
+	flag.StringVar(&publicDir, "public-dir", "", "serve the frontend from this directory instead of the embedded assets")
+	flag.StringVar(&logLevel, "log-level", "info", "log level (debug, info, warn, error)")
+	flag.StringVar(&logFormat, "log-format", "text", "log output format (text, json)")
 	flag.Parse()
 
-	// Override flags with environment variables if present
-	bindAddr = getEnvOrFlag("ATHOME_BIND", bindAddr)
-	appviewHost = getEnvOrFlag("ATHOME_APPVIEW", appviewHost)
-	validHandlesList := getEnvListOrFlag("ATHOME_VALID_HANDLES", validHandles)
-	pdsHost = getEnvOrFlag("ATHOME_PDS", pdsHost)
-	pdsHandle = getEnvOrFlag("ATHOME_PDS_HANDLE", pdsHandle)
-	pdsPassword = getEnvOrFlag("ATHOME_PDS_PASSWORD", pdsPassword)
-	if envPortfolio := os.Getenv("ATHOME_ENABLE_PORTFOLIO"); envPortfolio != "" {
-		enablePortfolio = strings.ToLower(envPortfolio) == "true" || envPortfolio == "1"
-	}
-
-	// Set up logging
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
-	}))
+	// Fill in flags not given on the command line from the config file
+	var fromFile []string
+	configFile = getEnvOrFlag("ATHOME_CONFIG", "config", configFile)
+	if configFile != "" {
+		settings, err := loadConfigFile(configFile)
+		if err == nil {
+			fromFile, err = applyConfigFile(flag.CommandLine, settings)
+		}
+		if err != nil {
+			slog.Error("configuration error", "path", configFile, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// Override the file and defaults with environment variables if present;
+	// flags given on the command line take precedence over both
+	bindAddr = getEnvOrFlag("ATHOME_BIND", "bind", bindAddr)
+	mode = getEnvOrFlag("ATHOME_MODE", "mode", mode)
+	publicOnly = getEnvBoolOrFlag("ATHOME_PUBLIC_ONLY", "public-only", publicOnly)
+	appviewHost = getEnvOrFlag("ATHOME_APPVIEW", "appview", appviewHost)
+	validHandlesList := getEnvListOrFlag("ATHOME_VALID_HANDLES", "valid-handles", validHandles)
+	validHandlesFile = getEnvOrFlag("ATHOME_VALID_HANDLES_FILE", "valid-handles-file", validHandlesFile)
+	validDIDsList := getEnvListOrFlag("ATHOME_VALID_DIDS", "valid-dids", validDIDs)
+	pdsHost = getEnvOrFlag("ATHOME_PDS", "pds", pdsHost)
+	pdsHandle = getEnvOrFlag("ATHOME_PDS_HANDLE", "pds-handle", pdsHandle)
+	pdsPassword = getEnvOrFlag("ATHOME_PDS_PASSWORD", "pds-password", pdsPassword)
+	publicDir = getEnvOrFlag("ATHOME_PUBLIC_DIR", "public-dir", publicDir)
+	assetMaxAge = getEnvDurationOrFlag("ATHOME_ASSET_MAX_AGE", "asset-max-age", assetMaxAge)
+	siteTitle = getEnvOrFlag("ATHOME_SITE_TITLE", "site-title", siteTitle)
+	titleFormat = getEnvOrFlag("ATHOME_TITLE_FORMAT", "title-format", titleFormat)
+	tagline = getEnvOrFlag("ATHOME_TAGLINE", "tagline", tagline)
+	contact = getEnvOrFlag("ATHOME_CONTACT", "contact", contact)
+	robotsTxt = getEnvOrFlag("ATHOME_ROBOTS", "robots", robotsTxt)
+	robotsFile = getEnvOrFlag("ATHOME_ROBOTS_FILE", "robots-file", robotsFile)
+	sitemapMaxURLs = getEnvIntOrFlag("ATHOME_SITEMAP_MAX_URLS", "sitemap-max-urls", sitemapMaxURLs)
+	sitemapCacheTTL = getEnvDurationOrFlag("ATHOME_SITEMAP_CACHE_TTL", "sitemap-cache-ttl", sitemapCacheTTL)
+	feedDefaultLimit = getEnvIntOrFlag("ATHOME_FEED_DEFAULT_LIMIT", "feed-default-limit", feedDefaultLimit)
+	feedMaxLimit = getEnvIntOrFlag("ATHOME_FEED_MAX_LIMIT", "feed-max-limit", feedMaxLimit)
+	feedMaxFetches = getEnvIntOrFlag("ATHOME_FEED_MAX_FETCHES", "feed-max-fetches", feedMaxFetches)
+	feedCacheTTL = getEnvDurationOrFlag("ATHOME_FEED_CACHE_TTL", "feed-cache-ttl", feedCacheTTL)
+	feedCacheMaxAge = getEnvDurationOrFlag("ATHOME_FEED_CACHE_MAX_AGE", "feed-cache-max-age", feedCacheMaxAge)
+	threadMaxNodes = getEnvIntOrFlag("ATHOME_THREAD_MAX_NODES", "thread-max-nodes", threadMaxNodes)
+	jetstreamURL = getEnvOrFlag("ATHOME_JETSTREAM_URL", "jetstream-url", jetstreamURL)
+	fallbackAppView = getEnvOrFlag("ATHOME_FALLBACK_APPVIEW", "fallback-appview", fallbackAppView)
+	hydrationAppView = getEnvOrFlag("ATHOME_HYDRATION_APPVIEW", "hydration-appview", hydrationAppView)
+	feedProxy = getEnvOrFlag("ATHOME_FEED_PROXY", "feed-proxy", feedProxy)
+	fallbackAfter = getEnvIntOrFlag("ATHOME_FALLBACK_AFTER", "fallback-after", fallbackAfter)
+	adminToken = getEnvOrFlag("ATHOME_ADMIN_TOKEN", "admin-token", adminToken)
+	fingerprintKey = getEnvOrFlag("ATHOME_CREDENTIAL_FINGERPRINT_KEY", "credential-fingerprint-key", fingerprintKey)
+	basicAuthUser = getEnvOrFlag("ATHOME_BASIC_AUTH_USER", "basic-auth-user", basicAuthUser)
+	basicAuthPassword = getEnvOrFlag("ATHOME_BASIC_AUTH_PASSWORD", "basic-auth-password", basicAuthPassword)
+	healthDetail = getEnvOrFlag("ATHOME_HEALTH_DETAIL", "health-detail", healthDetail)
+	healthSecret = getEnvOrFlag("ATHOME_HEALTH_SECRET", "health-secret", healthSecret)
+	canonicalHost = getEnvOrFlag("ATHOME_CANONICAL_HOST", "canonical-host", canonicalHost)
+	handleHeader = getEnvOrFlag("ATHOME_HANDLE_HEADER", "handle-header", handleHeader)
+	userAgent = getEnvOrFlag("ATHOME_USER_AGENT", "user-agent", userAgent)
+	if userAgent == "" {
+		userAgent = defaultUserAgent(canonicalHost)
+	}
+	breakerThreshold = getEnvIntOrFlag("ATHOME_BREAKER_THRESHOLD", "breaker-threshold", breakerThreshold)
+	breakerCooldown = getEnvDurationOrFlag("ATHOME_BREAKER_COOLDOWN", "breaker-cooldown", breakerCooldown)
+	upstream.MaxIdleConnsPerHost = getEnvIntOrFlag("ATHOME_UPSTREAM_MAX_IDLE_CONNS_PER_HOST", "upstream-max-idle-conns-per-host", upstream.MaxIdleConnsPerHost)
+	upstream.IdleConnTimeout = getEnvDurationOrFlag("ATHOME_UPSTREAM_IDLE_CONN_TIMEOUT", "upstream-idle-conn-timeout", upstream.IdleConnTimeout)
+	upstream.DialTimeout = getEnvDurationOrFlag("ATHOME_UPSTREAM_DIAL_TIMEOUT", "upstream-dial-timeout", upstream.DialTimeout)
+	upstreamMaxResponse = getEnvOrFlag("ATHOME_UPSTREAM_MAX_RESPONSE", "upstream-max-response", upstreamMaxResponse)
+	trustedProxiesList := getEnvListOrFlag("ATHOME_TRUSTED_PROXIES", "trusted-proxies", trustedProxies)
+	recordCollectionsList := getEnvListOrFlag("ATHOME_RECORD_COLLECTIONS", "record-collections", recordCollections)
+	cacheMaxAgesList := getEnvListOrFlag("ATHOME_CACHE_MAX_AGES", "cache-max-ages", cacheMaxAges)
+	bodyLimit = getEnvOrFlag("ATHOME_BODY_LIMIT", "body-limit", bodyLimit)
+	tuning.ReadHeaderTimeout = getEnvDurationOrFlag("ATHOME_READ_HEADER_TIMEOUT", "read-header-timeout", tuning.ReadHeaderTimeout)
+	tuning.ReadTimeout = getEnvDurationOrFlag("ATHOME_READ_TIMEOUT", "read-timeout", tuning.ReadTimeout)
+	tuning.WriteTimeout = getEnvDurationOrFlag("ATHOME_WRITE_TIMEOUT", "write-timeout", tuning.WriteTimeout)
+	tuning.IdleTimeout = getEnvDurationOrFlag("ATHOME_IDLE_TIMEOUT", "idle-timeout", tuning.IdleTimeout)
+	tuning.MaxHeaderBytes = getEnvIntOrFlag("ATHOME_MAX_HEADER_BYTES", "max-header-bytes", tuning.MaxHeaderBytes)
+	didDocuments := getEnvListOrFlag("ATHOME_DID_DOCUMENTS", "did-documents", didDocumentsFlag)
+	handleRecheckInterval = getEnvDurationOrFlag("ATHOME_HANDLE_RECHECK_INTERVAL", "handle-recheck-interval", handleRecheckInterval)
+	apiBodyLimit = getEnvOrFlag("ATHOME_API_BODY_LIMIT", "api-body-limit", apiBodyLimit)
+	maxInFlight = getEnvIntOrFlag("ATHOME_MAX_IN_FLIGHT", "max-in-flight", maxInFlight)
+	liveMaxConns = getEnvIntOrFlag("ATHOME_LIVE_MAX_CONNS", "live-max-conns", liveMaxConns)
+	enablePortfolio = getEnvBoolOrFlag("ATHOME_ENABLE_PORTFOLIO", "portfolio", enablePortfolio)
+	strictFields = getEnvBoolOrFlag("ATHOME_STRICT_FIELDS", "strict-fields", strictFields)
+	enableLive = getEnvBoolOrFlag("ATHOME_ENABLE_LIVE", "live", enableLive)
+	disableHostFallback = getEnvBoolOrFlag("ATHOME_DISABLE_HOST_FALLBACK", "disable-host-fallback", disableHostFallback)
+	defaultHandle = getEnvOrFlag("ATHOME_DEFAULT_HANDLE", "default-handle", defaultHandle)
+	traceUpstream = getEnvBoolOrFlag("ATHOME_TRACE_UPSTREAM", "trace-upstream", traceUpstream)
+	cspAllowExternalImg = getEnvBoolOrFlag("ATHOME_CSP_ALLOW_EXTERNAL_IMG", "csp-allow-external-img", cspAllowExternalImg)
+	cspConnectExtraList := getEnvListOrFlag("ATHOME_CSP_CONNECT_EXTRA", "csp-connect-extra", cspConnectExtra)
+
+	logLevel = getEnvOrFlag("ATHOME_LOG_LEVEL", "log-level", logLevel)
+	logFormat = getEnvOrFlag("ATHOME_LOG_FORMAT", "log-format", logFormat)
+
+	// Set up logging; the level can change on SIGHUP
+	level, ok := parseLogLevel(logLevel)
+	logLevelVar := new(slog.LevelVar)
+	logLevelVar.Set(level)
+	logger := slog.New(newLogHandler(logFormat, logLevelVar))
 	slog.SetDefault(logger)
+	if !ok {
+		slog.Warn("unknown log level, defaulting to info", "log_level", logLevel)
+	}
+
+	// A handles file takes precedence over the inline list
+	var err error
+	if validHandlesFile != "" {
+		validHandlesList, err = loadHandlesFile(validHandlesFile)
+		if err != nil {
+			slog.Error("failed to read handles file", "path", validHandlesFile, "error", err)
+			os.Exit(1)
+		}
+	}
 
-	// Validate configuration exclusivity
-	isPDSConfigured := pdsHost != ""
-	isAppViewConfigured := appviewHost != "https://api.bsky.app" // Check if non-default
-	if isPDSConfigured && isAppViewConfigured {
-		slog.Error("configuration error: cannot use both PDS and AppView configurations")
+	// Validate the configuration, reporting every problem at once
+	cfg, errs := validateConfig(rawConfig{
+		Mode:        mode,
+		PublicOnly:  publicOnly,
+		AppViewHost: appviewHost,
+		// An AppView counts as configured only when set explicitly, never by comparing to the default
+		AppViewConfigured:   isFlagSet("appview") || os.Getenv("ATHOME_APPVIEW") != "" || slices.Contains(fromFile, "appview"),
+		HydrationAppView:    hydrationAppView,
+		FeedProxy:           feedProxy,
+		PDSHost:             pdsHost,
+		PDSHandle:           pdsHandle,
+		PDSPassword:         pdsPassword,
+		FingerprintKey:      fingerprintKey,
+		ValidHandles:        validHandlesList,
+		ValidDIDs:           validDIDsList,
+		TrustedProxies:      trustedProxiesList,
+		RecordCollections:   recordCollectionsList,
+		CacheMaxAges:        cacheMaxAgesList,
+		CSPConnectExtra:     cspConnectExtraList,
+		Contact:             contact,
+		BodyLimit:           bodyLimit,
+		APIBodyLimit:        apiBodyLimit,
+		UpstreamMaxResponse: upstreamMaxResponse,
+		FeedDefaultLimit:    feedDefaultLimit,
+		FeedMaxLimit:        feedMaxLimit,
+		FeedMaxFetches:      feedMaxFetches,
+		EnablePortfolio:     enablePortfolio,
+		EnableLive:          enableLive,
+		StrictFields:        strictFields,
+		DisableHostFallback: disableHostFallback,
+		DefaultHandle:       defaultHandle,
+		AdminToken:          adminToken,
+		BasicAuthUser:       basicAuthUser,
+		BasicAuthPassword:   basicAuthPassword,
+		HealthDetail:        healthDetail,
+		HealthSecret:        healthSecret,
+	})
+	if len(errs) > 0 {
+		for _, err := range errs {
+			slog.Error("configuration error", "error", err)
+		}
 		os.Exit(1)
 	}
+	cfg.logSummary()
+	upstream.MaxResponseBytes = cfg.UpstreamMaxResponse
+
+	// Short-circuit upstream hosts that keep failing; shared by all clients
+	breaker := newCircuitBreaker(breakerThreshold, breakerCooldown)
 
 	// Create XRPC client based on configuration
 	var xrpcc *xrpc.Client
+	var readc *xrpc.Client
 	var auth *AuthConfig
 
-	if isPDSConfigured {
-		if pdsHandle == "" || pdsPassword == "" {
-			slog.Error("PDS host specified but missing handle or password")
-			os.Exit(1)
-		}
-
+	if cfg.Mode == modePDS {
 		// When using PDS, create both XRPC client and auth config
 		xrpcc = &xrpc.Client{
-			Client: util.RobustHTTPClient(),
-			Host:   pdsHost,
+			Client: newHTTPClient(userAgent, traceUpstream, breaker, upstream),
+			Host:   cfg.PDSHost,
 		}
 
 		// Create auth config for token management
 		auth = &AuthConfig{
-			PDS:      pdsHost,
-			Handle:   pdsHandle,
-			Password: pdsPassword,
+			PDS:            cfg.PDSHost,
+			Handle:         cfg.PDSHandle,
+			Password:       cfg.PDSPassword,
+			FingerprintKey: cfg.FingerprintKey,
 		}
 
-		slog.Info("using PDS configuration", "host", pdsHost)
+		// When an AppView is also configured, send hydrated reads there
+		// unauthenticated; calls made as the account stay on the PDS
+		if host := cfg.readHost(); host != "" {
+			readc = &xrpc.Client{
+				Client: newHTTPClient(userAgent, traceUpstream, breaker, upstream),
+				Host:   host,
+			}
+			slog.Info("using AppView for reads", "host", host)
+		}
 	} else {
 		// When using AppView, only create XRPC client
 		xrpcc = &xrpc.Client{
-			Client: util.RobustHTTPClient(),
-			Host:   appviewHost,
+			Client: newHTTPClient(userAgent, traceUpstream, breaker, upstream),
+			Host:   cfg.AppViewHost,
 		}
-
-		slog.Info("using AppView configuration", "host", appviewHost)
 	}
 
 	// Create directory service wrapper
 	dir := &defaultDirectory{
 		dir: identity.DefaultDirectory(),
 	}
+	if len(didDocuments) > 0 {
+		dir.static = newDIDDocumentResolver(didDocuments)
+		if err := dir.static.preload(context.Background()); err != nil {
+			slog.Error("failed to load DID documents", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("using configured did:web documents", "count", len(didDocuments))
+	}
 
-	// Set up server
-	srv, err := setupServer(bindAddr, xrpcc, dir, validHandlesList, auth)
+	// Set up server, without any credential handling for a public-only mirror
+	var srv *Server
+	if cfg.PublicOnly {
+		srv, err = setupPublicServer(bindAddr, xrpcc, dir, cfg.ValidHandles, cfg.ValidDIDs, publicDir)
+	} else {
+		srv, err = setupServer(bindAddr, xrpcc, dir, cfg.ValidHandles, cfg.ValidDIDs, publicDir, auth)
+	}
 	if err != nil {
 		slog.Error("failed to set up server", "error", err)
 		os.Exit(1)
 	}
 
+	// Route hydrated reads to the AppView if configured alongside a PDS
+	srv.readc = readc
+
+	// Fall back to a public AppView for reads if PDS credentials stop working
+	if cfg.Mode == modePDS && fallbackAfter > 0 {
+		srv.fallbackc = &xrpc.Client{
+			Client: newHTTPClient(userAgent, traceUpstream, breaker, upstream),
+			Host:   fallbackAppView,
+		}
+		srv.fallbackAfter = fallbackAfter
+	}
+
+	// Re-resolve configured handles periodically to catch handle changes
+	srv.handleRecheckInterval = handleRecheckInterval
+
+	// Apply connection timeouts to the underlying http.Server
+	tuning.apply(srv.e.Server)
+
+	// Configure ?fields= projection
+	srv.strictFields = cfg.StrictFields
+
+	// Configure request body limits
+	srv.bodyLimit = cfg.BodyLimit
+	srv.apiBodyLimit = cfg.APIBodyLimit
+
+	// Cap concurrent /api requests
+	srv.inFlight = newInFlightLimit(maxInFlight)
+
+	// Enable operator endpoints if a shared secret is configured
+	srv.adminToken = cfg.AdminToken
+
+	// Require credentials for every route but /healthz on private instances
+	srv.basicAuthUser = cfg.BasicAuthUser
+	srv.basicAuthPassword = cfg.BasicAuthPassword
+
+	// Configure who sees the detailed health status
+	srv.healthDetail = cfg.HealthDetail
+	srv.healthSecret = cfg.HealthSecret
+
+	// Configure where the CSP lets images load from
+	srv.cspAllowExternalImg = cspAllowExternalImg
+
+	// Let the frontend fetch from the extra hosts an operator allows
+	srv.cspConnectExtra = cfg.CSPConnectExtra
+
+	// Redirect other hostnames to the canonical one
+	srv.canonicalHost = canonicalHost
+
+	// Require explicit handles if the hostname must not be used as one
+	srv.disableHostFallback = cfg.DisableHostFallback
+
+	// Serve this handle when a request names none
+	srv.defaultHandle = cfg.DefaultHandle
+
+	// Configure the handle header accepted from trusted proxies
+	srv.handleHeader = handleHeader
+	srv.trustedProxies = cfg.TrustedProxies
+
+	// Limit which collections /api/record/* may read
+	srv.recordCollections = cfg.RecordCollections
+
+	// Route feed generator fetches to a specific service
+	srv.feedProxy = cfg.FeedProxy
+
+	// Tune how long clients may cache each API route
+	srv.routeMaxAges = cfg.RouteMaxAges
+
+	// Configure the document title
+	srv.siteTitle = siteTitle
+	srv.titleFormat = titleFormat
+
+	// Configure the site metadata served by /api/about
+	srv.tagline = tagline
+	srv.contact = cfg.Contact
+
+	// Configure robots.txt, preferring a file over inline content
+	if robotsFile != "" {
+		content, err := os.ReadFile(robotsFile)
+		if err != nil {
+			slog.Error("failed to read robots file", "path", robotsFile, "error", err)
+			os.Exit(1)
+		}
+		robotsTxt = string(content)
+	}
+	srv.robotsTxt = robotsTxt
+
+	// Configure browser caching of the frontend assets
+	srv.assetMaxAge = assetMaxAge
+
+	// Configure sitemap generation
+	srv.sitemapMaxURLs = sitemapMaxURLs
+	srv.sitemaps = newTTLCache[[]byte](sitemapCacheTTL, defaultSitemapCacheMaxEntries)
+
+	// Configure feed paging
+	srv.FeedDefaultLimit = int64(cfg.FeedDefaultLimit)
+	srv.FeedMaxLimit = int64(cfg.FeedMaxLimit)
+	srv.FeedMaxFetches = cfg.FeedMaxFetches
+
+	// Configure stale-while-revalidate caching of feed pages
+	if srv.feeds = newSWRCache[*authorFeedPage](feedCacheTTL, feedCacheMaxAge, feedCacheMaxEntries); srv.feeds != nil {
+		srv.registerPurgeable(srv.feeds)
+	}
+
+	// Configure thread pruning
+	srv.threadMaxNodes = threadMaxNodes
+
+	// Configure live post updates
+	srv.live.src = &jetstreamSource{url: jetstreamURL}
+	srv.live.maxConns = liveMaxConns
+	srv.enableLive = cfg.EnableLive
+	if cfg.EnableLive {
+		slog.Info("live updates enabled", "jetstream", jetstreamURL)
+	}
+
 	// Enable portfolio if configured
-	srv.enablePortfolio = enablePortfolio
-	if enablePortfolio {
-		slog.Info("portfolio feature enabled")
+	srv.enablePortfolio = cfg.EnablePortfolio
+
+	// Configure what SIGHUP reloads; a log level given by flag or
+	// environment stays pinned rather than following the config file
+	srv.handlesFile = validHandlesFile
+	srv.logLevel = logLevelVar
+	if !isFlagSet("log-level") && os.Getenv("ATHOME_LOG_LEVEL") == "" {
+		srv.reloadConfig = configFile
 	}
 
 	// Set up context for graceful shutdown
@@ -233,6 +822,11 @@ func main() {
 		cancel()
 	}()
 
+	// Reload the handle allowlist and log level on SIGHUP
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go srv.watchReload(ctx, hupChan)
+
 	// Start server
 	if err := startServer(ctx, srv, bindAddr); err != nil {
 		slog.Error("server error", "error", err)
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		input  string
+		want   slog.Level
+		wantOK bool
+	}{
+		{input: "debug", want: slog.LevelDebug, wantOK: true},
+		{input: "INFO", want: slog.LevelInfo, wantOK: true},
+		{input: " warn ", want: slog.LevelWarn, wantOK: true},
+		{input: "warning", want: slog.LevelWarn, wantOK: true},
+		{input: "error", want: slog.LevelError, wantOK: true},
+		{input: "", want: slog.LevelInfo, wantOK: true},
+		{input: "verbose", want: slog.LevelInfo, wantOK: false},
+		{input: "42", want: slog.LevelInfo, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, ok := parseLogLevel(tt.input)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantOK, ok)
+		})
+	}
+}
+
+func TestNewLogHandler(t *testing.T) {
+	_, isJSON := newLogHandler("json", slog.LevelInfo).(*slog.JSONHandler)
+	assert.True(t, isJSON)
+
+	_, isText := newLogHandler("text", slog.LevelInfo).(*slog.TextHandler)
+	assert.True(t, isText)
+
+	_, isText = newLogHandler("bogus", slog.LevelInfo).(*slog.TextHandler)
+	assert.True(t, isText)
+}
+
+func TestSelectMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		pdsHost  string
+		handle   string
+		password string
+		want     string
+		wantErr  bool
+	}{
+		{name: "default is appview", want: modeAppView},
+		{name: "inferred pds", pdsHost: "https://pds.test", handle: "me.test", password: "pw", want: modePDS},
+		{name: "inferred pds missing password", pdsHost: "https://pds.test", handle: "me.test", wantErr: true},
+		{name: "inferred pds missing handle", pdsHost: "https://pds.test", password: "pw", wantErr: true},
+		{name: "explicit appview", mode: "appview", want: modeAppView},
+		{name: "explicit appview with pds host", mode: "appview", pdsHost: "https://pds.test", handle: "me.test", password: "pw", wantErr: true},
+		{name: "explicit pds", mode: "PDS", pdsHost: "https://pds.test", handle: "me.test", password: "pw", want: modePDS},
+		{name: "explicit pds without host", mode: "pds", handle: "me.test", password: "pw", wantErr: true},
+		{name: "unknown mode", mode: "relay", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectMode(tt.mode, tt.pdsHost, tt.handle, tt.password)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
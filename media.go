@@ -0,0 +1,133 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/labstack/echo/v4"
+)
+
+// handleGetMedia handles requests for the posts of a user that carry
+// images or video, flattened into a compact shape for gallery views.
+//
+// URL Parameters:
+//   - handle: Optional handle parameter (falls back to hostname)
+//
+// Query Parameters:
+//   - cursor: Pagination cursor for fetching more posts
+//   - limit: Page size (see FeedDefaultLimit and FeedMaxLimit)
+//
+// Returns:
+//   - 200 OK with the media posts
+//   - 400 Bad Request if handle, cursor or limit is invalid
+//   - 403 Forbidden if handle is not allowed
+//   - 500 Internal Server Error if the fetch fails
+func (srv *Server) handleGetMedia(c echo.Context) error {
+	did, err := srv.validateAndGetDID(c, getActorFromRequest(c))
+	if err != nil {
+		return err
+	}
+
+	cursor, err := getCursorFromRequest(c)
+	if err != nil {
+		return err
+	}
+	limit, err := srv.getFeedLimitFromRequest(c)
+	if err != nil {
+		return err
+	}
+
+	// Ensure we have a valid token before making the API request
+	if err := srv.ensureValidToken(c); err != nil {
+		slog.Error("failed to ensure valid token", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Authentication error: "+err.Error())
+	}
+
+	feed, err := srv.feedFetcher().GetAuthorFeed(c.Request().Context(), did, cursor, "posts_with_media", limit)
+	if err != nil {
+		slog.Error("failed to fetch media feed", "error", err)
+		return upstreamError(c, err)
+	}
+
+	// The upstream filter also matches reposts and external cards, so keep
+	// only the owner's posts that actually hydrated with images or video
+	posts := []MediaPost{}
+	for _, item := range feed.Feed {
+		if !isOwnFeedPost(item, did) {
+			continue
+		}
+		media := postMedia(item.Post.Embed)
+		if len(media) == 0 {
+			continue
+		}
+		posts = append(posts, MediaPost{
+			URI:       item.Post.Uri,
+			CID:       item.Post.Cid,
+			IndexedAt: item.Post.IndexedAt,
+			Media:     media,
+		})
+	}
+
+	response := map[string]interface{}{
+		"cursor": feed.Cursor,
+		"posts":  posts,
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// postMedia flattens the images or video of a hydrated embed, including
+// the media half of a quote post. Other embeds yield nothing.
+func postMedia(embed *bsky.FeedDefs_PostView_Embed) []MediaItem {
+	if embed == nil {
+		return nil
+	}
+	if embed.EmbedRecordWithMedia_View != nil && embed.EmbedRecordWithMedia_View.Media != nil {
+		media := embed.EmbedRecordWithMedia_View.Media
+		return mediaItems(media.EmbedImages_View, media.EmbedVideo_View)
+	}
+	return mediaItems(embed.EmbedImages_View, embed.EmbedVideo_View)
+}
+
+// mediaItems converts image and video views to MediaItems
+func mediaItems(images *bsky.EmbedImages_View, video *bsky.EmbedVideo_View) []MediaItem {
+	var items []MediaItem
+	if images != nil {
+		for _, img := range images.Images {
+			if img == nil {
+				continue
+			}
+			items = append(items, MediaItem{
+				Type:        "image",
+				URL:         img.Fullsize,
+				Thumb:       img.Thumb,
+				Alt:         img.Alt,
+				AspectRatio: aspectRatio(img.AspectRatio),
+			})
+		}
+	}
+	if video != nil {
+		item := MediaItem{
+			Type:        "video",
+			URL:         video.Playlist,
+			AspectRatio: aspectRatio(video.AspectRatio),
+		}
+		if video.Thumbnail != nil {
+			item.Thumb = *video.Thumbnail
+		}
+		if video.Alt != nil {
+			item.Alt = *video.Alt
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// aspectRatio returns width/height, or 0 when unknown
+func aspectRatio(ar *bsky.EmbedDefs_AspectRatio) float64 {
+	if ar == nil || ar.Height == 0 {
+		return 0
+	}
+	return float64(ar.Width) / float64(ar.Height)
+}
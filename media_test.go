@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleGetMedia(t *testing.T) {
+	dir := identity.NewMockDirectory()
+	dir.Insert(identity.Identity{DID: syntax.DID("did:plc:alice"), Handle: syntax.Handle("alice.test")})
+
+	stub := newStubTransport().on("app.bsky.feed.getAuthorFeed", http.StatusOK, `{
+		"cursor": "media-next",
+		"feed": [
+			{"post": {
+				"uri": "at://did:plc:alice/app.bsky.feed.post/photos",
+				"cid": "bafyphotos",
+				"author": {"did": "did:plc:alice", "handle": "alice.test"},
+				"record": {"$type": "app.bsky.feed.post", "text": "sunset", "createdAt": "2024-01-01T00:00:00Z"},
+				"embed": {"$type": "app.bsky.embed.images#view", "images": [
+					{"fullsize": "https://cdn.test/full/1", "thumb": "https://cdn.test/thumb/1", "alt": "Sunset over the bay", "aspectRatio": {"width": 4, "height": 3}},
+					{"fullsize": "https://cdn.test/full/2", "thumb": "https://cdn.test/thumb/2", "alt": ""}
+				]},
+				"indexedAt": "2024-01-01T00:00:00Z"
+			}},
+			{"post": {
+				"uri": "at://did:plc:alice/app.bsky.feed.post/text",
+				"cid": "bafytext",
+				"author": {"did": "did:plc:alice", "handle": "alice.test"},
+				"record": {"$type": "app.bsky.feed.post", "text": "just words", "createdAt": "2024-01-01T00:00:00Z"},
+				"indexedAt": "2024-01-01T00:00:00Z"
+			}},
+			{"post": {
+				"uri": "at://did:plc:alice/app.bsky.feed.post/clip",
+				"cid": "bafyclip",
+				"author": {"did": "did:plc:alice", "handle": "alice.test"},
+				"record": {"$type": "app.bsky.feed.post", "text": "clip", "createdAt": "2024-01-01T00:00:00Z"},
+				"embed": {"$type": "app.bsky.embed.video#view", "cid": "bafyvideo", "playlist": "https://video.test/playlist.m3u8", "thumbnail": "https://video.test/thumb.jpg", "alt": "Waves"},
+				"indexedAt": "2024-01-01T00:00:00Z"
+			}},
+			{"post": {
+				"uri": "at://did:plc:bob/app.bsky.feed.post/repost",
+				"cid": "bafyrepost",
+				"author": {"did": "did:plc:bob", "handle": "bob.test"},
+				"record": {"$type": "app.bsky.feed.post", "text": "not alice", "createdAt": "2024-01-01T00:00:00Z"},
+				"embed": {"$type": "app.bsky.embed.images#view", "images": [{"fullsize": "https://cdn.test/full/bob", "thumb": "https://cdn.test/thumb/bob", "alt": "Bob's photo"}]},
+				"indexedAt": "2024-01-01T00:00:00Z"
+			}}
+		]
+	}`)
+	srv := newStubServer(stub)
+	srv.dir = &dir
+
+	rec, err := serveParam(srv, srv.handleGetMedia, "handle", "alice.test", "cursor=media-1")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req := stub.lastRequest("app.bsky.feed.getAuthorFeed")
+	require.NotNil(t, req)
+	assert.Equal(t, "posts_with_media", req.URL.Query().Get("filter"))
+	assert.Equal(t, "media-1", req.URL.Query().Get("cursor"))
+
+	var body struct {
+		Cursor string      `json:"cursor"`
+		Posts  []MediaPost `json:"posts"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "media-next", body.Cursor)
+
+	// Text-only posts and other authors' reposts are excluded
+	require.Len(t, body.Posts, 2)
+	assert.Equal(t, "at://did:plc:alice/app.bsky.feed.post/photos", body.Posts[0].URI)
+	assert.Equal(t, "at://did:plc:alice/app.bsky.feed.post/clip", body.Posts[1].URI)
+
+	photos := body.Posts[0].Media
+	require.Len(t, photos, 2)
+	assert.Equal(t, MediaItem{Type: "image", URL: "https://cdn.test/full/1", Thumb: "https://cdn.test/thumb/1", Alt: "Sunset over the bay", AspectRatio: 4.0 / 3.0}, photos[0])
+	assert.Equal(t, "", photos[1].Alt)
+
+	assert.Equal(t, []MediaItem{{Type: "video", URL: "https://video.test/playlist.m3u8", Thumb: "https://video.test/thumb.jpg", Alt: "Waves"}}, body.Posts[1].Media)
+}
+
+func TestHandleGetMedia_Empty(t *testing.T) {
+	stub := newStubTransport().on("app.bsky.feed.getAuthorFeed", http.StatusOK, `{"feed": []}`)
+	srv := newStubServer(stub)
+
+	rec, err := serveParam(srv, srv.handleGetMedia, "did", "did:plc:abc123", "")
+	require.NoError(t, err)
+	assert.Contains(t, rec.Body.String(), `"posts":[]`)
+}
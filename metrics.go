@@ -0,0 +1,89 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics holds the server's Prometheus metrics, served on /admin/metrics.
+// Each server has its own registry, so tests never share state.
+type metrics struct {
+	registry        *prometheus.Registry
+	refreshInterval prometheus.Histogram
+
+	mu          sync.Mutex
+	lastRefresh time.Time // Last successful token refresh, for refreshInterval
+}
+
+// newMetrics creates the registry with the Go runtime, process and auth metrics
+func newMetrics(srv *Server) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		refreshInterval: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name: "athome_token_refresh_interval_seconds",
+			Help: "Time between successful PDS token refreshes. Short intervals mean auth churn.",
+			// From refreshing on every request up to a day
+			Buckets: []float64{1, 10, 60, 300, 900, 1800, 3600, 7200, 21600, 86400},
+		}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.refreshInterval,
+		&tokenExpiryCollector{srv: srv},
+	)
+	return m
+}
+
+// observeRefresh records a successful token refresh at now
+func (m *metrics) observeRefresh(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.lastRefresh.IsZero() {
+		m.refreshInterval.Observe(now.Sub(m.lastRefresh).Seconds())
+	}
+	m.lastRefresh = now
+}
+
+// handler serves the metrics in the Prometheus exposition format
+func (m *metrics) handler() echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+}
+
+// tokenExpiryDesc describes the seconds-to-expiry gauge
+var tokenExpiryDesc = prometheus.NewDesc(
+	"athome_token_expiry_seconds",
+	"Seconds until the current PDS access token expires; negative once expired. Absent when the expiry is unknown.",
+	nil, nil,
+)
+
+// tokenExpiryCollector reports the access token's remaining lifetime as of
+// each scrape. Nothing is reported in AppView mode or while the expiry is
+// unknown, rather than a misleading zero.
+type tokenExpiryCollector struct {
+	srv *Server
+}
+
+// Describe implements prometheus.Collector
+func (tc *tokenExpiryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tokenExpiryDesc
+}
+
+// Collect implements prometheus.Collector
+func (tc *tokenExpiryCollector) Collect(ch chan<- prometheus.Metric) {
+	if tc.srv.auth == nil {
+		return
+	}
+	tc.srv.authMutex.RLock()
+	expiry := tc.srv.auth.TokenExpiry
+	tc.srv.authMutex.RUnlock()
+	if expiry.IsZero() {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(tokenExpiryDesc, prometheus.GaugeValue, time.Until(expiry).Seconds())
+}
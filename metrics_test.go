@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scrapeMetrics fetches /admin/metrics through the handler
+func scrapeMetrics(t *testing.T, srv *Server) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	c := srv.e.NewContext(httptest.NewRequest(http.MethodGet, "/admin/metrics", nil), rec)
+	require.NoError(t, srv.metrics.handler()(c))
+	require.Equal(t, http.StatusOK, rec.Code)
+	return rec.Body.String()
+}
+
+// metricValue extracts the value of an unlabelled sample from a scrape
+func metricValue(t *testing.T, scrape, name string) (float64, bool) {
+	t.Helper()
+	m := regexp.MustCompile(`(?m)^` + regexp.QuoteMeta(name) + ` (\S+)$`).FindStringSubmatch(scrape)
+	if m == nil {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(m[1], 64)
+	require.NoError(t, err)
+	return v, true
+}
+
+func TestMetrics_TokenExpiryAfterRefresh(t *testing.T) {
+	session := func(lifetime time.Duration) string {
+		token := testJWT(`{"alg": "HS256"}`, fmt.Sprintf(`{"exp": %d}`, time.Now().Add(lifetime).Unix()))
+		return `{"accessJwt": "` + token + `", "refreshJwt": "refresh", "handle": "alice.test", "did": "did:plc:abc123"}`
+	}
+	stub := newStubTransport().on("com.atproto.server.createSession", http.StatusOK, session(2*time.Hour))
+	srv := newStubServer(stub)
+	srv.auth = &AuthConfig{Handle: "alice.test", Password: "test-pass"}
+	srv.metrics = newMetrics(srv)
+
+	// Nothing is reported before there is a token
+	_, ok := metricValue(t, scrapeMetrics(t, srv), "athome_token_expiry_seconds")
+	assert.False(t, ok)
+
+	c := srv.e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	require.NoError(t, srv.refreshAuth(c))
+
+	expiresIn, ok := metricValue(t, scrapeMetrics(t, srv), "athome_token_expiry_seconds")
+	require.True(t, ok)
+	assert.InDelta(t, (2 * time.Hour).Seconds(), expiresIn, 5)
+
+	// A new session moves the gauge and records the interval between refreshes
+	stub.on("com.atproto.server.createSession", http.StatusOK, session(time.Hour))
+	_, err := srv.forceRefresh(c.Request().Context())
+	require.NoError(t, err)
+
+	scrape := scrapeMetrics(t, srv)
+	expiresIn, ok = metricValue(t, scrape, "athome_token_expiry_seconds")
+	require.True(t, ok)
+	assert.InDelta(t, time.Hour.Seconds(), expiresIn, 5)
+	count, ok := metricValue(t, scrape, "athome_token_refresh_interval_seconds_count")
+	require.True(t, ok)
+	assert.Equal(t, float64(1), count)
+	fast, ok := metricValue(t, scrape, `athome_token_refresh_interval_seconds_bucket{le="1"}`)
+	require.True(t, ok)
+	assert.Equal(t, float64(1), fast, "back-to-back refreshes land in the smallest bucket")
+}
+
+func TestMetrics_AppViewMode(t *testing.T) {
+	srv := newStubServer(newStubTransport())
+	srv.metrics = newMetrics(srv)
+
+	scrape := scrapeMetrics(t, srv)
+	assert.NotContains(t, scrape, "athome_token_expiry_seconds ")
+	assert.Contains(t, scrape, "go_goroutines")
+}
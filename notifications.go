@@ -0,0 +1,44 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/labstack/echo/v4"
+)
+
+// handleGetUnreadCount handles requests for the owner's unread notification
+// count, e.g. for a badge on their dashboard. Notifications belong to the
+// authenticated account and are private, so the route is guarded by the
+// admin token and only exists in PDS mode.
+//
+// Returns:
+//   - 200 OK with {"count": n}
+//   - 401 Unauthorized if the admin token is wrong
+//   - 404 Not Found if no admin token or PDS auth is configured
+//   - 503 Service Unavailable if PDS authentication is degraded
+func (srv *Server) handleGetUnreadCount(c echo.Context) error {
+	if srv.auth == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "no PDS authentication configured")
+	}
+
+	// Must be asked as the account itself; no AppView can answer this
+	if err := srv.ensureAuthToken(c); err != nil {
+		slog.Error("failed to ensure auth token", "error", err)
+		return err
+	}
+
+	// Called directly rather than through bsky.NotificationGetUnreadCount,
+	// which always sends an empty seenAt that servers reject as malformed
+	var out bsky.NotificationGetUnreadCount_Output
+	if err := srv.xrpcc.Do(c.Request().Context(), xrpc.Query, "", "app.bsky.notification.getUnreadCount", nil, nil, &out); err != nil {
+		slog.Error("failed to fetch unread notification count", "error", err)
+		return upstreamError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"count": out.Count,
+	})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleGetUnreadCount_PDSMode(t *testing.T) {
+	stub := newStubTransport().on("app.bsky.notification.getUnreadCount", http.StatusOK, `{"count": 7}`)
+	srv := newStubServer(stub)
+	srv.adminToken = "s3cret"
+	srv.auth = &AuthConfig{Handle: "alice.test", Password: "test-pass", Token: "access", RefreshAt: time.Now().Add(2 * time.Hour)}
+
+	_, err := serveAdmin(srv, http.MethodGet, srv.handleGetUnreadCount, "wrong")
+	assert.Equal(t, http.StatusUnauthorized, httpStatus(t, err))
+	assert.Nil(t, stub.lastRequest("app.bsky.notification.getUnreadCount"))
+
+	rec, err := serveAdmin(srv, http.MethodGet, srv.handleGetUnreadCount, "s3cret")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"count": 7}`, rec.Body.String())
+
+	// Asked as the account, with no empty seenAt
+	req := stub.lastRequest("app.bsky.notification.getUnreadCount")
+	require.NotNil(t, req)
+	assert.False(t, req.URL.Query().Has("seenAt"))
+
+	// Degraded auth has no fallback for private data
+	srv.degraded.Store(true)
+	_, err = serveAdmin(srv, http.MethodGet, srv.handleGetUnreadCount, "s3cret")
+	assert.Equal(t, http.StatusServiceUnavailable, httpStatus(t, err))
+}
+
+func TestHandleGetUnreadCount_AppViewMode(t *testing.T) {
+	stub := newStubTransport()
+	srv := newStubServer(stub)
+
+	// Hidden without an admin token
+	_, err := serveAdmin(srv, http.MethodGet, srv.handleGetUnreadCount, "anything")
+	assert.Equal(t, http.StatusNotFound, httpStatus(t, err))
+
+	// Still not found with one, since nobody is authenticated
+	srv.adminToken = "s3cret"
+	_, err = serveAdmin(srv, http.MethodGet, srv.handleGetUnreadCount, "s3cret")
+	assert.Equal(t, http.StatusNotFound, httpStatus(t, err))
+	assert.Empty(t, stub.requests)
+}
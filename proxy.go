@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// defaultHandleHeader is the header a trusted proxy uses to name the target handle
+	defaultHandleHeader = "X-AtHome-Handle"
+
+	// headerHandleKey is the context key holding a handle taken from the handle header
+	headerHandleKey = "headerHandle"
+)
+
+// parseTrustedProxies parses a list of IP addresses and CIDR ranges.
+// Bare addresses are treated as single-host ranges.
+func parseTrustedProxies(entries []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// isTrustedProxy reports whether the direct peer of a request is one of
+// the configured trusted proxies. Forwarding headers are not consulted,
+// since those are exactly what an untrusted client could forge.
+func (srv *Server) isTrustedProxy(remoteAddr string) bool {
+	if len(srv.trustedProxies) == 0 {
+		return false
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range srv.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleHeaderMiddleware records the handle named by the handle header
+// for getHandleFromRequest, but only for requests from a trusted proxy.
+// The header is ignored, and logged, when sent by anyone else.
+func (srv *Server) handleHeaderMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if srv.handleHeader == "" {
+			return next(c)
+		}
+		handle := strings.TrimSpace(c.Request().Header.Get(srv.handleHeader))
+		if handle == "" {
+			return next(c)
+		}
+		if !srv.isTrustedProxy(c.Request().RemoteAddr) {
+			slog.Warn("ignoring handle header from untrusted peer", "header", srv.handleHeader, "remote", c.Request().RemoteAddr)
+			return next(c)
+		}
+		c.Set(headerHandleKey, handle)
+		return next(c)
+	}
+}
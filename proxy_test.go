@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveHandle runs a request through handleHeaderMiddleware and returns
+// the handle getHandleFromRequest resolves for it
+func serveHandle(t *testing.T, srv *Server, remoteAddr, header string) string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Host = "host.example.com:8080"
+	req.RemoteAddr = remoteAddr
+	if header != "" {
+		req.Header.Set(defaultHandleHeader, header)
+	}
+	c := srv.e.NewContext(req, httptest.NewRecorder())
+
+	var handle string
+	err := srv.handleHeaderMiddleware(func(c echo.Context) error {
+		handle = getHandleFromRequest(c)
+		return nil
+	})(c)
+	require.NoError(t, err)
+	return handle
+}
+
+func TestHandleHeader(t *testing.T) {
+	proxies, err := parseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "::1"})
+	require.NoError(t, err)
+	srv := &Server{e: echo.New(), handleHeader: defaultHandleHeader, trustedProxies: proxies}
+
+	// Trusted peers may name the handle
+	assert.Equal(t, "alice.test", serveHandle(t, srv, "10.1.2.3:5000", "alice.test"))
+	assert.Equal(t, "alice.test", serveHandle(t, srv, "192.0.2.1:5000", "alice.test"))
+	assert.Equal(t, "alice.test", serveHandle(t, srv, "[::1]:5000", "alice.test"))
+
+	// Without the header the hostname is used
+	assert.Equal(t, "host.example.com", serveHandle(t, srv, "10.1.2.3:5000", ""))
+
+	// Untrusted peers cannot override the hostname
+	assert.Equal(t, "host.example.com", serveHandle(t, srv, "192.0.2.2:5000", "alice.test"))
+	assert.Equal(t, "host.example.com", serveHandle(t, srv, "203.0.113.7:5000", "alice.test"))
+
+	// Nobody is trusted by default
+	srv.trustedProxies = nil
+	assert.Equal(t, "host.example.com", serveHandle(t, srv, "10.1.2.3:5000", "alice.test"))
+
+	// An empty header name disables the feature
+	srv.trustedProxies = proxies
+	srv.handleHeader = ""
+	assert.Equal(t, "host.example.com", serveHandle(t, srv, "10.1.2.3:5000", "alice.test"))
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := parseTrustedProxies([]string{"10.0.0.7/8", "192.0.2.1"})
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.0/8", proxies[0].String())
+	assert.Equal(t, "192.0.2.1/32", proxies[1].String())
+
+	_, err = parseTrustedProxies([]string{"not-an-ip"})
+	assert.Error(t, err)
+	_, err = parseTrustedProxies([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+}
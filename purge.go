@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// Purgeable is implemented by anything holding entries keyed by an
+// identity, such as the identity directory or a per-DID cache, so that
+// purging the identity reaches every copy of it.
+type Purgeable interface {
+	Purge(ctx context.Context, id syntax.AtIdentifier) error
+}
+
+// Purge implements Purgeable for caches keyed by DID or handle
+func (tc *ttlCache[V]) Purge(ctx context.Context, id syntax.AtIdentifier) error {
+	tc.delete(id.String())
+	return nil
+}
+
+// registerPurgeable adds a cache to those cleared by purgeIdentity, on top
+// of the identity directory and the profile cache.
+func (srv *Server) registerPurgeable(p Purgeable) {
+	srv.purgeMu.Lock()
+	defer srv.purgeMu.Unlock()
+	srv.purgeables = append(srv.purgeables, p)
+}
+
+// purgeIdentity drops an identity from the directory, the profile cache
+// and every registered cache. Purges are serialized, so a concurrent purge
+// never observes one cache cleared and another not. Every cache is
+// purged even when one fails; the errors are joined.
+func (srv *Server) purgeIdentity(ctx context.Context, id syntax.AtIdentifier) error {
+	srv.purgeMu.Lock()
+	defer srv.purgeMu.Unlock()
+
+	var errs []error
+	if srv.dir != nil {
+		errs = append(errs, srv.dir.Purge(ctx, id))
+	}
+	if srv.profiles != nil {
+		errs = append(errs, srv.profiles.Purge(ctx, id))
+	}
+	for _, p := range srv.purgeables {
+		errs = append(errs, p.Purge(ctx, id))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePurgeable records the identities it was asked to purge
+type fakePurgeable struct {
+	purged []string
+	err    error
+}
+
+func (f *fakePurgeable) Purge(ctx context.Context, id syntax.AtIdentifier) error {
+	f.purged = append(f.purged, id.String())
+	return f.err
+}
+
+func TestPurgeIdentity_FansOut(t *testing.T) {
+	mock := identity.NewMockDirectory()
+	dir := &recordingDirectory{Directory: &mock}
+	srv := newStubServer(newStubTransport())
+	srv.dir = dir
+	srv.profiles = newTTLCache[*ProfileView](defaultProfileCacheTTL, defaultProfileCacheMaxEntries)
+	srv.profiles.set("did:plc:alice", &ProfileView{})
+	srv.profiles.set("did:plc:bob", &ProfileView{})
+
+	first, second := &fakePurgeable{}, &fakePurgeable{}
+	srv.registerPurgeable(first)
+	srv.registerPurgeable(second)
+
+	id := syntax.DID("did:plc:alice").AtIdentifier()
+	assert.NoError(t, srv.purgeIdentity(context.Background(), id))
+
+	assert.Equal(t, []string{"did:plc:alice"}, dir.purges())
+	assert.Equal(t, []string{"did:plc:alice"}, first.purged)
+	assert.Equal(t, []string{"did:plc:alice"}, second.purged)
+	_, cached := srv.profiles.get("did:plc:alice")
+	assert.False(t, cached)
+	_, cached = srv.profiles.get("did:plc:bob")
+	assert.True(t, cached, "other identities stay cached")
+}
+
+func TestPurgeIdentity_ContinuesPastErrors(t *testing.T) {
+	srv := newStubServer(newStubTransport())
+	failing := &fakePurgeable{err: errors.New("boom")}
+	after := &fakePurgeable{}
+	srv.registerPurgeable(failing)
+	srv.registerPurgeable(after)
+
+	err := srv.purgeIdentity(context.Background(), syntax.Handle("alice.test").AtIdentifier())
+	assert.ErrorContains(t, err, "boom")
+	assert.Equal(t, []string{"alice.test"}, after.purged)
+}
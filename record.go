@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/labstack/echo/v4"
+)
+
+// defaultRecordCollections are the collections /api/record/* may read
+// (ATHOME_RECORD_COLLECTIONS): public Bluesky records a profile page renders
+var defaultRecordCollections = []string{
+	"app.bsky.actor.profile",
+	"app.bsky.feed.post",
+	"app.bsky.feed.like",
+	"app.bsky.feed.repost",
+	"app.bsky.feed.generator",
+	"app.bsky.graph.list",
+	"app.bsky.graph.starterpack",
+}
+
+// parseRecordCollections validates the configured collection NSIDs.
+//
+// Returns:
+//   - The trimmed collection NSIDs
+//   - error naming the first malformed entry
+func parseRecordCollections(entries []string) ([]string, error) {
+	var collections []string
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if _, err := syntax.ParseNSID(entry); err != nil {
+			return nil, fmt.Errorf("invalid record collection %q: %w", entry, err)
+		}
+		collections = append(collections, entry)
+	}
+	return collections, nil
+}
+
+// handleGetRecord handles requests for a single raw record from any
+// allowed collection, e.g. profile, like or list records. Only the
+// configured collections can be read, so the endpoint cannot be used to
+// pull arbitrary data through this server.
+//
+// URL Parameters:
+//   - *: The AT-URI of the record (with or without at:// prefix)
+//
+// Returns:
+//   - 200 OK with the record URI, CID and value
+//   - 400 Bad Request if the URI is invalid or names no record
+//   - 403 Forbidden if the collection is not allowed
+//   - 404 Not Found if the record does not exist
+//   - 500 Internal Server Error if the fetch fails
+func (srv *Server) handleGetRecord(c echo.Context) error {
+	atUri, err := getATURIFromRequest(c)
+	if err != nil {
+		return err
+	}
+	if atUri.Collection() == "" || atUri.RecordKey() == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "uri does not name a record")
+	}
+	if !containsString(srv.recordCollections, atUri.Collection().String()) {
+		return echo.NewHTTPError(http.StatusForbidden, "collection is not allowed: "+atUri.Collection().String())
+	}
+	return srv.writeRecord(c, atUri, "record")
+}
+
+// writeRecord fetches the record named by atUri and responds with its
+// URI, CID and value. kind names the record in the not-found message.
+func (srv *Server) writeRecord(c echo.Context, atUri syntax.ATURI, kind string) error {
+	// Ensure we have a valid token before making the API request
+	if err := srv.ensureValidToken(c); err != nil {
+		slog.Error("failed to ensure valid token", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Authentication error: "+err.Error())
+	}
+
+	// Called directly rather than through atproto.RepoGetRecord, which
+	// fails on records whose $type indigo has no Go type for
+	var record struct {
+		URI   string          `json:"uri"`
+		CID   *string         `json:"cid"`
+		Value json.RawMessage `json:"value"`
+	}
+	params := map[string]interface{}{
+		"repo":       atUri.Authority().String(),
+		"collection": atUri.Collection().String(),
+		"rkey":       atUri.RecordKey().String(),
+	}
+	if err := srv.readClient().Do(c.Request().Context(), xrpc.Query, "", "com.atproto.repo.getRecord", params, nil, &record); err != nil {
+		if isNotFoundError(err) {
+			return echo.NewHTTPError(http.StatusNotFound, kind+" not found")
+		}
+		slog.Error("failed to fetch record", "uri", atUri, "error", err)
+		return upstreamError(c, err)
+	}
+
+	response := map[string]interface{}{
+		"uri":   record.URI,
+		"cid":   record.CID,
+		"value": record.Value,
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleGetRecord_AllowedCollection(t *testing.T) {
+	const profileURI = "at://did:plc:abc123/app.bsky.actor.profile/self"
+
+	stub := newStubTransport().on("com.atproto.repo.getRecord", http.StatusOK, `{
+		"uri": "`+profileURI+`",
+		"cid": "bafyprofile",
+		"value": {"$type": "app.bsky.actor.profile", "displayName": "Alice", "pinnedPost": {"uri": "at://x", "cid": "y"}}
+	}`)
+	srv := newStubServer(stub)
+	srv.recordCollections = defaultRecordCollections
+
+	rec, err := serveWildcard(srv, srv.handleGetRecord, "did:plc:abc123/app.bsky.actor.profile/self", "")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"uri": "`+profileURI+`",
+		"cid": "bafyprofile",
+		"value": {"$type": "app.bsky.actor.profile", "displayName": "Alice", "pinnedPost": {"uri": "at://x", "cid": "y"}}
+	}`, rec.Body.String())
+
+	req := stub.lastRequest("com.atproto.repo.getRecord")
+	require.NotNil(t, req)
+	assert.Equal(t, "did:plc:abc123", req.URL.Query().Get("repo"))
+	assert.Equal(t, "app.bsky.actor.profile", req.URL.Query().Get("collection"))
+	assert.Equal(t, "self", req.URL.Query().Get("rkey"))
+
+	// Records of lexicons unknown to indigo are passed through as they are
+	srv.recordCollections = []string{"com.example.recipe"}
+	stub.on("com.atproto.repo.getRecord", http.StatusOK, `{
+		"uri": "at://did:plc:abc123/com.example.recipe/1",
+		"cid": "bafyrecipe",
+		"value": {"$type": "com.example.recipe", "title": "Tortilla"}
+	}`)
+	rec, err = serveWildcard(srv, srv.handleGetRecord, "did:plc:abc123/com.example.recipe/1", "")
+	require.NoError(t, err)
+	assert.Contains(t, rec.Body.String(), `"title":"Tortilla"`)
+
+	stub.on("com.atproto.repo.getRecord", http.StatusBadRequest, `{"error": "RecordNotFound", "message": "Could not locate record"}`)
+	_, err = serveWildcard(srv, srv.handleGetRecord, "did:plc:abc123/com.example.recipe/2", "")
+	assert.Equal(t, http.StatusNotFound, httpStatus(t, err))
+}
+
+func TestHandleGetRecord_DisallowedCollection(t *testing.T) {
+	stub := newStubTransport()
+	srv := newStubServer(stub)
+	srv.recordCollections = defaultRecordCollections
+
+	_, err := serveWildcard(srv, srv.handleGetRecord, "did:plc:abc123/app.bsky.graph.block/3kxyz", "")
+	assert.Equal(t, http.StatusForbidden, httpStatus(t, err))
+	_, err = serveWildcard(srv, srv.handleGetRecord, "did:plc:abc123/chat.bsky.actor.declaration/self", "")
+	assert.Equal(t, http.StatusForbidden, httpStatus(t, err))
+
+	// Nothing is readable when the allowlist is emptied
+	srv.recordCollections = nil
+	_, err = serveWildcard(srv, srv.handleGetRecord, "did:plc:abc123/app.bsky.feed.post/3kxyz", "")
+	assert.Equal(t, http.StatusForbidden, httpStatus(t, err))
+
+	// A URI must name a single record
+	srv.recordCollections = defaultRecordCollections
+	_, err = serveWildcard(srv, srv.handleGetRecord, "did:plc:abc123/app.bsky.feed.post", "")
+	assert.Equal(t, http.StatusBadRequest, httpStatus(t, err))
+
+	assert.Empty(t, stub.requests)
+}
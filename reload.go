@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+)
+
+// Settings reloaded on SIGHUP, without restarting or dropping connections:
+//   - the handle allowlist, from ATHOME_VALID_HANDLES_FILE (guarded by handlesMu)
+//   - the log level, from the log-level key of ATHOME_CONFIG unless pinned
+//     by --log-level or ATHOME_LOG_LEVEL (a slog.LevelVar, safe for
+//     concurrent use)
+//
+// Everything else is read once at startup.
+
+// reload re-reads the reloadable settings. A source that fails to load
+// leaves its setting unchanged.
+func (srv *Server) reload() {
+	if srv.handlesFile != "" {
+		if err := srv.reloadHandlesFile(srv.handlesFile); err != nil {
+			slog.Error("keeping previous handle allowlist", "error", err)
+		}
+	}
+
+	if srv.reloadConfig != "" && srv.logLevel != nil {
+		settings, err := loadConfigFile(srv.reloadConfig)
+		if err != nil {
+			slog.Error("keeping previous log level", "error", err)
+			return
+		}
+		value, ok := settings["log-level"]
+		if !ok {
+			return
+		}
+		level, ok := parseLogLevel(value)
+		if !ok {
+			slog.Error("keeping previous log level", "log_level", value)
+			return
+		}
+		srv.logLevel.Set(level)
+		slog.Info("reloaded log level", "level", level)
+	}
+}
+
+// watchReload reloads the reloadable settings every time a signal arrives
+// (SIGHUP in production) until ctx is cancelled.
+func (srv *Server) watchReload(ctx context.Context, signals <-chan os.Signal) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			srv.reload()
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchReload_UpdatesWhileServing(t *testing.T) {
+	dir := t.TempDir()
+	handlesPath := filepath.Join(dir, "handles.txt")
+	configPath := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(handlesPath, []byte("alice.test\n"), 0o644))
+	require.NoError(t, os.WriteFile(configPath, []byte("log-level: info\n"), 0o644))
+
+	srv := newStubServer(newStubTransport())
+	srv.e.GET("/health", srv.HandleHealthCheck)
+	srv.setAllowedHandles([]string{"alice.test"})
+	srv.handlesFile = handlesPath
+	srv.reloadConfig = configPath
+	srv.logLevel = new(slog.LevelVar)
+
+	ts := httptest.NewServer(srv.e)
+	defer ts.Close()
+	client := ts.Client()
+
+	// A kept-alive connection must survive the reload
+	resp, err := client.Get(ts.URL + "/health")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal)
+	go srv.watchReload(ctx, signals)
+
+	require.NoError(t, os.WriteFile(handlesPath, []byte("bob.test\n"), 0o644))
+	require.NoError(t, os.WriteFile(configPath, []byte("log-level: debug\n"), 0o644))
+	signals <- syscall.SIGHUP
+	assert.Eventually(t, func() bool {
+		return srv.logLevel.Level() == slog.LevelDebug
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"bob.test"}, srv.allowedHandles())
+
+	resp, err = client.Get(ts.URL + "/health")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// An invalid level keeps the previous one
+	require.NoError(t, os.WriteFile(configPath, []byte("log-level: loud\n"), 0o644))
+	signals <- syscall.SIGHUP
+	signals <- syscall.SIGHUP // Unbuffered: returns once the first reload finished
+	assert.Equal(t, slog.LevelDebug, srv.logLevel.Level())
+}
+
+func TestReload_PinnedLogLevel(t *testing.T) {
+	// Without a config file to follow, the level is left alone
+	srv := newStubServer(newStubTransport())
+	srv.logLevel = new(slog.LevelVar)
+	srv.logLevel.Set(slog.LevelWarn)
+
+	srv.reload()
+	assert.Equal(t, slog.LevelWarn, srv.logLevel.Level())
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/xml"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// defaultSitemapMaxURLs caps the number of URLs listed in sitemap.xml
+	defaultSitemapMaxURLs = 500
+	// defaultSitemapCacheTTL is how long a generated sitemap.xml is reused
+	defaultSitemapCacheTTL = time.Hour
+	// defaultSitemapCacheMaxEntries caps the sitemaps cached, one per base URL
+	defaultSitemapCacheMaxEntries = 16
+	// sitemapNamespace is the XML namespace of the sitemap protocol
+	sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+)
+
+// sitemapHandles returns the handles listed in the sitemap: the configured
+// allowlist, or the handle derived from the request when none is configured.
+func (srv *Server) sitemapHandles(c echo.Context) []string {
+	if handles := srv.allowedHandles(); len(handles) > 0 {
+		return handles
+	}
+	if handle := getHandleFromRequest(c); handle != "" {
+		return []string{handle}
+	}
+	return nil
+}
+
+// buildSitemap lists the profile page and recent post permalinks for each
+// sitemap handle, up to maxURLs entries. Handles that cannot be resolved or
+// fetched are skipped.
+//
+// Parameters:
+//   - c: The Echo context
+//   - baseURL: Scheme and host the SPA is served from
+//
+// Returns:
+//   - The sitemap document
+//   - Whether every handle was fetched successfully (only complete sitemaps are cached)
+func (srv *Server) buildSitemap(c echo.Context, baseURL string) (*SitemapURLSet, bool) {
+	set := &SitemapURLSet{Xmlns: sitemapNamespace, URLs: []SitemapURL{}}
+	complete := true
+
+	for _, handle := range srv.sitemapHandles(c) {
+		remaining := srv.sitemapMaxURLs - len(set.URLs)
+		if remaining <= 0 {
+			break
+		}
+
+		did, err := srv.validateAndGetDID(c, handle)
+		if err != nil {
+			slog.Warn("skipping handle in sitemap", "handle", handle, "error", err)
+			complete = false
+			continue
+		}
+
+		// One entry is taken by the profile page itself
+		limit := int64(remaining - 1)
+		if limit > maxListLimit {
+			limit = maxListLimit
+		}
+
+		var posts []*bsky.FeedDefs_FeedViewPost
+		if limit > 0 {
+			feed, err := srv.feedFetcher().GetAuthorFeed(c.Request().Context(), did, "", "posts_no_replies", limit)
+			if err != nil {
+				slog.Warn("failed to fetch posts for sitemap", "handle", handle, "error", err)
+				complete = false
+			} else if feed != nil {
+				posts = feed.Feed
+			}
+		}
+
+		profile := SitemapURL{Loc: baseURL + "/?" + url.Values{"handle": {handle}}.Encode()}
+		entries := []SitemapURL{}
+		for _, item := range posts {
+			if !isOwnFeedPost(item, did) {
+				continue
+			}
+			if profile.LastMod == "" {
+				profile.LastMod = item.Post.IndexedAt
+			}
+			entries = append(entries, SitemapURL{
+				Loc:     baseURL + "/?" + url.Values{"handle": {handle}, "post": {item.Post.Uri}}.Encode(),
+				LastMod: item.Post.IndexedAt,
+			})
+		}
+
+		set.URLs = append(set.URLs, profile)
+		if len(entries) > remaining-1 {
+			entries = entries[:remaining-1]
+		}
+		set.URLs = append(set.URLs, entries...)
+	}
+
+	return set, complete
+}
+
+// sitemapBaseURL returns the scheme and host the sitemap links to, which
+// also key the sitemap cache. The Host header is client input, so only
+// the canonical host (ATHOME_CANONICAL_HOST), or failing that an allowed
+// or default handle, is accepted; ports are dropped and any scheme other
+// than http counts as https.
+func (srv *Server) sitemapBaseURL(c echo.Context) (string, bool) {
+	scheme := "https"
+	if c.Scheme() == "http" {
+		scheme = "http"
+	}
+	if srv.canonicalHost != "" {
+		return scheme + "://" + srv.canonicalHost, true
+	}
+	host := hostHandle(c.Request().Host)
+	if host == "" || (host != srv.defaultHandle && srv.validateHandle(host) != nil) {
+		return "", false
+	}
+	return scheme + "://" + host, true
+}
+
+// handleSitemap serves sitemap.xml listing the profile page and recent
+// post permalinks for the configured handle(s). The rendered document is
+// cached per base URL (see sitemapBaseURL) to avoid hitting the API for
+// every crawler request.
+//
+// Returns:
+//   - 200 OK with the sitemap as application/xml
+//   - 404 Not Found if the request's host is not a configured one
+//   - 500 Internal Server Error if the sitemap cannot be encoded
+func (srv *Server) handleSitemap(c echo.Context) error {
+	baseURL, ok := srv.sitemapBaseURL(c)
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, "no sitemap for this host")
+	}
+
+	if srv.sitemaps != nil {
+		if body, ok := srv.sitemaps.get(baseURL); ok {
+			return c.Blob(http.StatusOK, echo.MIMEApplicationXMLCharsetUTF8, body)
+		}
+	}
+
+	set, complete := srv.buildSitemap(c, baseURL)
+	body, err := xml.MarshalIndent(set, "", "  ")
+	if err != nil {
+		slog.Error("failed to encode sitemap", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to encode sitemap")
+	}
+	body = append([]byte(xml.Header), body...)
+
+	if complete && srv.sitemaps != nil {
+		srv.sitemaps.set(baseURL, body)
+	}
+
+	return c.Blob(http.StatusOK, echo.MIMEApplicationXMLCharsetUTF8, body)
+}
+
+// defaultRobotsTxt builds the robots.txt served when none is configured.
+// SPA pages are crawlable while the JSON API is kept out of search indexes.
+func defaultRobotsTxt(baseURL string) string {
+	var b strings.Builder
+	b.WriteString("User-agent: *\n")
+	b.WriteString("Allow: /\n")
+	b.WriteString("Disallow: /api/\n")
+	b.WriteString("\n")
+	b.WriteString("Sitemap: " + baseURL + "/sitemap.xml\n")
+	return b.String()
+}
+
+// handleRobots serves robots.txt, either the content configured through
+// ATHOME_ROBOTS / ATHOME_ROBOTS_FILE or a default generated from the known routes.
+//
+// Returns:
+//   - 200 OK with the robots.txt policy as text/plain
+func (srv *Server) handleRobots(c echo.Context) error {
+	body := srv.robotsTxt
+	if body == "" {
+		body = defaultRobotsTxt(c.Scheme() + "://" + c.Request().Host)
+	}
+	return c.String(http.StatusOK, body)
+}
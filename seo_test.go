@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// authorFeedJSON builds a getAuthorFeed response with the given number of posts
+// by did:plc:alice followed by one repost of someone else's post
+func authorFeedJSON(posts int) string {
+	items := []string{}
+	for i := 0; i < posts; i++ {
+		items = append(items, fmt.Sprintf(`{"post": {
+			"uri": "at://did:plc:alice/app.bsky.feed.post/%d",
+			"cid": "bafy%d",
+			"author": {"did": "did:plc:alice", "handle": "alice.test"},
+			"record": {"$type": "app.bsky.feed.post", "text": "post %d", "createdAt": "2024-01-0%dT00:00:00Z"},
+			"indexedAt": "2024-01-0%dT00:00:00Z"
+		}}`, i, i, i, i+1, i+1))
+	}
+	items = append(items, `{"post": {
+		"uri": "at://did:plc:bob/app.bsky.feed.post/x",
+		"cid": "bafyx",
+		"author": {"did": "did:plc:bob", "handle": "bob.test"},
+		"record": {"$type": "app.bsky.feed.post", "text": "not mine", "createdAt": "2024-01-01T00:00:00Z"},
+		"indexedAt": "2024-01-01T00:00:00Z"
+	}}`)
+	return `{"cursor": "next", "feed": [` + strings.Join(items, ",") + `]}`
+}
+
+func TestHandleSitemap(t *testing.T) {
+	dir := identity.NewMockDirectory()
+	dir.Insert(identity.Identity{DID: syntax.DID("did:plc:alice"), Handle: syntax.Handle("alice.test")})
+
+	stub := newStubTransport().on("app.bsky.feed.getAuthorFeed", http.StatusOK, authorFeedJSON(5))
+	srv := newStubServer(stub)
+	srv.dir = &dir
+	srv.validHandles = []string{"alice.test"}
+	srv.sitemapMaxURLs = 4
+	srv.sitemaps = newTTLCache[[]byte](time.Hour, defaultSitemapCacheMaxEntries)
+
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/sitemap.xml", nil)
+		req.Host = "alice.test"
+		rec := httptest.NewRecorder()
+		require.NoError(t, srv.handleSitemap(srv.e.NewContext(req, rec)))
+		return rec
+	}
+
+	rec := serve()
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, strings.HasPrefix(rec.Header().Get("Content-Type"), "application/xml"))
+
+	var set SitemapURLSet
+	require.NoError(t, xml.Unmarshal(rec.Body.Bytes(), &set))
+	assert.Equal(t, sitemapNamespace, set.Xmlns)
+
+	// Profile page plus posts, capped at the configured maximum and owner posts only
+	require.Len(t, set.URLs, 4)
+	assert.Equal(t, "http://alice.test/?handle=alice.test", set.URLs[0].Loc)
+	assert.Equal(t, "2024-01-01T00:00:00Z", set.URLs[0].LastMod)
+	assert.Equal(t, "http://alice.test/?handle=alice.test&post=at%3A%2F%2Fdid%3Aplc%3Aalice%2Fapp.bsky.feed.post%2F0", set.URLs[1].Loc)
+	for _, u := range set.URLs {
+		assert.NotContains(t, u.Loc, "bob")
+	}
+
+	// Only as many posts as fit are requested upstream
+	assert.Equal(t, "3", stub.lastRequest("app.bsky.feed.getAuthorFeed").URL.Query().Get("limit"))
+
+	// Second request is served from the cache
+	second := serve()
+	assert.Equal(t, rec.Body.String(), second.Body.String())
+	stub.mu.Lock()
+	assert.Len(t, stub.requests, 1)
+	stub.mu.Unlock()
+}
+
+func TestHandleSitemap_Hosts(t *testing.T) {
+	dir := identity.NewMockDirectory()
+	dir.Insert(identity.Identity{DID: syntax.DID("did:plc:alice"), Handle: syntax.Handle("alice.test")})
+
+	stub := newStubTransport().on("app.bsky.feed.getAuthorFeed", http.StatusOK, authorFeedJSON(1))
+	srv := newStubServer(stub)
+	srv.dir = &dir
+	srv.validHandles = []string{"alice.test"}
+	srv.sitemapMaxURLs = 10
+	srv.sitemaps = newTTLCache[[]byte](time.Hour, defaultSitemapCacheMaxEntries)
+
+	serve := func(host, proto string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodGet, "/sitemap.xml", nil)
+		req.Host = host
+		if proto != "" {
+			req.Header.Set(echo.HeaderXForwardedProto, proto)
+		}
+		rec := httptest.NewRecorder()
+		return rec, srv.handleSitemap(srv.e.NewContext(req, rec))
+	}
+
+	// Hosts that are not configured never reach the cache or the upstream
+	for _, host := range []string{"evil.test", "random-1.example", "10.0.0.1", ""} {
+		_, err := serve(host, "")
+		assert.Equal(t, http.StatusNotFound, httpStatus(t, err), host)
+	}
+	assert.Empty(t, stub.requests)
+	assert.Empty(t, srv.sitemaps.entries)
+
+	// Ports, case and odd schemes all share one entry
+	for _, tt := range []struct{ host, proto string }{{"alice.test", "https"}, {"Alice.Test:8443", "https"}, {"alice.test", "gopher"}} {
+		rec, err := serve(tt.host, tt.proto)
+		require.NoError(t, err)
+		assert.Contains(t, rec.Body.String(), "https://alice.test/?handle=alice.test")
+	}
+	assert.Len(t, srv.sitemaps.entries, 1)
+	assert.Len(t, stub.requests, 1)
+
+	// With a canonical host every hostname links there
+	srv.canonicalHost = "www.alice.example"
+	rec, err := serve("anything.example", "https")
+	require.NoError(t, err)
+	assert.Contains(t, rec.Body.String(), "https://www.alice.example/?handle=alice.test")
+	_, err = serve("other.example", "https")
+	require.NoError(t, err)
+	assert.Len(t, srv.sitemaps.entries, 2)
+}
+
+func TestHandleRobots(t *testing.T) {
+	srv := newStubServer(newStubTransport())
+
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/robots.txt", nil)
+		req.Host = "alice.test"
+		rec := httptest.NewRecorder()
+		require.NoError(t, srv.handleRobots(srv.e.NewContext(req, rec)))
+		return rec
+	}
+
+	rec := serve()
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain"))
+	lines := strings.Split(rec.Body.String(), "\n")
+	assert.Contains(t, lines, "Allow: /")
+	assert.Contains(t, lines, "Disallow: /api/")
+	assert.Contains(t, lines, "Sitemap: http://alice.test/sitemap.xml")
+
+	srv.robotsTxt = "User-agent: *\nDisallow: /\n"
+	assert.Equal(t, "User-agent: *\nDisallow: /\n", serve().Body.String())
+}
@@ -3,11 +3,19 @@ package main
 import (
 	"context"
 	"crypto/rand"
+	"embed"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bluesky-social/indigo/atproto/identity"
 	"github.com/bluesky-social/indigo/xrpc"
@@ -25,6 +33,62 @@ func generateNonce() string {
 	return base64.StdEncoding.EncodeToString(b)
 }
 
+// embeddedPublic holds the frontend build copied into public/ at build time,
+// allowing the binary to be deployed without the directory alongside it.
+//
+//go:embed all:public
+var embeddedPublic embed.FS
+
+// publicAssets is the embedded frontend rooted at public/.
+// It is a variable so tests can substitute their own file tree.
+var publicAssets fs.FS = echo.MustSubFS(embeddedPublic, "public")
+
+// checkPublicDir validates a disk-based static asset directory at startup so that
+// misconfiguration is reported immediately rather than on the first request.
+// A missing index.html is not fatal: handleIndex serves a minimal fallback page.
+//
+// Parameters:
+//   - dir: The directory holding the built frontend
+//
+// Returns:
+//   - error if the directory does not exist, is not a directory, or index.html is unreadable
+func checkPublicDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("public directory %q is not accessible (set ATHOME_PUBLIC_DIR): %w", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("public directory %q is not a directory", dir)
+	}
+
+	index := filepath.Join(dir, "index.html")
+	f, err := os.Open(index)
+	if errors.Is(err, fs.ErrNotExist) {
+		slog.Warn("index.html not found, serving fallback page", "path", index)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", index, err)
+	}
+	return f.Close()
+}
+
+// openPublicFS returns the file system static files and index.html are served from.
+// A configured directory is served from disk, which is convenient during development;
+// otherwise the assets embedded in the binary are used.
+func openPublicFS(dir string) (fs.FS, error) {
+	if dir == "" {
+		if _, err := fs.Stat(publicAssets, "index.html"); err != nil {
+			slog.Warn("embedded frontend has no index.html, serving fallback page")
+		}
+		return publicAssets, nil
+	}
+	if err := checkPublicDir(dir); err != nil {
+		return nil, err
+	}
+	return os.DirFS(dir), nil
+}
+
 // setupServer initializes and configures the Echo web server with all necessary middleware,
 // routes, and security settings.
 //
@@ -33,6 +97,8 @@ func generateNonce() string {
 //   - xrpcClient: The XRPC client for Bluesky API communication
 //   - dir: The identity directory service for handle resolution
 //   - validHandles: List of allowed handles for access control
+//   - validDIDs: List of allowed DIDs for access control
+//   - publicDir: Directory holding the built frontend (empty to use embedded assets)
 //   - authConfig: Optional PDS authentication configuration
 //
 // Returns:
@@ -47,61 +113,101 @@ func generateNonce() string {
 //   - HSTS support
 //   - Request size limits
 //   - CORS configuration
-func setupServer(bindAddr string, xrpcClient *xrpc.Client, dir identity.Directory, validHandles []string, authConfig *AuthConfig) (*Server, error) {
+func setupServer(bindAddr string, xrpcClient *xrpc.Client, dir identity.Directory, validHandles []string, validDIDs []string, publicDir string, authConfig *AuthConfig) (*Server, error) {
+	return newServer(bindAddr, xrpcClient, dir, validHandles, validDIDs, publicDir, authConfig, false)
+}
+
+// setupPublicServer initializes a read-only public mirror (ATHOME_PUBLIC_ONLY).
+// It takes no auth configuration at all: the refresh middleware is never
+// installed and the /admin and owner routes are not registered, so there
+// is no code path that handles credentials.
+func setupPublicServer(bindAddr string, xrpcClient *xrpc.Client, dir identity.Directory, validHandles []string, validDIDs []string, publicDir string) (*Server, error) {
+	return newServer(bindAddr, xrpcClient, dir, validHandles, validDIDs, publicDir, nil, true)
+}
+
+// newServer implements setupServer and setupPublicServer
+func newServer(bindAddr string, xrpcClient *xrpc.Client, dir identity.Directory, validHandles []string, validDIDs []string, publicDir string, authConfig *AuthConfig, publicOnly bool) (*Server, error) {
+	publicFS, err := openPublicFS(publicDir)
+	if err != nil {
+		return nil, err
+	}
+
 	e := echo.New()
 	e.HideBanner = true
 
-	// Set up security middleware with improved CSP
+	// Answer HEAD from the GET routes
+	e.Pre(headAsGet)
+
+	// Set up security middleware; the CSP is added once the server exists
 	e.Use(middleware.SecureWithConfig(middleware.SecureConfig{
 		XSSProtection:      "1; mode=block",
 		ContentTypeNosniff: "nosniff",
 		XFrameOptions:      "SAMEORIGIN",
 		HSTSMaxAge:         31536000,
-		ContentSecurityPolicy: func() string {
-			extraHost := ""
-			if authConfig != nil && authConfig.PDS != "" {
-				extraHost = authConfig.PDS
-			}
-			return fmt.Sprintf(`default-src 'self';
-				script-src 'self' 'nonce-{nonce}';
-				style-src 'self' 'unsafe-inline' https://fonts.googleapis.com;
-				font-src 'self' https://fonts.gstatic.com;
-				img-src 'self' data: https:;
-				connect-src 'self' https://api.bsky.app %s;
-				manifest-src 'self';
-				worker-src 'self'`, extraHost)
-		}(),
 	}))
 
-	// Add nonce middleware for CSP script validation
-	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
-		return func(c echo.Context) error {
-			nonce := generateNonce()
-			c.Set("nonce", nonce)
-			// Update CSP header with actual nonce
-			csp := c.Response().Header().Get("Content-Security-Policy")
-			c.Response().Header().Set("Content-Security-Policy",
-				strings.Replace(csp, "{nonce}", nonce, 1))
-			return next(c)
-		}
-	})
+	// Bound how long clients may hold connections
+	defaultServerTuning.apply(e.Server)
+
+	// Assign each request an ID (or keep the client's X-Request-Id) and carry
+	// it in the request context so upstream calls can forward it
+	e.Use(middleware.RequestIDWithConfig(middleware.RequestIDConfig{
+		RequestIDHandler: func(c echo.Context, id string) {
+			c.SetRequest(c.Request().WithContext(withRequestID(c.Request().Context(), id)))
+		},
+	}))
 
 	// Set up standard middleware stack
 	e.Use(middleware.Logger())              // Request logging
 	e.Use(middleware.Recover())             // Panic recovery
 	e.Use(middleware.CORS())                // Cross-Origin Resource Sharing
-	e.Use(middleware.BodyLimit("64M"))      // Request size limiting
 	e.Use(middleware.RemoveTrailingSlash()) // URL normalization
 
 	// Create server instance with dependencies
 	srv := &Server{
-		e:            e,
-		xrpcc:        xrpcClient,
-		dir:          dir,
-		validHandles: validHandles,
-		auth:         authConfig,
+		e:                     e,
+		xrpcc:                 xrpcClient,
+		dir:                   dir,
+		validHandles:          validHandles,
+		validDIDs:             validDIDs,
+		publicFS:              publicFS,
+		index:                 newIndexCache(publicFS, publicDir != ""),
+		profiles:              newTTLCache[*ProfileView](defaultProfileCacheTTL, defaultProfileCacheMaxEntries),
+		sitemaps:              newTTLCache[[]byte](defaultSitemapCacheTTL, defaultSitemapCacheMaxEntries),
+		sitemapMaxURLs:        defaultSitemapMaxURLs,
+		live:                  newLiveHub(&jetstreamSource{url: defaultJetstreamURL}, defaultLiveMaxConns),
+		fallbackAfter:         defaultFallbackAfter,
+		handleRecheckInterval: defaultHandleRecheckInterval,
+		bodyLimit:             defaultBodyLimit,
+		apiBodyLimit:          defaultAPIBodyLimit,
+		FeedDefaultLimit:      defaultFeedLimit,
+		FeedMaxLimit:          defaultFeedMaxLimit,
+		FeedMaxFetches:        defaultFeedMaxFetches,
+		assetMaxAge:           defaultAssetMaxAge,
+		threadMaxNodes:        defaultThreadMaxNodes,
+		handleHeader:          defaultHandleHeader,
+		healthDetail:          healthDetailPublic,
+		recordCollections:     defaultRecordCollections,
+		routeMaxAges:          sortRouteMaxAges(defaultRouteMaxAges),
+		auth:                  authConfig,
+	}
+
+	srv.metrics = newMetrics(srv)
+
+	// Parse index.html once at startup; disk-based assets are reparsed when they change
+	if _, err := srv.index.get(); err != nil {
+		return nil, err
 	}
 
+	// Add nonce middleware for CSP script validation
+	e.Use(srv.contentSecurityPolicy)
+
+	// Send pages served under other hostnames to the canonical one
+	e.Use(canonicalHostRedirect(&srv.canonicalHost))
+
+	// Request size limiting; the /api group gets a tighter limit below
+	e.Use(limitBody(&srv.bodyLimit))
+
 	// Add server instance to context for middleware access
 	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -110,8 +216,18 @@ func setupServer(bindAddr string, xrpcClient *xrpc.Client, dir identity.Director
 		}
 	})
 
+	// Accept the target handle from a header set by a trusted proxy
+	e.Use(srv.handleHeaderMiddleware)
+
+	// Require credentials for private instances
+	e.Use(srv.basicAuth())
+
 	// Configure authentication refresh middleware when using PDS
 	if authConfig != nil {
+		// Fingerprint the credentials so status and logs can identify them
+		authConfig.CredentialFingerprint = credentialFingerprint(authConfig.FingerprintKey, authConfig.Handle, authConfig.Password)
+		slog.Info("using PDS credentials", "handle", authConfig.Handle, "credential", authConfig.CredentialFingerprint)
+
 		// Create a context for background refresh that will be cancelled when server stops
 		refreshCtx, refreshCancel := context.WithCancel(context.Background())
 		srv.refreshCancel = refreshCancel
@@ -122,10 +238,18 @@ func setupServer(bindAddr string, xrpcClient *xrpc.Client, dir identity.Director
 		// Also keep the request middleware for immediate refresh if needed
 		e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
 			return func(c echo.Context) error {
+				if skipAuthRefresh(c) {
+					return next(c)
+				}
 				srv := c.Get("server").(*Server)
 
+				// Reads are served by the fallback AppView while degraded
+				if srv.degraded.Load() {
+					return next(c)
+				}
+
 				// Use the server's refreshAuth method to handle token refresh
-				if err := srv.refreshAuth(c); err != nil {
+				if err := srv.refreshAuth(c); err != nil && !srv.degraded.Load() {
 					slog.Error("failed to refresh auth in middleware", "error", err)
 					return echo.NewHTTPError(http.StatusUnauthorized, "authentication failed")
 				}
@@ -136,19 +260,80 @@ func setupServer(bindAddr string, xrpcClient *xrpc.Client, dir identity.Director
 
 	// Register API routes
 	e.GET("/healthz", srv.HandleHealthCheck) // Health check endpoint
+	e.GET("/sitemap.xml", srv.handleSitemap) // Sitemap for search engines
+	e.GET("/robots.txt", srv.handleRobots)   // Crawler policy
+	e.GET("/ws/:handle", srv.handleLive)     // Live stream of new posts by a handle
+	e.GET("/ws", srv.handleLive)             // Live stream of new posts (handle from hostname)
+	e.GET("/sse/:handle", srv.handleLiveSSE) // Server-Sent Events fallback for /ws
+	e.GET("/sse", srv.handleLiveSSE)         // Server-Sent Events fallback (handle from hostname)
+
+	// Handle verification for vanity domains
+	e.GET(atprotoDIDPath, srv.handleAtprotoDID)
+
+	// Operator routes, guarded by ATHOME_ADMIN_TOKEN
+	if !publicOnly {
+		admin := e.Group("/admin", srv.requireAdmin)
+		admin.GET("/status", srv.handleAdminStatus)    // Non-secret auth state
+		admin.POST("/refresh", srv.handleAdminRefresh) // Force a new PDS session
+		admin.GET("/metrics", srv.metrics.handler())   // Prometheus metrics
+	}
 
 	// Group API routes under /api
-	api := e.Group("/api")
+	api := e.Group("/api", srv.limitInFlight, limitBody(&srv.apiBodyLimit), dropCancelled, srv.routeCacheControl)
 	{
+		// Service information
+		api.GET("/version", srv.handleGetVersion)      // Build version and operating mode
+		api.GET("/config", srv.handleGetRuntimeConfig) // Runtime config for the frontend
+		api.GET("/describe", srv.handleDescribe)       // Available routes and features
+		api.GET("/about", srv.handleGetAbout)          // Owner, tagline and contact for the site chrome
+
+		// DID-specific routes (skip handle resolution)
+		api.GET("/profile/did/:did", srv.handleGetProfile) // Get profile by DID
+		api.GET("/feed/did/:did", srv.handleGetFeed)       // Get feed by DID
+
 		// Handle-specific routes
-		api.GET("/profile/:handle", srv.handleGetProfile) // Get profile by handle
-		api.GET("/feed/:handle", srv.handleGetFeed)       // Get feed by handle
-		api.GET("/post/*", srv.handleGetPost)             // Get post by AT-URI
+		api.GET("/profile/:handle", srv.handleGetProfile)  // Get profile by handle
+		api.GET("/feed/:handle", srv.handleGetFeed)        // Get feed by handle
+		api.GET("/post/record/*", srv.handleGetPostRecord) // Get the raw post record by AT-URI
+		api.GET("/record/*", srv.handleGetRecord)          // Get a raw record from an allowed collection by AT-URI
+		api.GET("/post/*", srv.handleGetPost)              // Get post by AT-URI
+
+		// Identity routes
+		api.GET("/did-doc/did/:did", srv.handleGetDIDDoc) // Get a resolved DID document by DID
+		api.GET("/did-doc/:handle", srv.handleGetDIDDoc)  // Get a resolved DID document by handle
+		api.GET("/did-doc", srv.handleGetDIDDoc)          // Get a resolved DID document (handle from hostname)
+		api.GET("/resolve", srv.handleResolve)            // Resolve ?handle= to a DID or ?did= to a handle and PDS
+
+		// Custom feed routes
+		api.GET("/generator-feeds/:handle", srv.handleGetActorFeeds) // List feed generators created by a handle
+		api.GET("/generator-feeds", srv.handleGetActorFeeds)         // List feed generators (handle from hostname)
+		api.GET("/feed-generator/*", srv.handleGetFeedGenerator)     // Get posts from a feed generator by AT-URI
+
+		// Starter pack routes
+		api.GET("/starter-packs/:handle", srv.handleGetActorStarterPacks) // List starter packs created by a handle
+		api.GET("/starter-packs", srv.handleGetActorStarterPacks)         // List starter packs (handle from hostname)
+		api.GET("/starter-pack/*", srv.handleGetStarterPack)              // Get a starter pack by AT-URI
+
+		// Media routes
+		api.GET("/media/:handle", srv.handleGetMedia) // List image and video posts by a handle
+		api.GET("/media", srv.handleGetMedia)         // List image and video posts (handle from hostname)
+
+		// Post interaction routes
+		api.GET("/repost-authors/*", srv.handleGetRepostedBy) // Get actors who reposted a post
+		api.GET("/liked-by/*", srv.handleGetLikes)            // Get actors who liked a post
+		api.GET("/quotes/*", srv.handleGetQuotes)             // Get posts quoting a post
 
 		// Hostname-based routes (handle derived from hostname)
 		api.GET("/profile", srv.handleGetProfile)
 		api.GET("/feed", srv.handleGetFeed)
 
+		// Owner routes, guarded by ATHOME_ADMIN_TOKEN
+		if !publicOnly {
+			api.GET("/suggestions", srv.handleGetSuggestions, srv.requireAdmin)         // Accounts suggested to the owner (PDS mode)
+			api.GET("/notifications/count", srv.handleGetUnreadCount, srv.requireAdmin) // Unread notification count (PDS mode)
+			api.GET("/timeline", srv.handleGetTimeline, srv.requireAdmin)               // Owner's home timeline (PDS mode)
+		}
+
 		// Portfolio routes
 		api.GET("/portfolio-config", srv.handleGetPortfolioConfig) // Get portfolio configuration
 		api.GET("/portfolio/:handle", srv.handleGetPortfolio)      // Get portfolio by handle
@@ -163,13 +348,294 @@ func setupServer(bindAddr string, xrpcClient *xrpc.Client, dir identity.Director
 	e.GET("/feed/*", srv.handleIndex)
 	e.GET("/post/*", srv.handleIndex)
 
-	// Static file serving
-	e.Static("/assets", "public/assets") // Vite assets
-	e.Static("/", "public")              // Root static files
+	// Static file serving; Vite assets are content-hashed, so browsers may cache them for good
+	assets := e.Group("/assets", cacheAssets(&srv.assetMaxAge))
+	assets.StaticFS("/", echo.MustSubFS(publicFS, "assets")) // Vite assets
+	e.StaticFS("/", publicFS)                                // Root static files
 
 	return srv, nil
 }
 
+// serverTuning holds the connection limits applied to the underlying http.Server
+type serverTuning struct {
+	ReadHeaderTimeout time.Duration // Reading the request headers; guards against slowloris
+	ReadTimeout       time.Duration // Reading the entire request, including the body
+	WriteTimeout      time.Duration // Writing the response; streams clear it themselves
+	IdleTimeout       time.Duration // Keep-alive connections waiting for the next request
+	MaxHeaderBytes    int           // Largest request header accepted
+}
+
+// defaultServerTuning replaces net/http's zero values, which never time out
+var defaultServerTuning = serverTuning{
+	ReadHeaderTimeout: 10 * time.Second,
+	ReadTimeout:       30 * time.Second,
+	WriteTimeout:      60 * time.Second,
+	IdleTimeout:       120 * time.Second,
+	MaxHeaderBytes:    http.DefaultMaxHeaderBytes,
+}
+
+// apply sets the tuning on s
+func (t serverTuning) apply(s *http.Server) {
+	s.ReadHeaderTimeout = t.ReadHeaderTimeout
+	s.ReadTimeout = t.ReadTimeout
+	s.WriteTimeout = t.WriteTimeout
+	s.IdleTimeout = t.IdleTimeout
+	s.MaxHeaderBytes = t.MaxHeaderBytes
+}
+
+// Default request body limits (ATHOME_BODY_LIMIT, ATHOME_API_BODY_LIMIT)
+const (
+	defaultBodyLimit    = 64 * 1024 * 1024 // Whole server
+	defaultAPIBodyLimit = 64 * 1024        // GET-only /api routes
+)
+
+// dropCancelled is middleware that stops responding to clients that have
+// gone away. The request context is passed to every upstream call, so a
+// disconnect already abandons it; this keeps the handler from then writing
+// an error (or the rest of a streamed body) to a closed connection.
+func dropCancelled(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := c.Request().Context()
+		res := c.Response()
+		res.Writer = &cancelAwareWriter{ResponseWriter: res.Writer, ctx: ctx}
+
+		err := next(c)
+		if ctx.Err() != nil {
+			slog.Debug("client went away, dropping response", "path", c.Request().URL.Path, "error", err)
+			return nil
+		}
+		return err
+	}
+}
+
+// cancelAwareWriter refuses writes once its request context is done
+type cancelAwareWriter struct {
+	http.ResponseWriter
+	ctx context.Context
+}
+
+// Write implements http.ResponseWriter
+func (w *cancelAwareWriter) Write(b []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *cancelAwareWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// headAsGet is pre-routing middleware answering HEAD requests with the
+// GET handler of the same route, as RSS readers and uptime monitors
+// expect. The body is counted rather than sent, so Content-Length and the
+// caching headers match a GET. The live streams never finish, so HEAD is
+// left unrouted there.
+func headAsGet(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		if req.Method != http.MethodHead || isLivePath(req.URL.Path) {
+			return next(c)
+		}
+		req.Method = http.MethodGet
+
+		res := c.Response()
+		w := &headWriter{ResponseWriter: res.Writer}
+		res.Writer = w
+		defer func() { res.Writer = w.ResponseWriter }()
+
+		// Errors are rendered here so their headers are counted too
+		if err := next(c); err != nil {
+			c.Error(err)
+		}
+		w.finish()
+		return nil
+	}
+}
+
+// isLivePath reports whether a path is one of the /ws or /sse streams
+func isLivePath(path string) bool {
+	for _, prefix := range []string{"/ws", "/sse"} {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// headWriter discards a response body, holding back the status until the
+// handler is done so the body's length can be sent as Content-Length
+type headWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+// WriteHeader implements http.ResponseWriter
+func (w *headWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+// Write implements http.ResponseWriter
+func (w *headWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.size += len(b)
+	return len(b), nil
+}
+
+// Flush holds the headers back like WriteHeader does
+func (w *headWriter) Flush() {}
+
+// finish sends the held back headers
+func (w *headWriter) finish() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	header := w.Header()
+	if header.Get(echo.HeaderContentLength) == "" && w.size > 0 {
+		header.Set(echo.HeaderContentLength, strconv.Itoa(w.size))
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// defaultMaxInFlight caps concurrent /api requests (ATHOME_MAX_IN_FLIGHT)
+const defaultMaxInFlight = 100
+
+// newInFlightLimit creates the semaphore bounding concurrent /api
+// requests, or nil when max is 0 to disable the cap
+func newInFlightLimit(max int) chan struct{} {
+	if max <= 0 {
+		return nil
+	}
+	return make(chan struct{}, max)
+}
+
+// limitInFlight is middleware capping how many /api requests are handled
+// at once, so a burst cannot pile up goroutines and upstream calls on a
+// small instance. Unlike a rate limit it only counts requests in progress.
+// Requests over the cap are refused with 503 rather than queued. Only the
+// /api group uses it, so /healthz and static assets are never refused.
+func (srv *Server) limitInFlight(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		sem := srv.inFlight
+		if sem == nil {
+			return next(c)
+		}
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+			return next(c)
+		default:
+			slog.Warn("too many requests in flight, refusing", "path", c.Request().URL.Path, "max", cap(sem))
+			c.Response().Header().Set("Retry-After", "1")
+			return echo.NewHTTPError(http.StatusServiceUnavailable, "server busy, try again shortly")
+		}
+	}
+}
+
+// limitBody returns middleware rejecting request bodies larger than *limit
+// bytes with 413. The limit is read per request so it can be configured
+// after the routes are set up; zero disables the check.
+func limitBody(limit *int64) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			max := *limit
+			if max <= 0 {
+				return next(c)
+			}
+
+			req := c.Request()
+			if req.ContentLength > max {
+				return echo.ErrStatusRequestEntityTooLarge
+			}
+
+			// Bodies without a declared length fail on read once they exceed the limit
+			req.Body = http.MaxBytesReader(c.Response(), req.Body, max)
+			err := next(c)
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				return echo.ErrStatusRequestEntityTooLarge
+			}
+			return err
+		}
+	}
+}
+
+// canonicalHostRedirect returns middleware that 301-redirects GET and HEAD
+// requests for any other host to *host, keeping the path and query. API
+// and health check routes are served under every host. The host is read
+// per request so it can be configured after the routes are set up; an
+// empty host disables the redirect.
+func canonicalHostRedirect(host *string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			canonical := *host
+			req := c.Request()
+			if canonical == "" || (req.Method != http.MethodGet && req.Method != http.MethodHead) {
+				return next(c)
+			}
+
+			path := req.URL.Path
+			if path == "/api" || strings.HasPrefix(path, "/api/") || path == "/healthz" {
+				return next(c)
+			}
+
+			// Without a port in the canonical host, any port on it matches
+			requested := req.Host
+			if !strings.Contains(canonical, ":") {
+				if h, _, err := net.SplitHostPort(requested); err == nil {
+					requested = h
+				}
+			}
+			if strings.EqualFold(requested, canonical) {
+				return next(c)
+			}
+
+			return c.Redirect(http.StatusMovedPermanently, c.Scheme()+"://"+canonical+req.URL.RequestURI())
+		}
+	}
+}
+
+// defaultAssetMaxAge is how long browsers may cache /assets (ATHOME_ASSET_MAX_AGE)
+const defaultAssetMaxAge = 365 * 24 * time.Hour
+
+// cacheAssets returns middleware marking successful responses as cacheable
+// for *maxAge and immutable. It must only wrap content-hashed files, whose
+// URL changes whenever their content does. Errors such as 404 are left
+// uncached. The age is read per request so it can be configured after the
+// routes are set up; zero disables the header.
+func cacheAssets(maxAge *time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			age := *maxAge
+			if age <= 0 {
+				return next(c)
+			}
+			header := c.Response().Header()
+			header.Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", int64(age.Seconds())))
+			err := next(c)
+			if err != nil && !c.Response().Committed {
+				header.Del("Cache-Control")
+			}
+			return err
+		}
+	}
+}
+
+// skipAuthRefresh reports whether a request bypasses the token refresh
+// middleware. Operator routes must keep working while the credentials
+// are broken, since /admin/refresh is how they get fixed, and health
+// probes must not trigger a refresh.
+func skipAuthRefresh(c echo.Context) bool {
+	path := c.Request().URL.Path
+	return path == "/healthz" || path == "/admin" || strings.HasPrefix(path, "/admin/")
+}
+
 // startServer launches the HTTP server and manages its lifecycle.
 // It handles graceful shutdown on context cancellation and returns any errors
 // encountered during startup or shutdown.
@@ -189,6 +655,14 @@ func setupServer(bindAddr string, xrpcClient *xrpc.Client, dir identity.Director
 func startServer(ctx context.Context, srv *Server, bindAddr string) error {
 	errChan := make(chan error, 1)
 
+	// Prefetch the primary profile without delaying startup
+	go srv.warmCache(ctx)
+
+	// Watch the configured handles for upstream changes
+	if srv.handleRecheckInterval > 0 && len(srv.allowedHandles()) > 0 && srv.dir != nil {
+		go srv.startHandleRecheck(ctx, srv.handleRecheckInterval)
+	}
+
 	// Start server in goroutine
 	go func() {
 		if err := srv.e.Start(bindAddr); err != nil && err != http.ErrServerClosed {
@@ -204,16 +678,29 @@ func startServer(ctx context.Context, srv *Server, bindAddr string) error {
 			srv.refreshCancel()
 		}
 
+		// Disconnect live clients; Shutdown does not wait for hijacked connections
+		if srv.live != nil {
+			srv.live.close()
+		}
+
 		// Attempt graceful shutdown
 		if err := srv.e.Shutdown(context.Background()); err != nil {
 			return fmt.Errorf("failed to shutdown server: %w", err)
 		}
+
+		// Let background cache refreshes finish rather than cutting them off
+		if srv.feeds != nil {
+			srv.feeds.wait()
+		}
 		return nil
 	case err := <-errChan:
 		// Cancel background refresh on error
 		if srv.refreshCancel != nil {
 			srv.refreshCancel()
 		}
+		if srv.live != nil {
+			srv.live.close()
+		}
 		return err
 	}
 }
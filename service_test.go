@@ -0,0 +1,457 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveIndex runs handleIndex against a server using the given public directory
+func serveIndex(t *testing.T, srv *Server) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Host = "alice.test"
+	rec := httptest.NewRecorder()
+	c := srv.e.NewContext(req, rec)
+	c.Set("nonce", "test-nonce")
+	require.NoError(t, srv.handleIndex(c))
+	return rec
+}
+
+func TestSetupServer_PublicDir(t *testing.T) {
+	t.Run("missing directory fails fast", func(t *testing.T) {
+		_, err := setupServer(":0", nil, nil, nil, nil, filepath.Join(t.TempDir(), "missing"), nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "ATHOME_PUBLIC_DIR")
+	})
+
+	t.Run("file instead of directory fails", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "public")
+		require.NoError(t, os.WriteFile(file, []byte("x"), 0o644))
+		_, err := setupServer(":0", nil, nil, nil, nil, file, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("configured directory is served", func(t *testing.T) {
+		dir := t.TempDir()
+		index := `<!doctype html><html lang="en"><head><title>AtHome</title></head><body>custom</body></html>`
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "index.html"), []byte(index), 0o644))
+
+		srv, err := setupServer(":0", nil, nil, nil, nil, dir, nil)
+		require.NoError(t, err)
+
+		rec := serveIndex(t, srv)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "custom")
+		assert.Contains(t, rec.Body.String(), "<title>@alice.test</title>")
+	})
+
+	t.Run("missing index.html serves fallback", func(t *testing.T) {
+		srv, err := setupServer(":0", nil, nil, nil, nil, t.TempDir(), nil)
+		require.NoError(t, err)
+
+		rec := serveIndex(t, srv)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "has not been built")
+		assert.Contains(t, rec.Body.String(), `data-default-handle="alice.test"`)
+	})
+}
+
+func TestSetupServer_EmbeddedAssets(t *testing.T) {
+	prev := publicAssets
+	defer func() { publicAssets = prev }()
+	publicAssets = fstest.MapFS{
+		"index.html":             {Data: []byte(`<!doctype html><html lang="en"><head><title>AtHome</title><script type="module" src="/assets/index-abc123.js"></script></head></html>`)},
+		"assets/index-abc123.js": {Data: []byte("console.log('embedded')")},
+	}
+
+	srv, err := setupServer(":0", nil, nil, nil, nil, "", nil)
+	require.NoError(t, err)
+
+	// Embedded asset is served through the static route
+	req := httptest.NewRequest(http.MethodGet, "/assets/index-abc123.js", nil)
+	rec := httptest.NewRecorder()
+	srv.e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "console.log('embedded')", rec.Body.String())
+
+	// Embedded index is rendered by the SPA handler
+	req = httptest.NewRequest(http.MethodGet, "/app", nil)
+	req.Host = "alice.test"
+	rec = httptest.NewRecorder()
+	srv.e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `src="/assets/index-abc123.js"`)
+	assert.Contains(t, rec.Body.String(), "<title>@alice.test</title>")
+}
+
+func TestBodyLimit(t *testing.T) {
+	srv, err := setupServer(":0", nil, nil, nil, nil, "", nil)
+	require.NoError(t, err)
+	srv.apiBodyLimit = 1024
+
+	send := func(method, path string, body io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, body)
+		rec := httptest.NewRecorder()
+		srv.e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Oversized bodies on API routes are rejected with a JSON 413
+	rec := send(http.MethodPost, "/api/profile/did/did:plc:abc123", strings.NewReader(strings.Repeat("x", 2048)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "application/json")
+	assert.JSONEq(t, `{"message": "Request Entity Too Large"}`, rec.Body.String())
+
+	// The global limit is looser than the API one
+	rec = send(http.MethodPost, "/healthz", strings.NewReader(strings.Repeat("x", 2048)))
+	assert.NotEqual(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	srv.bodyLimit = 512
+	rec = send(http.MethodPost, "/healthz", strings.NewReader(strings.Repeat("x", 2048)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
+
+func TestLimitBody_UndeclaredLength(t *testing.T) {
+	limit := int64(16)
+	h := limitBody(&limit)(func(c echo.Context) error {
+		_, err := io.ReadAll(c.Request().Body)
+		return err
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Repeat("x", 64)))
+	req.ContentLength = -1
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	assert.Equal(t, http.StatusRequestEntityTooLarge, httpStatus(t, h(c)))
+}
+
+func TestServerTuning(t *testing.T) {
+	srv, err := setupServer(":0", nil, nil, nil, nil, "", nil)
+	require.NoError(t, err)
+
+	// Defaults replace net/http's "never time out" zero values
+	assert.Equal(t, 10*time.Second, srv.e.Server.ReadHeaderTimeout)
+	assert.Equal(t, defaultServerTuning.ReadTimeout, srv.e.Server.ReadTimeout)
+	assert.Equal(t, defaultServerTuning.WriteTimeout, srv.e.Server.WriteTimeout)
+	assert.Equal(t, defaultServerTuning.IdleTimeout, srv.e.Server.IdleTimeout)
+	assert.Equal(t, defaultServerTuning.MaxHeaderBytes, srv.e.Server.MaxHeaderBytes)
+	assert.NotZero(t, srv.e.Server.ReadTimeout)
+
+	serverTuning{
+		ReadHeaderTimeout: 3 * time.Second,
+		ReadTimeout:       5 * time.Second,
+		WriteTimeout:      7 * time.Second,
+		IdleTimeout:       11 * time.Second,
+		MaxHeaderBytes:    4096,
+	}.apply(srv.e.Server)
+	assert.Equal(t, 3*time.Second, srv.e.Server.ReadHeaderTimeout)
+	assert.Equal(t, 5*time.Second, srv.e.Server.ReadTimeout)
+	assert.Equal(t, 7*time.Second, srv.e.Server.WriteTimeout)
+	assert.Equal(t, 11*time.Second, srv.e.Server.IdleTimeout)
+	assert.Equal(t, 4096, srv.e.Server.MaxHeaderBytes)
+}
+
+func TestCanonicalHostRedirect(t *testing.T) {
+	srv, err := setupServer(":0", nil, nil, nil, nil, "", nil)
+	require.NoError(t, err)
+	srv.canonicalHost = "alice.test"
+
+	send := func(host, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Host = host
+		rec := httptest.NewRecorder()
+		srv.e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Non-canonical hosts are redirected, keeping the path and query
+	rec := send("www.alice.test", "/profile/alice.test?tab=media")
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+	assert.Equal(t, "http://alice.test/profile/alice.test?tab=media", rec.Header().Get("Location"))
+
+	// The canonical host is served, in any case and on any port
+	assert.NotEqual(t, http.StatusMovedPermanently, send("alice.test", "/robots.txt").Code)
+	assert.NotEqual(t, http.StatusMovedPermanently, send("Alice.Test:8080", "/robots.txt").Code)
+
+	// API and health check routes are never redirected
+	assert.NotEqual(t, http.StatusMovedPermanently, send("www.alice.test", "/api/profile/did/did:plc:abc123").Code)
+	assert.Equal(t, http.StatusOK, send("www.alice.test", "/healthz").Code)
+
+	// No redirect when unset
+	srv.canonicalHost = ""
+	assert.NotEqual(t, http.StatusMovedPermanently, send("www.alice.test", "/robots.txt").Code)
+}
+
+func TestCacheControl(t *testing.T) {
+	dir := t.TempDir()
+	index := `<!doctype html><html lang="en"><head><title>AtHome</title><script type="module" src="/assets/index-abc123.js"></script></head><body></body></html>`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "index.html"), []byte(index), 0o644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "assets"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "assets", "index-abc123.js"), []byte("console.log(1)"), 0o644))
+
+	srv, err := setupServer(":0", nil, nil, nil, nil, dir, nil)
+	require.NoError(t, err)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Host = "alice.test"
+		rec := httptest.NewRecorder()
+		srv.e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Hashed assets are cached for good
+	rec := get("/assets/index-abc123.js")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "public, max-age=31536000, immutable", rec.Header().Get("Cache-Control"))
+
+	// The HTML entrypoint is always revalidated
+	rec = get("/")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "no-cache", rec.Header().Get("Cache-Control"))
+
+	// Missing assets are not cached
+	rec = get("/assets/index-missing.js")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Empty(t, rec.Header().Get("Cache-Control"))
+
+	// The max-age is configurable and can be disabled
+	srv.assetMaxAge = time.Hour
+	assert.Equal(t, "public, max-age=3600, immutable", get("/assets/index-abc123.js").Header().Get("Cache-Control"))
+	srv.assetMaxAge = 0
+	assert.Empty(t, get("/assets/index-abc123.js").Header().Get("Cache-Control"))
+}
+
+func TestDropCancelled(t *testing.T) {
+	stub := newStubTransport().onDelayed("app.bsky.feed.getAuthorFeed", 5*time.Second, http.StatusOK, `{"feed": []}`)
+	srv := newStubServer(stub)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/api/feed/did/did:plc:abc123", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	c := srv.e.NewContext(req, rec)
+	c.SetParamNames("did")
+	c.SetParamValues("did:plc:abc123")
+
+	// The client disconnects while the upstream call is in flight
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	err := dropCancelled(srv.handleGetFeed)(c)
+
+	// The delayed upstream response is abandoned rather than awaited, and
+	// nothing is written for the departed client
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+	upstream := stub.lastRequest("app.bsky.feed.getAuthorFeed")
+	require.NotNil(t, upstream)
+	assert.ErrorIs(t, upstream.Context().Err(), context.Canceled)
+	assert.False(t, c.Response().Committed)
+	assert.Empty(t, rec.Body.String())
+
+	// Writes after cancellation are refused
+	_, err = c.Response().Write([]byte("late"))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, rec.Body.String())
+}
+
+func TestDropCancelled_PassesThroughLiveRequests(t *testing.T) {
+	srv := newStubServer(newStubTransport().on("app.bsky.feed.getAuthorFeed", http.StatusOK, `{"feed": []}`))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/feed/did/did:plc:abc123", nil)
+	rec := httptest.NewRecorder()
+	c := srv.e.NewContext(req, rec)
+	c.SetParamNames("did")
+	c.SetParamValues("did:plc:abc123")
+
+	require.NoError(t, dropCancelled(srv.handleGetFeed)(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"cursor": null, "feed": [], "hasMore": false}`, rec.Body.String())
+
+	// Upstream errors still reach the client
+	c = srv.e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	c.SetParamNames("did")
+	c.SetParamValues("not-a-did")
+	assert.Error(t, dropCancelled(srv.handleGetFeed)(c))
+}
+
+func TestLimitInFlight(t *testing.T) {
+	dir := identity.NewMockDirectory()
+	dir.Insert(identity.Identity{DID: syntax.DID("did:plc:alice"), Handle: syntax.Handle("alice.test")})
+	stub := newStubTransport().onDelayed("app.bsky.feed.getAuthorFeed", 10*time.Second, http.StatusOK, `{"feed": []}`)
+	srv, err := setupServer(":0", &xrpc.Client{Host: "https://mock.bsky.test", Client: &http.Client{Transport: stub}}, &dir, nil, nil, t.TempDir(), nil)
+	require.NoError(t, err)
+	srv.inFlight = newInFlightLimit(2)
+
+	get := func(ctx context.Context, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx))
+		return rec
+	}
+
+	// Saturate the limiter with requests stuck on a slow upstream
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			get(ctx, "/api/feed/did/did:plc:alice")
+		}()
+	}
+	require.Eventually(t, func() bool {
+		stub.mu.Lock()
+		defer stub.mu.Unlock()
+		return len(stub.requests) == 2
+	}, 2*time.Second, 5*time.Millisecond)
+
+	// The overflow request is refused without reaching upstream
+	rec := get(context.Background(), "/api/feed/did/did:plc:alice")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	assert.Len(t, stub.requests, 2)
+
+	// Health checks and static pages are exempt
+	assert.Equal(t, http.StatusOK, get(context.Background(), "/healthz").Code)
+	assert.Equal(t, http.StatusOK, get(context.Background(), "/").Code)
+
+	// Slots are released once the slow requests finish
+	cancel()
+	wg.Wait()
+	assert.Equal(t, http.StatusOK, get(context.Background(), "/api/version").Code)
+}
+
+func TestSetupPublicServer(t *testing.T) {
+	srv, err := setupPublicServer(":0", nil, nil, nil, nil, t.TempDir())
+	require.NoError(t, err)
+
+	// No auth config means no refresh middleware or background refresh
+	assert.Nil(t, srv.auth)
+	assert.Nil(t, srv.refreshCancel)
+
+	for _, route := range srv.e.Routes() {
+		assert.False(t, strings.HasPrefix(route.Path, "/admin"), "admin route %s %s registered", route.Method, route.Path)
+		assert.NotContains(t, []string{"/api/suggestions", "/api/notifications/count", "/api/timeline"}, route.Path)
+	}
+
+	// Even a configured admin token cannot reach an operator endpoint
+	srv.adminToken = "s3cret"
+	req := httptest.NewRequest(http.MethodPost, "/admin/refresh", nil)
+	req.Header.Set(adminTokenHeader, "s3cret")
+	rec := httptest.NewRecorder()
+	srv.e.ServeHTTP(rec, req)
+	assert.NotEqual(t, http.StatusOK, rec.Code)
+
+	// The regular server still registers them
+	full, err := setupServer(":0", nil, nil, nil, nil, t.TempDir(), nil)
+	require.NoError(t, err)
+	var paths []string
+	for _, route := range full.e.Routes() {
+		paths = append(paths, route.Path)
+	}
+	assert.Contains(t, paths, "/admin/status")
+	assert.Contains(t, paths, "/api/suggestions")
+	assert.Contains(t, paths, "/api/timeline")
+
+	// Owner routes sit behind the admin token
+	full.adminToken = "s3cret"
+	for _, path := range []string{"/api/suggestions", "/api/notifications/count", "/api/timeline"} {
+		rec := httptest.NewRecorder()
+		full.e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, path)
+	}
+}
+
+func TestAuthRefresh_SkipsAdminAndHealth(t *testing.T) {
+	pds := newStubTransport().on("com.atproto.server.createSession", http.StatusUnauthorized,
+		`{"error": "AuthenticationRequired", "message": "Invalid identifier or password"}`)
+	client := &xrpc.Client{Host: "https://pds.test", Client: &http.Client{Transport: pds}}
+	srv, err := setupServer(":0", client, nil, nil, nil, t.TempDir(), &AuthConfig{Handle: "alice.test", Password: "rotated"})
+	require.NoError(t, err)
+	defer srv.refreshCancel()
+	srv.adminToken = "s3cret"
+
+	serve := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set(adminTokenHeader, token)
+		}
+		rec := httptest.NewRecorder()
+		srv.e.ServeHTTP(rec, req)
+		return rec
+	}
+	sessions := func() int {
+		n := 0
+		for _, req := range pds.requests {
+			if strings.HasSuffix(req.URL.Path, "/com.atproto.server.createSession") {
+				n++
+			}
+		}
+		return n
+	}
+
+	// Probes and unauthenticated admin requests never log in
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/healthz", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "/admin/status", "").Code)
+	assert.Equal(t, 0, sessions())
+
+	// Operators can still inspect the broken credentials
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/admin/status", "s3cret").Code)
+	assert.Equal(t, 0, sessions())
+
+	// Everything else still refreshes first
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "/api/version", "").Code)
+	assert.Equal(t, 1, sessions())
+}
+
+func TestHeadAsGet(t *testing.T) {
+	stub := newStubTransport().
+		on("app.bsky.actor.getProfile", http.StatusOK, `{"did": "did:plc:abc123", "handle": "alice.test"}`).
+		on("app.bsky.feed.getAuthorFeed", http.StatusOK, `{"feed": [], "cursor": "next"}`)
+	client := &xrpc.Client{Host: "https://mock.bsky.test", Client: &http.Client{Transport: stub}}
+	srv, err := setupServer(":0", client, nil, nil, nil, t.TempDir(), nil)
+	require.NoError(t, err)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.e.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	for _, path := range []string{"/api/profile/did/did:plc:abc123", "/api/feed/did/did:plc:abc123", "/robots.txt", "/api/about"} {
+		t.Run(path, func(t *testing.T) {
+			get := serve(http.MethodGet, path)
+			require.Equal(t, http.StatusOK, get.Code)
+
+			head := serve(http.MethodHead, path)
+			assert.Equal(t, http.StatusOK, head.Code)
+			assert.Empty(t, head.Body.String())
+			assert.Equal(t, strconv.Itoa(get.Body.Len()), head.Header().Get(echo.HeaderContentLength))
+			assert.Equal(t, get.Header().Get(echo.HeaderContentType), head.Header().Get(echo.HeaderContentType))
+			assert.Equal(t, get.Header().Get(echo.HeaderCacheControl), head.Header().Get(echo.HeaderCacheControl))
+		})
+	}
+
+	// Errors keep their status
+	head := serve(http.MethodHead, "/api/profile/did/not-a-did")
+	assert.Equal(t, http.StatusBadRequest, head.Code)
+	assert.Empty(t, head.Body.String())
+
+	// The live streams are not answered
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodHead, "/sse").Code)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// handleGetRuntimeConfig returns the settings the frontend needs at
+// runtime, so the SPA can fetch them rather than scrape index.html. Only
+// non-secret values belong here: the endpoint is public.
+//
+// Returns:
+//   - 200 OK with RuntimeConfig
+func (srv *Server) handleGetRuntimeConfig(c echo.Context) error {
+	return c.JSON(http.StatusOK, RuntimeConfig{
+		DefaultHandle: getHandleFromRequest(c),
+		Mode:          srv.buildInfo().Mode,
+		Features: RuntimeFeatures{
+			Portfolio: srv.enablePortfolio,
+			Live:      srv.enableLive,
+		},
+		FeedDefaultLimit: srv.FeedDefaultLimit,
+		FeedMaxLimit:     srv.FeedMaxLimit,
+	})
+}
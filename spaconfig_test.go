@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleGetRuntimeConfig(t *testing.T) {
+	serve := func(srv *Server, host string) map[string]interface{} {
+		req := httptest.NewRequest(http.MethodGet, "/api/config", nil)
+		req.Host = host
+		rec := httptest.NewRecorder()
+		require.NoError(t, srv.handleGetRuntimeConfig(srv.e.NewContext(req, rec)))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		return body
+	}
+
+	srv := &Server{e: echo.New(), FeedDefaultLimit: 20, FeedMaxLimit: 50}
+	assert.Equal(t, map[string]interface{}{
+		"defaultHandle":    "",
+		"mode":             modeAppView,
+		"features":         map[string]interface{}{"portfolio": false, "live": false},
+		"feedDefaultLimit": float64(20),
+		"feedMaxLimit":     float64(50),
+	}, serve(srv, "localhost:8080"))
+
+	// Enabled features, the PDS mode and the hostname handle are reflected,
+	// while credentials never appear
+	srv = &Server{
+		e:                echo.New(),
+		auth:             &AuthConfig{Handle: "alice.test", Password: "app-password"},
+		adminToken:       "admin-secret",
+		enablePortfolio:  true,
+		enableLive:       true,
+		FeedDefaultLimit: 10,
+		FeedMaxLimit:     100,
+	}
+	rec := serve(srv, "alice.test")
+	assert.Equal(t, "alice.test", rec["defaultHandle"])
+	assert.Equal(t, modePDS, rec["mode"])
+	assert.Equal(t, map[string]interface{}{"portfolio": true, "live": true}, rec["features"])
+	assert.Equal(t, float64(100), rec["feedMaxLimit"])
+
+	raw, err := json.Marshal(rec)
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "app-password")
+	assert.NotContains(t, string(raw), "admin-secret")
+}
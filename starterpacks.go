@@ -0,0 +1,104 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/labstack/echo/v4"
+)
+
+// starterPackCollection is the NSID of starter pack records
+const starterPackCollection = "app.bsky.graph.starterpack"
+
+// handleGetActorStarterPacks handles requests for the starter packs a
+// user has created. The handle is checked against the allowed list.
+//
+// URL Parameters:
+//   - handle: Optional handle parameter (falls back to hostname)
+//
+// Query Parameters:
+//   - cursor: Pagination cursor for fetching more packs
+//   - limit: Page size (default 50, max 100)
+//
+// Returns:
+//   - 200 OK with the starter packs
+//   - 400 Bad Request if handle, cursor or limit is invalid
+//   - 403 Forbidden if handle is not allowed
+//   - 500 Internal Server Error if the fetch fails
+func (srv *Server) handleGetActorStarterPacks(c echo.Context) error {
+	did, err := srv.validateAndGetDID(c, getActorFromRequest(c))
+	if err != nil {
+		return err
+	}
+
+	limit, err := getLimitFromRequest(c, defaultListLimit, maxListLimit)
+	if err != nil {
+		return err
+	}
+	cursor, err := getCursorFromRequest(c)
+	if err != nil {
+		return err
+	}
+
+	// Ensure we have a valid token before making the API request
+	if err := srv.ensureValidToken(c); err != nil {
+		slog.Error("failed to ensure valid token", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Authentication error: "+err.Error())
+	}
+
+	out, err := bsky.GraphGetActorStarterPacks(c.Request().Context(), srv.readClient(), did, cursor, limit)
+	if err != nil {
+		slog.Error("failed to fetch starter packs", "error", err)
+		return upstreamError(c, err)
+	}
+
+	packs := out.StarterPacks
+	if packs == nil {
+		packs = []*bsky.GraphDefs_StarterPackViewBasic{}
+	}
+
+	response := map[string]interface{}{
+		"cursor":       out.Cursor,
+		"starterPacks": packs,
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// handleGetStarterPack handles requests for a single starter pack.
+//
+// URL Parameters:
+//   - *: The AT-URI of the starter pack record (with or without at:// prefix)
+//
+// Returns:
+//   - 200 OK with the starter pack
+//   - 400 Bad Request if URI is invalid or not a starter pack
+//   - 404 Not Found if the starter pack does not exist
+//   - 500 Internal Server Error if the fetch fails
+func (srv *Server) handleGetStarterPack(c echo.Context) error {
+	atUri, err := getATURIFromRequest(c)
+	if err != nil {
+		return err
+	}
+	if atUri.Collection().String() != starterPackCollection {
+		return echo.NewHTTPError(http.StatusBadRequest, "uri is not a starter pack")
+	}
+
+	// Ensure we have a valid token before making the API request
+	if err := srv.ensureValidToken(c); err != nil {
+		slog.Error("failed to ensure valid token", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Authentication error: "+err.Error())
+	}
+
+	out, err := bsky.GraphGetStarterPack(c.Request().Context(), srv.readClient(), atUri.String())
+	if err != nil {
+		if isNotFoundError(err) {
+			return echo.NewHTTPError(http.StatusNotFound, "starter pack not found")
+		}
+		slog.Error("failed to fetch starter pack", "error", err)
+		return upstreamError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, out.StarterPack)
+}
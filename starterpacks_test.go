@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleGetActorStarterPacks(t *testing.T) {
+	dir := identity.NewMockDirectory()
+	dir.Insert(identity.Identity{DID: syntax.DID("did:plc:alice"), Handle: syntax.Handle("alice.test")})
+
+	stub := newStubTransport().on("app.bsky.graph.getActorStarterPacks", http.StatusOK, `{
+		"cursor": "packs-next",
+		"starterPacks": [{
+			"uri": "at://did:plc:alice/app.bsky.graph.starterpack/friends",
+			"cid": "bafypack",
+			"creator": {"did": "did:plc:alice", "handle": "alice.test"},
+			"record": {"$type": "app.bsky.graph.starterpack", "name": "Friends", "list": "at://did:plc:alice/app.bsky.graph.list/1", "createdAt": "2024-01-01T00:00:00Z"},
+			"indexedAt": "2024-01-01T00:00:00Z"
+		}]
+	}`)
+	srv := newStubServer(stub)
+	srv.dir = &dir
+
+	rec, err := serveParam(srv, srv.handleGetActorStarterPacks, "handle", "alice.test", "cursor=packs-1&limit=5")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req := stub.lastRequest("app.bsky.graph.getActorStarterPacks")
+	require.NotNil(t, req)
+	assert.Equal(t, "did:plc:alice", req.URL.Query().Get("actor"))
+	assert.Equal(t, "packs-1", req.URL.Query().Get("cursor"))
+	assert.Equal(t, "5", req.URL.Query().Get("limit"))
+	assert.Contains(t, rec.Body.String(), `"cursor":"packs-next"`)
+	assert.Contains(t, rec.Body.String(), `"name":"Friends"`)
+
+	_, err = serveParam(srv, srv.handleGetActorStarterPacks, "handle", "not a handle", "")
+	assert.Equal(t, http.StatusBadRequest, httpStatus(t, err))
+}
+
+func TestHandleGetStarterPack(t *testing.T) {
+	const packURI = "at://did:plc:alice/app.bsky.graph.starterpack/friends"
+
+	stub := newStubTransport().on("app.bsky.graph.getStarterPack", http.StatusOK, `{
+		"starterPack": {
+			"uri": "at://did:plc:alice/app.bsky.graph.starterpack/friends",
+			"cid": "bafypack",
+			"creator": {"did": "did:plc:alice", "handle": "alice.test"},
+			"record": {"$type": "app.bsky.graph.starterpack", "name": "Friends", "list": "at://did:plc:alice/app.bsky.graph.list/1", "createdAt": "2024-01-01T00:00:00Z"},
+			"indexedAt": "2024-01-01T00:00:00Z"
+		}
+	}`)
+	srv := newStubServer(stub)
+
+	rec, err := serveWildcard(srv, srv.handleGetStarterPack, packURI, "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req := stub.lastRequest("app.bsky.graph.getStarterPack")
+	require.NotNil(t, req)
+	assert.Equal(t, packURI, req.URL.Query().Get("starterPack"))
+	assert.Contains(t, rec.Body.String(), `"uri":"`+packURI+`"`)
+
+	// Only starter pack records are accepted
+	_, err = serveWildcard(srv, srv.handleGetStarterPack, "did:plc:alice/app.bsky.feed.post/1", "")
+	assert.Equal(t, http.StatusBadRequest, httpStatus(t, err))
+
+	stub.on("app.bsky.graph.getStarterPack", http.StatusNotFound, `{"error": "NotFound", "message": "missing"}`)
+	_, err = serveWildcard(srv, srv.handleGetStarterPack, packURI, "")
+	assert.Equal(t, http.StatusNotFound, httpStatus(t, err))
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/labstack/echo/v4"
+)
+
+// handleGetSuggestions handles requests for accounts suggested to follow,
+// e.g. for a "discover" sidebar. Suggestions are personalised for the
+// authenticated account and reveal who it follows, so the route is
+// guarded by the admin token and only exists in PDS mode.
+//
+// Query Parameters:
+//   - cursor: Pagination cursor for fetching more suggestions
+//   - limit: Page size (see FeedDefaultLimit and FeedMaxLimit)
+//
+// Returns:
+//   - 200 OK with {"cursor": ..., "actors": [...]}
+//   - 400 Bad Request if cursor or limit is invalid
+//   - 401 Unauthorized if the admin token is wrong
+//   - 404 Not Found if no admin token or PDS auth is configured
+//   - 503 Service Unavailable if PDS authentication is degraded
+func (srv *Server) handleGetSuggestions(c echo.Context) error {
+	if srv.auth == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "suggestions require PDS authentication")
+	}
+
+	cursor, err := getCursorFromRequest(c)
+	if err != nil {
+		return err
+	}
+	limit, err := srv.getFeedLimitFromRequest(c)
+	if err != nil {
+		return err
+	}
+
+	// Must be asked as the account itself; the fallback AppView has no viewer
+	if err := srv.ensureAuthToken(c); err != nil {
+		slog.Error("failed to ensure auth token", "error", err)
+		return err
+	}
+
+	out, err := bsky.ActorGetSuggestions(c.Request().Context(), srv.xrpcc, cursor, limit)
+	if err != nil {
+		slog.Error("failed to fetch suggestions", "error", err)
+		return upstreamError(c, err)
+	}
+
+	actors := out.Actors
+	if actors == nil {
+		actors = []*bsky.ActorDefs_ProfileView{}
+	}
+
+	// Private to the owner; keep it out of every cache
+	c.Response().Header().Set(echo.HeaderCacheControl, "private, no-store")
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"cursor": out.Cursor,
+		"actors": actors,
+	})
+}
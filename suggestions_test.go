@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleGetSuggestions_PDSMode(t *testing.T) {
+	stub := newStubTransport().on("app.bsky.actor.getSuggestions", http.StatusOK, `{
+		"cursor": "page-2",
+		"actors": [
+			{"did": "did:plc:bob", "handle": "bob.test"},
+			{"did": "did:plc:carol", "handle": "carol.test", "displayName": "Carol"}
+		]
+	}`)
+	srv := newStubServer(stub)
+	srv.adminToken = "s3cret"
+	srv.auth = &AuthConfig{Handle: "alice.test", Password: "test-pass", Token: "access", RefreshAt: time.Now().Add(2 * time.Hour)}
+
+	_, err := serveAdmin(srv, http.MethodGet, srv.handleGetSuggestions, "wrong")
+	assert.Equal(t, http.StatusUnauthorized, httpStatus(t, err))
+	_, err = serveAdmin(srv, http.MethodGet, srv.handleGetSuggestions, "")
+	assert.Equal(t, http.StatusUnauthorized, httpStatus(t, err))
+	assert.Nil(t, stub.lastRequest("app.bsky.actor.getSuggestions"))
+
+	rec, err := serveParam(srv, srv.handleGetSuggestions, "", "", "cursor=page-1&limit=2")
+	require.NoError(t, err)
+	assert.Equal(t, "private, no-store", rec.Header().Get("Cache-Control"))
+	assert.JSONEq(t, `{
+		"cursor": "page-2",
+		"actors": [
+			{"did": "did:plc:bob", "handle": "bob.test"},
+			{"did": "did:plc:carol", "handle": "carol.test", "displayName": "Carol"}
+		]
+	}`, rec.Body.String())
+
+	req := stub.lastRequest("app.bsky.actor.getSuggestions")
+	require.NotNil(t, req)
+	assert.Equal(t, "page-1", req.URL.Query().Get("cursor"))
+	assert.Equal(t, "2", req.URL.Query().Get("limit"))
+
+	// An empty page is still a list
+	stub.on("app.bsky.actor.getSuggestions", http.StatusOK, `{}`)
+	rec, err = serveParam(srv, srv.handleGetSuggestions, "", "", "")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"cursor": null, "actors": []}`, rec.Body.String())
+
+	_, err = serveParam(srv, srv.handleGetSuggestions, "", "", "limit=0")
+	assert.Equal(t, http.StatusBadRequest, httpStatus(t, err))
+
+	// Degraded auth has no fallback for personalised data
+	srv.degraded.Store(true)
+	_, err = serveParam(srv, srv.handleGetSuggestions, "", "", "")
+	assert.Equal(t, http.StatusServiceUnavailable, httpStatus(t, err))
+}
+
+func TestHandleGetSuggestions_AppViewMode(t *testing.T) {
+	stub := newStubTransport()
+	srv := newStubServer(stub)
+
+	// Hidden without an admin token
+	_, err := serveAdmin(srv, http.MethodGet, srv.handleGetSuggestions, "anything")
+	assert.Equal(t, http.StatusNotFound, httpStatus(t, err))
+
+	_, err = serveParam(srv, srv.handleGetSuggestions, "", "", "")
+	assert.Equal(t, http.StatusNotFound, httpStatus(t, err))
+	assert.Empty(t, stub.requests)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// Feed cache defaults (ATHOME_FEED_CACHE_TTL, ATHOME_FEED_CACHE_MAX_AGE)
+const (
+	defaultFeedCacheTTL    = 0 // Disabled unless configured
+	defaultFeedCacheMaxAge = 5 * time.Minute
+)
+
+// feedCacheMaxEntries caps the feed pages cached, since their keys come
+// from client input such as cursors
+const feedCacheMaxEntries = 1000
+
+// swrRefreshTimeout bounds a background refresh, which outlives the
+// request that triggered it
+const swrRefreshTimeout = 30 * time.Second
+
+// swrEntry is a cached value with the time it was fetched
+type swrEntry[V any] struct {
+	key        string
+	value      V
+	fetched    time.Time
+	refreshing bool          // Whether a background refresh is in flight
+	elem       *list.Element // Position in swrCache.recent
+}
+
+// swrCache is a stale-while-revalidate cache. Entries younger than soft
+// are served as they are. Entries between soft and hard are still served
+// immediately, but trigger a single background refresh so the next
+// request sees fresher data. Entries older than hard are fetched in the
+// foreground and dropped. Keys come from client input such as cursors,
+// so at most maxEntries are kept, evicting the least recently used. It is
+// safe for concurrent use.
+type swrCache[V any] struct {
+	soft       time.Duration
+	hard       time.Duration
+	maxEntries int
+	now        func() time.Time // Overridable clock for tests
+
+	mu        sync.Mutex
+	entries   map[string]*swrEntry[V]
+	recent    *list.List     // Entries, most recently used first
+	refreshes sync.WaitGroup // Background refreshes in flight
+}
+
+// newSWRCache creates a cache with the given soft and hard TTLs holding
+// at most maxEntries, or nil when soft or maxEntries is 0 to disable
+// caching
+func newSWRCache[V any](soft, hard time.Duration, maxEntries int) *swrCache[V] {
+	if soft <= 0 || maxEntries <= 0 {
+		return nil
+	}
+	return &swrCache[V]{
+		soft:       soft,
+		hard:       max(hard, soft),
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    make(map[string]*swrEntry[V]),
+		recent:     list.New(),
+	}
+}
+
+// get returns the value for key, calling fetch when there is no usable
+// entry. A stale entry is returned as is while fetch runs in the
+// background; its context is detached from ctx, since the request may
+// finish first. Failed fetches are not cached.
+func (sc *swrCache[V]) get(ctx context.Context, key string, fetch func(context.Context) (V, error)) (V, error) {
+	sc.mu.Lock()
+	entry, ok := sc.entries[key]
+	if ok {
+		age := sc.now().Sub(entry.fetched)
+		switch {
+		case age < sc.soft:
+			sc.recent.MoveToFront(entry.elem)
+			value := entry.value
+			sc.mu.Unlock()
+			return value, nil
+		case age < sc.hard:
+			sc.recent.MoveToFront(entry.elem)
+			if !entry.refreshing {
+				entry.refreshing = true
+				sc.refreshes.Add(1)
+				go sc.refresh(context.WithoutCancel(ctx), entry, fetch)
+			}
+			value := entry.value // Read under the lock; the refresh updates it
+			sc.mu.Unlock()
+			return value, nil
+		default:
+			// Too old to serve; a refresh in flight is discarded
+			sc.remove(entry)
+		}
+	}
+	sc.mu.Unlock()
+
+	value, err := fetch(ctx)
+	if err != nil {
+		return value, err
+	}
+	sc.set(key, value)
+	return value, nil
+}
+
+// refresh fetches entry's key in the background and updates entry with
+// the result. If entry was purged, evicted or replaced meanwhile, the
+// result is discarded rather than bringing it back.
+func (sc *swrCache[V]) refresh(ctx context.Context, entry *swrEntry[V], fetch func(context.Context) (V, error)) {
+	defer sc.refreshes.Done()
+
+	ctx, cancel := context.WithTimeout(ctx, swrRefreshTimeout)
+	defer cancel()
+
+	value, err := fetch(ctx)
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	entry.refreshing = false
+	if err != nil {
+		slog.Warn("background cache refresh failed, serving stale entry", "key", entry.key, "error", err)
+		return
+	}
+	if sc.entries[entry.key] != entry {
+		return
+	}
+	entry.value = value
+	entry.fetched = sc.now()
+}
+
+// set stores value under key as freshly fetched, evicting the least
+// recently used entries beyond maxEntries
+func (sc *swrCache[V]) set(key string, value V) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if entry, ok := sc.entries[key]; ok {
+		sc.remove(entry)
+	}
+	entry := &swrEntry[V]{key: key, value: value, fetched: sc.now()}
+	entry.elem = sc.recent.PushFront(entry)
+	sc.entries[key] = entry
+	for sc.recent.Len() > sc.maxEntries {
+		sc.remove(sc.recent.Back().Value.(*swrEntry[V]))
+	}
+}
+
+// remove drops entry from the cache; sc.mu must be held
+func (sc *swrCache[V]) remove(entry *swrEntry[V]) {
+	sc.recent.Remove(entry.elem)
+	delete(sc.entries, entry.key)
+}
+
+// wait blocks until background refreshes in flight have finished. Each is
+// bounded by swrRefreshTimeout.
+func (sc *swrCache[V]) wait() {
+	sc.refreshes.Wait()
+}
+
+// Purge implements Purgeable for caches whose keys start with the
+// identity followed by "|"
+func (sc *swrCache[V]) Purge(ctx context.Context, id syntax.AtIdentifier) error {
+	prefix := id.String() + "|"
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	for key, entry := range sc.entries {
+		if strings.HasPrefix(key, prefix) {
+			sc.remove(entry)
+		}
+	}
+	return nil
+}
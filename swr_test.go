@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestSWRCache creates a cache with a manually advanced clock
+func newTestSWRCache(soft, hard time.Duration) (*swrCache[string], *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sc := newSWRCache[string](soft, hard, 3)
+	sc.now = func() time.Time { return now }
+	return sc, &now
+}
+
+func TestSWRCache_StaleHitRefreshesOnce(t *testing.T) {
+	sc, now := newTestSWRCache(time.Minute, 10*time.Minute)
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fetch := func(ctx context.Context) (string, error) {
+		n := calls.Add(1)
+		if n > 1 {
+			<-release // Hold the background refresh until the stale hits are done
+		}
+		return []string{"", "v1", "v2"}[n], nil
+	}
+
+	v, err := sc.get(context.Background(), "k", fetch)
+	require.NoError(t, err)
+	assert.Equal(t, "v1", v)
+
+	// Fresh hits are served without fetching
+	*now = now.Add(30 * time.Second)
+	v, _ = sc.get(context.Background(), "k", fetch)
+	assert.Equal(t, "v1", v)
+	assert.Equal(t, int32(1), calls.Load())
+
+	// Stale hits return the cached value at once and share one refresh
+	*now = now.Add(time.Minute)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := sc.get(context.Background(), "k", fetch)
+			assert.NoError(t, err)
+			assert.Equal(t, "v1", v)
+		}()
+	}
+	wg.Wait()
+	close(release)
+	sc.refreshes.Wait()
+	assert.Equal(t, int32(2), calls.Load())
+
+	// The refreshed value is served as fresh
+	v, _ = sc.get(context.Background(), "k", fetch)
+	assert.Equal(t, "v2", v)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestSWRCache_HardExpiry(t *testing.T) {
+	sc, now := newTestSWRCache(time.Minute, 10*time.Minute)
+
+	var calls int
+	fetch := func(ctx context.Context) (string, error) {
+		calls++
+		return "v", nil
+	}
+	_, _ = sc.get(context.Background(), "k", fetch)
+
+	// Past the hard TTL the entry is fetched in the foreground
+	*now = now.Add(11 * time.Minute)
+	_, err := sc.get(context.Background(), "k", fetch)
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	// and dropped, even when that fetch fails
+	*now = now.Add(11 * time.Minute)
+	_, err = sc.get(context.Background(), "k", func(ctx context.Context) (string, error) { return "", errors.New("boom") })
+	assert.Error(t, err)
+	assert.Empty(t, sc.entries)
+	assert.Equal(t, 0, sc.recent.Len())
+}
+
+func TestSWRCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	sc, _ := newTestSWRCache(time.Minute, 10*time.Minute)
+	value := func(v string) func(context.Context) (string, error) {
+		return func(ctx context.Context) (string, error) { return v, nil }
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		_, _ = sc.get(context.Background(), key, value(key))
+	}
+
+	// Reading "a" makes "b" the least recently used
+	v, _ := sc.get(context.Background(), "a", nil)
+	assert.Equal(t, "a", v)
+	_, _ = sc.get(context.Background(), "d", value("d"))
+	assert.Len(t, sc.entries, 3)
+	assert.NotContains(t, sc.entries, "b")
+
+	// Storing an existing key does not grow the cache
+	sc.set("a", "a2")
+	assert.Len(t, sc.entries, 3)
+	assert.Equal(t, 3, sc.recent.Len())
+
+	// Caching is disabled without room for entries
+	assert.Nil(t, newSWRCache[string](time.Minute, time.Hour, 0))
+}
+
+func TestSWRCache_Errors(t *testing.T) {
+	sc, now := newTestSWRCache(time.Minute, 10*time.Minute)
+	boom := errors.New("boom")
+
+	// Failed fetches are not cached
+	_, err := sc.get(context.Background(), "k", func(ctx context.Context) (string, error) { return "", boom })
+	assert.ErrorIs(t, err, boom)
+	v, err := sc.get(context.Background(), "k", func(ctx context.Context) (string, error) { return "v1", nil })
+	require.NoError(t, err)
+	assert.Equal(t, "v1", v)
+
+	// A failed background refresh keeps serving the stale value and
+	// lets the next stale hit try again
+	*now = now.Add(2 * time.Minute)
+	var calls atomic.Int32
+	failing := func(ctx context.Context) (string, error) {
+		calls.Add(1)
+		return "", boom
+	}
+	v, err = sc.get(context.Background(), "k", failing)
+	require.NoError(t, err)
+	assert.Equal(t, "v1", v)
+	sc.refreshes.Wait()
+	v, _ = sc.get(context.Background(), "k", failing)
+	assert.Equal(t, "v1", v)
+	sc.refreshes.Wait()
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestSWRCache_RefreshOutlivesRequest(t *testing.T) {
+	sc, now := newTestSWRCache(time.Minute, 10*time.Minute)
+	_, _ = sc.get(context.Background(), "k", func(ctx context.Context) (string, error) { return "v1", nil })
+
+	// The request finishing does not cancel the refresh it triggered
+	*now = now.Add(2 * time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	_, _ = sc.get(ctx, "k", func(ctx context.Context) (string, error) {
+		cancel()
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		return "v2", nil
+	})
+	sc.refreshes.Wait()
+	*now = now.Add(time.Second)
+	v, _ := sc.get(context.Background(), "k", nil)
+	assert.Equal(t, "v2", v)
+}
+
+func TestSWRCache_PurgeDuringRefresh(t *testing.T) {
+	sc, now := newTestSWRCache(time.Minute, 10*time.Minute)
+	const key = "did:plc:alice|"
+	_, _ = sc.get(context.Background(), key, func(ctx context.Context) (string, error) { return "v1", nil })
+
+	// A stale hit starts a refresh that blocks until released
+	*now = now.Add(2 * time.Minute)
+	started, release := make(chan struct{}), make(chan struct{})
+	v, err := sc.get(context.Background(), key, func(ctx context.Context) (string, error) {
+		close(started)
+		<-release
+		return "v2", nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "v1", v)
+	<-started
+
+	// The purge wins over the refresh finishing after it
+	require.NoError(t, sc.Purge(context.Background(), syntax.DID("did:plc:alice").AtIdentifier()))
+	close(release)
+	sc.refreshes.Wait()
+	assert.Empty(t, sc.entries)
+	assert.Equal(t, 0, sc.recent.Len())
+
+	// Likewise for an entry replaced meanwhile: the newer value is kept
+	_, _ = sc.get(context.Background(), key, func(ctx context.Context) (string, error) { return "v3", nil })
+	*now = now.Add(2 * time.Minute)
+	release = make(chan struct{})
+	_, _ = sc.get(context.Background(), key, func(ctx context.Context) (string, error) {
+		<-release
+		return "stale", nil
+	})
+	sc.set(key, "v4")
+	close(release)
+	sc.refreshes.Wait()
+	v, _ = sc.get(context.Background(), key, nil)
+	assert.Equal(t, "v4", v)
+}
+
+func TestSWRCache_Purge(t *testing.T) {
+	sc, _ := newTestSWRCache(time.Minute, 10*time.Minute)
+	for _, key := range []string{"did:plc:alice|", "did:plc:alice|cursor|20|", "did:plc:alice2|"} {
+		sc.set(key, "v")
+	}
+
+	require.NoError(t, sc.Purge(context.Background(), syntax.DID("did:plc:alice").AtIdentifier()))
+	assert.Len(t, sc.entries, 1)
+	assert.Equal(t, 1, sc.recent.Len())
+	assert.Contains(t, sc.entries, "did:plc:alice2|")
+}
+
+func TestHandleGetFeed_Cached(t *testing.T) {
+	stub := newStubTransport().on("app.bsky.feed.getAuthorFeed", http.StatusOK, `{"feed": [{"post": {
+		"uri": "at://did:plc:abc123/app.bsky.feed.post/1",
+		"cid": "bafy1",
+		"author": {"did": "did:plc:abc123", "handle": "alice.test"},
+		"record": {"$type": "app.bsky.feed.post", "text": "first", "createdAt": "2024-01-01T00:00:00Z"},
+		"indexedAt": "2024-01-01T00:00:00Z"
+	}}]}`)
+	srv := newStubServer(stub)
+	srv.feeds = newSWRCache[*authorFeedPage](time.Minute, 10*time.Minute, feedCacheMaxEntries)
+
+	for i := 0; i < 3; i++ {
+		rec, err := serveParam(srv, srv.handleGetFeed, "did", "did:plc:abc123", "")
+		require.NoError(t, err)
+		assert.Contains(t, rec.Body.String(), `"text":"first"`)
+	}
+	assert.Len(t, stub.requests, 1)
+
+	// Pages are cached separately
+	_, err := serveParam(srv, srv.handleGetFeed, "did", "did:plc:abc123", "lang=en")
+	require.NoError(t, err)
+	assert.Len(t, stub.requests, 2)
+}
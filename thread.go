@@ -0,0 +1,109 @@
+package main
+
+import (
+	"github.com/bluesky-social/indigo/api/bsky"
+)
+
+// defaultThreadMaxNodes caps the posts returned for one thread (ATHOME_THREAD_MAX_NODES)
+const defaultThreadMaxNodes = 500
+
+// pruneThread caps the number of posts in a thread at maxNodes, counting
+// the anchor post, its parents and every reply, including not-found and
+// blocked placeholders. Parents are always kept; replies are kept in
+// breadth-first order, so the deepest and widest branches are cut first.
+// It reports whether anything was removed; maxNodes <= 0 disables pruning.
+func pruneThread(thread *bsky.FeedDefs_ThreadViewPost, maxNodes int) bool {
+	if thread == nil || maxNodes <= 0 {
+		return false
+	}
+
+	budget := maxNodes - 1
+	for parent := thread.Parent; parent != nil; {
+		budget--
+		if parent.FeedDefs_ThreadViewPost == nil {
+			break
+		}
+		parent = parent.FeedDefs_ThreadViewPost.Parent
+	}
+
+	truncated := false
+	queue := []*bsky.FeedDefs_ThreadViewPost{thread}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+
+		if keep := max(budget, 0); len(node.Replies) > keep {
+			node.Replies = node.Replies[:keep]
+			truncated = true
+		}
+		budget -= len(node.Replies)
+		for _, reply := range node.Replies {
+			if reply != nil && reply.FeedDefs_ThreadViewPost != nil {
+				queue = append(queue, reply.FeedDefs_ThreadViewPost)
+			}
+		}
+	}
+	return truncated
+}
+
+// Thread node types, the "type" discriminator of ThreadNode
+const (
+	threadNodePost     = "post"     // A visible post
+	threadNodeNotFound = "notFound" // A deleted or otherwise missing post
+	threadNodeBlocked  = "blocked"  // A post hidden by a block
+)
+
+// normalizeThread converts a thread into ThreadNodes, tagging every node
+// with its type so clients can render placeholders for blocked and
+// not-found posts without inspecting the upstream union shape.
+func normalizeThread(thread *bsky.FeedGetPostThread_Output_Thread) *ThreadNode {
+	if thread == nil {
+		return nil
+	}
+	return threadNode(thread.FeedDefs_ThreadViewPost, thread.FeedDefs_NotFoundPost, thread.FeedDefs_BlockedPost)
+}
+
+// threadNode converts one member of a thread union; it returns nil when
+// the union is empty, e.g. for a type this version doesn't know
+func threadNode(view *bsky.FeedDefs_ThreadViewPost, notFound *bsky.FeedDefs_NotFoundPost, blocked *bsky.FeedDefs_BlockedPost) *ThreadNode {
+	switch {
+	case view != nil:
+		node := &ThreadNode{
+			LexiconTypeID: "app.bsky.feed.defs#threadViewPost",
+			Type:          threadNodePost,
+			Post:          view.Post,
+			ThreadContext: view.ThreadContext,
+		}
+		if view.Post != nil {
+			node.URI = view.Post.Uri
+		}
+		if p := view.Parent; p != nil {
+			node.Parent = threadNode(p.FeedDefs_ThreadViewPost, p.FeedDefs_NotFoundPost, p.FeedDefs_BlockedPost)
+		}
+		for _, r := range view.Replies {
+			if r == nil {
+				continue
+			}
+			if reply := threadNode(r.FeedDefs_ThreadViewPost, r.FeedDefs_NotFoundPost, r.FeedDefs_BlockedPost); reply != nil {
+				node.Replies = append(node.Replies, reply)
+			}
+		}
+		return node
+	case notFound != nil:
+		return &ThreadNode{
+			LexiconTypeID: "app.bsky.feed.defs#notFoundPost",
+			Type:          threadNodeNotFound,
+			URI:           notFound.Uri,
+			NotFound:      true,
+		}
+	case blocked != nil:
+		return &ThreadNode{
+			LexiconTypeID: "app.bsky.feed.defs#blockedPost",
+			Type:          threadNodeBlocked,
+			URI:           blocked.Uri,
+			Blocked:       true,
+			Author:        blocked.Author,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syntheticThread builds a thread whose every post has width replies,
+// depth levels deep
+func syntheticThread(uri string, width, depth int) *bsky.FeedDefs_ThreadViewPost {
+	node := &bsky.FeedDefs_ThreadViewPost{
+		Post: &bsky.FeedDefs_PostView{
+			Uri:       uri,
+			Cid:       "bafy",
+			Author:    &bsky.ActorDefs_ProfileViewBasic{Did: "did:plc:abc123", Handle: "alice.test"},
+			IndexedAt: "2024-01-01T00:00:00Z",
+		},
+	}
+	if depth == 0 {
+		return node
+	}
+	for i := 0; i < width; i++ {
+		node.Replies = append(node.Replies, &bsky.FeedDefs_ThreadViewPost_Replies_Elem{
+			FeedDefs_ThreadViewPost: syntheticThread(fmt.Sprintf("%s/%d", uri, i), width, depth-1),
+		})
+	}
+	return node
+}
+
+// countThread returns the number of posts in each level of a thread
+func countThread(thread *bsky.FeedDefs_ThreadViewPost) []int {
+	var levels []int
+	for level := []*bsky.FeedDefs_ThreadViewPost{thread}; len(level) > 0; {
+		levels = append(levels, len(level))
+		var next []*bsky.FeedDefs_ThreadViewPost
+		for _, node := range level {
+			for _, reply := range node.Replies {
+				next = append(next, reply.FeedDefs_ThreadViewPost)
+			}
+		}
+		level = next
+	}
+	return levels
+}
+
+func TestPruneThread(t *testing.T) {
+	// 1 + 10 + 100 + 1000 posts
+	thread := syntheticThread("at://did:plc:abc123/app.bsky.feed.post/root", 10, 3)
+	assert.True(t, pruneThread(thread, 500))
+
+	// Shallow levels are kept whole and the deepest one is cut
+	assert.Equal(t, []int{1, 10, 100, 389}, countThread(thread))
+
+	// Threads within the cap are untouched
+	small := syntheticThread("at://did:plc:abc123/app.bsky.feed.post/root", 3, 2)
+	assert.False(t, pruneThread(small, 500))
+	assert.Equal(t, []int{1, 3, 9}, countThread(small))
+
+	// Parents count towards the cap
+	withParents := syntheticThread("at://did:plc:abc123/app.bsky.feed.post/root", 10, 1)
+	withParents.Parent = &bsky.FeedDefs_ThreadViewPost_Parent{
+		FeedDefs_ThreadViewPost: &bsky.FeedDefs_ThreadViewPost{
+			Post:   &bsky.FeedDefs_PostView{Uri: "at://did:plc:abc123/app.bsky.feed.post/parent"},
+			Parent: &bsky.FeedDefs_ThreadViewPost_Parent{FeedDefs_NotFoundPost: &bsky.FeedDefs_NotFoundPost{NotFound: true}},
+		},
+	}
+	assert.True(t, pruneThread(withParents, 5))
+	assert.Equal(t, []int{1, 2}, countThread(withParents))
+
+	// Zero disables pruning
+	assert.False(t, pruneThread(syntheticThread("at://did:plc:abc123/app.bsky.feed.post/root", 10, 3), 0))
+}
+
+func TestHandleGetPost_ThreadCap(t *testing.T) {
+	body, err := json.Marshal(&bsky.FeedGetPostThread_Output{
+		Thread: &bsky.FeedGetPostThread_Output_Thread{
+			FeedDefs_ThreadViewPost: syntheticThread("at://did:plc:abc123/app.bsky.feed.post/root", 5, 3),
+		},
+	})
+	require.NoError(t, err)
+
+	stub := newStubTransport().on("app.bsky.feed.getPostThread", http.StatusOK, string(body))
+	srv := newStubServer(stub)
+
+	decode := func(maxNodes int) (bool, []int) {
+		srv.threadMaxNodes = maxNodes
+		rec, err := serveWildcard(srv, srv.handleGetPost, "did:plc:abc123/app.bsky.feed.post/root", "")
+		require.NoError(t, err)
+		var out struct {
+			Thread    bsky.FeedGetPostThread_Output_Thread `json:"thread"`
+			Truncated bool                                 `json:"truncated"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &out))
+		return out.Truncated, countThread(out.Thread.FeedDefs_ThreadViewPost)
+	}
+
+	truncated, levels := decode(20)
+	assert.True(t, truncated)
+	assert.Equal(t, []int{1, 5, 14}, levels)
+
+	truncated, levels = decode(defaultThreadMaxNodes)
+	assert.False(t, truncated)
+	assert.Equal(t, []int{1, 5, 25, 125}, levels)
+}
+
+func TestHandleGetPost_TagsPlaceholders(t *testing.T) {
+	stub := newStubTransport().on("app.bsky.feed.getPostThread", http.StatusOK, `{"thread": {
+		"$type": "app.bsky.feed.defs#threadViewPost",
+		"post": {
+			"uri": "at://did:plc:abc123/app.bsky.feed.post/root",
+			"cid": "bafyroot",
+			"author": {"did": "did:plc:abc123", "handle": "alice.test"},
+			"record": {"$type": "app.bsky.feed.post", "text": "root", "createdAt": "2024-01-01T00:00:00Z"},
+			"indexedAt": "2024-01-01T00:00:00Z"
+		},
+		"parent": {
+			"$type": "app.bsky.feed.defs#notFoundPost",
+			"uri": "at://did:plc:gone/app.bsky.feed.post/deleted",
+			"notFound": true
+		},
+		"replies": [{
+			"$type": "app.bsky.feed.defs#blockedPost",
+			"uri": "at://did:plc:troll/app.bsky.feed.post/reply",
+			"blocked": true,
+			"author": {"did": "did:plc:troll", "viewer": {"blocking": "at://did:plc:abc123/app.bsky.graph.block/1"}}
+		}]
+	}}`)
+	srv := newStubServer(stub)
+
+	rec, err := serveWildcard(srv, srv.handleGetPost, "did:plc:abc123/app.bsky.feed.post/root", "")
+	require.NoError(t, err)
+
+	var out struct {
+		Thread struct {
+			Type    string                     `json:"type"`
+			URI     string                     `json:"uri"`
+			Parent  map[string]json.RawMessage `json:"parent"`
+			Replies []map[string]interface{}   `json:"replies"`
+		} `json:"thread"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &out))
+
+	assert.Equal(t, threadNodePost, out.Thread.Type)
+	assert.Equal(t, "at://did:plc:abc123/app.bsky.feed.post/root", out.Thread.URI)
+	assert.JSONEq(t, `"notFound"`, string(out.Thread.Parent["type"]))
+	assert.JSONEq(t, `"at://did:plc:gone/app.bsky.feed.post/deleted"`, string(out.Thread.Parent["uri"]))
+	assert.NotContains(t, out.Thread.Parent, "post")
+
+	require.Len(t, out.Thread.Replies, 1)
+	reply := out.Thread.Replies[0]
+	assert.Equal(t, threadNodeBlocked, reply["type"])
+	assert.Equal(t, "at://did:plc:troll/app.bsky.feed.post/reply", reply["uri"])
+	assert.Equal(t, "did:plc:troll", reply["author"].(map[string]interface{})["did"])
+
+	// The lexicon union still decodes for existing clients
+	var union struct {
+		Thread bsky.FeedGetPostThread_Output_Thread `json:"thread"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &union))
+	require.NotNil(t, union.Thread.FeedDefs_ThreadViewPost)
+	require.NotNil(t, union.Thread.FeedDefs_ThreadViewPost.Replies[0].FeedDefs_BlockedPost)
+}
+
+func TestHandleGetPost_MissingThread(t *testing.T) {
+	stub := newStubTransport().on("app.bsky.feed.getPostThread", http.StatusOK, `{}`)
+	srv := newStubServer(stub)
+
+	_, err := serveWildcard(srv, srv.handleGetPost, "did:plc:abc123/app.bsky.feed.post/root", "")
+	assert.Equal(t, http.StatusInternalServerError, httpStatus(t, err))
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/labstack/echo/v4"
+)
+
+// handleGetTimeline handles requests for the owner's home timeline, the
+// feed of the accounts they follow as shaped by their preferences. The
+// timeline belongs to the authenticated account and is private, so the
+// route is guarded by the admin token and only exists in PDS mode.
+//
+// Query Parameters:
+//   - cursor: Pagination cursor for fetching more posts
+//   - limit: Page size (see FeedDefaultLimit and FeedMaxLimit)
+//
+// Returns:
+//   - 200 OK with {"cursor": ..., "hasMore": ..., "feed": [...]}
+//   - 400 Bad Request if cursor or limit is invalid
+//   - 401 Unauthorized if the admin token is wrong
+//   - 404 Not Found if no admin token or PDS auth is configured
+//   - 503 Service Unavailable if PDS authentication is degraded
+func (srv *Server) handleGetTimeline(c echo.Context) error {
+	if srv.auth == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "no PDS authentication configured")
+	}
+
+	cursor, err := getCursorFromRequest(c)
+	if err != nil {
+		return err
+	}
+	limit, err := srv.getFeedLimitFromRequest(c)
+	if err != nil {
+		return err
+	}
+
+	// Must be asked as the account itself; no AppView can answer this
+	if err := srv.ensureAuthToken(c); err != nil {
+		slog.Error("failed to ensure auth token", "error", err)
+		return err
+	}
+
+	out, err := bsky.FeedGetTimeline(c.Request().Context(), srv.xrpcc, "", cursor, limit)
+	if err != nil {
+		slog.Error("failed to fetch timeline", "error", err)
+		return upstreamError(c, err)
+	}
+
+	feed := out.Feed
+	if feed == nil {
+		feed = []*bsky.FeedDefs_FeedViewPost{}
+	}
+
+	// Private to the owner; keep it out of every cache
+	c.Response().Header().Set(echo.HeaderCacheControl, "private, no-store")
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"cursor":  out.Cursor,
+		"hasMore": hasMore(out.Cursor),
+		"feed":    feed,
+	})
+}
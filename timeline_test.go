@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleGetTimeline_PDSMode(t *testing.T) {
+	stub := newStubTransport().on("app.bsky.feed.getTimeline", http.StatusOK, `{"cursor": "next", "feed": [{"post": {
+		"uri": "at://did:plc:bob/app.bsky.feed.post/1",
+		"cid": "bafyreib2rxk3rh6kzwq",
+		"author": {"did": "did:plc:bob", "handle": "bob.test"},
+		"record": {"$type": "app.bsky.feed.post", "text": "hi", "createdAt": "2024-01-01T00:00:00Z"},
+		"indexedAt": "2024-01-01T00:00:00Z"
+	}}]}`)
+	srv := newStubServer(stub)
+	srv.adminToken = "s3cret"
+	srv.auth = &AuthConfig{Handle: "alice.test", Password: "test-pass", Token: "access", RefreshAt: time.Now().Add(2 * time.Hour)}
+
+	_, err := serveAdmin(srv, http.MethodGet, srv.handleGetTimeline, "wrong")
+	assert.Equal(t, http.StatusUnauthorized, httpStatus(t, err))
+	assert.Nil(t, stub.lastRequest("app.bsky.feed.getTimeline"))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/timeline?cursor=c1&limit=5", nil)
+	req.Header.Set(adminTokenHeader, "s3cret")
+	rec := httptest.NewRecorder()
+	require.NoError(t, srv.requireAdmin(srv.handleGetTimeline)(srv.e.NewContext(req, rec)))
+	assert.Contains(t, rec.Body.String(), `"cursor":"next"`)
+	assert.Contains(t, rec.Body.String(), `"text":"hi"`)
+	assert.Equal(t, "private, no-store", rec.Header().Get("Cache-Control"))
+
+	// The paging parameters are passed through
+	upstream := stub.lastRequest("app.bsky.feed.getTimeline")
+	require.NotNil(t, upstream)
+	assert.Equal(t, "c1", upstream.URL.Query().Get("cursor"))
+	assert.Equal(t, "5", upstream.URL.Query().Get("limit"))
+
+	// Degraded auth has no fallback for private data
+	srv.degraded.Store(true)
+	_, err = serveAdmin(srv, http.MethodGet, srv.handleGetTimeline, "s3cret")
+	assert.Equal(t, http.StatusServiceUnavailable, httpStatus(t, err))
+}
+
+func TestHandleGetTimeline_AppViewMode(t *testing.T) {
+	stub := newStubTransport()
+	srv := newStubServer(stub)
+
+	// Hidden without an admin token
+	_, err := serveAdmin(srv, http.MethodGet, srv.handleGetTimeline, "anything")
+	assert.Equal(t, http.StatusNotFound, httpStatus(t, err))
+
+	// Still not found with one, since nobody is authenticated
+	srv.adminToken = "s3cret"
+	_, err = serveAdmin(srv, http.MethodGet, srv.handleGetTimeline, "s3cret")
+	assert.Equal(t, http.StatusNotFound, httpStatus(t, err))
+	assert.Empty(t, stub.requests)
+}
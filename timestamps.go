@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/labstack/echo/v4"
+)
+
+// postTimes derives display timestamps for posts relative to one instant,
+// so every post in a response is measured against the same "now"
+type postTimes struct {
+	now time.Time
+	loc *time.Location // Zone for localTime; nil unless ?tz= was given
+}
+
+// timedPostView is a post with its derived timestamps next to indexedAt
+type timedPostView struct {
+	*bsky.FeedDefs_PostView
+	RelativeTime string `json:"relativeTime,omitempty"` // e.g. "2h"; omitted for unparseable timestamps
+	LocalTime    string `json:"localTime,omitempty"`    // indexedAt in the ?tz= zone
+}
+
+// timedFeedViewPost is a feed item whose post carries derived timestamps.
+// Its Post field shadows the embedded one when encoded.
+type timedFeedViewPost struct {
+	*bsky.FeedDefs_FeedViewPost
+	Post *timedPostView `json:"post"`
+}
+
+// getPostTimesFromRequest parses the optional "tz" query parameter, an
+// IANA time zone name such as "Europe/Madrid".
+//
+// Returns:
+//   - The postTimes for the response
+//   - error (400) if the zone is unknown
+func getPostTimesFromRequest(c echo.Context) (postTimes, error) {
+	times := postTimes{now: time.Now()}
+	if tz := c.QueryParam("tz"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return postTimes{}, echo.NewHTTPError(http.StatusBadRequest, "invalid tz: "+tz)
+		}
+		times.loc = loc
+	}
+	return times, nil
+}
+
+// annotateFeed adds the derived timestamps to every post of a feed
+func (pt postTimes) annotateFeed(feed []*bsky.FeedDefs_FeedViewPost) []*timedFeedViewPost {
+	annotated := make([]*timedFeedViewPost, 0, len(feed))
+	for _, item := range feed {
+		annotated = append(annotated, &timedFeedViewPost{
+			FeedDefs_FeedViewPost: item,
+			Post:                  pt.annotate(item.Post),
+		})
+	}
+	return annotated
+}
+
+// annotate adds the derived timestamps to a post. Posts with a missing or
+// malformed indexedAt are returned without them.
+func (pt postTimes) annotate(post *bsky.FeedDefs_PostView) *timedPostView {
+	timed := &timedPostView{FeedDefs_PostView: post}
+	indexedAt, err := time.Parse(time.RFC3339Nano, post.IndexedAt)
+	if err != nil || indexedAt.IsZero() {
+		return timed
+	}
+	timed.RelativeTime = relativeTime(pt.now.Sub(indexedAt))
+	if pt.loc != nil {
+		timed.LocalTime = indexedAt.In(pt.loc).Format(time.RFC3339)
+	}
+	return timed
+}
+
+// relativeTime formats how long ago something happened in the compact
+// style of social feeds: "now", "45s", "5m", "2h", "3d", "4mo", "2y".
+// Timestamps slightly in the future (clock skew) read as "now"; ones
+// further ahead are not meaningful and give "".
+func relativeTime(ago time.Duration) string {
+	const (
+		day   = 24 * time.Hour
+		month = 30 * day
+		year  = 365 * day
+	)
+	switch {
+	case ago < -time.Minute:
+		return ""
+	case ago < 5*time.Second:
+		return "now"
+	case ago < time.Minute:
+		return fmt.Sprintf("%ds", ago/time.Second)
+	case ago < time.Hour:
+		return fmt.Sprintf("%dm", ago/time.Minute)
+	case ago < day:
+		return fmt.Sprintf("%dh", ago/time.Hour)
+	case ago < month:
+		return fmt.Sprintf("%dd", ago/day)
+	case ago < year:
+		return fmt.Sprintf("%dmo", ago/month)
+	default:
+		return fmt.Sprintf("%dy", ago/year)
+	}
+}
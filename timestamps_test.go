@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelativeTime(t *testing.T) {
+	for _, tc := range []struct {
+		ago  time.Duration
+		want string
+	}{
+		{0, "now"},
+		{4 * time.Second, "now"},
+		{-30 * time.Second, "now"}, // Clock skew
+		{-2 * time.Hour, ""},       // Not meaningful
+		{45 * time.Second, "45s"},
+		{time.Minute, "1m"},
+		{59*time.Minute + 59*time.Second, "59m"},
+		{2 * time.Hour, "2h"},
+		{23 * time.Hour, "23h"},
+		{24 * time.Hour, "1d"},
+		{29 * 24 * time.Hour, "29d"},
+		{95 * 24 * time.Hour, "3mo"},
+		{800 * 24 * time.Hour, "2y"},
+	} {
+		assert.Equal(t, tc.want, relativeTime(tc.ago), tc.ago.String())
+	}
+}
+
+func TestPostTimes_Annotate(t *testing.T) {
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	require.NoError(t, err)
+
+	timed := postTimes{now: now}.annotate(&bsky.FeedDefs_PostView{IndexedAt: "2024-01-02T10:00:00.000Z"})
+	assert.Equal(t, "2h", timed.RelativeTime)
+	assert.Empty(t, timed.LocalTime)
+
+	timed = postTimes{now: now, loc: madrid}.annotate(&bsky.FeedDefs_PostView{IndexedAt: "2024-01-02T10:00:00.000Z"})
+	assert.Equal(t, "2024-01-02T11:00:00+01:00", timed.LocalTime)
+
+	// Invalid and zero timestamps get no derived values
+	for _, indexedAt := range []string{"", "yesterday", "0001-01-01T00:00:00Z"} {
+		timed := postTimes{now: now, loc: madrid}.annotate(&bsky.FeedDefs_PostView{IndexedAt: indexedAt})
+		assert.Empty(t, timed.RelativeTime, indexedAt)
+		assert.Empty(t, timed.LocalTime, indexedAt)
+	}
+}
+
+func TestHandleGetFeed_Timestamps(t *testing.T) {
+	indexedAt := time.Now().Add(-3 * time.Hour).UTC().Format(time.RFC3339)
+	stub := newStubTransport().on("app.bsky.feed.getAuthorFeed", http.StatusOK, `{"feed": [{"post": {
+		"uri": "at://did:plc:abc123/app.bsky.feed.post/1",
+		"cid": "bafy1",
+		"author": {"did": "did:plc:abc123", "handle": "alice.test"},
+		"record": {"$type": "app.bsky.feed.post", "text": "hi", "createdAt": "`+indexedAt+`"},
+		"indexedAt": "`+indexedAt+`"
+	}}]}`)
+	srv := newStubServer(stub)
+
+	posts := func(query string) []map[string]interface{} {
+		rec, err := serveParam(srv, srv.handleGetFeed, "did", "did:plc:abc123", query)
+		require.NoError(t, err)
+		var body struct {
+			Feed []struct {
+				Post map[string]interface{} `json:"post"`
+			} `json:"feed"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		var out []map[string]interface{}
+		for _, item := range body.Feed {
+			out = append(out, item.Post)
+		}
+		return out
+	}
+
+	post := posts("")[0]
+	assert.Equal(t, indexedAt, post["indexedAt"])
+	assert.Equal(t, "3h", post["relativeTime"])
+	assert.Equal(t, "at://did:plc:abc123/app.bsky.feed.post/1", post["uri"])
+	assert.NotContains(t, post, "localTime")
+
+	post = posts("tz=Asia/Tokyo")[0]
+	local, err := time.Parse(time.RFC3339, post["localTime"].(string))
+	require.NoError(t, err)
+	_, offset := local.Zone()
+	assert.Equal(t, 9*60*60, offset)
+
+	// The derived timestamps are selectable fields
+	assert.Equal(t, []map[string]interface{}{{"relativeTime": "3h"}}, posts("fields=relativeTime"))
+
+	_, err = serveParam(srv, srv.handleGetFeed, "did", "did:plc:abc123", "tz=Mars/Olympus_Mons")
+	assert.Equal(t, http.StatusBadRequest, httpStatus(t, err))
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/util"
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/bytes"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// userAgentTransport sets the User-Agent of every outbound request,
+// replacing the generic one the xrpc client sends, so PDS and AppView
+// operators can identify athome traffic.
+type userAgentTransport struct {
+	next      http.RoundTripper
+	userAgent string
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the caller's request
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	return t.next.RoundTrip(req)
+}
+
+// requestIDKey is the context key holding the ID of the inbound request
+type requestIDKey struct{}
+
+// withRequestID returns a context carrying the inbound request ID
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestIDFromContext returns the inbound request ID, or "" outside a request
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestIDTransport forwards the inbound request ID as X-Request-Id on
+// outbound requests made with its context, so operators can correlate a
+// client request with the upstream calls it caused.
+type requestIDTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := requestIDFromContext(req.Context())
+	if id == "" {
+		return t.next.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set(echo.HeaderXRequestID, id)
+	return t.next.RoundTrip(req)
+}
+
+// atprotoProxyKey is the context key holding an atproto-proxy target
+type atprotoProxyKey struct{}
+
+// withAtprotoProxy returns a context whose outbound XRPC calls ask the
+// upstream to proxy them to service, a service reference such as
+// "did:web:api.bsky.app#bsky_appview"
+func withAtprotoProxy(ctx context.Context, service string) context.Context {
+	return context.WithValue(ctx, atprotoProxyKey{}, service)
+}
+
+// atprotoProxyTransport sets the atproto-proxy header on outbound
+// requests whose context names a service (see withAtprotoProxy), so a
+// single call can target a specific service while the client is shared.
+type atprotoProxyTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *atprotoProxyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	service, _ := req.Context().Value(atprotoProxyKey{}).(string)
+	if service == "" {
+		return t.next.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("atproto-proxy", service)
+	return t.next.RoundTrip(req)
+}
+
+// parseServiceRef validates an atproto-proxy service reference of the
+// form did#service_id. Empty means no proxying.
+func parseServiceRef(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	did, id, ok := strings.Cut(raw, "#")
+	if _, err := syntax.ParseDID(did); err != nil || !ok || id == "" || strings.ContainsAny(id, "# \t") {
+		return "", fmt.Errorf("invalid service reference %q: expected did#service_id", raw)
+	}
+	return raw, nil
+}
+
+// traceTransport logs every outbound request at debug level, for
+// investigating upstream latency. Query strings are left out of the log
+// since they carry actor identifiers and cursors.
+type traceTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	attrs := []any{
+		"method", req.Method,
+		"host", req.URL.Host,
+		"path", req.URL.Path,
+		"duration", time.Since(start),
+	}
+	if err != nil {
+		slog.Debug("upstream request failed", append(attrs, "error", err)...)
+		return resp, err
+	}
+	slog.Debug("upstream request", append(attrs, "status", resp.StatusCode)...)
+	return resp, nil
+}
+
+// defaultUserAgent describes this build and, when known, the public host
+// it serves, e.g. "athome/v1.2.3 (+https://alice.example.com)".
+func defaultUserAgent(host string) string {
+	ua := "athome/dev"
+	if version != "" {
+		ua = "athome/" + version
+	}
+	if host != "" {
+		ua += " (+https://" + host + ")"
+	}
+	return ua
+}
+
+// upstreamTuning holds the connection pool settings for outbound XRPC
+// requests, which matter when a busy deployment talks to a single AppView,
+// and the cap on their response bodies
+type upstreamTuning struct {
+	MaxIdleConnsPerHost int           // Idle keep-alive connections kept per upstream host
+	IdleConnTimeout     time.Duration // How long an idle connection is kept before closing
+	DialTimeout         time.Duration // Establishing a TCP connection
+	MaxResponseBytes    int64         // Largest response body read; 0 disables the cap
+}
+
+// defaultUpstreamTuning matches the pooled transport of indigo's
+// RobustHTTPClient, which this client used before it was tunable
+var defaultUpstreamTuning = upstreamTuning{
+	MaxIdleConnsPerHost: runtime.GOMAXPROCS(0) + 1,
+	IdleConnTimeout:     90 * time.Second,
+	DialTimeout:         30 * time.Second,
+	MaxResponseBytes:    defaultUpstreamMaxResponse,
+}
+
+// defaultUpstreamMaxResponse caps upstream response bodies
+// (ATHOME_UPSTREAM_MAX_RESPONSE); a full feed page is well under 1MB. The
+// flag default is formatted from it, so both always agree.
+const defaultUpstreamMaxResponse = 16 * bytes.MB
+
+// responseTooLargeError is returned when an upstream response body runs
+// past the configured cap
+type responseTooLargeError struct {
+	host  string
+	limit int64
+}
+
+func (e *responseTooLargeError) Error() string {
+	return fmt.Sprintf("upstream %s sent a response larger than %d bytes", e.host, e.limit)
+}
+
+// limitedBody fails reads once more than limit bytes have been read, and
+// every read after that
+type limitedBody struct {
+	io.ReadCloser
+	host     string
+	limit    int64
+	read     int64
+	exceeded bool
+}
+
+// Read implements io.Reader
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, &responseTooLargeError{host: b.host, limit: b.limit}
+	}
+	// Read at most one byte past the limit, to tell a body of exactly
+	// limit bytes from a longer one
+	if allowed := b.limit - b.read + 1; int64(len(p)) > allowed {
+		p = p[:allowed]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if b.read > b.limit {
+		b.exceeded = true
+		return max(0, n-int(b.read-b.limit)), &responseTooLargeError{host: b.host, limit: b.limit}
+	}
+	return n, err
+}
+
+// limitResponseTransport caps the response bodies of outbound requests,
+// since indigo reads them fully into memory. Bodies announcing a larger
+// Content-Length fail at once; others fail on the read past the limit.
+type limitResponseTransport struct {
+	next  http.RoundTripper
+	limit int64
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *limitResponseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if resp.ContentLength > t.limit {
+		resp.Body.Close()
+		return nil, &responseTooLargeError{host: req.URL.Host, limit: t.limit}
+	}
+	resp.Body = &limitedBody{ReadCloser: resp.Body, host: req.URL.Host, limit: t.limit}
+	return resp, nil
+}
+
+// transport builds the pooled http.Transport for the tuning
+func (t upstreamTuning) transport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   t.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.MaxIdleConnsPerHost = t.MaxIdleConnsPerHost
+	transport.IdleConnTimeout = t.IdleConnTimeout
+	return transport
+}
+
+// tracedTransport gives every request an OpenTelemetry span through
+// otelhttp, keeping the pooled transport beneath it at hand since
+// otelhttp.Transport does not expose it
+type tracedTransport struct {
+	*otelhttp.Transport
+	pool *http.Transport
+}
+
+// newTracedTransport wraps pool in otelhttp
+func newTracedTransport(pool *http.Transport) *tracedTransport {
+	return &tracedTransport{Transport: otelhttp.NewTransport(pool), pool: pool}
+}
+
+// retryLogger sends the retry client's messages to slog. As in indigo's
+// LeveledSlog, errors and warnings (failed attempts, giving up) are logged
+// as warnings and the rest at debug level, since retries are routine.
+type retryLogger struct{}
+
+func (retryLogger) Error(msg string, keysAndValues ...interface{}) {
+	slog.Warn(msg, keysAndValues...)
+}
+
+func (retryLogger) Warn(msg string, keysAndValues ...interface{}) {
+	slog.Warn(msg, keysAndValues...)
+}
+
+func (retryLogger) Info(msg string, keysAndValues ...interface{}) {
+	slog.Debug(msg, keysAndValues...)
+}
+
+func (retryLogger) Debug(msg string, keysAndValues ...interface{}) {
+	slog.Debug(msg, keysAndValues...)
+}
+
+// newHTTPClient returns the HTTP client used for XRPC requests, sending
+// userAgent and the inbound request ID with every request. With trace set, each request is logged at
+// debug level; the logged duration includes any retries. A non-nil breaker
+// short-circuits requests to failing hosts; retries count as one attempt.
+// Connections are pooled as configured by tuning; retries follow indigo's
+// RobustHTTPClient, leaving 429s to the caller, and each attempt gets an
+// OpenTelemetry span as it does there.
+func newHTTPClient(userAgent string, trace bool, breaker *circuitBreaker, tuning upstreamTuning) *http.Client {
+	retryClient := retryablehttp.NewClient()
+	retryClient.HTTPClient.Transport = newTracedTransport(tuning.transport())
+	retryClient.RetryMax = 3
+	retryClient.RetryWaitMin = 1 * time.Second
+	retryClient.RetryWaitMax = 10 * time.Second
+	retryClient.Logger = retryLogger{}
+	retryClient.CheckRetry = util.XRPCRetryPolicy
+
+	client := retryClient.StandardClient()
+	client.Timeout = 30 * time.Second
+	client.Transport = &userAgentTransport{next: client.Transport, userAgent: userAgent}
+	client.Transport = &requestIDTransport{next: client.Transport}
+	client.Transport = &atprotoProxyTransport{next: client.Transport}
+	if breaker != nil {
+		client.Transport = &breakerTransport{next: client.Transport, breaker: breaker}
+	}
+	// Outside the breaker: an oversized response is not a failing host
+	if tuning.MaxResponseBytes > 0 {
+		client.Transport = &limitResponseTransport{next: client.Transport, limit: tuning.MaxResponseBytes}
+	}
+	if trace {
+		client.Transport = &traceTransport{next: client.Transport}
+	}
+	return client
+}
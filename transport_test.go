@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/labstack/echo/v4"
+	gommonbytes "github.com/labstack/gommon/bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserAgentTransport(t *testing.T) {
+	stub := newStubTransport().on("app.bsky.actor.getProfile", http.StatusOK, `{"did": "did:plc:abc123", "handle": "alice.test"}`)
+	client := &xrpc.Client{
+		Host:   "https://mock.bsky.test",
+		Client: &http.Client{Transport: &userAgentTransport{next: stub, userAgent: "athome/v1.2.3 (+https://alice.test)"}},
+	}
+
+	_, err := bsky.ActorGetProfile(context.Background(), client, "did:plc:abc123")
+	require.NoError(t, err)
+
+	req := stub.lastRequest("app.bsky.actor.getProfile")
+	require.NotNil(t, req)
+	assert.Equal(t, "athome/v1.2.3 (+https://alice.test)", req.Header.Get("User-Agent"))
+}
+
+func TestDefaultUserAgent(t *testing.T) {
+	assert.Equal(t, "athome/dev", defaultUserAgent(""))
+
+	version = "v1.2.3"
+	t.Cleanup(func() { version = "" })
+	assert.Equal(t, "athome/v1.2.3 (+https://alice.test)", defaultUserAgent("alice.test"))
+}
+
+func TestTraceTransport(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer slog.SetDefault(prev)
+
+	stub := newStubTransport().on("app.bsky.actor.getProfile", http.StatusOK, `{"did": "did:plc:abc123", "handle": "alice.test"}`)
+	client := &xrpc.Client{
+		Host:   "https://mock.bsky.test",
+		Client: &http.Client{Transport: &traceTransport{next: stub}},
+	}
+
+	_, err := bsky.ActorGetProfile(context.Background(), client, "did:plc:abc123")
+	require.NoError(t, err)
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "DEBUG", entry["level"])
+	assert.Equal(t, "upstream request", entry["msg"])
+	assert.Equal(t, http.MethodGet, entry["method"])
+	assert.Equal(t, "mock.bsky.test", entry["host"])
+	assert.Equal(t, "/xrpc/app.bsky.actor.getProfile", entry["path"])
+	assert.Equal(t, float64(http.StatusOK), entry["status"])
+	assert.Contains(t, entry, "duration")
+	assert.NotContains(t, buf.String(), "did:plc:abc123", "query strings are not logged")
+
+	// Transport failures are traced with the error
+	buf.Reset()
+	_, err = bsky.ActorGetProfile(context.Background(), &xrpc.Client{
+		Host:   "https://mock.bsky.test",
+		Client: &http.Client{Transport: &traceTransport{next: roundTripFunc(func(*http.Request) (*http.Response, error) { return nil, errors.New("connection refused") })}},
+	}, "did:plc:abc123")
+	require.Error(t, err)
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "upstream request failed", entry["msg"])
+	assert.Equal(t, "connection refused", entry["error"])
+}
+
+func TestRequestIDPropagation(t *testing.T) {
+	stub := newStubTransport().on("app.bsky.actor.getProfile", http.StatusOK, `{"did": "did:plc:abc123", "handle": "alice.test"}`)
+	srv, err := setupServer(":0", &xrpc.Client{
+		Host:   "https://mock.bsky.test",
+		Client: &http.Client{Transport: &requestIDTransport{next: stub}},
+	}, nil, nil, nil, "", nil)
+	require.NoError(t, err)
+
+	// A client-supplied ID is forwarded upstream and echoed back
+	req := httptest.NewRequest(http.MethodGet, "/api/profile/did/did:plc:abc123", nil)
+	req.Header.Set(echo.HeaderXRequestID, "req-123")
+	rec := httptest.NewRecorder()
+	srv.e.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "req-123", rec.Header().Get(echo.HeaderXRequestID))
+	assert.Equal(t, "req-123", stub.lastRequest("app.bsky.actor.getProfile").Header.Get(echo.HeaderXRequestID))
+
+	// Otherwise a generated ID is used for both
+	srv.profiles = nil
+	rec = httptest.NewRecorder()
+	srv.e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/profile/did/did:plc:abc123", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	generated := rec.Header().Get(echo.HeaderXRequestID)
+	assert.NotEmpty(t, generated)
+	assert.Equal(t, generated, stub.lastRequest("app.bsky.actor.getProfile").Header.Get(echo.HeaderXRequestID))
+}
+
+// pooledTransport digs the connection pool out of a client built by newHTTPClient
+func pooledTransport(t *testing.T, client *http.Client) *http.Transport {
+	rt := client.Transport
+	for {
+		switch next := rt.(type) {
+		case *traceTransport:
+			rt = next.next
+		case *breakerTransport:
+			rt = next.next
+		case *requestIDTransport:
+			rt = next.next
+		case *atprotoProxyTransport:
+			rt = next.next
+		case *limitResponseTransport:
+			rt = next.next
+		case *userAgentTransport:
+			rt = next.next
+		case *retryablehttp.RoundTripper:
+			rt = next.Client.HTTPClient.Transport
+		case *tracedTransport:
+			// Every attempt, retries included, is traced
+			require.NotNil(t, next.Transport)
+			return next.pool
+		default:
+			t.Fatalf("unexpected transport %T", rt)
+		}
+	}
+}
+
+func TestNewHTTPClient_Tuning(t *testing.T) {
+	tuning := upstreamTuning{
+		MaxIdleConnsPerHost: 64,
+		IdleConnTimeout:     5 * time.Minute,
+		DialTimeout:         3 * time.Second,
+	}
+	client := newHTTPClient("athome/test", true, newCircuitBreaker(5, time.Minute), tuning)
+
+	transport := pooledTransport(t, client)
+	assert.Equal(t, 64, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 5*time.Minute, transport.IdleConnTimeout)
+	assert.NotNil(t, transport.DialContext)
+
+	// The defaults keep the previous pooled transport settings
+	transport = pooledTransport(t, newHTTPClient("athome/test", false, nil, defaultUpstreamTuning))
+	assert.Equal(t, defaultUpstreamTuning.MaxIdleConnsPerHost, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 90*time.Second, transport.IdleConnTimeout)
+}
+
+func TestParseServiceRef(t *testing.T) {
+	ref, err := parseServiceRef(" did:web:api.bsky.app#bsky_appview ")
+	require.NoError(t, err)
+	assert.Equal(t, "did:web:api.bsky.app#bsky_appview", ref)
+
+	ref, err = parseServiceRef("")
+	require.NoError(t, err)
+	assert.Empty(t, ref)
+
+	for _, raw := range []string{"did:web:api.bsky.app", "did:web:api.bsky.app#", "api.bsky.app#bsky_appview", "did:web:api.bsky.app#a#b"} {
+		_, err := parseServiceRef(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestAtprotoProxyFeedGenerator(t *testing.T) {
+	stub := newStubTransport().on("app.bsky.feed.getFeed", http.StatusOK, `{"feed": []}`).
+		on("app.bsky.actor.getProfile", http.StatusOK, `{"did": "did:plc:abc123", "handle": "alice.test"}`)
+	srv := newStubServer(stub)
+	srv.xrpcc.Client.Transport = &atprotoProxyTransport{next: stub}
+	srv.feedProxy = "did:web:api.bsky.app#bsky_appview"
+
+	_, err := serveWildcard(srv, srv.handleGetFeedGenerator, "did:plc:abc123/app.bsky.feed.generator/whats-hot", "")
+	require.NoError(t, err)
+	assert.Equal(t, "did:web:api.bsky.app#bsky_appview", stub.lastRequest("app.bsky.feed.getFeed").Header.Get("atproto-proxy"))
+
+	// Other calls on the same client are not proxied
+	_, err = serveParam(srv, srv.handleGetProfile, "did", "did:plc:abc123", "")
+	require.NoError(t, err)
+	assert.Empty(t, stub.lastRequest("app.bsky.actor.getProfile").Header.Get("atproto-proxy"))
+
+	// Nor is the feed generator fetch without a configured service
+	srv.feedProxy = ""
+	_, err = serveWildcard(srv, srv.handleGetFeedGenerator, "did:plc:abc123/app.bsky.feed.generator/whats-hot", "")
+	require.NoError(t, err)
+	assert.Empty(t, stub.lastRequest("app.bsky.feed.getFeed").Header.Get("atproto-proxy"))
+}
+
+func TestLimitResponseTransport(t *testing.T) {
+	body := `{"did": "did:plc:abc123", "handle": "alice.test", "description": "` + strings.Repeat("x", 200) + `"}`
+	client := func(limit int64, stub http.RoundTripper) *xrpc.Client {
+		return &xrpc.Client{
+			Host:   "https://mock.bsky.test",
+			Client: &http.Client{Transport: &limitResponseTransport{next: stub, limit: limit}},
+		}
+	}
+	getProfile := func(xc *xrpc.Client) error {
+		var out ProfileView
+		return xc.Do(context.Background(), xrpc.Query, "", "app.bsky.actor.getProfile", map[string]interface{}{"actor": "did:plc:abc123"}, nil, &out)
+	}
+
+	// Bodies up to the limit are read as usual
+	stub := newStubTransport().on("app.bsky.actor.getProfile", http.StatusOK, body)
+	require.NoError(t, getProfile(client(int64(len(body)), stub)))
+
+	// A longer body without Content-Length fails on the read past the limit
+	err := getProfile(client(100, stub))
+	var tooLarge *responseTooLargeError
+	require.ErrorAs(t, err, &tooLarge)
+	assert.Equal(t, int64(100), tooLarge.limit)
+
+	// An announced Content-Length over the limit fails before reading
+	announced := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode:    http.StatusOK,
+			ContentLength: 1 << 30,
+			Body:          io.NopCloser(strings.NewReader(body)),
+			Header:        http.Header{"Content-Type": {"application/json"}},
+			Request:       req,
+		}, nil
+	})
+	require.ErrorAs(t, getProfile(client(100, announced)), &tooLarge)
+
+	// Reads past the limit keep failing without a negative count, which
+	// io.Reader forbids and bytes.Buffer panics on
+	lb := &limitedBody{ReadCloser: io.NopCloser(strings.NewReader(body)), host: "mock.bsky.test", limit: 10}
+	p := make([]byte, 64)
+	n, err := lb.Read(p)
+	assert.Equal(t, 10, n)
+	require.ErrorAs(t, err, &tooLarge)
+	for i := 0; i < 2; i++ {
+		n, err = lb.Read(p)
+		assert.Equal(t, 0, n)
+		require.ErrorAs(t, err, &tooLarge)
+	}
+	var buf bytes.Buffer
+	_, err = buf.ReadFrom(&limitedBody{ReadCloser: io.NopCloser(strings.NewReader(body)), limit: 10})
+	require.ErrorAs(t, err, &tooLarge)
+	assert.Equal(t, 10, buf.Len())
+
+	// The flag default and the tuning default are the same size
+	def, err := gommonbytes.Parse(gommonbytes.FormatDecimal(defaultUpstreamMaxResponse))
+	require.NoError(t, err)
+	assert.Equal(t, defaultUpstreamTuning.MaxResponseBytes, def)
+
+	// Handlers report the oversized response as a bad gateway
+	srv := newStubServer(stub)
+	srv.xrpcc = client(100, stub)
+	_, err = serveParam(srv, srv.handleGetProfile, "did", "did:plc:abc123", "")
+	assert.Equal(t, http.StatusBadGateway, httpStatus(t, err))
+}
+
+func TestLimitResponseTransport_NotABreakerFailure(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1000")
+		w.Write([]byte(strings.Repeat("x", 1000)))
+	}))
+	defer ts.Close()
+
+	// One failure would open the circuit, yet oversized responses keep
+	// reaching the upstream
+	tuning := defaultUpstreamTuning
+	tuning.MaxResponseBytes = 100
+	client := newHTTPClient("athome/test", false, newCircuitBreaker(1, time.Minute), tuning)
+	for i := 0; i < 3; i++ {
+		_, err := client.Get(ts.URL)
+		var tooLarge *responseTooLargeError
+		require.ErrorAs(t, err, &tooLarge, "attempt %d", i)
+	}
+}
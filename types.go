@@ -2,9 +2,16 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"encoding/xml"
+	"io/fs"
+	"log/slog"
+	"net/netip"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/bluesky-social/indigo/api/bsky"
 	"github.com/bluesky-social/indigo/atproto/identity"
 	"github.com/bluesky-social/indigo/xrpc"
 	"github.com/labstack/echo/v4"
@@ -13,13 +20,106 @@ import (
 // Server represents the main application server
 type Server struct {
 	e               *echo.Echo
-	xrpcc           *xrpc.Client
+	xrpcc           *xrpc.Client // Primary client; authenticated against the PDS in PDS mode
+	readc           *xrpc.Client // Optional unauthenticated AppView client for hydrated reads
 	dir             identity.Directory
-	validHandles    []string
+	validHandles    []string     // Guarded by handlesMu; use allowedHandles()
+	handlesMu       sync.RWMutex // Protects validHandles, which can be reloaded on SIGHUP
+	validDIDs       []string
 	auth            *AuthConfig
 	authMutex       sync.RWMutex       // Protects auth token refresh operations
 	refreshCancel   context.CancelFunc // For cancelling background token refresh
 	enablePortfolio bool               // Flag to enable/disable portfolio feature
+
+	// Upstream reads; nil uses XRPC through readClient (see fetch.go)
+	profileSource ProfileFetcher
+	feedSource    FeedFetcher
+	feedProxy     string // atproto-proxy service for feed generator fetches (ATHOME_FEED_PROXY); empty disables
+
+	// Frontend serving
+	publicFS    fs.FS         // Built frontend, embedded or from ATHOME_PUBLIC_DIR
+	index       *indexCache   // Parsed index.html template
+	siteTitle   string        // Base document title (ATHOME_SITE_TITLE)
+	titleFormat string        // Per-profile title format (ATHOME_TITLE_FORMAT)
+	tagline     string        // Site tagline for /api/about (ATHOME_TAGLINE)
+	contact     string        // Contact link for /api/about (ATHOME_CONTACT)
+	robotsTxt   string        // Custom robots.txt content; generated when empty
+	assetMaxAge time.Duration // How long browsers may cache /assets (ATHOME_ASSET_MAX_AGE); 0 disables
+
+	// Client caching
+	routeMaxAges []routeMaxAge // How long clients may cache API responses, by route prefix, longest first (ATHOME_CACHE_MAX_AGES)
+
+	// Content Security Policy
+	cspAllowExternalImg bool     // Allow images from any HTTPS host (ATHOME_CSP_ALLOW_EXTERNAL_IMG)
+	cspConnectExtra     []string // Additional connect-src origins or hosts (ATHOME_CSP_CONNECT_EXTRA)
+
+	// Identity freshness
+	handleRecheckInterval time.Duration          // How often configured handles are re-resolved; 0 disables
+	primaryDID            atomic.Pointer[string] // DID of the primary handle, resolved at startup or on first request; served at /.well-known/atproto-did
+
+	// Caches
+	profiles       *ttlCache[*ProfileView]    // Profiles keyed by DID
+	sitemaps       *ttlCache[[]byte]          // Rendered sitemap.xml keyed by base URL
+	feeds          *swrCache[*authorFeedPage] // Author feed pages (see feedCacheKey); nil disables
+	sitemapMaxURLs int                        // Cap on URLs listed in sitemap.xml
+	purgeables     []Purgeable                // Extra caches cleared by purgeIdentity; guarded by purgeMu
+	purgeMu        sync.Mutex                 // Serializes purgeIdentity
+
+	// Live updates
+	live       *liveHub // Fans out new posts to /ws and /sse clients
+	enableLive bool     // Flag to enable/disable live updates (ATHOME_ENABLE_LIVE)
+
+	// Request limits
+	bodyLimit    int64         // Maximum request body size in bytes (ATHOME_BODY_LIMIT)
+	apiBodyLimit int64         // Maximum request body size for /api routes (ATHOME_API_BODY_LIMIT)
+	inFlight     chan struct{} // Semaphore capping concurrent /api requests (ATHOME_MAX_IN_FLIGHT); nil disables
+
+	// Response shaping
+	strictFields bool // Reject unknown ?fields= names with 400 instead of ignoring them
+
+	// Thread size
+	threadMaxNodes int // Posts returned for one thread before pruning (ATHOME_THREAD_MAX_NODES); 0 disables
+
+	// Feed paging
+	FeedDefaultLimit int64 // Page size used by feed endpoints when no limit is given
+	FeedMaxLimit     int64 // Largest page size feed endpoints will request upstream
+	FeedMaxFetches   int   // Upstream pages read to fill one author feed page
+
+	// Token refresh statistics
+	refreshSuccesses atomic.Int64 // Number of successful token refreshes
+	refreshFailures  atomic.Int64 // Number of failed token refreshes
+
+	// Degraded mode when PDS authentication keeps failing
+	fallbackc           *xrpc.Client // Unauthenticated AppView client serving reads while degraded
+	fallbackAfter       int          // Consecutive refresh failures before degrading; 0 disables
+	consecutiveFailures atomic.Int64 // Refresh failures since the last success
+	degraded            atomic.Bool  // Set while reads are served by fallbackc
+
+	// Reverse proxies
+	disableHostFallback bool           // Require an explicit handle instead of using the Host (ATHOME_DISABLE_HOST_FALLBACK)
+	defaultHandle       string         // Handle used when a request names none and the Host is no handle (ATHOME_DEFAULT_HANDLE)
+	canonicalHost       string         // Host other hostnames redirect to (ATHOME_CANONICAL_HOST); disabled when empty
+	handleHeader        string         // Header a trusted proxy uses to name the handle (ATHOME_HANDLE_HEADER)
+	recordCollections   []string       // Collections /api/record/* may read (ATHOME_RECORD_COLLECTIONS)
+	trustedProxies      []netip.Prefix // Peers allowed to set handleHeader (ATHOME_TRUSTED_PROXIES)
+
+	// Reloaded on SIGHUP (see reload.go)
+	handlesFile  string         // Allowlist file (ATHOME_VALID_HANDLES_FILE); validHandles is static when empty
+	reloadConfig string         // Config file whose log-level is re-read; empty when the level is pinned
+	logLevel     *slog.LevelVar // Level of the default logger; nil when not adjustable
+
+	// Private instances
+	basicAuthUser     string // Username required site-wide (ATHOME_BASIC_AUTH_USER); disabled when empty
+	basicAuthPassword string // Password for basicAuthUser (ATHOME_BASIC_AUTH_PASSWORD)
+
+	// Health check
+	healthDetail string // Who sees daemon and build details (ATHOME_HEALTH_DETAIL); see healthDetailPublic
+	healthSecret string // Secret unlocking details in healthDetailSecret mode (ATHOME_HEALTH_SECRET)
+
+	// Operator endpoints
+	adminToken  string                         // Shared secret for /admin routes (ATHOME_ADMIN_TOKEN); disabled when empty
+	lastRefresh atomic.Pointer[RefreshOutcome] // Outcome of the most recent token refresh
+	metrics     *metrics                       // Prometheus metrics (/admin/metrics)
 }
 
 // AuthConfig manages PDS authentication and token refresh
@@ -32,18 +132,168 @@ type AuthConfig struct {
 	Handle string `json:"handle"`
 	// User password for authentication
 	Password string `json:"password"`
+	// Fingerprint of the credentials for status and logs (see credentialFingerprint)
+	CredentialFingerprint string `json:"credential_fingerprint,omitempty"`
+	// Secret keying the fingerprint; random per process when empty
+	FingerprintKey string `json:"-"`
 	// Current access token (managed by refreshAuth)
 	Token string `json:"token,omitempty"`
 	// Refresh token for session renewal
 	RefreshToken string `json:"refresh_token,omitempty"`
+	// Expiry of the current access token, zero if unknown (see scheduleRefresh)
+	TokenExpiry time.Time `json:"-"`
 	// Time when token should be refreshed
 	RefreshAt time.Time `json:"refresh_at,omitempty"`
 }
 
+// AdminStatus is the non-secret authentication state shown on /admin/status
+type AdminStatus struct {
+	Mode             string          `json:"mode"`
+	Handle           string          `json:"handle,omitempty"`
+	PDS              string          `json:"pds,omitempty"`
+	Credential       string          `json:"credential,omitempty"`     // Fingerprint of the PDS credentials
+	CredentialKind   string          `json:"credentialKind,omitempty"` // app-password, privileged-app-password or account-password
+	HasToken         bool            `json:"hasToken"`
+	HasRefreshToken  bool            `json:"hasRefreshToken"`
+	RefreshAt        *time.Time      `json:"refreshAt,omitempty"`
+	RefreshIn        string          `json:"refreshIn,omitempty"`
+	Degraded         bool            `json:"degraded"`
+	RefreshSucceeded int64           `json:"refreshSucceeded"`
+	RefreshFailed    int64           `json:"refreshFailed"`
+	LastRefresh      *RefreshOutcome `json:"lastRefresh,omitempty"`
+}
+
+// RefreshOutcome records the result of a token refresh attempt
+type RefreshOutcome struct {
+	At      time.Time `json:"at"`
+	Success bool      `json:"success"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// ProfileView is a hydrated profile including its verification state,
+// which the pinned indigo lexicons predate
+type ProfileView struct {
+	bsky.ActorDefs_ProfileViewDetailed
+	Verification *VerificationState `json:"verification,omitempty"`
+}
+
+// VerificationState is app.bsky.actor.defs#verificationState
+type VerificationState struct {
+	Verifications         []VerificationView `json:"verifications"`
+	VerifiedStatus        string             `json:"verifiedStatus"`
+	TrustedVerifierStatus string             `json:"trustedVerifierStatus"`
+}
+
+// VerificationView is app.bsky.actor.defs#verificationView, one
+// verification of the profile by a trusted verifier
+type VerificationView struct {
+	Issuer    string `json:"issuer"`
+	URI       string `json:"uri"`
+	IsValid   bool   `json:"isValid"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// ProfileVerification is the verification block of a profile response
+type ProfileVerification struct {
+	Verified        bool     `json:"verified"`
+	TrustedVerifier bool     `json:"trustedVerifier"`
+	Verifiers       []string `json:"verifiers,omitempty"`
+}
+
+// ThreadNode is one node of a post thread, tagged with its type
+// (threadNodePost, threadNodeNotFound or threadNodeBlocked). Placeholders
+// carry only the URI and, for blocks, the blocked author. The lexicon
+// $type is kept so clients decoding the upstream union keep working.
+type ThreadNode struct {
+	LexiconTypeID string                       `json:"$type"`
+	Type          string                       `json:"type"`
+	URI           string                       `json:"uri,omitempty"`
+	Post          *bsky.FeedDefs_PostView      `json:"post,omitempty"`
+	NotFound      bool                         `json:"notFound,omitempty"`
+	Blocked       bool                         `json:"blocked,omitempty"`
+	Author        *bsky.FeedDefs_BlockedAuthor `json:"author,omitempty"`
+	ThreadContext *bsky.FeedDefs_ThreadContext `json:"threadContext,omitempty"`
+	Parent        *ThreadNode                  `json:"parent,omitempty"`
+	Replies       []*ThreadNode                `json:"replies,omitempty"`
+}
+
+// DIDDocument is the parsed subset of an actor's DID document
+type DIDDocument struct {
+	DID         string                `json:"did"`
+	Handle      string                `json:"handle"`
+	AlsoKnownAs []string              `json:"alsoKnownAs"`
+	PDS         string                `json:"pds,omitempty"`
+	Services    map[string]DIDService `json:"services"`
+	Keys        map[string]DIDKey     `json:"keys"`
+}
+
+// Resolution is a handle or DID resolved through the directory (/api/resolve)
+type Resolution struct {
+	DID    string `json:"did"`
+	Handle string `json:"handle"`        // "handle.invalid" if the DID's handle does not verify
+	PDS    string `json:"pds,omitempty"` // Only for DID inputs
+}
+
+// DIDService is a service endpoint declared in a DID document
+type DIDService struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+// DIDKey is a verification method declared in a DID document
+type DIDKey struct {
+	Type               string `json:"type"`
+	PublicKeyMultibase string `json:"publicKeyMultibase"`
+}
+
 // GenericStatus represents a basic status response
 type GenericStatus struct {
-	Status string `json:"status"`
-	Daemon string `json:"daemon"`
+	Status string     `json:"status"`
+	Daemon string     `json:"daemon,omitempty"`
+	Build  *BuildInfo `json:"build,omitempty"`
+}
+
+// BuildInfo identifies the running build, from values injected with -ldflags
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"buildTime"`
+	Mode      string `json:"mode"`
+}
+
+// RuntimeConfig is the frontend's runtime configuration (/api/config)
+type RuntimeConfig struct {
+	DefaultHandle    string          `json:"defaultHandle"` // Handle from the proxy header or hostname, if any
+	Mode             string          `json:"mode"`
+	Features         RuntimeFeatures `json:"features"`
+	FeedDefaultLimit int64           `json:"feedDefaultLimit"`
+	FeedMaxLimit     int64           `json:"feedMaxLimit"`
+}
+
+// RuntimeFeatures lists the optional features enabled on the server
+type RuntimeFeatures struct {
+	Portfolio bool `json:"portfolio"`
+	Live      bool `json:"live"`
+}
+
+// About is the deployment's public metadata (/api/about)
+type About struct {
+	Handle   string          `json:"handle,omitempty"`  // Owner's handle (see primaryHandle)
+	Tagline  string          `json:"tagline,omitempty"` // ATHOME_TAGLINE
+	Contact  string          `json:"contact,omitempty"` // ATHOME_CONTACT, an http(s) or mailto URL
+	Features RuntimeFeatures `json:"features"`
+}
+
+// Description is the API's self-description (/api/describe)
+type Description struct {
+	Routes   []RouteDescription `json:"routes"`
+	Features RuntimeFeatures    `json:"features"`
+}
+
+// RouteDescription is one registered API route
+type RouteDescription struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
 }
 
 // PortfolioConfig represents the portfolio feature configuration
@@ -64,3 +314,51 @@ type PortfolioItem struct {
 	Image       string    `json:"image,omitempty"`
 	CreatedAt   time.Time `json:"createdAt"`
 }
+
+// SitemapURLSet is the root element of a sitemap.xml document
+type SitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	URLs    []SitemapURL `xml:"url"`
+}
+
+// SitemapURL is a single page listed in sitemap.xml
+type SitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// FeedGenerator is the compact shape of a custom feed generator
+type FeedGenerator struct {
+	URI         string  `json:"uri"`
+	DisplayName string  `json:"displayName"`
+	Description *string `json:"description,omitempty"`
+	Avatar      *string `json:"avatar,omitempty"`
+	LikeCount   *int64  `json:"likeCount,omitempty"`
+}
+
+// MediaPost is a post with its media flattened for gallery views
+type MediaPost struct {
+	URI       string      `json:"uri"`
+	CID       string      `json:"cid"`
+	IndexedAt string      `json:"indexedAt"`
+	Media     []MediaItem `json:"media"`
+}
+
+// MediaItem is a single image or video attached to a post
+type MediaItem struct {
+	Type        string  `json:"type"`
+	URL         string  `json:"url"`
+	Thumb       string  `json:"thumb,omitempty"`
+	Alt         string  `json:"alt"`
+	AspectRatio float64 `json:"aspectRatio,omitempty"`
+}
+
+// LivePost is a newly published post pushed to live clients
+type LivePost struct {
+	URI       string          `json:"uri"`
+	CID       string          `json:"cid"`
+	DID       string          `json:"did"`
+	Record    json.RawMessage `json:"record"`
+	IndexedAt time.Time       `json:"indexedAt"`
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Build metadata, injected at build time with
+//
+//	go build -ldflags "-X main.version=v1.2.3 -X main.commit=abc123 -X main.buildTime=2025-01-01T00:00:00Z"
+//
+// All three are empty in development builds.
+var (
+	version   string
+	commit    string
+	buildTime string
+)
+
+// buildInfo describes the running binary and its operating mode
+func (srv *Server) buildInfo() *BuildInfo {
+	mode := modeAppView
+	if srv.auth != nil {
+		mode = modePDS
+	}
+	return &BuildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildTime: buildTime,
+		Mode:      mode,
+	}
+}
+
+// handleGetVersion reports which build is running.
+//
+// Returns:
+//   - 200 OK with BuildInfo
+func (srv *Server) handleGetVersion(c echo.Context) error {
+	return c.JSON(http.StatusOK, srv.buildInfo())
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleGetVersion(t *testing.T) {
+	srv := &Server{e: echo.New()}
+
+	serve := func(h echo.HandlerFunc) map[string]interface{} {
+		rec := httptest.NewRecorder()
+		require.NoError(t, h(srv.e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		return body
+	}
+
+	// Test binaries are built without -ldflags, so the build fields are empty
+	assert.Equal(t, map[string]interface{}{
+		"version":   "",
+		"commit":    "",
+		"buildTime": "",
+		"mode":      modeAppView,
+	}, serve(srv.handleGetVersion))
+
+	// Injected values and the PDS mode are reported, also by the health check
+	version, commit, buildTime = "v1.2.3", "abc123", "2025-01-01T00:00:00Z"
+	t.Cleanup(func() { version, commit, buildTime = "", "", "" })
+	srv.auth = &AuthConfig{Handle: "alice.test"}
+
+	health := serve(srv.HandleHealthCheck)
+	assert.Equal(t, "ok", health["status"])
+	assert.Equal(t, map[string]interface{}{
+		"version":   "v1.2.3",
+		"commit":    "abc123",
+		"buildTime": "2025-01-01T00:00:00Z",
+		"mode":      modePDS,
+	}, health["build"])
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/labstack/echo/v4"
+)
+
+// atprotoDIDPath is where atproto looks for a handle's DID over HTTPS
+const atprotoDIDPath = "/.well-known/atproto-did"
+
+// handleAtprotoDID serves the DID of the primary handle, so a vanity
+// domain pointed at this deployment can verify handle ownership over
+// HTTPS instead of a DNS TXT record. The DID is normally resolved at
+// startup by warmCache; if that failed, it is resolved on the next request
+// instead. Verification only succeeds for the domain the DID document
+// names as its handle.
+//
+// Returns:
+//   - 200 OK with the DID as text/plain
+//   - 404 Not Found if no handle is configured or it did not resolve
+func (srv *Server) handleAtprotoDID(c echo.Context) error {
+	if did := srv.primaryDID.Load(); did != nil {
+		return c.String(http.StatusOK, *did)
+	}
+
+	primary := srv.primaryHandle()
+	if primary == "" || srv.dir == nil {
+		return echo.ErrNotFound
+	}
+	did, err := srv.resolvePrimaryDID(c.Request().Context(), primary)
+	if err != nil {
+		slog.Warn("failed to resolve primary handle", "handle", primary, "error", err)
+		return echo.ErrNotFound
+	}
+	return c.String(http.StatusOK, did.String())
+}
+
+// resolvePrimaryDID resolves the primary handle and remembers its DID for
+// /.well-known/atproto-did.
+//
+// Returns:
+//   - The DID of the primary handle
+//   - error if the handle is invalid or does not resolve
+func (srv *Server) resolvePrimaryDID(ctx context.Context, primary string) (syntax.DID, error) {
+	handle, err := syntax.ParseHandle(primary)
+	if err != nil {
+		return "", fmt.Errorf("invalid primary handle: %w", err)
+	}
+	ident, err := srv.dir.LookupHandle(ctx, handle)
+	if err != nil {
+		return "", err
+	}
+	did := ident.DID.String()
+	srv.primaryDID.Store(&did)
+	return ident.DID, nil
+}
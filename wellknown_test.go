@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleAtprotoDID(t *testing.T) {
+	dir := identity.NewMockDirectory()
+	dir.Insert(identity.Identity{DID: syntax.DID("did:plc:alice"), Handle: syntax.Handle("alice.test")})
+
+	client := &xrpc.Client{Host: "https://mock.bsky.test", Client: &http.Client{Transport: newStubTransport()}}
+	srv, err := setupServer(":0", client, &dir, []string{"alice.test"}, nil, t.TempDir(), nil)
+	require.NoError(t, err)
+
+	// The profile prefetch fails against the empty stub, but the DID is kept
+	srv.warmCache(context.Background())
+
+	rec := httptest.NewRecorder()
+	srv.e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, atprotoDIDPath, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "did:plc:alice", rec.Body.String())
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+}
+
+func TestHandleAtprotoDID_NoHandle(t *testing.T) {
+	dir := identity.NewMockDirectory()
+	srv, err := setupServer(":0", nil, &dir, nil, nil, t.TempDir(), nil)
+	require.NoError(t, err)
+	srv.warmCache(context.Background())
+
+	rec := httptest.NewRecorder()
+	srv.e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, atprotoDIDPath, nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHandleAtprotoDID_ResolvesAfterStartupFailure(t *testing.T) {
+	dir := newFakeDirectory().add("alice.test", "did:plc:alice")
+	dir.err = errors.New("directory unavailable")
+	srv, err := setupServer(":0", nil, dir, []string{"alice.test"}, nil, t.TempDir(), nil)
+	require.NoError(t, err)
+	srv.warmCache(context.Background())
+
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, atprotoDIDPath, nil))
+		return rec
+	}
+
+	// Still failing: not found, and nothing is remembered
+	assert.Equal(t, http.StatusNotFound, get().Code)
+
+	// Once the directory recovers, the next request resolves the handle
+	dir.mu.Lock()
+	dir.err = nil
+	dir.mu.Unlock()
+	rec := get()
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "did:plc:alice", rec.Body.String())
+
+	// and later requests are served without another lookup
+	dir.mu.Lock()
+	lookups := dir.lookups
+	dir.mu.Unlock()
+	assert.Equal(t, http.StatusOK, get().Code)
+	assert.Equal(t, lookups, dir.lookups)
+}